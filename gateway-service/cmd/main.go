@@ -35,25 +35,38 @@ func main() {
 		return logger, nil
 	})
 
-	c.Provide(func(conf config.Config, logger *logging.Logger) services.KmsService {
-		kmsService, err := services.NewKmsService(conf.KmsHttpAddress, 10*time.Second)
-		if err != nil {
-			logger.Fatal("initializing kms service", "err", err)
-		}
-		return kmsService
+	c.Provide(func(conf config.Config) services.KmsService {
+		return services.NewKmsService(conf.KmsHttpAddress, 10*time.Second)
 	})
 
 	c.Provide(func(conf config.Config, logger *logging.Logger, kmsService services.KmsService) services.DsService {
-		keyShares, err := kmsService.GetShares()
+		policy, err := services.NewIdentityPolicy(conf.IdentityConfig.Policy)
+		if err != nil {
+			logger.Fatal("initializing identity policy", "err", err)
+		}
+
+		signingPolicy, err := services.NewSigningPolicy(conf.SigningConfig.Policy, conf.SigningConfig.SignerTokens)
+		if err != nil {
+			logger.Fatal("initializing signing policy", "err", err)
+		}
+
+		if conf.DsToken == "" {
+			logger.Warn("no decryption node token in " + config.DsTokenEnv + ", the nodes refuse partial identity keys and signatures")
+		}
+
+		dsService, err := services.NewDsService(conf.DsNodes, 10*time.Second, conf.DsToken, kmsService, policy, signingPolicy, services.CombineOptions{
+			Robust:          conf.CombineConfig.Robust,
+			ExclusionPeriod: conf.CombineConfig.ExclusionPeriod,
+		})
 		if err != nil {
-			logger.Fatal("getting key shares", "err", err)
+			logger.Fatal("initializing ds service", "err", err)
 		}
-		return services.NewDsService(conf.DsHttpAddress, 10*time.Second, keyShares)
+		return dsService
 	})
 
-	c.Provide(func(logger *logging.Logger, kmsService services.KmsService, dsService services.DsService) eHttp.Endpoint {
+	c.Provide(func(conf config.Config, logger *logging.Logger, kmsService services.KmsService, dsService services.DsService) eHttp.Endpoint {
 		r := chi.NewRouter()
-		routes.RegisterRoutes(r, logger, kmsService, dsService)
+		routes.RegisterRoutes(r, logger, kmsService, dsService, conf.IdentityConfig.RequesterHeader)
 		return eHttp.Endpoint{Pattern: "/*", Handler: r}
 	}, dig.Group("endpoint"))
 
@@ -0,0 +1,287 @@
+// Package e2e runs the key management service, the decryption nodes and the gateway together. The binaries are built
+// with CGO_ENABLED=0 on the pure-Go pairing, so the test needs neither libpbc nor libgmp, only the three modules
+// checked out next to each other.
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/services"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	threshold   = 3
+	totalShares = 5
+	// gatewayToken authenticates the gateway to the decryption nodes
+	gatewayToken = "gateway-token"
+	// signerToken signs under the keys of the KMS's default tenant, otherSignerToken under those of another tenant
+	signerToken      = "default-signer"
+	otherSignerToken = "acme-signer"
+)
+
+// cluster is a running KMS, its decryption nodes and a gateway in front of them
+type cluster struct {
+	t       *testing.T
+	bin     string
+	gateway string
+	nodes   map[int]*exec.Cmd
+}
+
+// TestThresholdDecryption encrypts through the gateway and decrypts with the partials of the decryption nodes, which the
+// gateway verifies with their Chaum-Pedersen proofs before combining. It decrypts again once only a quorum is left.
+func TestThresholdDecryption(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds and starts every service")
+	}
+	c := startCluster(t)
+
+	plaintext := "hello threshold"
+	var encrypted services.CiphertextResponse
+	if status := c.post("/ds/encrypt", services.EncryptRequest{Plaintext: plaintext}, &encrypted); status != http.StatusOK {
+		t.Fatalf("encrypt: status %d", status)
+	}
+
+	decrypt := func() (services.DecryptResponse, int) {
+		var decrypted services.DecryptResponse
+		status := c.post("/ds/decrypt", services.DecryptRequest{Ciphertext: encrypted.Ciphertext, Verbose: true}, &decrypted)
+		return decrypted, status
+	}
+
+	decrypted, status := decrypt()
+	if status != http.StatusOK || decrypted.DecryptedMessage != plaintext {
+		t.Fatalf("decrypt: status %d, message %q, want %q", status, decrypted.DecryptedMessage, plaintext)
+	}
+	ok := 0
+	for _, node := range decrypted.Nodes {
+		if node.Outcome == services.NodeOutcomeFaulty {
+			t.Errorf("node %d gave a partial with an invalid proof: %s", node.ShareID, node.Error)
+		}
+		if node.Outcome == services.NodeOutcomeOK {
+			ok++
+		}
+	}
+	if ok < threshold {
+		t.Errorf("%d nodes gave a valid partial, want at least %d: %+v", ok, threshold, decrypted.Nodes)
+	}
+
+	// Any quorum decrypts, fewer nodes do not
+	for id := threshold + 1; id <= totalShares; id++ {
+		c.stop(id)
+	}
+	if decrypted, status := decrypt(); status != http.StatusOK || decrypted.DecryptedMessage != plaintext {
+		t.Errorf("decrypt with %d nodes: status %d, message %q", threshold, status, decrypted.DecryptedMessage)
+	}
+	c.stop(threshold)
+	if decrypted, status := decrypt(); status == http.StatusOK {
+		t.Errorf("decrypted %q with %d nodes", decrypted.DecryptedMessage, threshold-1)
+	}
+}
+
+// TestThresholdSignature signs through the gateway, only for signers of the tenant owning the key
+func TestThresholdSignature(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds and starts every service")
+	}
+	c := startCluster(t)
+	request := services.SignRequest{Message: "sha256 of a release artifact"}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{name: "without a token", status: http.StatusUnauthorized},
+		{name: "with an unknown token", token: gatewayToken, status: http.StatusUnauthorized},
+		{name: "as a signer of another tenant", token: otherSignerToken, status: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		var signature services.SignatureResponse
+		if status := c.postAs(test.token, "/sign", request, &signature); status != test.status {
+			t.Errorf("sign %s: status %d, want %d", test.name, status, test.status)
+		}
+	}
+
+	var signature services.SignatureResponse
+	if status := c.postAs(signerToken, "/sign", request, &signature); status != http.StatusOK {
+		t.Fatalf("sign: status %d", status)
+	}
+	var verified services.VerifyResponse
+	verify := services.VerifyRequest{KeyID: signature.KeyID, Version: signature.Version, Message: request.Message, Signature: signature.Signature}
+	if status := c.post("/verify", verify, &verified); status != http.StatusOK || !verified.Valid {
+		t.Errorf("verify: status %d, valid %v", status, verified.Valid)
+	}
+}
+
+// startCluster builds the services and starts them on free ports, they are stopped when the test ends
+func startCluster(t *testing.T) *cluster {
+	t.Helper()
+
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, module := range []string{"key-management-service", "threshold-decryption-service"} {
+		if _, err := os.Stat(filepath.Join(root, module, "go.mod")); err != nil {
+			t.Skipf("%s is not checked out next to the gateway", module)
+		}
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+
+	c := &cluster{t: t, bin: t.TempDir(), nodes: make(map[int]*exec.Cmd)}
+	c.build("kms", filepath.Join(root, "key-management-service"), "./cmd")
+	c.build("ds", filepath.Join(root, "threshold-decryption-service"), "./cmd/decryption-service")
+	c.build("gateway", filepath.Join(root, "gateway-service"), "./cmd")
+
+	nodeTokens := make([]string, 0, totalShares)
+	for id := 1; id <= totalShares; id++ {
+		nodeTokens = append(nodeTokens, fmt.Sprintf("%d=node-%d", id, id))
+	}
+	kms := freeAddress(t)
+	c.start("kms", []string{"KMS_NODE_TOKENS=" + strings.Join(nodeTokens, ",")},
+		"-http.public.address", kms,
+		"-pairing.type", "bls12-381",
+		"-thresholdconfig.threshold", fmt.Sprint(threshold),
+		"-thresholdconfig.shares", fmt.Sprint(totalShares))
+	c.waitHealthy(kms)
+
+	dsNodes := make([]string, 0, totalShares)
+	for id := 1; id <= totalShares; id++ {
+		address := freeAddress(t)
+		c.nodes[id] = c.start(fmt.Sprintf("ds-%d", id), []string{"DS_NODE_TOKEN=" + fmt.Sprintf("node-%d", id), "DS_GATEWAY_TOKEN=" + gatewayToken},
+			"-node.id", fmt.Sprint(id),
+			"-http.public.address", address,
+			"-kms.http.public.address", "http://"+kms)
+		c.waitHealthy(address)
+		dsNodes = append(dsNodes, fmt.Sprintf("%d=http://%s", id, address))
+	}
+
+	c.gateway = freeAddress(t)
+	c.start("gateway", []string{"GW_DS_TOKEN=" + gatewayToken, "GW_SIGNER_TOKENS=default=" + signerToken + ",acme=" + otherSignerToken},
+		"-http.public.address", c.gateway,
+		"-signing.policy", "tenant",
+		"-kms.http.public.address", "http://"+kms,
+		"-ds.http.public.address", strings.Join(dsNodes, ","))
+	c.waitHealthy(c.gateway)
+	return c
+}
+
+// build compiles the main package of a module without cgo
+func (c *cluster) build(name, module, pkg string) {
+	c.t.Helper()
+	cmd := exec.Command("go", "build", "-o", filepath.Join(c.bin, name), pkg)
+	cmd.Dir = module
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		c.t.Fatalf("build %s: %v\n%s", name, err, out)
+	}
+}
+
+// start runs a built service, its output is logged when the test fails
+func (c *cluster) start(name string, env []string, args ...string) *exec.Cmd {
+	c.t.Helper()
+	logFile := filepath.Join(c.bin, name+".log")
+	out, err := os.Create(logFile)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	cmd := exec.Command(filepath.Join(c.bin, strings.SplitN(name, "-", 2)[0]), append(args, "-logger.handler.type", "text")...)
+	cmd.Dir = c.bin
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout, cmd.Stderr = out, out
+	if err := cmd.Start(); err != nil {
+		c.t.Fatalf("start %s: %v", name, err)
+	}
+	c.t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		out.Close()
+		if c.t.Failed() {
+			logs, _ := os.ReadFile(logFile)
+			c.t.Logf("%s:\n%s", name, logs)
+		}
+	})
+	return cmd
+}
+
+// stop kills a decryption node
+func (c *cluster) stop(id int) {
+	c.t.Helper()
+	if err := c.nodes[id].Process.Kill(); err != nil {
+		c.t.Fatalf("stop node %d: %v", id, err)
+	}
+}
+
+// waitHealthy waits for the health endpoint of a service to answer
+func (c *cluster) waitHealthy(address string) {
+	c.t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		response, err := http.Get("http://" + address + "/health")
+		if err == nil {
+			response.Body.Close()
+			if response.StatusCode == http.StatusOK {
+				return
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.t.Fatalf("%s did not become healthy", address)
+}
+
+// post sends a JSON request to the gateway and decodes a successful response into out
+func (c *cluster) post(path string, request, out interface{}) int {
+	c.t.Helper()
+	return c.postAs("", path, request, out)
+}
+
+// postAs is post with a bearer token, none if it is empty
+func (c *cluster) postAs(token, path string, request, out interface{}) int {
+	c.t.Helper()
+	body, err := json.Marshal(request)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	httpRequest, err := http.NewRequest(http.MethodPost, "http://"+c.gateway+path, bytes.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	response, err := client.Do(httpRequest)
+	if err != nil {
+		c.t.Fatalf("post %s: %v", path, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+			c.t.Fatalf("decode %s: %v", path, err)
+		}
+	}
+	return response.StatusCode
+}
+
+// freeAddress returns a local address nothing listens on
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
@@ -11,12 +11,15 @@ require (
 )
 
 require (
+	github.com/Nik-U/pbc v0.0.0-20181205041846-3e516ca0c5d6
+	github.com/cloudflare/circl v1.3.7
 	github.com/go-kit/kit v0.13.0
-	github.com/hashicorp/vault v1.16.2
 	github.com/pkg/errors v0.9.1
 )
 
 require (
 	github.com/go-kit/log v0.2.0 // indirect
 	github.com/go-logfmt/logfmt v0.5.1 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
 )
@@ -1,6 +1,7 @@
 package httpclient
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"time"
@@ -9,6 +10,8 @@ import (
 // Client is a wrapper around http.Client
 type Client struct {
 	httpClient *http.Client
+	// token is sent as a bearer token on every POST, empty sends none
+	token string
 }
 
 // NewHttpClient creates a new instance of Client with a specified timeout
@@ -20,6 +23,13 @@ func NewHttpClient(timeout time.Duration) *Client {
 	}
 }
 
+// NewAuthenticatedHttpClient creates a Client that authenticates its POST requests with the given bearer token
+func NewAuthenticatedHttpClient(timeout time.Duration, token string) *Client {
+	client := NewHttpClient(timeout)
+	client.token = token
+	return client
+}
+
 // Get performs a GET request
 func (c *Client) Get(url string) (*http.Response, error) {
 	return c.httpClient.Get(url)
@@ -27,5 +37,18 @@ func (c *Client) Get(url string) (*http.Response, error) {
 
 // Post performs a POST request
 func (c *Client) Post(url, contentType string, body io.Reader) (*http.Response, error) {
-	return c.httpClient.Post(url, contentType, body)
+	return c.PostContext(context.Background(), url, contentType, body)
+}
+
+// PostContext performs a POST request that is aborted once the context is done
+func (c *Client) PostContext(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.httpClient.Do(req)
 }
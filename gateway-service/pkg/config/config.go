@@ -1,34 +1,164 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/mdshahjahanmiah/explore-go/logging"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	HttpAddress    string
 	KmsHttpAddress string
-	DsHttpAddress  string
+	// DsNodes maps the id of every key share to the address of the decryption node holding it
+	DsNodes map[int]string
+	// DsToken authenticates the gateway to the decryption nodes, they only compute partial identity keys and signatures for it
+	DsToken        string
+	CombineConfig  CombineConfig
+	IdentityConfig IdentityConfig
+	SigningConfig  SigningConfig
 	LoggerConfig   logging.LoggerConfig
 }
 
+// DsTokenEnv is the environment variable holding the token the gateway authenticates with to the decryption nodes
+const DsTokenEnv = "GW_DS_TOKEN"
+
+// SignerTokensEnv is the environment variable holding the tokens signers authenticate with, as <tenant>=<token> entries
+const SignerTokensEnv = "GW_SIGNER_TOKENS"
+
+// CombineConfig is how the gateway combines the partials of the decryption nodes and how long it excludes faulty ones
+type CombineConfig struct {
+	Robust          bool
+	ExclusionPeriod time.Duration
+}
+
+// IdentityConfig is the policy that authorizes identity key extraction and the header naming the requester
+type IdentityConfig struct {
+	Policy          string
+	RequesterHeader string
+}
+
+// SigningConfig is the policy that authorizes signatures and the tokens of every tenant's signers, the tenant * is for
+// operators signing under the keys of every tenant
+type SigningConfig struct {
+	Policy       string
+	SignerTokens map[string]string
+}
+
 func Load() (Config, error) {
 	fs := flag.NewFlagSet("", flag.ExitOnError)
 
 	httpAddress := fs.String("http.public.address", "0.0.0.0:9000", "HTTP listen address for all specified endpoints.")
 	kmsHttpAddress := fs.String("kms.http.public.address", "http://localhost:9001", "KMS HTTP listen address for all specified endpoints.")
-	dsHttpAddress := fs.String("ds.http.public.address", "http://localhost:9002", "KMS HTTP listen address for all specified endpoints.")
+	dsHttpAddress := fs.String("ds.http.public.address", "http://localhost:9002", "comma-separated decryption nodes as <share id>=<HTTP address>, e.g. 1=http://ds-1:9002,2=http://ds-2:9002. An address without a share id holds the share of its position in the list.")
+
+	combineConfig := CombineConfig{}
+	fs.BoolVar(&combineConfig.Robust, "combine.robust", false, "wait for every decryption node and find nodes with wrong partials from the partials beyond the threshold, instead of trusting their proofs alone")
+	fs.DurationVar(&combineConfig.ExclusionPeriod, "combine.exclusion.period", 10*time.Minute, "how long a node found faulty by the robust combiner is left out of the rounds of that key version, 0 turns exclusion off")
+
+	identityConfig := IdentityConfig{}
+	fs.StringVar(&identityConfig.Policy, "identity.policy", "deny", "who may extract identity keys. Possible values are 'deny', 'requester' (only the key of the requester's own identity) and 'allow-all' (development only)")
+	fs.StringVar(&identityConfig.RequesterHeader, "identity.requester.header", "X-Authenticated-Identity", "header set by the authenticating proxy in front of the gateway with the identity of the requester")
+
+	signingConfig := SigningConfig{}
+	fs.StringVar(&signingConfig.Policy, "signing.policy", "deny", "who may have messages signed. Possible values are 'deny', 'tenant' (signers of the tenant owning the key, authenticated with the tokens in "+SignerTokensEnv+") and 'allow-all' (development only)")
 
 	loggerConfig := logging.LoggerConfig{}
 	fs.StringVar(&loggerConfig.CommandHandler, "logger.handler.type", "json", "handler type e.g json, otherwise default will be text type")
 	fs.StringVar(&loggerConfig.LogLevel, "logger.log.level", "debug", "log level wise logging with fatal log")
 
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return Config{}, err
+	}
+
+	dsNodes, err := parseDsNodes(*dsHttpAddress)
+	if err != nil {
+		return Config{}, err
+	}
+
+	signingConfig.SignerTokens, err = parseSignerTokens(os.Getenv(SignerTokensEnv))
+	if err != nil {
+		return Config{}, err
+	}
+
 	config := Config{
 		HttpAddress:    *httpAddress,
 		KmsHttpAddress: *kmsHttpAddress,
-		DsHttpAddress:  *dsHttpAddress,
+		DsNodes:        dsNodes,
+		DsToken:        os.Getenv(DsTokenEnv),
+		CombineConfig:  combineConfig,
+		IdentityConfig: identityConfig,
+		SigningConfig:  signingConfig,
 		LoggerConfig:   loggerConfig,
 	}
 
 	return config, nil
 }
+
+// parseDsNodes parses the comma-separated decryption nodes. Every share id may only be given to one node.
+func parseDsNodes(value string) (map[int]string, error) {
+	nodes := make(map[int]string)
+	for position, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		shareID, address := position+1, entry
+		if id, rest, found := strings.Cut(entry, "="); found {
+			parsed, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil || parsed < 1 {
+				return nil, fmt.Errorf("invalid share id %q for decryption node %q", id, rest)
+			}
+			shareID, address = parsed, strings.TrimSpace(rest)
+		}
+
+		if address == "" {
+			return nil, fmt.Errorf("no address for the decryption node of share %d", shareID)
+		}
+		if existing, ok := nodes[shareID]; ok {
+			return nil, fmt.Errorf("share %d is assigned to both %s and %s", shareID, existing, address)
+		}
+		nodes[shareID] = address
+	}
+
+	if len(nodes) == 0 {
+		return nil, errors.New("no decryption node address configured")
+	}
+	return nodes, nil
+}
+
+// parseSignerTokens parses comma-separated <tenant>=<token> entries, every tenant has one token and no token has two
+// tenants
+func parseSignerTokens(value string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	tenants := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		tenant, token, found := strings.Cut(entry, "=")
+		tenant, token = strings.TrimSpace(tenant), strings.TrimSpace(token)
+		if !found || tenant == "" {
+			return nil, fmt.Errorf("invalid signer token entry %q, expected <tenant>=<token>", tenant)
+		}
+		if token == "" {
+			return nil, fmt.Errorf("empty signer token for tenant %s", tenant)
+		}
+		if _, ok := tokens[tenant]; ok {
+			return nil, fmt.Errorf("tenant %s has more than one signer token", tenant)
+		}
+		if other, ok := tenants[token]; ok {
+			return nil, fmt.Errorf("tenants %s and %s share a signer token", other, tenant)
+		}
+		tokens[tenant] = token
+		tenants[token] = tenant
+	}
+	return tokens, nil
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDsNodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  map[int]string
+		ok    bool
+	}{
+		{name: "positional", value: "http://ds-1:9002, http://ds-2:9002", want: map[int]string{1: "http://ds-1:9002", 2: "http://ds-2:9002"}, ok: true},
+		{name: "explicit ids", value: "3=http://ds-3:9002,5 = http://ds-5:9002", want: map[int]string{3: "http://ds-3:9002", 5: "http://ds-5:9002"}, ok: true},
+		{name: "mixed", value: "http://ds-1:9002,4=http://ds-4:9002,http://ds-3:9002", want: map[int]string{1: "http://ds-1:9002", 4: "http://ds-4:9002", 3: "http://ds-3:9002"}, ok: true},
+		{name: "empty entries skipped", value: "http://ds-1:9002,,http://ds-3:9002,", want: map[int]string{1: "http://ds-1:9002", 3: "http://ds-3:9002"}, ok: true},
+		{name: "duplicate ids", value: "1=http://ds-1:9002,1=http://ds-2:9002"},
+		{name: "explicit id taken by a position", value: "http://ds-1:9002,http://ds-2:9002,2=http://ds-3:9002"},
+		{name: "id 0", value: "0=http://ds-0:9002"},
+		{name: "negative id", value: "-1=http://ds-1:9002"},
+		{name: "id not a number", value: "one=http://ds-1:9002"},
+		{name: "no address", value: "2="},
+		{name: "no node", value: " , "},
+	}
+	for _, test := range tests {
+		nodes, err := parseDsNodes(test.value)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%s: parsed %q into %v, want an error", test.name, test.value, nodes)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(nodes, test.want) {
+			t.Errorf("%s: parsed %v, want %v", test.name, nodes, test.want)
+		}
+	}
+}
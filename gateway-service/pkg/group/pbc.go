@@ -0,0 +1,88 @@
+//go:build cgo
+
+package group
+
+import (
+	"github.com/Nik-U/pbc"
+	"hash"
+	"math/big"
+)
+
+// pbcPairing is the PBC backend, any pairing type PBC can load
+type pbcPairing struct {
+	pairing *pbc.Pairing
+}
+
+func newPBCPairing(params string) (Pairing, error) {
+	pairing, err := pbc.NewPairingFromString(params)
+	if err != nil {
+		return nil, err
+	}
+	return pbcPairing{pairing: pairing}, nil
+}
+
+func (p pbcPairing) NewG1() Element { return &pbcElement{p.pairing.NewG1()} }
+func (p pbcPairing) NewG2() Element { return &pbcElement{p.pairing.NewG2()} }
+func (p pbcPairing) NewGT() Element { return &pbcElement{p.pairing.NewGT()} }
+func (p pbcPairing) NewZr() Element { return &pbcElement{p.pairing.NewZr()} }
+func (p pbcPairing) G1Length() uint { return p.pairing.G1Length() }
+func (p pbcPairing) G2Length() uint { return p.pairing.G2Length() }
+func (p pbcPairing) ZrLength() uint { return p.pairing.ZrLength() }
+
+// pbcElement wraps a PBC element, the operations map one to one
+type pbcElement struct {
+	el *pbc.Element
+}
+
+// unwrap returns the PBC element behind x, it panics on elements of another backend
+func unwrap(x Element) *pbc.Element {
+	other, ok := x.(*pbcElement)
+	if !ok {
+		panic("group: incompatible elements")
+	}
+	return other.el
+}
+
+func (e *pbcElement) Set0() Element            { e.el.Set0(); return e }
+func (e *pbcElement) Set1() Element            { e.el.Set1(); return e }
+func (e *pbcElement) SetInt32(i int32) Element { e.el.SetInt32(i); return e }
+func (e *pbcElement) SetBig(i *big.Int) Element {
+	e.el.SetBig(i)
+	return e
+}
+func (e *pbcElement) Set(src Element) Element         { e.el.Set(unwrap(src)); return e }
+func (e *pbcElement) SetFromHash(hash []byte) Element { e.el.SetFromHash(hash); return e }
+
+// SetBytes checks the length first, PBC reads as many bytes as the element takes whatever the length of buf
+func (e *pbcElement) SetBytes(buf []byte) Element {
+	if len(buf) != e.el.BytesLen() {
+		e.el.Set0()
+		return e
+	}
+	e.el.SetBytes(buf)
+	return e
+}
+func (e *pbcElement) SetFromStringHash(s string, h hash.Hash) Element {
+	e.el.SetFromStringHash(s, h)
+	return e
+}
+func (e *pbcElement) Rand() Element { e.el.Rand(); return e }
+
+func (e *pbcElement) Add(x, y Element) Element   { e.el.Add(unwrap(x), unwrap(y)); return e }
+func (e *pbcElement) Sub(x, y Element) Element   { e.el.Sub(unwrap(x), unwrap(y)); return e }
+func (e *pbcElement) Mul(x, y Element) Element   { e.el.Mul(unwrap(x), unwrap(y)); return e }
+func (e *pbcElement) Div(x, y Element) Element   { e.el.Div(unwrap(x), unwrap(y)); return e }
+func (e *pbcElement) PowZn(x, i Element) Element { e.el.PowZn(unwrap(x), unwrap(i)); return e }
+func (e *pbcElement) Pair(x, y Element) Element  { e.el.Pair(unwrap(x), unwrap(y)); return e }
+
+func (e *pbcElement) ThenAdd(y Element) Element   { e.el.ThenAdd(unwrap(y)); return e }
+func (e *pbcElement) ThenMul(y Element) Element   { e.el.ThenMul(unwrap(y)); return e }
+func (e *pbcElement) ThenDiv(y Element) Element   { e.el.ThenDiv(unwrap(y)); return e }
+func (e *pbcElement) ThenPowZn(i Element) Element { e.el.ThenPowZn(unwrap(i)); return e }
+
+func (e *pbcElement) Is0() bool             { return e.el.Is0() }
+func (e *pbcElement) Equals(x Element) bool { return e.el.Equals(unwrap(x)) }
+func (e *pbcElement) Bytes() []byte         { return e.el.Bytes() }
+func (e *pbcElement) String() string        { return e.el.String() }
+func (e *pbcElement) X() *big.Int           { return e.el.X() }
+func (e *pbcElement) Y() *big.Int           { return e.el.Y() }
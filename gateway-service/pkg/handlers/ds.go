@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
 	eError "github.com/mdshahjahanmiah/explore-go/error"
 	"github.com/mdshahjahanmiah/explore-go/logging"
 	"github.com/mdshahjahanmiah/gateway-service/pkg/services"
@@ -15,24 +19,45 @@ func GetDecryptEndpoint(logger *logging.Logger, dsService services.DsService) en
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(services.DecryptRequest)
 
-		decryptedMessage, err := dsService.Decrypt(req.Ciphertext)
+		decryptedMessage, nodes, err := dsService.Decrypt(req.Ciphertext)
+		if errors.Is(err, services.ErrInvalidCiphertext) {
+			logger.Warn("invalid ciphertext", "error", err, "nodes", nodes)
+			return nil, eError.NewServiceError(err, "invalid_ciphertext", "ciphertext", http.StatusBadRequest)
+		}
+		var quorumErr *services.QuorumError
+		if errors.As(err, &quorumErr) {
+			logger.Error("decryption quorum not reached", "error", err, "threshold", quorumErr.Threshold, "faulty_share_ids", services.FaultyShares(nodes), "nodes", nodes)
+			return nil, eError.NewServiceError(err, "quorum_not_reached", "nodes", http.StatusServiceUnavailable)
+		}
 		if err != nil {
-			logger.Error("failed to decrypt message", "error", err)
+			logger.Error("failed to decrypt message", "error", err, "nodes", nodes)
 			return nil, eError.NewTransportError(err, "INTERNAL_SERVER_ERROR")
 		}
 
-		return services.DecryptResponse{
+		logNodeReport(logger, "decryption", nodes)
+
+		decryptResponse := services.DecryptResponse{
 			DecryptedMessage: decryptedMessage,
-		}, nil
+		}
+		if req.Verbose {
+			decryptResponse.Nodes = nodes
+		}
+		return decryptResponse, nil
 	}
 }
 
-// GetCiphertextEndpoint decodes a decrypt request from an HTTP request
-func GetCiphertextEndpoint(logger *logging.Logger, dsService services.DsService) endpoint.Endpoint {
+// GetEncryptEndpoint returns the endpoint for encrypting a plaintext under a key of the KMS
+func GetEncryptEndpoint(logger *logging.Logger, dsService services.DsService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		ciphertextResponse, err := dsService.Ciphertext()
+		req := request.(services.EncryptRequest)
+
+		ciphertextResponse, err := dsService.Encrypt(req.KeyID, req.Mode, req.Plaintext)
+		if errors.Is(err, services.ErrPlaintextRejected) {
+			logger.Warn("plaintext rejected", "error", err)
+			return nil, eError.NewServiceError(err, "validation_error", "plaintext", http.StatusUnprocessableEntity)
+		}
 		if err != nil {
-			logger.Error("failed to generate cipher text message", "error", err)
+			logger.Error("failed to encrypt message", "error", err)
 			return nil, eError.NewTransportError(err, "INTERNAL_SERVER_ERROR")
 		}
 
@@ -40,6 +65,166 @@ func GetCiphertextEndpoint(logger *logging.Logger, dsService services.DsService)
 	}
 }
 
+// GetUnwrapKeyEndpoint returns the endpoint for unwrapping the data key of a hybrid ciphertext's KEM header
+func GetUnwrapKeyEndpoint(logger *logging.Logger, dsService services.DsService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(services.UnwrapKeyRequest)
+
+		dataKey, nodes, err := dsService.UnwrapKey(req.Kem)
+		if errors.Is(err, services.ErrInvalidCiphertext) {
+			logger.Warn("invalid KEM header", "error", err, "nodes", nodes)
+			return nil, eError.NewServiceError(err, "invalid_ciphertext", "kem", http.StatusBadRequest)
+		}
+		var quorumErr *services.QuorumError
+		if errors.As(err, &quorumErr) {
+			logger.Error("unwrap quorum not reached", "error", err, "threshold", quorumErr.Threshold, "faulty_share_ids", services.FaultyShares(nodes), "nodes", nodes)
+			return nil, eError.NewServiceError(err, "quorum_not_reached", "nodes", http.StatusServiceUnavailable)
+		}
+		if err != nil {
+			logger.Error("failed to unwrap data key", "error", err, "nodes", nodes)
+			return nil, eError.NewTransportError(err, "INTERNAL_SERVER_ERROR")
+		}
+
+		logNodeReport(logger, "unwrap", nodes)
+
+		unwrapResponse := services.UnwrapKeyResponse{
+			DataKey: base64.StdEncoding.EncodeToString(dataKey),
+		}
+		if req.Verbose {
+			unwrapResponse.Nodes = nodes
+		}
+		return unwrapResponse, nil
+	}
+}
+
+// logNodeReport logs the node report of a threshold operation that succeeded. One that succeeded with failed nodes still
+// tells which of them are degrading the quorum, so it is logged as a warning.
+func logNodeReport(logger *logging.Logger, operation string, nodes []services.NodeStatus) {
+	if faulty := services.FaultyShares(nodes); len(faulty) > 0 {
+		logger.Warn("faulty decryption nodes excluded", "operation", operation, "share_ids", faulty, "nodes", nodes)
+	} else if degraded := services.DegradedNodes(nodes); len(degraded) > 0 {
+		logger.Warn(operation+" succeeded with failed nodes", "failed", len(degraded), "nodes", nodes)
+	} else {
+		logger.Debug(operation+" succeeded", "nodes", nodes)
+	}
+}
+
+// GetEncryptIdentityEndpoint returns the endpoint for encrypting a plaintext to an identity
+func GetEncryptIdentityEndpoint(logger *logging.Logger, dsService services.DsService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(services.IdentityEncryptRequest)
+
+		ciphertextResponse, err := dsService.EncryptIdentity(req.KeyID, req.Identity, req.Plaintext)
+		if errors.Is(err, services.ErrPlaintextRejected) {
+			logger.Warn("plaintext rejected", "error", err)
+			return nil, eError.NewServiceError(err, "validation_error", "plaintext", http.StatusUnprocessableEntity)
+		}
+		if err != nil {
+			logger.Error("failed to encrypt message to identity", "error", err)
+			return nil, eError.NewTransportError(err, "INTERNAL_SERVER_ERROR")
+		}
+
+		return ciphertextResponse, nil
+	}
+}
+
+// GetExtractIdentityKeyEndpoint returns the endpoint for combining the private key of an identity
+func GetExtractIdentityKeyEndpoint(logger *logging.Logger, dsService services.DsService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(services.ExtractIdentityKeyRequest)
+
+		identityKey, err := dsService.ExtractIdentityKey(req)
+		if errors.Is(err, services.ErrExtractionDenied) {
+			logger.Warn("identity key extraction denied", "identity", req.Identity, "requester", req.Requester)
+			return nil, eError.NewServiceError(err, "forbidden", "identity", http.StatusForbidden)
+		}
+		if err != nil {
+			logger.Error("failed to extract identity key", "error", err)
+			return nil, eError.NewTransportError(err, "INTERNAL_SERVER_ERROR")
+		}
+
+		logger.Info("identity key extracted", "key_id", identityKey.KeyID, "version", identityKey.Version, "identity", req.Identity, "requester", req.Requester)
+		return identityKey, nil
+	}
+}
+
+// DecodeEncryptIdentityRequest decodes an identity encrypt request from an HTTP request
+func DecodeEncryptIdentityRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var encryptRequest services.IdentityEncryptRequest
+	if err := json.NewDecoder(request.Body).Decode(&encryptRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode identity encrypt request", "payload", http.StatusBadRequest)
+	}
+
+	if encryptRequest.Identity == "" {
+		return nil, eError.NewServiceError(errors.New("identity is empty"), "validation_error", "identity", http.StatusBadRequest)
+	}
+	if encryptRequest.Plaintext == "" {
+		return nil, eError.NewServiceError(errors.New("plaintext is empty"), "validation_error", "plaintext", http.StatusBadRequest)
+	}
+	if len(encryptRequest.Plaintext) > services.MaxPlaintextSize {
+		return nil, eError.NewServiceError(fmt.Errorf("plaintext exceeds %d bytes", services.MaxPlaintextSize), "validation_error", "plaintext", http.StatusBadRequest)
+	}
+
+	return encryptRequest, nil
+}
+
+// MakeExtractIdentityKeyDecoder decodes an identity key request and takes the requester from the given header
+func MakeExtractIdentityKeyDecoder(requesterHeader string) kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, request *http.Request) (interface{}, error) {
+		var extractRequest services.ExtractIdentityKeyRequest
+		if err := json.NewDecoder(request.Body).Decode(&extractRequest); err != nil {
+			return nil, eError.NewServiceError(err, "decode identity key request", "payload", http.StatusBadRequest)
+		}
+
+		if extractRequest.Identity == "" {
+			return nil, eError.NewServiceError(errors.New("identity is empty"), "validation_error", "identity", http.StatusBadRequest)
+		}
+		if extractRequest.Version < 0 {
+			return nil, eError.NewServiceError(errors.New("version must not be negative"), "validation_error", "version", http.StatusBadRequest)
+		}
+
+		extractRequest.Requester = request.Header.Get(requesterHeader)
+		return extractRequest, nil
+	}
+}
+
+// DecodeEncryptRequest decodes an encrypt request from an HTTP request
+func DecodeEncryptRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	decoder := json.NewDecoder(request.Body)
+
+	var encryptRequest services.EncryptRequest
+	err := decoder.Decode(&encryptRequest)
+	if err != nil {
+		return nil, eError.NewServiceError(err, "decode encrypt request", "payload", http.StatusBadRequest)
+	}
+
+	if encryptRequest.Plaintext == "" {
+		return nil, eError.NewServiceError(errors.New("plaintext is empty"), "validation_error", "plaintext", http.StatusBadRequest)
+	}
+	if encryptRequest.Mode != "" && encryptRequest.Mode != "direct" && encryptRequest.Mode != "hybrid" {
+		return nil, eError.NewServiceError(errors.New("mode must be 'direct' or 'hybrid'"), "validation_error", "mode", http.StatusBadRequest)
+	}
+	if encryptRequest.Mode != "hybrid" && len(encryptRequest.Plaintext) > services.MaxPlaintextSize {
+		return nil, eError.NewServiceError(fmt.Errorf("plaintext exceeds %d bytes, use the hybrid mode", services.MaxPlaintextSize), "validation_error", "plaintext", http.StatusBadRequest)
+	}
+
+	return encryptRequest, nil
+}
+
+// DecodeUnwrapKeyRequest decodes an unwrap key request from an HTTP request
+func DecodeUnwrapKeyRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var unwrapRequest services.UnwrapKeyRequest
+	if err := json.NewDecoder(request.Body).Decode(&unwrapRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode unwrap key request", "payload", http.StatusBadRequest)
+	}
+
+	if unwrapRequest.Kem == "" {
+		return nil, eError.NewServiceError(errors.New("kem is empty"), "validation_error", "kem", http.StatusBadRequest)
+	}
+
+	return unwrapRequest, nil
+}
+
 // DecodeDecryptRequest decodes a decrypt request from an HTTP request
 func DecodeDecryptRequest(ctx context.Context, request *http.Request) (interface{}, error) {
 	decoder := json.NewDecoder(request.Body)
@@ -52,6 +237,7 @@ func DecodeDecryptRequest(ctx context.Context, request *http.Request) (interface
 
 	return services.DecryptRequest{
 		Ciphertext: decryptRequest.Ciphertext,
+		Verbose:    decryptRequest.Verbose,
 	}, nil
 }
 
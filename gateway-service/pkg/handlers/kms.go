@@ -2,18 +2,57 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-kit/kit/endpoint"
 	eError "github.com/mdshahjahanmiah/explore-go/error"
 	"github.com/mdshahjahanmiah/explore-go/logging"
 	"github.com/mdshahjahanmiah/gateway-service/pkg/services"
+	"net/http"
+	"strconv"
 )
 
+// VersionRequest selects a version of a key, the empty key id is the default key and version 0 is the latest
+type VersionRequest struct {
+	KeyID   string
+	Version int
+}
+
 func GetPublicKeyEndpoint(logger *logging.Logger, kmsService services.KmsService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		publicKey, err := kmsService.FetchPublicKey()
+		req := request.(VersionRequest)
+
+		publicKey, err := kmsService.FetchPublicKey(req.KeyID, req.Version)
 		if err != nil {
 			return nil, eError.NewTransportError(err, "INTERNAL_SERVER_ERROR")
 		}
 		return publicKey, nil
 	}
 }
+
+// GetVerificationKeysEndpoint returns the endpoint for the per-share verification keys
+func GetVerificationKeysEndpoint(logger *logging.Logger, kmsService services.KmsService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(VersionRequest)
+
+		verificationKeys, err := kmsService.FetchVerificationKeys(req.KeyID, req.Version)
+		if err != nil {
+			logger.Error("failed to fetch verification keys", "error", err)
+			return nil, eError.NewTransportError(err, "INTERNAL_SERVER_ERROR")
+		}
+		return verificationKeys, nil
+	}
+}
+
+// DecodeVersionRequest decodes the key id in the path and the optional version query parameter of a key request
+func DecodeVersionRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	versionRequest := VersionRequest{KeyID: chi.URLParam(request, "keyID")}
+	if version := request.URL.Query().Get("version"); version != "" {
+		parsed, err := strconv.Atoi(version)
+		if err != nil || parsed < 1 {
+			return nil, eError.NewServiceError(errors.New("version must be a positive integer"), "validation_error", "version", http.StatusBadRequest)
+		}
+		versionRequest.Version = parsed
+	}
+	return versionRequest, nil
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	eError "github.com/mdshahjahanmiah/explore-go/error"
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/services"
+	"net/http"
+	"strings"
+)
+
+// maxMessageSize matches the largest message the decryption nodes sign, larger artifacts are signed by digest
+const maxMessageSize = 4096
+
+// GetSignEndpoint returns the endpoint for signing a message with the threshold key
+func GetSignEndpoint(logger *logging.Logger, dsService services.DsService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(services.SignRequest)
+
+		signature, err := dsService.Sign(req)
+		if errors.Is(err, services.ErrUnauthenticated) {
+			logger.Warn("signing request without a signer token", "key_id", req.KeyID)
+			return nil, eError.NewServiceError(err, "unauthorized", "authorization", http.StatusUnauthorized)
+		}
+		if errors.Is(err, services.ErrSigningDenied) {
+			logger.Warn("signing denied", "error", err, "key_id", req.KeyID)
+			return nil, eError.NewServiceError(err, "forbidden", "key_id", http.StatusForbidden)
+		}
+		var quorumErr *services.QuorumError
+		if errors.As(err, &quorumErr) {
+			logger.Error("signing quorum not reached", "error", err, "threshold", quorumErr.Threshold, "faulty_share_ids", services.FaultyShares(quorumErr.Nodes), "nodes", quorumErr.Nodes)
+			return nil, eError.NewServiceError(err, "quorum_not_reached", "nodes", http.StatusServiceUnavailable)
+		}
+		if err != nil {
+			logger.Error("failed to sign message", "error", err)
+			return nil, eError.NewTransportError(err, "INTERNAL_SERVER_ERROR")
+		}
+
+		logger.Info("message signed", "key_id", signature.KeyID, "version", signature.Version)
+		return signature, nil
+	}
+}
+
+// GetVerifyEndpoint returns the endpoint for verifying a signature against the KMS public key
+func GetVerifyEndpoint(logger *logging.Logger, dsService services.DsService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(services.VerifyRequest)
+
+		valid, err := dsService.Verify(req)
+		if err != nil {
+			logger.Error("failed to verify signature", "error", err)
+			return nil, eError.NewTransportError(err, "INTERNAL_SERVER_ERROR")
+		}
+
+		return services.VerifyResponse{Valid: valid}, nil
+	}
+}
+
+// DecodeSignRequest decodes a sign request from an HTTP request
+func DecodeSignRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var signRequest services.SignRequest
+	if err := json.NewDecoder(request.Body).Decode(&signRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode sign request", "payload", http.StatusBadRequest)
+	}
+
+	if signRequest.Message == "" || len(signRequest.Message) > maxMessageSize {
+		return nil, eError.NewServiceError(errors.New("message must be between 1 and 4096 bytes"), "validation_error", "message", http.StatusBadRequest)
+	}
+
+	signRequest.Token = bearerToken(request)
+	return signRequest, nil
+}
+
+// bearerToken returns the bearer token of the Authorization header, empty if there is none
+func bearerToken(request *http.Request) string {
+	token, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// DecodeVerifyRequest decodes a verify request from an HTTP request
+func DecodeVerifyRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var verifyRequest services.VerifyRequest
+	if err := json.NewDecoder(request.Body).Decode(&verifyRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode verify request", "payload", http.StatusBadRequest)
+	}
+
+	if verifyRequest.Message == "" {
+		return nil, eError.NewServiceError(errors.New("message is empty"), "validation_error", "message", http.StatusBadRequest)
+	}
+	if verifyRequest.Signature == "" {
+		return nil, eError.NewServiceError(errors.New("signature is empty"), "validation_error", "signature", http.StatusBadRequest)
+	}
+	if verifyRequest.Version < 0 {
+		return nil, eError.NewServiceError(errors.New("version must not be negative"), "validation_error", "version", http.StatusBadRequest)
+	}
+
+	return verifyRequest, nil
+}
@@ -10,15 +10,15 @@ import (
 )
 
 // RegisterDecryptionRoutes RegisterKmsRoutes registers the KMS routes with the given router.
-func RegisterDecryptionRoutes(r chi.Router, logger *logging.Logger, dsService services.DsService) {
+func RegisterDecryptionRoutes(r chi.Router, logger *logging.Logger, dsService services.DsService, requesterHeader string) {
 	r.Route("/ds", func(r chi.Router) {
 		opts := []kithttp.ServerOption{
 			kithttp.ServerErrorEncoder(error.EncodeError),
 		}
 
-		handleCiphertext := kithttp.NewServer(
-			handlers.GetCiphertextEndpoint(logger, dsService),
-			handlers.NoRequestDecoder,
+		handleEncrypt := kithttp.NewServer(
+			handlers.GetEncryptEndpoint(logger, dsService),
+			handlers.DecodeEncryptRequest,
 			kithttp.EncodeJSONResponse,
 			opts...,
 		)
@@ -29,7 +29,31 @@ func RegisterDecryptionRoutes(r chi.Router, logger *logging.Logger, dsService se
 			kithttp.EncodeJSONResponse,
 			opts...,
 		)
-		r.Get("/ciphertext", handleCiphertext.ServeHTTP)
+		handleUnwrapKey := kithttp.NewServer(
+			handlers.GetUnwrapKeyEndpoint(logger, dsService),
+			handlers.DecodeUnwrapKeyRequest,
+			kithttp.EncodeJSONResponse,
+			opts...,
+		)
+
+		handleEncryptIdentity := kithttp.NewServer(
+			handlers.GetEncryptIdentityEndpoint(logger, dsService),
+			handlers.DecodeEncryptIdentityRequest,
+			kithttp.EncodeJSONResponse,
+			opts...,
+		)
+
+		handleExtractIdentityKey := kithttp.NewServer(
+			handlers.GetExtractIdentityKeyEndpoint(logger, dsService),
+			handlers.MakeExtractIdentityKeyDecoder(requesterHeader),
+			kithttp.EncodeJSONResponse,
+			opts...,
+		)
+
+		r.Post("/encrypt", handleEncrypt.ServeHTTP)
 		r.Post("/decrypt", handleDecrypt.ServeHTTP)
+		r.Post("/unwrap-key", handleUnwrapKey.ServeHTTP)
+		r.Post("/encrypt-identity", handleEncryptIdentity.ServeHTTP)
+		r.Post("/identity-key", handleExtractIdentityKey.ServeHTTP)
 	})
 }
@@ -18,11 +18,21 @@ func RegisterKmsRoutes(r chi.Router, logger *logging.Logger, kmsService services
 
 		handlePublicKey := kithttp.NewServer(
 			handlers.GetPublicKeyEndpoint(logger, kmsService),
-			kithttp.NopRequestDecoder,
+			handlers.DecodeVersionRequest,
+			kithttp.EncodeJSONResponse,
+			opts...,
+		)
+
+		handleVerificationKeys := kithttp.NewServer(
+			handlers.GetVerificationKeysEndpoint(logger, kmsService),
+			handlers.DecodeVersionRequest,
 			kithttp.EncodeJSONResponse,
 			opts...,
 		)
 
 		r.Get("/public-key", handlePublicKey.ServeHTTP)
+		r.Get("/verification-keys", handleVerificationKeys.ServeHTTP)
+		r.Get("/keys/{keyID}/public-key", handlePublicKey.ServeHTTP)
+		r.Get("/keys/{keyID}/verification-keys", handleVerificationKeys.ServeHTTP)
 	})
 }
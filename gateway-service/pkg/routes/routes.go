@@ -7,7 +7,9 @@ import (
 )
 
 // RegisterRoutes registers the KMS and decryption routes with the given router.
-func RegisterRoutes(r chi.Router, logger *logging.Logger, kmsService services.KmsService, dsService services.DsService) {
+// The requester header names the identity of the caller for identity key extraction.
+func RegisterRoutes(r chi.Router, logger *logging.Logger, kmsService services.KmsService, dsService services.DsService, requesterHeader string) {
 	RegisterKmsRoutes(r, logger, kmsService)
-	RegisterDecryptionRoutes(r, logger, dsService)
+	RegisterDecryptionRoutes(r, logger, dsService, requesterHeader)
+	RegisterSignatureRoutes(r, logger, dsService)
 }
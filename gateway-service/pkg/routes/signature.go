@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"github.com/go-chi/chi/v5"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/mdshahjahanmiah/explore-go/error"
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/handlers"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/services"
+)
+
+// RegisterSignatureRoutes registers the threshold signing routes with the given router.
+func RegisterSignatureRoutes(r chi.Router, logger *logging.Logger, dsService services.DsService) {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorEncoder(error.EncodeError),
+	}
+
+	handleSign := kithttp.NewServer(
+		handlers.GetSignEndpoint(logger, dsService),
+		handlers.DecodeSignRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleVerify := kithttp.NewServer(
+		handlers.GetVerifyEndpoint(logger, dsService),
+		handlers.DecodeVerifyRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	r.Post("/sign", handleSign.ServeHTTP)
+	r.Post("/verify", handleVerify.ServeHTTP)
+}
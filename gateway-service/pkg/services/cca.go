@@ -0,0 +1,50 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/group"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCiphertext is returned for a ciphertext that does not decode or whose validity tag does not check out, by the
+// gateway itself or by the decryption nodes, which refuse to compute a partial decryption of it
+var ErrInvalidCiphertext = errors.New("ciphertext validity check failed")
+
+// ccaDomain separates the hash of ciphertexts into G2 from every other use of hashing.
+// It must match the decryption nodes, otherwise no tag they produce verifies.
+const ccaDomain = "threshold-cca:"
+
+// ccaBase returns the fixed G1 element h the header U = h^r is a power of
+func ccaBase(pairing group.Pairing) group.Element {
+	return pairing.NewG1().SetFromStringHash(ccaDomain+"generator", sha256.New())
+}
+
+// validityPoint hashes the key id, the key version, the header U and the payload V into G2
+func validityPoint(pairing group.Pairing, keyID string, version int, header, payload []byte) group.Element {
+	hash := sha256.New()
+	hash.Write([]byte(ccaDomain))
+	hash.Write([]byte{byte(len(keyID))})
+	hash.Write([]byte(keyID))
+	hash.Write(binary.BigEndian.AppendUint32(nil, uint32(version)))
+	hash.Write(header)
+	hash.Write(payload)
+	return pairing.NewG2().SetFromHash(hash.Sum(nil))
+}
+
+// checkValidity checks that the header U = h^r and the tag W = H(key id, version, U, V)^r share the exponent r,
+// i.e. e(U, H) = e(h, W), exactly as the decryption nodes do before they release a partial decryption
+func checkValidity(pairing group.Pairing, sealed envelope, header group.Element, tagBytes, payload []byte) error {
+	tag := pairing.NewG2().SetBytes(tagBytes)
+	if tag.Is0() {
+		return ErrInvalidCiphertext
+	}
+
+	point := validityPoint(pairing, sealed.KeyID, sealed.Version, header.Bytes(), payload)
+	left := pairing.NewGT().Pair(header, point)
+	right := pairing.NewGT().Pair(ccaBase(pairing), tag)
+	if !left.Equals(right) {
+		return ErrInvalidCiphertext
+	}
+	return nil
+}
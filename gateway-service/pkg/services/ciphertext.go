@@ -0,0 +1,156 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/group"
+)
+
+// deriveMask expands the shared GT element into a keystream of the given size.
+// It must match the derivation the decryption service used when encrypting.
+func deriveMask(sharedKey group.Element, size int) []byte {
+	keyBytes := sharedKey.Bytes()
+	mask := make([]byte, 0, size+sha256.Size)
+
+	var counter [4]byte
+	for i := uint32(0); len(mask) < size; i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		hash := sha256.New()
+		hash.Write(counter[:])
+		hash.Write(keyBytes)
+		mask = hash.Sum(mask)
+	}
+
+	return mask[:size]
+}
+
+// xorBytes returns a XOR b, both slices must have the same length.
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+// ciphertextFormat is the leading byte of the ciphertexts produced by the decryption service, they carry a validity tag
+const ciphertextFormat = 0x04
+
+// legacyCiphertextFormat is the leading byte of ciphertexts made before the validity tag.
+// They are passed on as they are, the decryption nodes decide whether they still decrypt them.
+const legacyCiphertextFormat = 0x01
+
+// envelope is a decoded ciphertext: the key and the key version it was encrypted under, followed by U || W || V,
+// or by U || V for the legacy format
+type envelope struct {
+	Format  byte
+	KeyID   string
+	Version int
+	Body    []byte
+}
+
+// openEnvelope decodes the base64 ciphertext and reads the key id and version in front of it.
+// The layout is format || len(key id) || key id || version (uint32, big endian) || U || W || V.
+func openEnvelope(ciphertext string) (envelope, error) {
+	ciphertextBytes, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return envelope{}, fmt.Errorf("decoding ciphertext base64: %v: %w", err, ErrInvalidCiphertext)
+	}
+
+	if len(ciphertextBytes) < 2 || (ciphertextBytes[0] != ciphertextFormat && ciphertextBytes[0] != legacyCiphertextFormat) {
+		return envelope{}, fmt.Errorf("unknown ciphertext format: %w", ErrInvalidCiphertext)
+	}
+
+	keyIDLength := int(ciphertextBytes[1])
+	if len(ciphertextBytes) < 2+keyIDLength+4 {
+		return envelope{}, fmt.Errorf("ciphertext is too short for its key id and version: %w", ErrInvalidCiphertext)
+	}
+
+	return envelope{
+		Format:  ciphertextBytes[0],
+		KeyID:   string(ciphertextBytes[2 : 2+keyIDLength]),
+		Version: int(binary.BigEndian.Uint32(ciphertextBytes[2+keyIDLength:])),
+		Body:    ciphertextBytes[2+keyIDLength+4:],
+	}, nil
+}
+
+// splitCiphertext separates the G1 header U, the G2 validity tag W and the masked payload V.
+// The tag is nil for the legacy format.
+func splitCiphertext(pairing group.Pairing, sealed envelope) ([]byte, []byte, []byte, error) {
+	headerLength := int(pairing.G1Length())
+	tagLength := 0
+	if sealed.Format == ciphertextFormat {
+		tagLength = int(pairing.G2Length())
+	}
+	if len(sealed.Body) <= headerLength+tagLength {
+		return nil, nil, nil, fmt.Errorf("ciphertext is too short, expected more than %d bytes: %w", headerLength+tagLength, ErrInvalidCiphertext)
+	}
+
+	var tag []byte
+	if tagLength > 0 {
+		tag = sealed.Body[headerLength : headerLength+tagLength]
+	}
+	return sealed.Body[:headerLength], tag, sealed.Body[headerLength+tagLength:], nil
+}
+
+// recoverPlaintext unmasks the ciphertext payload given the combined decryption U^s.
+// e(U^s, g) equals the e(U, pk) the encryptor used, so both sides derive the same keystream.
+func recoverPlaintext(pairing group.Pairing, generator group.Element, combined group.Element, payload []byte) []byte {
+	sharedKey := pairing.NewGT().Pair(combined, generator)
+	return xorBytes(payload, deriveMask(sharedKey, len(payload)))
+}
+
+// hybridCiphertextFormat is the leading byte of hybrid ciphertexts, a KEM header followed by an AES-256-GCM payload
+const hybridCiphertextFormat = 0x03
+
+// dataKeySize is the size of the AES-256 key a KEM header wraps
+const dataKeySize = 32
+
+// gcmNonceSize is the nonce size of AES-GCM
+const gcmNonceSize = 12
+
+// isHybridCiphertext tells a hybrid envelope from a direct ciphertext by its format byte
+func isHybridCiphertext(ciphertext string) bool {
+	raw, err := base64.StdEncoding.DecodeString(ciphertext)
+	return err == nil && len(raw) > 0 && raw[0] == hybridCiphertextFormat
+}
+
+// openHybridEnvelope splits a hybrid ciphertext into the KEM header, the nonce and the sealed payload.
+// The layout is format || len(KEM header) (uint16, big endian) || KEM header || nonce || AES-GCM ciphertext.
+func openHybridEnvelope(ciphertext string) ([]byte, []byte, []byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("decoding ciphertext base64: %v: %w", err, ErrInvalidCiphertext)
+	}
+	if len(raw) < 3 || raw[0] != hybridCiphertextFormat {
+		return nil, nil, nil, fmt.Errorf("not a hybrid ciphertext: %w", ErrInvalidCiphertext)
+	}
+
+	kemLength := int(binary.BigEndian.Uint16(raw[1:]))
+	nonceOffset := 3 + kemLength
+	if len(raw) < nonceOffset+gcmNonceSize {
+		return nil, nil, nil, fmt.Errorf("hybrid ciphertext is too short for its KEM header and nonce: %w", ErrInvalidCiphertext)
+	}
+	return raw[3:nonceOffset], raw[nonceOffset : nonceOffset+gcmNonceSize], raw[nonceOffset+gcmNonceSize:], nil
+}
+
+// openPayload decrypts the AES-256-GCM payload, the KEM header is authenticated as additional data
+func openPayload(dataKey, nonce, sealed, kem []byte) ([]byte, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, nonce, sealed, kem)
+	if err != nil {
+		return nil, fmt.Errorf("hybrid payload does not authenticate under the data key: %w", ErrInvalidCiphertext)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/group"
+	"testing"
+)
+
+// layoutEnvelope lays out a ciphertext as format || len(key id) || key id || version || body
+func layoutEnvelope(format byte, keyID string, version uint32, body []byte) []byte {
+	raw := append([]byte{format, byte(len(keyID))}, keyID...)
+	raw = binary.BigEndian.AppendUint32(raw, version)
+	return append(raw, body...)
+}
+
+func encode(raw []byte) string {
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestOpenEnvelope(t *testing.T) {
+	sealed, err := openEnvelope(encode(layoutEnvelope(ciphertextFormat, "payments", 3, []byte{1, 2, 3})))
+	if err != nil {
+		t.Fatalf("openEnvelope: %v", err)
+	}
+	if sealed.Format != ciphertextFormat || sealed.KeyID != "payments" || sealed.Version != 3 || string(sealed.Body) != "\x01\x02\x03" {
+		t.Errorf("openEnvelope = %+v", sealed)
+	}
+
+	legacy, err := openEnvelope(encode(layoutEnvelope(legacyCiphertextFormat, "default", 1, nil)))
+	if err != nil {
+		t.Fatalf("openEnvelope of a legacy ciphertext: %v", err)
+	}
+	if legacy.Format != legacyCiphertextFormat || legacy.KeyID != "default" || legacy.Version != 1 {
+		t.Errorf("openEnvelope of a legacy ciphertext = %+v", legacy)
+	}
+
+	valid := layoutEnvelope(ciphertextFormat, "payments", 3, nil)
+	tests := []struct {
+		name       string
+		ciphertext string
+	}{
+		{name: "not base64", ciphertext: "not base64!"},
+		{name: "empty", ciphertext: ""},
+		{name: "format byte only", ciphertext: encode([]byte{ciphertextFormat})},
+		{name: "unknown format", ciphertext: encode(layoutEnvelope(0x7f, "payments", 3, nil))},
+		{name: "hybrid format", ciphertext: encode(layoutEnvelope(hybridCiphertextFormat, "payments", 3, nil))},
+		{name: "key id longer than the ciphertext", ciphertext: encode([]byte{ciphertextFormat, 200, 'a', 'b'})},
+		{name: "truncated version", ciphertext: encode(valid[:len(valid)-1])},
+	}
+
+	for _, test := range tests {
+		if _, err := openEnvelope(test.ciphertext); !errors.Is(err, ErrInvalidCiphertext) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, ErrInvalidCiphertext)
+		}
+	}
+}
+
+func TestSplitCiphertext(t *testing.T) {
+	pairing, err := group.NewPairing(group.BLS12381Params())
+	if err != nil {
+		t.Fatalf("NewPairing: %v", err)
+	}
+	headerLength := int(pairing.G1Length())
+	tagLength := int(pairing.G2Length())
+
+	body := make([]byte, headerLength+tagLength+5)
+	header, tag, payload, err := splitCiphertext(pairing, envelope{Format: ciphertextFormat, Body: body})
+	if err != nil {
+		t.Fatalf("splitCiphertext: %v", err)
+	}
+	if len(header) != headerLength || len(tag) != tagLength || len(payload) != 5 {
+		t.Errorf("splitCiphertext = %d, %d and %d bytes", len(header), len(tag), len(payload))
+	}
+
+	_, tag, payload, err = splitCiphertext(pairing, envelope{Format: legacyCiphertextFormat, Body: body[:headerLength+1]})
+	if err != nil {
+		t.Fatalf("splitCiphertext of a legacy ciphertext: %v", err)
+	}
+	if tag != nil || len(payload) != 1 {
+		t.Errorf("splitCiphertext of a legacy ciphertext = %d-byte tag and %d-byte payload", len(tag), len(payload))
+	}
+
+	tests := []struct {
+		name   string
+		sealed envelope
+	}{
+		{name: "empty body", sealed: envelope{Format: ciphertextFormat}},
+		{name: "header only", sealed: envelope{Format: ciphertextFormat, Body: body[:headerLength]}},
+		{name: "no payload", sealed: envelope{Format: ciphertextFormat, Body: body[:headerLength+tagLength]}},
+		{name: "legacy header only", sealed: envelope{Format: legacyCiphertextFormat, Body: body[:headerLength]}},
+	}
+	for _, test := range tests {
+		if _, _, _, err := splitCiphertext(pairing, test.sealed); !errors.Is(err, ErrInvalidCiphertext) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, ErrInvalidCiphertext)
+		}
+	}
+}
+
+func TestOpenHybridEnvelope(t *testing.T) {
+	raw := []byte{hybridCiphertextFormat, 0, 4, 'k', 'e', 'm', '!'}
+	raw = append(raw, make([]byte, gcmNonceSize)...)
+	raw = append(raw, "sealed"...)
+
+	kem, nonce, sealed, err := openHybridEnvelope(encode(raw))
+	if err != nil {
+		t.Fatalf("openHybridEnvelope: %v", err)
+	}
+	if string(kem) != "kem!" || len(nonce) != gcmNonceSize || string(sealed) != "sealed" {
+		t.Errorf("openHybridEnvelope = %q, %d-byte nonce, %q", kem, len(nonce), sealed)
+	}
+
+	tests := []struct {
+		name       string
+		ciphertext string
+	}{
+		{name: "not base64", ciphertext: "%%%"},
+		{name: "too short", ciphertext: encode([]byte{hybridCiphertextFormat, 0})},
+		{name: "direct format", ciphertext: encode(layoutEnvelope(ciphertextFormat, "payments", 3, make([]byte, 32)))},
+		{name: "KEM header longer than the ciphertext", ciphertext: encode([]byte{hybridCiphertextFormat, 0xff, 0xff, 1, 2, 3})},
+		{name: "truncated nonce", ciphertext: encode(raw[:3+4+gcmNonceSize-1])},
+	}
+	for _, test := range tests {
+		if _, _, _, err := openHybridEnvelope(test.ciphertext); !errors.Is(err, ErrInvalidCiphertext) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, ErrInvalidCiphertext)
+		}
+	}
+
+	if _, err := openPayload(make([]byte, dataKeySize), nonce, sealed, kem); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Errorf("payload that does not authenticate: err = %v, want %v", err, ErrInvalidCiphertext)
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/group"
+	"sort"
+)
+
+// PartialDecryption is a partial decryption U^{s_i} together with the ID i of the share that produced it
+type PartialDecryption struct {
+	ShareID int
+	Element group.Element
+}
+
+// decodePartialDecryption decodes a base64-encoded G1 partial decryption produced by the given share. The node is not
+// trusted, so the length is checked before the bytes reach the pairing library.
+func decodePartialDecryption(pairing group.Pairing, shareID int, partial string) (PartialDecryption, error) {
+	partialBytes, err := base64.StdEncoding.DecodeString(partial)
+	if err != nil {
+		return PartialDecryption{}, err
+	}
+	if len(partialBytes) != int(pairing.G1Length()) {
+		return PartialDecryption{}, fmt.Errorf("partial decryption of share %d has %d bytes, expected %d", shareID, len(partialBytes), pairing.G1Length())
+	}
+
+	element := pairing.NewG1().SetBytes(partialBytes)
+	if element.Is0() {
+		return PartialDecryption{}, fmt.Errorf("partial decryption of share %d is zero", shareID)
+	}
+
+	return PartialDecryption{ShareID: shareID, Element: element}, nil
+}
+
+// lagrangeCoefficientsAt computes the Lagrange coefficients at x in Zr for the given share IDs:
+// lambda_i(x) = prod_{j != i} (x - x_j) / (x_i - x_j), at x = 0 this is prod_{j != i} x_j / (x_j - x_i)
+func lagrangeCoefficientsAt(pairing group.Pairing, shareIDs []int, x int) ([]group.Element, error) {
+	at := pairing.NewZr().SetInt32(int32(x))
+
+	coefficients := make([]group.Element, len(shareIDs))
+	for i, id := range shareIDs {
+		if id < 1 {
+			return nil, fmt.Errorf("invalid share id %d", id)
+		}
+
+		xi := pairing.NewZr().SetInt32(int32(id))
+		numerator := pairing.NewZr().Set1()
+		denominator := pairing.NewZr().Set1()
+
+		for j, otherID := range shareIDs {
+			if i == j {
+				continue
+			}
+			if otherID == id {
+				return nil, fmt.Errorf("duplicate share id %d", id)
+			}
+
+			xj := pairing.NewZr().SetInt32(int32(otherID))
+			numerator.ThenMul(pairing.NewZr().Sub(at, xj))
+			denominator.ThenMul(pairing.NewZr().Sub(xi, xj))
+		}
+
+		coefficients[i] = pairing.NewZr().Div(numerator, denominator)
+	}
+
+	return coefficients, nil
+}
+
+// interpolateAt interpolates the partials in the exponent at x: prod_i (U^{s_i})^{lambda_i(x)}.
+// At x = 0 this is U^s, at the id of another share it is the partial that share must have to lie on the same polynomial.
+func interpolateAt(pairing group.Pairing, partials []PartialDecryption, x int) (group.Element, error) {
+	shareIDs := make([]int, len(partials))
+	for i, partial := range partials {
+		shareIDs[i] = partial.ShareID
+	}
+
+	coefficients, err := lagrangeCoefficientsAt(pairing, shareIDs, x)
+	if err != nil {
+		return nil, err
+	}
+
+	interpolated := pairing.NewG1().Set1()
+	for i, partial := range partials {
+		interpolated.ThenMul(pairing.NewG1().PowZn(partial.Element, coefficients[i]))
+	}
+	return interpolated, nil
+}
+
+// combinePartialDecryptions interpolates U^s in the exponent from any threshold partial decryptions:
+// U^s = prod_i (U^{s_i})^{lambda_i}
+func combinePartialDecryptions(pairing group.Pairing, partials []PartialDecryption, threshold int) (group.Element, error) {
+	if threshold < 1 {
+		return nil, errors.New("threshold must be greater than 0")
+	}
+	if len(partials) < threshold {
+		return nil, fmt.Errorf("got %d partial decryptions, need %d", len(partials), threshold)
+	}
+
+	// Use the lowest share IDs so the same set of responses always combines the same way
+	selected := make([]PartialDecryption, len(partials))
+	copy(selected, partials)
+	sort.Slice(selected, func(i, j int) bool { return selected[i].ShareID < selected[j].ShareID })
+	selected = selected[:threshold]
+
+	return interpolateAt(pairing, selected, 0)
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/group"
+	"testing"
+)
+
+// thresholdFixture is a key dealt to n shares with threshold t on the pure-Go pairing, with a ciphertext header U.
+// It plays the KMS and the decryption nodes, so the combiner can be tested without either.
+type thresholdFixture struct {
+	params PublicParams
+	secret group.Element
+	shares map[int]group.Element
+	header group.Element
+}
+
+// newThresholdFixture shares a random secret with a random polynomial of degree t - 1 and publishes g^s and g^{s_i}
+func newThresholdFixture(t *testing.T, threshold, n int) thresholdFixture {
+	t.Helper()
+
+	pairing, err := group.NewPairing(group.BLS12381Params())
+	if err != nil {
+		t.Fatalf("NewPairing: %v", err)
+	}
+
+	coefficients := make([]group.Element, threshold)
+	for i := range coefficients {
+		coefficients[i] = pairing.NewZr().Rand()
+	}
+
+	generator := pairing.NewG2().Rand()
+	fixture := thresholdFixture{
+		params: PublicParams{
+			KeyID:            "default",
+			Version:          1,
+			Pairing:          pairing,
+			Generator:        generator,
+			PublicKey:        pairing.NewG2().PowZn(generator, coefficients[0]),
+			Threshold:        threshold,
+			VerificationKeys: make(map[int]group.Element, n),
+		},
+		secret: coefficients[0],
+		shares: make(map[int]group.Element, n),
+		header: pairing.NewG1().Rand(),
+	}
+
+	for id := 1; id <= n; id++ {
+		// Horner's rule: f(id) = a_0 + id * (a_1 + id * (...))
+		x := pairing.NewZr().SetInt32(int32(id))
+		share := pairing.NewZr().Set0()
+		for i := len(coefficients) - 1; i >= 0; i-- {
+			share.ThenMul(x).ThenAdd(coefficients[i])
+		}
+		fixture.shares[id] = share
+		fixture.params.VerificationKeys[id] = pairing.NewG2().PowZn(generator, share)
+	}
+	return fixture
+}
+
+// partial is the partial decryption U^{s_i} of the header with share i
+func (f thresholdFixture) partial(shareID int) PartialDecryption {
+	return PartialDecryption{ShareID: shareID, Element: f.params.Pairing.NewG1().PowZn(f.header, f.shares[shareID])}
+}
+
+// partials returns the partial decryptions of the given shares
+func (f thresholdFixture) partials(shareIDs ...int) []PartialDecryption {
+	partials := make([]PartialDecryption, len(shareIDs))
+	for i, shareID := range shareIDs {
+		partials[i] = f.partial(shareID)
+	}
+	return partials
+}
+
+// decrypted is U^s, the value the partials must combine to
+func (f thresholdFixture) decrypted() group.Element {
+	return f.params.Pairing.NewG1().PowZn(f.header, f.secret)
+}
+
+func TestCombineAnyThresholdSubset(t *testing.T) {
+	tests := []struct {
+		threshold int
+		n         int
+	}{
+		{threshold: 1, n: 1},
+		{threshold: 1, n: 3},
+		{threshold: 2, n: 3},
+		{threshold: 3, n: 5},
+		{threshold: 5, n: 5},
+	}
+
+	for _, test := range tests {
+		fixture := newThresholdFixture(t, test.threshold, test.n)
+		want := fixture.decrypted()
+
+		for subset := firstSubset(test.threshold); subset != nil; subset = nextSubset(subset, test.n) {
+			shareIDs := make([]int, len(subset))
+			for i, index := range subset {
+				shareIDs[i] = index + 1
+			}
+
+			combined, err := combinePartialDecryptions(fixture.params.Pairing, fixture.partials(shareIDs...), test.threshold)
+			if err != nil {
+				t.Fatalf("%d of %d, shares %v: %v", test.threshold, test.n, shareIDs, err)
+			}
+			if !combined.Equals(want) {
+				t.Errorf("%d of %d, shares %v: combined partials differ from U^s", test.threshold, test.n, shareIDs)
+			}
+		}
+	}
+}
+
+func TestCombineUsesLowestShares(t *testing.T) {
+	fixture := newThresholdFixture(t, 2, 4)
+
+	// The partial of share 4 is wrong, but shares 1 and 2 are enough and come first
+	partials := fixture.partials(4, 2, 1)
+	partials[0].Element = fixture.params.Pairing.NewG1().Rand()
+
+	combined, err := combinePartialDecryptions(fixture.params.Pairing, partials, 2)
+	if err != nil {
+		t.Fatalf("combinePartialDecryptions: %v", err)
+	}
+	if !combined.Equals(fixture.decrypted()) {
+		t.Error("combined partials differ from U^s")
+	}
+}
+
+func TestCombineErrors(t *testing.T) {
+	fixture := newThresholdFixture(t, 3, 5)
+	duplicate := fixture.partials(1, 2, 2)
+	zeroID := fixture.partials(1, 2, 3)
+	zeroID[0].ShareID = 0
+
+	tests := []struct {
+		name      string
+		partials  []PartialDecryption
+		threshold int
+	}{
+		{name: "too few partials", partials: fixture.partials(1, 2), threshold: 3},
+		{name: "no threshold", partials: fixture.partials(1, 2, 3), threshold: 0},
+		{name: "duplicate share", partials: duplicate, threshold: 3},
+		{name: "share id 0", partials: zeroID, threshold: 3},
+	}
+
+	for _, test := range tests {
+		if _, err := combinePartialDecryptions(fixture.params.Pairing, test.partials, test.threshold); err == nil {
+			t.Errorf("%s: combined without an error", test.name)
+		}
+	}
+}
+
+func TestDecodePartialDecryption(t *testing.T) {
+	fixture := newThresholdFixture(t, 2, 3)
+	encoded := fixture.partial(1).Element.Bytes()
+
+	partial, err := decodePartialDecryption(fixture.params.Pairing, 1, base64.StdEncoding.EncodeToString(encoded))
+	if err != nil || !partial.Element.Equals(fixture.partial(1).Element) {
+		t.Fatalf("decodePartialDecryption: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		partial string
+	}{
+		{name: "empty", partial: ""},
+		{name: "too short", partial: base64.StdEncoding.EncodeToString(encoded[:len(encoded)-1])},
+		{name: "too long", partial: base64.StdEncoding.EncodeToString(append(encoded, 0))},
+		{name: "identity", partial: base64.StdEncoding.EncodeToString(fixture.params.Pairing.NewG1().Bytes())},
+		{name: "not base64", partial: "partial"},
+	}
+	for _, test := range tests {
+		if _, err := decodePartialDecryption(fixture.params.Pairing, 1, test.partial); err == nil {
+			t.Errorf("%s: decoded", test.name)
+		}
+	}
+
+	// A node answering with an empty partial is reported, not trusted with the pairing library
+	ds := newRobustService(3, 0)
+	request := func(ctx context.Context, nodeUrl string) (*PartialDecryptResponse, error) {
+		return &PartialDecryptResponse{ShareID: 1, Proof: fixture.prove(1)}, nil
+	}
+	if _, class, err := ds.verifiedPartial(context.Background(), fixture.params, fixture.header, 1, ds.nodes[1], request); err == nil || class != ErrorClassMalformedResponse {
+		t.Errorf("empty partial gave class %q and error %v", class, err)
+	}
+}
+
+func TestInterpolateAtShare(t *testing.T) {
+	fixture := newThresholdFixture(t, 3, 5)
+	selected := fixture.partials(1, 3, 5)
+
+	for shareID := 1; shareID <= 5; shareID++ {
+		interpolated, err := interpolateAt(fixture.params.Pairing, selected, shareID)
+		if err != nil {
+			t.Fatalf("interpolateAt(%d): %v", shareID, err)
+		}
+		if !interpolated.Equals(fixture.partial(shareID).Element) {
+			t.Errorf("interpolateAt(%d) is not the partial of share %d", shareID, shareID)
+		}
+	}
+}
@@ -2,74 +2,280 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
-	"github.com/hashicorp/vault/shamir"
+	"fmt"
 	httpclient "github.com/mdshahjahanmiah/gateway-service/pkg/client"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/group"
 	"github.com/pkg/errors"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// DecryptRequest represents the request payload for decryption
+// EncryptRequest represents the request payload for encryption, the default key of the KMS is used if the key id is empty.
+// The mode is "direct" (the default) or "hybrid" for plaintexts too large to mask with the pairing value directly.
+type EncryptRequest struct {
+	KeyID     string `json:"key_id,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+	Plaintext string `json:"plaintext"`
+}
+
+// MaxPlaintextSize is the largest plaintext, in bytes, the decryption nodes encrypt in direct mode or to an identity
+const MaxPlaintextSize = 256
+
+// ErrPlaintextRejected is returned when the decryption node refuses to encrypt a plaintext, which no retry will change
+var ErrPlaintextRejected = errors.New("plaintext rejected by the decryption node")
+
+// DecryptRequest represents the request payload for decryption, a direct ciphertext or the full hybrid envelope.
+// A verbose request also gets the status of every decryption node in the response.
 type DecryptRequest struct {
 	Ciphertext string `json:"ciphertext"`
+	Verbose    bool   `json:"verbose,omitempty"`
+}
+
+// UnwrapKeyRequest is the KEM header of a hybrid ciphertext, for clients that decrypt the payload themselves
+type UnwrapKeyRequest struct {
+	Kem     string `json:"kem"`
+	Verbose bool   `json:"verbose,omitempty"`
+}
+
+// UnwrapKeyResponse is the base64-encoded AES-256 data key wrapped in a KEM header, with the status of every decryption
+// node when the request asked for it
+type UnwrapKeyResponse struct {
+	DataKey string       `json:"data_key"`
+	Nodes   []NodeStatus `json:"nodes,omitempty"`
 }
 
-// PartialDecryptRequest represents the payload sent to the decryption service for partial decryption
+// PartialDecryptRequest represents the payload sent to a decryption node for partial decryption.
+// It carries no share, every node decrypts with its own share of the key version the ciphertext names.
 type PartialDecryptRequest struct {
 	Ciphertext string `json:"ciphertext"`
-	Share      string `json:"share"`
 }
 
-// DecryptResponse represents the response from the decryption service
+// DecryptResponse represents the response from the decryption service, with the node statuses of a verbose request
 type DecryptResponse struct {
-	DecryptedMessage string `json:"decrypted_message"`
+	DecryptedMessage string       `json:"decrypted_message"`
+	Nodes            []NodeStatus `json:"nodes,omitempty"`
 }
 
-// PartialDecryptResponse represents the response from a partial decryption
+// PartialDecryptResponse represents the response from a partial decryption, with the id of the share the node holds
 type PartialDecryptResponse struct {
-	PartialDecryption string `json:"partial_decryption"`
+	PartialDecryption string        `json:"partial_decryption"`
+	Proof             ProofResponse `json:"proof"`
+	ShareID           int           `json:"share_id"`
+	Epoch             int           `json:"epoch"`
+}
+
+// ProofResponse is the Chaum-Pedersen proof a decryption node attaches to its partial decryption
+type ProofResponse struct {
+	Challenge string `json:"challenge"`
+	Response  string `json:"response"`
 }
 
-// CiphertextResponse is the response from the KMS for the ciphertext
+// CiphertextResponse is the response from the decryption service for an encryption
 type CiphertextResponse struct {
 	Ciphertext string `json:"ciphertext"`
 }
 
 // DsService defines the interface for the decryption service
 type DsService interface {
-	Ciphertext() (CiphertextResponse, error)
-	Decrypt(ciphertext string) (string, error)
+	Encrypt(keyID, mode, plaintext string) (CiphertextResponse, error)
+	Decrypt(ciphertext string) (string, []NodeStatus, error)
+	UnwrapKey(kem string) ([]byte, []NodeStatus, error)
+	EncryptIdentity(keyID, identity, plaintext string) (CiphertextResponse, error)
+	ExtractIdentityKey(request ExtractIdentityKeyRequest) (IdentityKeyResponse, error)
+	Sign(request SignRequest) (SignatureResponse, error)
+	Verify(request VerifyRequest) (bool, error)
 }
 
 // dsService implements the DsService interface
 type dsService struct {
-	client    *httpclient.Client
-	dsUrl     string
-	keyShares []KeyShareResponse
+	client *httpclient.Client
+	// nodes maps every share id to the URL of the decryption node holding that share
+	nodes map[int]string
+	// encryptionNode is the position, among the share ids, of the node that answered the last encryption
+	encryptionNode atomic.Int32
+	kmsService     KmsService
+	policy         IdentityPolicy
+	// signingPolicy authorizes the callers of Sign
+	signingPolicy SigningPolicy
+	mutex         sync.Mutex
+	material      map[materialKey]PublicParams
+	combine       CombineOptions
+	// excluded holds when the node of a share was found faulty for a key version, it is left out of that version's
+	// rounds until the exclusion period is over
+	exclusionMutex sync.Mutex
+	excluded       map[exclusionKey]time.Time
+}
+
+// CombineOptions configures how partials are combined. In robust mode the gateway waits for every node and finds the
+// nodes with wrong partials from the spare partials beyond the threshold, instead of trusting the proofs alone. Faulty
+// nodes are left out of the following rounds of the same key version for the exclusion period, 0 turns exclusion off.
+type CombineOptions struct {
+	Robust          bool
+	ExclusionPeriod time.Duration
+}
+
+// materialKey identifies a version of a key of the KMS keyring
+type materialKey struct {
+	keyID   string
+	version int
+}
+
+// exclusionKey identifies the share of a key version whose node was found faulty. A node is only excluded for the key
+// version it gave a wrong partial for, its shares of other keys and versions may well be fine.
+type exclusionKey struct {
+	materialKey
+	shareID int
+}
+
+// NewDsService creates a new DsService with the URLs of the decryption nodes by the id of the share they hold, and the
+// given timeout. Every node holds its own key share, the gateway never sees one. It only loads the public params from the KMS:
+// the threshold, the verification keys used to check every partial decryption, and the pairing and G2 generator
+// needed to turn the combined partial decryptions back into the plaintext. They are kept per key version and
+// reloaded whenever the KMS reports a new refresh epoch.
+// The identity policy authorizes every identity key extraction and the signing policy every signature, the nodes only
+// compute partial identity keys and partial signatures for requests carrying the node token.
+func NewDsService(nodes map[int]string, timeout time.Duration, nodeToken string, kmsService KmsService, policy IdentityPolicy, signingPolicy SigningPolicy, combine CombineOptions) (DsService, error) {
+	if len(nodes) == 0 {
+		return nil, errors.New("no decryption nodes configured")
+	}
+
+	service := &dsService{
+		client:        httpclient.NewAuthenticatedHttpClient(timeout, nodeToken),
+		nodes:         nodes,
+		kmsService:    kmsService,
+		policy:        policy,
+		signingPolicy: signingPolicy,
+		material:      make(map[materialKey]PublicParams),
+		combine:       combine,
+		excluded:      make(map[exclusionKey]time.Time),
+	}
+
+	// Load the latest version of the default key up front so a misconfigured KMS or node list shows at startup
+	params, err := service.keyMaterial("", 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading key material from kms")
+	}
+	if _, _, err := service.nodesFor(params); err != nil {
+		return nil, err
+	}
+
+	return service, nil
 }
 
-// NewDsService creates a new DsService with the specified decryption service URL and timeout
-func NewDsService(dsUrl string, timeout time.Duration, keyShares []KeyShareResponse) DsService {
-	client := httpclient.NewHttpClient(timeout)
-	return &dsService{
-		client:    client,
-		dsUrl:     dsUrl,
-		keyShares: keyShares,
+// shareIDs returns the ids of the shares a decryption node is configured for, in ascending order
+func (ds *dsService) shareIDs() []int {
+	shareIDs := make([]int, 0, len(ds.nodes))
+	for shareID := range ds.nodes {
+		shareIDs = append(shareIDs, shareID)
 	}
+	sort.Ints(shareIDs)
+	return shareIDs
 }
 
-func (ds *dsService) Ciphertext() (CiphertextResponse, error) {
+// nodesFor returns the share ids of the configured nodes that hold a share of the key version, split into the ones to
+// ask and the ones currently excluded as faulty. Nodes beyond the number of shares of the version, e.g. after a
+// reshare to fewer shares, are left out. Fewer than t configured nodes can never decrypt, so that is a configuration
+// error. Exclusion never leaves fewer than t nodes to ask: below that floor the nodes excluded the longest are asked
+// again, a wrong partial of theirs only costs the round while excluding them would cost the key.
+func (ds *dsService) nodesFor(params PublicParams) ([]int, []int, error) {
+	var configured []int
+	for _, shareID := range ds.shareIDs() {
+		if _, ok := params.VerificationKeys[shareID]; ok {
+			configured = append(configured, shareID)
+		}
+	}
+
+	if len(configured) < params.Threshold {
+		return nil, nil, fmt.Errorf("decryption nodes are configured for %d shares of %s version %d, need %d", len(configured), params.KeyID, params.Version, params.Threshold)
+	}
+
+	ds.exclusionMutex.Lock()
+	defer ds.exclusionMutex.Unlock()
+
+	var shareIDs, excluded []int
+	for _, shareID := range configured {
+		if ds.isExcluded(params, shareID) {
+			excluded = append(excluded, shareID)
+		} else {
+			shareIDs = append(shareIDs, shareID)
+		}
+	}
+
+	if len(shareIDs) < params.Threshold {
+		sort.SliceStable(excluded, func(i, j int) bool {
+			return ds.excluded[exclusionKeyOf(params, excluded[i])].Before(ds.excluded[exclusionKeyOf(params, excluded[j])])
+		})
+		readmitted := params.Threshold - len(shareIDs)
+		shareIDs = append(shareIDs, excluded[:readmitted]...)
+		excluded = excluded[readmitted:]
+		sort.Ints(shareIDs)
+		sort.Ints(excluded)
+	}
+	return shareIDs, excluded, nil
+}
+
+// exclusionKeyOf returns the exclusion key of a share of the key version
+func exclusionKeyOf(params PublicParams, shareID int) exclusionKey {
+	return exclusionKey{materialKey: materialKey{keyID: params.KeyID, version: params.Version}, shareID: shareID}
+}
+
+// isExcluded reports whether the node of a share is still excluded for the key version, the caller holds the exclusion
+// mutex
+func (ds *dsService) isExcluded(params PublicParams, shareID int) bool {
+	key := exclusionKeyOf(params, shareID)
+	since, ok := ds.excluded[key]
+	if !ok {
+		return false
+	}
+	if time.Since(since) >= ds.combine.ExclusionPeriod {
+		delete(ds.excluded, key)
+		return false
+	}
+	return true
+}
+
+// exclude leaves the nodes of the given shares out of the following rounds of the key version
+func (ds *dsService) exclude(params PublicParams, shareIDs []int) {
+	if ds.combine.ExclusionPeriod <= 0 {
+		return
+	}
+
+	ds.exclusionMutex.Lock()
+	defer ds.exclusionMutex.Unlock()
+
+	for _, shareID := range shareIDs {
+		ds.excluded[exclusionKeyOf(params, shareID)] = time.Now()
+	}
+}
+
+// Encrypt asks a decryption node to encrypt the plaintext under the latest version of the given key in the given mode
+func (ds *dsService) Encrypt(keyID, mode, plaintext string) (CiphertextResponse, error) {
+	reqBytes, err := json.Marshal(EncryptRequest{KeyID: keyID, Mode: mode, Plaintext: plaintext})
+	if err != nil {
+		return CiphertextResponse{}, err
+	}
+
 	var ciphertext []byte
-	resp, err := ds.client.Get(ds.dsUrl + "/ciphertext")
+	resp, err := ds.postEncryption("/encrypt", reqBytes)
 	if err != nil {
 		return CiphertextResponse{}, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError {
+		return CiphertextResponse{}, nodeRejection(resp)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return CiphertextResponse{}, errors.New("failed to encrypt plaintext")
+	}
+
 	ciphertext, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return CiphertextResponse{}, err
@@ -86,67 +292,282 @@ func (ds *dsService) Ciphertext() (CiphertextResponse, error) {
 	return response, err
 }
 
-// Decrypt performs the decryption using partial decryptions from key shares
-func (ds *dsService) Decrypt(ciphertext string) (string, error) {
-	partialDecryptions := make([]string, len(ds.keyShares))
+// postEncryption posts an encryption request to a decryption node. Encryption needs no share, so any node will do: the
+// node that answered the last encryption is asked first, then the others in the order of their share ids, until one
+// answers without a server error.
+func (ds *dsService) postEncryption(path string, request []byte) (*http.Response, error) {
+	shareIDs := ds.shareIDs()
+	start := int(ds.encryptionNode.Load())
 
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	errChan := make(chan error, len(ds.keyShares))
+	var lastErr error
+	for i := range shareIDs {
+		position := (start + i) % len(shareIDs)
+		nodeUrl := ds.nodes[shareIDs[position]]
 
-	for i, share := range ds.keyShares {
-		wg.Add(1)
-		go func(i int, share KeyShareResponse) {
-			defer wg.Done()
-			partialReq := PartialDecryptRequest{
-				Ciphertext: ciphertext,
-				Share:      share.Share,
-			}
+		resp, err := ds.client.Post(nodeUrl+path, "application/json", bytes.NewReader(request))
+		if err != nil {
+			lastErr = errors.Wrapf(err, "node %s", nodeUrl)
+			continue
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("node %s answered %s", nodeUrl, resp.Status)
+			continue
+		}
+
+		ds.encryptionNode.Store(int32(position))
+		return resp, nil
+	}
+	return nil, errors.Wrap(lastErr, "no decryption node could encrypt")
+}
 
-			partialDecryptResp, err := ds.sendPartialDecryptRequest(partialReq)
-			if err != nil {
-				errChan <- err
-				return
+// nodeRejection reads the reason a decryption node gave for refusing a plaintext from its error response
+func nodeRejection(resp *http.Response) error {
+	var body struct {
+		Errors []struct {
+			Source struct {
+				Message string `json:"message"`
+			} `json:"source"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || len(body.Errors) == 0 || body.Errors[0].Source.Message == "" {
+		return errors.Wrap(ErrPlaintextRejected, resp.Status)
+	}
+	return errors.Wrap(ErrPlaintextRejected, body.Errors[0].Source.Message)
+}
+
+// Decrypt performs the decryption using partial decryptions of the decryption nodes, each with its share of the version
+// the ciphertext was encrypted under. It returns the status of every node asked, also when the decryption failed.
+// For a hybrid ciphertext only the KEM header goes to the decryption service, the payload is decrypted here.
+func (ds *dsService) Decrypt(ciphertext string) (string, []NodeStatus, error) {
+	if isHybridCiphertext(ciphertext) {
+		return ds.decryptHybrid(ciphertext)
+	}
+	return ds.decryptDirect(ciphertext)
+}
+
+// decryptHybrid unwraps the data key from the KEM header and opens the AES-256-GCM payload with it
+func (ds *dsService) decryptHybrid(ciphertext string) (string, []NodeStatus, error) {
+	kem, nonce, sealed, err := openHybridEnvelope(ciphertext)
+	if err != nil {
+		return "", nil, err
+	}
+
+	dataKey, nodes, err := ds.UnwrapKey(base64.StdEncoding.EncodeToString(kem))
+	if err != nil {
+		return "", nodes, errors.Wrap(err, "unwrapping data key")
+	}
+
+	plaintext, err := openPayload(dataKey, nonce, sealed, kem)
+	if err != nil {
+		return "", nodes, err
+	}
+	return string(plaintext), nodes, nil
+}
+
+// UnwrapKey threshold-decrypts the KEM header of a hybrid ciphertext into its AES-256 data key and returns the status of
+// the decryption nodes with it
+func (ds *dsService) UnwrapKey(kem string) ([]byte, []NodeStatus, error) {
+	dataKey, nodes, err := ds.decryptDirect(kem)
+	if err != nil {
+		return nil, nodes, err
+	}
+	if len(dataKey) != dataKeySize {
+		return nil, nodes, errors.Errorf("KEM header wraps %d bytes, expected a %d-byte data key", len(dataKey), dataKeySize)
+	}
+	return []byte(dataKey), nodes, nil
+}
+
+// decryptDirect combines partial decryptions of the ciphertext header and unmasks the payload
+func (ds *dsService) decryptDirect(ciphertext string) (string, []NodeStatus, error) {
+	sealed, err := openEnvelope(ciphertext)
+	if err != nil {
+		return "", nil, err
+	}
+	if sealed.Version < 1 {
+		return "", nil, errors.Wrapf(ErrInvalidCiphertext, "invalid key version %d", sealed.Version)
+	}
+
+	params, err := ds.keyMaterial(sealed.KeyID, sealed.Version)
+	if err != nil {
+		return "", nil, err
+	}
+	if sealed.KeyID != params.KeyID {
+		return "", nil, errors.Errorf("ciphertext was encrypted under key %q, not %q", sealed.KeyID, params.KeyID)
+	}
+
+	headerBytes, tagBytes, payload, err := splitCiphertext(params.Pairing, sealed)
+	if err != nil {
+		return "", nil, err
+	}
+
+	header := params.Pairing.NewG1().SetBytes(headerBytes)
+	if header.Is0() {
+		return "", nil, errors.Wrap(ErrInvalidCiphertext, "ciphertext header is zero")
+	}
+
+	// The nodes refuse an invalid ciphertext anyway, checking it here spares them the requests
+	if sealed.Format == ciphertextFormat {
+		if err := checkValidity(params.Pairing, sealed, header, tagBytes, payload); err != nil {
+			return "", nil, err
+		}
+	}
+
+	// Combine partial decryptions to get U^s for the ciphertext header
+	combined, nodes, err := ds.combineShares(params, header, func(ctx context.Context, nodeUrl string) (*PartialDecryptResponse, error) {
+		return ds.sendPartialDecryptRequest(ctx, nodeUrl, PartialDecryptRequest{Ciphertext: ciphertext})
+	})
+	if err != nil {
+		return "", nodes, err
+	}
+
+	// Unmask the payload with the keystream derived from e(U^s, g)
+	plaintext := recoverPlaintext(params.Pairing, params.Generator, combined, payload)
+
+	return string(plaintext), nodes, nil
+}
+
+// combineShares asks the decryption node of every share of the key version for element^{s_i}, keeps the partials whose
+// proofs tie them to the verification key of that share and combines the first threshold of them into element^s. The
+// element is the ciphertext header for a decryption and the identity point for an identity key extraction.
+// The requests run concurrently and the outstanding ones are cancelled as soon as t partials are verified, so slow or
+// failed nodes only matter once fewer than t nodes can still answer. In robust mode every node is waited for instead.
+// The status of every node is returned with the result, and with the QuorumError when the threshold was not reached.
+func (ds *dsService) combineShares(params PublicParams, element group.Element, request func(ctx context.Context, nodeUrl string) (*PartialDecryptResponse, error)) (group.Element, []NodeStatus, error) {
+	shareIDs, excluded, err := ds.nodesFor(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Buffered for every node, so the requests still running after the quorum never block on sending their result
+	started := time.Now()
+	resultChan := make(chan partialResult, len(shareIDs))
+	for _, shareID := range shareIDs {
+		go func(shareID int, nodeUrl string) {
+			partial, class, err := ds.verifiedPartial(ctx, params, element, shareID, nodeUrl, request)
+			resultChan <- partialResult{shareID: shareID, partial: partial, class: class, err: err, latency: time.Since(started)}
+		}(shareID, ds.nodes[shareID])
+	}
+
+	if ds.combine.Robust {
+		return ds.collectRobust(params, element, shareIDs, excluded, resultChan, started)
+	}
+
+	var results []partialResult
+	var partialDecryptions []PartialDecryption
+	var failures int
+	var firstErr error
+	for range shareIDs {
+		result := <-resultChan
+		results = append(results, result)
+		if result.err == nil {
+			partialDecryptions = append(partialDecryptions, result.partial)
+			if len(partialDecryptions) == params.Threshold {
+				cancel()
+				combined, err := combinePartialDecryptions(params.Pairing, partialDecryptions, params.Threshold)
+				return combined, ds.nodeReport(shareIDs, excluded, results, started), err
 			}
+			continue
+		}
 
-			mu.Lock()
-			partialDecryptions[i] = partialDecryptResp.PartialDecryption
-			mu.Unlock()
-		}(i, share)
+		failures++
+		firstErr = preferredError(firstErr, result.err)
+		if len(shareIDs)-failures < params.Threshold {
+			break
+		}
 	}
 
-	wg.Wait()
-	close(errChan)
+	nodes := ds.nodeReport(shareIDs, excluded, results, started)
+	return nil, nodes, &QuorumError{Threshold: params.Threshold, Nodes: nodes, err: firstErr}
+}
 
-	if err := <-errChan; err != nil {
-		return "", err
+// verifiedPartial requests the partial of one share from its node and returns it once it checks out: the node must
+// answer with the share it is configured for, in the current refresh epoch, with a proof tying the partial to the
+// verification key of that share. A failure comes with its error class for the node status.
+func (ds *dsService) verifiedPartial(ctx context.Context, params PublicParams, element group.Element, shareID int, nodeUrl string, request func(ctx context.Context, nodeUrl string) (*PartialDecryptResponse, error)) (PartialDecryption, string, error) {
+	partialDecryptResp, err := request(ctx, nodeUrl)
+	if err != nil {
+		return PartialDecryption{}, requestErrorClass(err), errors.Wrapf(err, "node %s of share %d", nodeUrl, shareID)
 	}
 
-	// Combine partial decryptions to get the final decrypted message
-	finalDecryption, err := ds.combinePartialDecryptions(partialDecryptions)
+	// A node answering with another share than the one it is configured for is misconfigured or misbehaving
+	if partialDecryptResp.ShareID != shareID {
+		return PartialDecryption{}, ErrorClassShareMismatch, fmt.Errorf("node %s of share %d answered with share %d", nodeUrl, shareID, partialDecryptResp.ShareID)
+	}
+
+	// Shares of different refresh epochs lie on different polynomials and must never be combined
+	if partialDecryptResp.Epoch != params.Epoch {
+		return PartialDecryption{}, ErrorClassStaleEpoch, fmt.Errorf("partial decryption of share %d is from epoch %d, expected %d", shareID, partialDecryptResp.Epoch, params.Epoch)
+	}
+
+	partial, err := decodePartialDecryption(params.Pairing, shareID, partialDecryptResp.PartialDecryption)
 	if err != nil {
-		return "", err
+		return PartialDecryption{}, ErrorClassMalformedResponse, err
+	}
+
+	// Every share asked has a verification key, so a partial without a proof is never accepted, in robust mode neither
+	if partialDecryptResp.Proof == (ProofResponse{}) {
+		return PartialDecryption{}, ErrorClassInvalidProof, fmt.Errorf("partial decryption of share %d has no proof", shareID)
 	}
 
-	return finalDecryption, nil
+	// A partial only counts once its proof ties it to the verification key of its share
+	if err := verifyPartialDecryption(params, element, partial, partialDecryptResp.Proof); errors.Is(err, errMalformedProof) {
+		return PartialDecryption{}, ErrorClassMalformedResponse, err
+	} else if err != nil {
+		return PartialDecryption{}, ErrorClassInvalidProof, err
+	}
+	return partial, "", nil
 }
 
-// sendPartialDecryptRequest sends a partial decryption request to the decryption service
-func (d *dsService) sendPartialDecryptRequest(req PartialDecryptRequest) (*PartialDecryptResponse, error) {
+// keyMaterial returns the public params of the current refresh epoch of the given key version.
+// The empty key id is the default key and version 0 is the latest.
+// After a refresh the cached verification keys are stale, so they are reloaded.
+func (ds *dsService) keyMaterial(keyID string, version int) (PublicParams, error) {
+	publicKey, err := ds.kmsService.FetchPublicKey(keyID, version)
+	if err != nil {
+		return PublicParams{}, err
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	cacheKey := materialKey{keyID: publicKey.KeyID, version: publicKey.Version}
+	cached, ok := ds.material[cacheKey]
+	if ok && publicKey.Epoch == cached.Epoch {
+		return cached, nil
+	}
+
+	params, err := LoadPublicParams(ds.kmsService, publicKey.KeyID, publicKey.Version)
+	if err != nil {
+		return PublicParams{}, errors.Wrapf(err, "loading public params of %s version %d", publicKey.KeyID, publicKey.Version)
+	}
+
+	ds.material[cacheKey] = params
+	return params, nil
+}
+
+// sendPartialDecryptRequest sends a partial decryption request to a decryption node
+func (d *dsService) sendPartialDecryptRequest(ctx context.Context, nodeUrl string, req PartialDecryptRequest) (*PartialDecryptResponse, error) {
 
 	reqBytes, err := json.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := d.client.Post(d.dsUrl+"/partial-decrypt", "application/json", bytes.NewBuffer(reqBytes))
+	resp, err := d.client.PostContext(ctx, nodeUrl+"/partial-decrypt", "application/json", bytes.NewBuffer(reqBytes))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusBadRequest {
+		return nil, errors.Wrap(ErrInvalidCiphertext, "rejected by the decryption service")
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to get partial decryption")
+		return nil, errors.Wrapf(errNodeFailed, "failed to get partial decryption: status %d", resp.StatusCode)
 	}
 
 	var partialDecryptResp PartialDecryptResponse
@@ -156,24 +577,3 @@ func (d *dsService) sendPartialDecryptRequest(req PartialDecryptRequest) (*Parti
 
 	return &partialDecryptResp, nil
 }
-
-// combinePartialDecryptions combines partial decryptions to get the final decrypted message
-func (ds *dsService) combinePartialDecryptions(partials []string) (string, error) {
-	// Decode base64-encoded shares
-	shares := make([][]byte, len(partials))
-	for i, partial := range partials {
-		decoded, err := base64.StdEncoding.DecodeString(partial)
-		if err != nil {
-			return "", err
-		}
-		shares[i] = decoded
-	}
-
-	// Combine shares using Shamir's Secret Sharing
-	secret, err := shamir.Combine(shares)
-	if err != nil {
-		return "", err
-	}
-
-	return string(secret), nil
-}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	httpclient "github.com/mdshahjahanmiah/gateway-service/pkg/client"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEncryptRejected(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"errors":[{"status":422,"code":"fail to encrypt plaintext","source":{"field":"plaintext","message":"plaintext exceeds 256 bytes"}}]}`))
+	}))
+	defer node.Close()
+
+	ds := &dsService{client: httpclient.NewHttpClient(time.Second), nodes: map[int]string{1: node.URL}}
+	_, err := ds.Encrypt("", "direct", strings.Repeat("a", 300))
+	if !errors.Is(err, ErrPlaintextRejected) {
+		t.Fatalf("Encrypt: %v, want ErrPlaintextRejected", err)
+	}
+	if !strings.Contains(err.Error(), "plaintext exceeds 256 bytes") {
+		t.Errorf("Encrypt: %v does not carry the reason of the node", err)
+	}
+
+	if _, err := ds.EncryptIdentity("", "alice", "hello"); !errors.Is(err, ErrPlaintextRejected) {
+		t.Errorf("EncryptIdentity: %v, want ErrPlaintextRejected", err)
+	}
+}
+
+func TestEncryptFailover(t *testing.T) {
+	var calls [4]atomic.Int32
+	node := func(shareID int, status int) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls[shareID].Add(1)
+			w.WriteHeader(status)
+			w.Write([]byte(`{"ciphertext":"ciphertext of node ` + strconv.Itoa(shareID) + `"}`))
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	ds := &dsService{
+		client: httpclient.NewHttpClient(time.Second),
+		nodes:  map[int]string{1: down.URL, 2: node(2, http.StatusServiceUnavailable), 3: node(3, http.StatusOK)},
+	}
+	for i := 0; i < 2; i++ {
+		response, err := ds.Encrypt("", "direct", "hello")
+		if err != nil {
+			t.Fatalf("Encrypt %d: %v", i, err)
+		}
+		if response.Ciphertext != "ciphertext of node 3" {
+			t.Errorf("Encrypt %d: ciphertext %q, want the one of node 3", i, response.Ciphertext)
+		}
+	}
+	// The node that answered is asked first the next time, the ones that failed are not retried
+	if calls[2].Load() != 1 || calls[3].Load() != 2 {
+		t.Errorf("node 2 asked %d times and node 3 %d times, want 1 and 2", calls[2].Load(), calls[3].Load())
+	}
+
+	// A refusal is the answer of a node, the others are not asked
+	ds.nodes[3] = node(3, http.StatusUnprocessableEntity)
+	if _, err := ds.Encrypt("", "direct", "hello"); !errors.Is(err, ErrPlaintextRejected) {
+		t.Errorf("Encrypt: %v, want ErrPlaintextRejected", err)
+	}
+	if calls[2].Load() != 1 {
+		t.Errorf("node 2 asked after node 3 refused")
+	}
+
+	ds.nodes = map[int]string{1: down.URL, 2: node(2, http.StatusBadGateway)}
+	ds.encryptionNode.Store(0)
+	if _, err := ds.EncryptIdentity("", "alice", "hello"); err == nil {
+		t.Errorf("EncryptIdentity succeeded without a working node")
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/group"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+// identityDomain separates the hash of identities from every other use of hashing into G1.
+// It must match the decryption nodes, otherwise the proofs of their partial identity keys do not verify.
+const identityDomain = "threshold-ibe:"
+
+// IdentityEncryptRequest is a plaintext to encrypt to an identity, under the default key of the KMS if the key id is empty
+type IdentityEncryptRequest struct {
+	KeyID     string `json:"key_id,omitempty"`
+	Identity  string `json:"identity"`
+	Plaintext string `json:"plaintext"`
+}
+
+// ExtractIdentityKeyRequest asks for the private key of an identity under a version of a key, version 0 is the latest.
+// The requester is not part of the payload, it is taken from the header set by whatever authenticated the caller.
+type ExtractIdentityKeyRequest struct {
+	KeyID     string `json:"key_id,omitempty"`
+	Version   int    `json:"version,omitempty"`
+	Identity  string `json:"identity"`
+	Requester string `json:"-"`
+}
+
+// IdentityKeyResponse is the private key Q_id^s of an identity, base64-encoded
+type IdentityKeyResponse struct {
+	KeyID       string `json:"key_id"`
+	Version     int    `json:"version"`
+	Identity    string `json:"identity"`
+	IdentityKey string `json:"identity_key"`
+}
+
+// PartialIdentityKeyRequest is the payload sent to a decryption node for a partial identity key under a key version
+type PartialIdentityKeyRequest struct {
+	KeyID    string `json:"key_id"`
+	Version  int    `json:"version"`
+	Identity string `json:"identity"`
+}
+
+// PartialIdentityKeyResponse is a partial identity key Q_id^{s_i} with the proof that share i computed it
+type PartialIdentityKeyResponse struct {
+	PartialKey string        `json:"partial_key"`
+	Proof      ProofResponse `json:"proof"`
+	ShareID    int           `json:"share_id"`
+	Epoch      int           `json:"epoch"`
+}
+
+// hashIdentity maps an identity string to its public point Q_id = H(id) in G1
+func hashIdentity(pairing group.Pairing, identity string) group.Element {
+	return pairing.NewG1().SetFromStringHash(identityDomain+identity, sha256.New())
+}
+
+// EncryptIdentity asks a decryption node to encrypt the plaintext to an identity under the latest version of the given key
+func (ds *dsService) EncryptIdentity(keyID, identity, plaintext string) (CiphertextResponse, error) {
+	reqBytes, err := json.Marshal(IdentityEncryptRequest{KeyID: keyID, Identity: identity, Plaintext: plaintext})
+	if err != nil {
+		return CiphertextResponse{}, err
+	}
+
+	resp, err := ds.postEncryption("/encrypt-identity", reqBytes)
+	if err != nil {
+		return CiphertextResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError {
+		return CiphertextResponse{}, nodeRejection(resp)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return CiphertextResponse{}, errors.New("failed to encrypt plaintext to identity")
+	}
+
+	var response CiphertextResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return CiphertextResponse{}, err
+	}
+	return response, nil
+}
+
+// ExtractIdentityKey combines the private key Q_id^s of an identity from the partial identity keys of the decryption
+// nodes, once the identity policy has authorized the requester. Every partial is checked against its verification
+// key exactly like a partial decryption, so a faulty node cannot hand out a wrong identity key.
+func (ds *dsService) ExtractIdentityKey(request ExtractIdentityKeyRequest) (IdentityKeyResponse, error) {
+	if err := ds.policy.Authorize(request.Requester, request.KeyID, request.Identity); err != nil {
+		return IdentityKeyResponse{}, err
+	}
+
+	params, err := ds.keyMaterial(request.KeyID, request.Version)
+	if err != nil {
+		return IdentityKeyResponse{}, err
+	}
+
+	point := hashIdentity(params.Pairing, request.Identity)
+	identityKey, _, err := ds.combineShares(params, point, func(ctx context.Context, nodeUrl string) (*PartialDecryptResponse, error) {
+		return ds.sendPartialIdentityKeyRequest(ctx, nodeUrl, PartialIdentityKeyRequest{
+			KeyID:    params.KeyID,
+			Version:  params.Version,
+			Identity: request.Identity,
+		})
+	})
+	if err != nil {
+		return IdentityKeyResponse{}, err
+	}
+
+	return IdentityKeyResponse{
+		KeyID:       params.KeyID,
+		Version:     params.Version,
+		Identity:    request.Identity,
+		IdentityKey: base64.StdEncoding.EncodeToString(identityKey.Bytes()),
+	}, nil
+}
+
+// sendPartialIdentityKeyRequest sends a partial identity key request to a decryption node.
+// The partial key is returned as a partial decryption, both are checked and combined the same way.
+func (ds *dsService) sendPartialIdentityKeyRequest(ctx context.Context, nodeUrl string, req PartialIdentityKeyRequest) (*PartialDecryptResponse, error) {
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ds.client.PostContext(ctx, nodeUrl+"/partial-identity-key", "application/json", bytes.NewBuffer(reqBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(errNodeFailed, "failed to get partial identity key: status %d", resp.StatusCode)
+	}
+
+	var partialResp PartialIdentityKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&partialResp); err != nil {
+		return nil, err
+	}
+
+	return &PartialDecryptResponse{
+		PartialDecryption: partialResp.PartialKey,
+		Proof:             partialResp.Proof,
+		ShareID:           partialResp.ShareID,
+		Epoch:             partialResp.Epoch,
+	}, nil
+}
@@ -1,65 +1,79 @@
 package services
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	httpclient "github.com/mdshahjahanmiah/gateway-service/pkg/client"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/group"
 	"github.com/pkg/errors"
 	"io/ioutil"
 	"net/http"
-	"sync"
+	"net/url"
+	"strconv"
 	"time"
 )
 
 // KmsService is a service that interacts with the KMS
 type kmsService struct {
-	keyShares []KeyShareResponse
-	client    *httpclient.Client
-	kmsURL    string
-	mutex     sync.Mutex
+	client *httpclient.Client
+	kmsURL string
 }
 
+// KmsService fetches the key material of one version of a key of the KMS keyring.
+// The empty key id is the default key of the KMS and version 0 is the latest version.
 type KmsService interface {
-	FetchPublicKey() (PublicKeyResponse, error)
-	GetShares() ([]KeyShareResponse, error)
+	FetchPublicKey(keyID string, version int) (PublicKeyResponse, error)
+	FetchPairingParams(keyID string) (string, error)
+	FetchVerificationKeys(keyID string, version int) ([]VerificationKeyResponse, error)
 }
 
 // PublicKeyResponse is the response from the KMS for the public key
 type PublicKeyResponse struct {
-	X string `json:"x"`
-	Y string `json:"y"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	Key       string `json:"key"`
+	Generator string `json:"generator"`
+	KeyID     string `json:"key_id"`
+	Tenant    string `json:"tenant"`
+	Version   int    `json:"version"`
+	Threshold int    `json:"threshold"`
+	Epoch     int    `json:"epoch"`
 }
 
-// KeyShareResponse is the response from the KMS for the key shares
-type KeyShareResponse struct {
-	ID    int    `json:"id"`
-	Share string `json:"share"`
+// VerificationKeyResponse is the response from the KMS for the verification key g^{s_i} of a key share
+type VerificationKeyResponse struct {
+	ID      int    `json:"id"`
+	Key     string `json:"key"`
+	Version int    `json:"version"`
+	Epoch   int    `json:"epoch"`
+}
+
+// PairingParamResponse is the response from the KMS for the pairing parameters
+type PairingParamResponse struct {
+	Params string `json:"params"`
 }
 
 // NewKmsService creates a new KmsService with the specified KMS URL and timeout
-func NewKmsService(kmsURL string, timeout time.Duration) (KmsService, error) {
+func NewKmsService(kmsURL string, timeout time.Duration) KmsService {
 	client := httpclient.NewHttpClient(timeout)
-	service := &kmsService{
+	return &kmsService{
 		client: client,
 		kmsURL: kmsURL,
 	}
-
-	// Fetch and cache key shares during initialization
-	err := service.fetchAndCacheKeyShares()
-	if err != nil {
-		return nil, err
-	}
-
-	return service, nil
 }
 
-// FetchPublicKey fetches the public key from the KMS
-func (kms *kmsService) FetchPublicKey() (PublicKeyResponse, error) {
+// FetchPublicKey fetches the public key of the given key and version from the KMS
+func (kms *kmsService) FetchPublicKey(keyID string, version int) (PublicKeyResponse, error) {
 	var publicKey []byte
-	resp, err := kms.client.Get(kms.kmsURL + "/public-key")
+	resp, err := kms.client.Get(kms.keyURL(keyID, "/public-key") + versionQuery(version))
 	if err != nil {
 		return PublicKeyResponse{}, err
 	}
 	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return PublicKeyResponse{}, errors.Errorf("failed to fetch public key %q version %d from KMS", keyID, version)
+	}
 	publicKey, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return PublicKeyResponse{}, err
@@ -76,42 +90,159 @@ func (kms *kmsService) FetchPublicKey() (PublicKeyResponse, error) {
 	return response, err
 }
 
-// GetShares fetches the key shares from the KMS
-func (kms *kmsService) GetShares() ([]KeyShareResponse, error) {
-	kms.mutex.Lock()
-	defer kms.mutex.Unlock()
+// FetchPairingParams fetches the base64-encoded pairing parameters of the given key from the KMS
+func (kms *kmsService) FetchPairingParams(keyID string) (string, error) {
+	resp, err := kms.client.Get(kms.keyURL(keyID, "/pairing-param"))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("failed to fetch pairing parameters from KMS")
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
 
-	if len(kms.keyShares) == 0 {
-		return nil, errors.New("no key shares available")
+	var response PairingParamResponse
+	if err = json.Unmarshal(body, &response); err != nil {
+		return "", err
 	}
-	return kms.keyShares, nil
+
+	return response.Params, nil
 }
 
-// fetchAndCacheKeyShares fetches key shares from the KMS and caches them
-func (k *kmsService) fetchAndCacheKeyShares() error {
-	resp, err := k.client.Get(k.kmsURL + "/key-shares")
+// FetchVerificationKeys fetches the verification keys of all key shares of the given key and version from the KMS
+func (kms *kmsService) FetchVerificationKeys(keyID string, version int) ([]VerificationKeyResponse, error) {
+	resp, err := kms.client.Get(kms.keyURL(keyID, "/verification-keys") + versionQuery(version))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return errors.New("failed to fetch key shares from KMS")
+		return nil, errors.New("failed to fetch verification keys from KMS")
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var verificationKeys []VerificationKeyResponse
+	if err = json.Unmarshal(body, &verificationKeys); err != nil {
+		return nil, err
+	}
+
+	return verificationKeys, nil
+}
+
+// keyURL is the KMS URL of a resource of the given key, the KMS serves its default key at the root
+func (kms *kmsService) keyURL(keyID, resource string) string {
+	if keyID == "" {
+		return kms.kmsURL + resource
+	}
+	return kms.kmsURL + "/keys/" + url.PathEscape(keyID) + resource
+}
+
+// versionQuery selects a key version in a KMS request, the KMS answers with the latest version without it
+func versionQuery(version int) string {
+	if version == 0 {
+		return ""
+	}
+	return "?version=" + strconv.Itoa(version)
+}
+
+// PublicParams is the public material the gateway needs to check and combine partial decryptions.
+// The verification keys belong to the shares of one key version and refresh epoch.
+type PublicParams struct {
+	KeyID            string
+	Tenant           string
+	Version          int
+	Pairing          group.Pairing
+	Generator        group.Element
+	PublicKey        group.Element
+	Threshold        int
+	Epoch            int
+	VerificationKeys map[int]group.Element
+}
+
+// LoadPublicParams rebuilds the pairing, the G2 generator, the public key and the per-share verification keys the KMS publishes for the given key version
+func LoadPublicParams(kmsService KmsService, keyID string, version int) (PublicParams, error) {
+	encodedParams, err := kmsService.FetchPairingParams(keyID)
+	if err != nil {
+		return PublicParams{}, err
+	}
+
+	paramsBytes, err := base64.StdEncoding.DecodeString(encodedParams)
+	if err != nil {
+		return PublicParams{}, err
+	}
+
+	pairing, err := group.NewPairing(string(paramsBytes))
+	if err != nil {
+		return PublicParams{}, err
+	}
+
+	publicKey, err := kmsService.FetchPublicKey(keyID, version)
+	if err != nil {
+		return PublicParams{}, err
 	}
 
-	var keyShares []KeyShareResponse
-	if err = json.Unmarshal(body, &keyShares); err != nil {
-		return err
+	generator, err := decodeG2(pairing, publicKey.Generator)
+	if err != nil {
+		return PublicParams{}, errors.Wrap(err, "decoding generator")
+	}
+
+	publicKeyElement, err := decodeG2(pairing, publicKey.Key)
+	if err != nil {
+		return PublicParams{}, errors.Wrap(err, "decoding public key")
+	}
+
+	verificationKeyResponses, err := kmsService.FetchVerificationKeys(keyID, publicKey.Version)
+	if err != nil {
+		return PublicParams{}, err
+	}
+
+	verificationKeys := make(map[int]group.Element, len(verificationKeyResponses))
+	for _, verificationKey := range verificationKeyResponses {
+		if verificationKey.Version != publicKey.Version || verificationKey.Epoch != publicKey.Epoch {
+			return PublicParams{}, errors.Errorf("verification key %d is from version %d epoch %d, expected version %d epoch %d", verificationKey.ID, verificationKey.Version, verificationKey.Epoch, publicKey.Version, publicKey.Epoch)
+		}
+		element, err := decodeG2(pairing, verificationKey.Key)
+		if err != nil {
+			return PublicParams{}, errors.Wrapf(err, "decoding verification key %d", verificationKey.ID)
+		}
+		verificationKeys[verificationKey.ID] = element
+	}
+
+	return PublicParams{
+		KeyID:            publicKey.KeyID,
+		Tenant:           publicKey.Tenant,
+		Version:          publicKey.Version,
+		Pairing:          pairing,
+		Generator:        generator,
+		PublicKey:        publicKeyElement,
+		Threshold:        publicKey.Threshold,
+		Epoch:            publicKey.Epoch,
+		VerificationKeys: verificationKeys,
+	}, nil
+}
+
+// decodeG2 decodes a base64-encoded G2 element such as the generator or a verification key
+func decodeG2(pairing group.Pairing, encoded string) (group.Element, error) {
+	elementBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
 	}
 
-	k.mutex.Lock()
-	k.keyShares = keyShares
-	k.mutex.Unlock()
+	element := pairing.NewG2().SetBytes(elementBytes)
+	if element.Is0() {
+		return nil, errors.New("G2 element is zero after SetBytes")
+	}
 
-	return nil
+	return element, nil
 }
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// ErrExtractionDenied is returned when the identity policy refuses to hand out the private key of an identity
+var ErrExtractionDenied = errors.New("identity key extraction denied")
+
+const (
+	// IdentityPolicyDeny refuses every extraction, identity keys can only be handed out once a policy is chosen
+	IdentityPolicyDeny = "deny"
+	// IdentityPolicyRequester hands out the key of an identity only to the requester with that identity
+	IdentityPolicyRequester = "requester"
+	// IdentityPolicyAllowAll hands out any identity key to anyone, for development only
+	IdentityPolicyAllowAll = "allow-all"
+)
+
+// IdentityPolicy decides whether a requester may obtain the private key of an identity under a key.
+// The requester is whoever the gateway was told made the request, e.g. by an authenticating proxy in front of it,
+// and is empty if nobody told it.
+type IdentityPolicy interface {
+	Authorize(requester, keyID, identity string) error
+}
+
+// IdentityPolicyFunc lets a plain function serve as an IdentityPolicy
+type IdentityPolicyFunc func(requester, keyID, identity string) error
+
+// Authorize calls f(requester, keyID, identity)
+func (f IdentityPolicyFunc) Authorize(requester, keyID, identity string) error {
+	return f(requester, keyID, identity)
+}
+
+// NewIdentityPolicy returns one of the built-in policies by name
+func NewIdentityPolicy(name string) (IdentityPolicy, error) {
+	switch name {
+	case IdentityPolicyDeny:
+		return IdentityPolicyFunc(func(requester, keyID, identity string) error {
+			return ErrExtractionDenied
+		}), nil
+	case IdentityPolicyRequester:
+		return IdentityPolicyFunc(func(requester, keyID, identity string) error {
+			if requester == "" || requester != identity {
+				return errors.Wrapf(ErrExtractionDenied, "requester %q may not obtain the key of %q", requester, identity)
+			}
+			return nil
+		}), nil
+	case IdentityPolicyAllowAll:
+		return IdentityPolicyFunc(func(requester, keyID, identity string) error {
+			return nil
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown identity policy %q", name)
+	}
+}
+
+// ErrUnauthenticated is returned when a request carries no bearer token or one the gateway does not know
+var ErrUnauthenticated = errors.New("missing or unknown bearer token")
+
+// ErrSigningDenied is returned when the signing policy refuses to sign under a key
+var ErrSigningDenied = errors.New("signing denied")
+
+const (
+	// SigningPolicyDeny refuses every signature, the gateway only signs once a policy is chosen
+	SigningPolicyDeny = "deny"
+	// SigningPolicyTenant signs under a key only for signers of the tenant owning it, or operators
+	SigningPolicyTenant = "tenant"
+	// SigningPolicyAllowAll signs anything under any key for anyone, for development only
+	SigningPolicyAllowAll = "allow-all"
+)
+
+// OperatorTenant is the tenant of signer tokens that may sign under the keys of every tenant
+const OperatorTenant = "*"
+
+// SigningPolicy decides whether a caller may have a message signed under a key of a tenant.
+// The token is the bearer token of the request, and is empty if it carried none.
+type SigningPolicy interface {
+	Authorize(token, tenant, keyID string) error
+}
+
+// SigningPolicyFunc lets a plain function serve as a SigningPolicy
+type SigningPolicyFunc func(token, tenant, keyID string) error
+
+// Authorize calls f(token, tenant, keyID)
+func (f SigningPolicyFunc) Authorize(token, tenant, keyID string) error {
+	return f(token, tenant, keyID)
+}
+
+// NewSigningPolicy returns one of the built-in policies by name. The tenant policy authenticates callers with the
+// signer tokens, which map every tenant to the token its signers present.
+func NewSigningPolicy(name string, signers map[string]string) (SigningPolicy, error) {
+	switch name {
+	case SigningPolicyDeny:
+		return SigningPolicyFunc(func(token, tenant, keyID string) error {
+			return ErrSigningDenied
+		}), nil
+	case SigningPolicyTenant:
+		if len(signers) == 0 {
+			return nil, fmt.Errorf("the %s signing policy needs signer tokens", name)
+		}
+		return SigningPolicyFunc(func(token, tenant, keyID string) error {
+			signer, found := signerOf(signers, token)
+			if !found {
+				return ErrUnauthenticated
+			}
+			if signer != OperatorTenant && signer != tenant {
+				return errors.Wrapf(ErrSigningDenied, "tenant %q may not sign under key %q of tenant %q", signer, keyID, tenant)
+			}
+			return nil
+		}), nil
+	case SigningPolicyAllowAll:
+		return SigningPolicyFunc(func(token, tenant, keyID string) error {
+			return nil
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown signing policy %q", name)
+	}
+}
+
+// signerOf returns the tenant a signer token belongs to. Every token is compared so the time taken does not tell which
+// tenant a guess came close to.
+func signerOf(signers map[string]string, token string) (string, bool) {
+	signer, found := "", false
+	if token == "" {
+		return signer, found
+	}
+	for tenant, signerToken := range signers {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(signerToken)) == 1 {
+			signer, found = tenant, true
+		}
+	}
+	return signer, found
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSigningPolicy(t *testing.T) {
+	signers := map[string]string{"acme": "acme-signer", "globex": "globex-signer", OperatorTenant: "operator"}
+
+	tests := []struct {
+		name   string
+		policy string
+		token  string
+		tenant string
+		want   error
+	}{
+		{name: "deny", policy: SigningPolicyDeny, token: "acme-signer", tenant: "acme", want: ErrSigningDenied},
+		{name: "signer of the key's tenant", policy: SigningPolicyTenant, token: "acme-signer", tenant: "acme"},
+		{name: "signer of another tenant", policy: SigningPolicyTenant, token: "globex-signer", tenant: "acme", want: ErrSigningDenied},
+		{name: "operator", policy: SigningPolicyTenant, token: "operator", tenant: "acme"},
+		{name: "unknown token", policy: SigningPolicyTenant, token: "acme", tenant: "acme", want: ErrUnauthenticated},
+		{name: "no token", policy: SigningPolicyTenant, tenant: "acme", want: ErrUnauthenticated},
+		{name: "allow-all", policy: SigningPolicyAllowAll, tenant: "acme"},
+	}
+	for _, test := range tests {
+		policy, err := NewSigningPolicy(test.policy, signers)
+		if err != nil {
+			t.Fatalf("%s: NewSigningPolicy: %v", test.name, err)
+		}
+		err = policy.Authorize(test.token, test.tenant, "default")
+		if test.want == nil && err != nil || test.want != nil && !errors.Is(err, test.want) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	if _, err := NewSigningPolicy(SigningPolicyTenant, nil); err == nil {
+		t.Error("tenant policy without signer tokens")
+	}
+	if _, err := NewSigningPolicy("anyone", signers); err == nil {
+		t.Error("unknown policy")
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/group"
+)
+
+// challengeHash hashes the given group elements, in order, into a Zr challenge.
+// It must match the hash the decryption nodes use when they build their proofs.
+func challengeHash(pairing group.Pairing, elements ...group.Element) group.Element {
+	hash := sha256.New()
+	for _, element := range elements {
+		hash.Write(element.Bytes())
+	}
+	return pairing.NewZr().SetFromHash(hash.Sum(nil))
+}
+
+// errMalformedProof marks a proof whose challenge or response is not an encoded Zr element
+var errMalformedProof = errors.New("malformed proof")
+
+// decodeZr decodes a base64-encoded Zr element of a proof, the length is checked before the bytes reach the pairing
+// library
+func decodeZr(pairing group.Pairing, encoded string) (group.Element, error) {
+	elementBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedProof, err)
+	}
+	if len(elementBytes) != int(pairing.ZrLength()) {
+		return nil, fmt.Errorf("%w: %d bytes, expected %d", errMalformedProof, len(elementBytes), pairing.ZrLength())
+	}
+	return pairing.NewZr().SetBytes(elementBytes), nil
+}
+
+// verifyPartialDecryption checks the Chaum-Pedersen proof that log_U(U^{s_i}) = log_g(g^{s_i}),
+// where g^{s_i} is the verification key the KMS published for the share that produced the partial.
+// The commitments are recomputed as U^z / W^c and g^z / VK^c and must hash back to the challenge c.
+func verifyPartialDecryption(params PublicParams, header group.Element, partial PartialDecryption, proof ProofResponse) error {
+	pairing := params.Pairing
+
+	verificationKey, ok := params.VerificationKeys[partial.ShareID]
+	if !ok {
+		return fmt.Errorf("no verification key for share %d", partial.ShareID)
+	}
+
+	challenge, err := decodeZr(pairing, proof.Challenge)
+	if err != nil {
+		return fmt.Errorf("decoding proof challenge of share %d: %w", partial.ShareID, err)
+	}
+
+	response, err := decodeZr(pairing, proof.Response)
+	if err != nil {
+		return fmt.Errorf("decoding proof response of share %d: %w", partial.ShareID, err)
+	}
+
+	commitmentG1 := pairing.NewG1().PowZn(header, response)
+	commitmentG1.ThenDiv(pairing.NewG1().PowZn(partial.Element, challenge))
+
+	commitmentG2 := pairing.NewG2().PowZn(params.Generator, response)
+	commitmentG2.ThenDiv(pairing.NewG2().PowZn(verificationKey, challenge))
+
+	expected := challengeHash(pairing, header, partial.Element, params.Generator, verificationKey, commitmentG1, commitmentG2)
+	if !expected.Equals(challenge) {
+		return fmt.Errorf("invalid partial decryption proof for share %d", partial.ShareID)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/group"
+	"testing"
+)
+
+// prove builds the Chaum-Pedersen proof a decryption node attaches to the partial of share i:
+// c = H(U, W, g, VK, U^r, g^r) and z = r + c s_i
+func (f thresholdFixture) prove(shareID int) ProofResponse {
+	pairing := f.params.Pairing
+	share := f.shares[shareID]
+
+	nonce := pairing.NewZr().Rand()
+	commitmentG1 := pairing.NewG1().PowZn(f.header, nonce)
+	commitmentG2 := pairing.NewG2().PowZn(f.params.Generator, nonce)
+
+	challenge := challengeHash(pairing, f.header, f.partial(shareID).Element, f.params.Generator, f.params.VerificationKeys[shareID], commitmentG1, commitmentG2)
+	response := pairing.NewZr().Mul(challenge, share)
+	response.ThenAdd(nonce)
+
+	return ProofResponse{
+		Challenge: base64.StdEncoding.EncodeToString(challenge.Bytes()),
+		Response:  base64.StdEncoding.EncodeToString(response.Bytes()),
+	}
+}
+
+func TestVerifyPartialDecryption(t *testing.T) {
+	fixture := newThresholdFixture(t, 2, 3)
+	pairing := fixture.params.Pairing
+
+	proof := fixture.prove(1)
+	otherProof := fixture.prove(2)
+
+	wrongShare := fixture.partial(1)
+	wrongShare.Element = fixture.partial(2).Element
+
+	randomPartial := fixture.partial(1)
+	randomPartial.Element = pairing.NewG1().Rand()
+
+	challenge, _ := base64.StdEncoding.DecodeString(proof.Challenge)
+	tamperedChallenge := pairing.NewZr().Add(pairing.NewZr().SetBytes(challenge), pairing.NewZr().Set1())
+	response, _ := base64.StdEncoding.DecodeString(proof.Response)
+	tamperedResponse := pairing.NewZr().Add(pairing.NewZr().SetBytes(response), pairing.NewZr().Set1())
+
+	withoutKey := fixture.params
+	withoutKey.VerificationKeys = map[int]group.Element{2: fixture.params.VerificationKeys[2]}
+
+	tests := []struct {
+		name    string
+		params  PublicParams
+		header  group.Element
+		partial PartialDecryption
+		proof   ProofResponse
+		valid   bool
+	}{
+		{name: "valid proof", params: fixture.params, header: fixture.header, partial: fixture.partial(1), proof: proof, valid: true},
+		{name: "tampered challenge", params: fixture.params, header: fixture.header, partial: fixture.partial(1),
+			proof: ProofResponse{Challenge: base64.StdEncoding.EncodeToString(tamperedChallenge.Bytes()), Response: proof.Response}},
+		{name: "tampered response", params: fixture.params, header: fixture.header, partial: fixture.partial(1),
+			proof: ProofResponse{Challenge: proof.Challenge, Response: base64.StdEncoding.EncodeToString(tamperedResponse.Bytes())}},
+		{name: "partial of another share", params: fixture.params, header: fixture.header, partial: wrongShare, proof: proof},
+		{name: "random partial", params: fixture.params, header: fixture.header, partial: randomPartial, proof: proof},
+		{name: "proof of another share", params: fixture.params, header: fixture.header, partial: fixture.partial(1), proof: otherProof},
+		{name: "other header", params: fixture.params, header: pairing.NewG1().Rand(), partial: fixture.partial(1), proof: proof},
+		{name: "no verification key", params: withoutKey, header: fixture.header, partial: fixture.partial(1), proof: proof},
+		{name: "malformed challenge", params: fixture.params, header: fixture.header, partial: fixture.partial(1),
+			proof: ProofResponse{Challenge: "not base64", Response: proof.Response}},
+		{name: "missing proof", params: fixture.params, header: fixture.header, partial: fixture.partial(1)},
+	}
+
+	for _, test := range tests {
+		err := verifyPartialDecryption(test.params, test.header, test.partial, test.proof)
+		if test.valid && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: proof verified", test.name)
+		}
+	}
+}
+
+func TestMalformedProof(t *testing.T) {
+	fixture := newThresholdFixture(t, 2, 3)
+	proof := fixture.prove(1)
+	response, _ := base64.StdEncoding.DecodeString(proof.Response)
+
+	tests := []struct {
+		name  string
+		proof ProofResponse
+	}{
+		{name: "empty challenge", proof: ProofResponse{Response: proof.Response}},
+		{name: "empty response", proof: ProofResponse{Challenge: proof.Challenge}},
+		{name: "short response", proof: ProofResponse{Challenge: proof.Challenge, Response: base64.StdEncoding.EncodeToString(response[1:])}},
+		{name: "long challenge", proof: ProofResponse{Challenge: base64.StdEncoding.EncodeToString(append(response, 0)), Response: proof.Response}},
+	}
+
+	ds := newRobustService(3, 0)
+	for _, test := range tests {
+		if err := verifyPartialDecryption(fixture.params, fixture.header, fixture.partial(1), test.proof); !errors.Is(err, errMalformedProof) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, errMalformedProof)
+		}
+
+		// The node that sent it is reported with a malformed response
+		request := func(ctx context.Context, nodeUrl string) (*PartialDecryptResponse, error) {
+			return &PartialDecryptResponse{
+				PartialDecryption: base64.StdEncoding.EncodeToString(fixture.partial(1).Element.Bytes()),
+				Proof:             test.proof,
+				ShareID:           1,
+			}, nil
+		}
+		if _, class, err := ds.verifiedPartial(context.Background(), fixture.params, fixture.header, 1, ds.nodes[1], request); err == nil || class != ErrorClassMalformedResponse {
+			t.Errorf("%s: class %q and error %v", test.name, class, err)
+		}
+	}
+}
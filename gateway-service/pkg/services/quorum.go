@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// NodeOutcomeOK is a node whose partial was verified
+	NodeOutcomeOK = "ok"
+	// NodeOutcomeFailed is a node that gave no valid partial, its error class tells why
+	NodeOutcomeFailed = "failed"
+	// NodeOutcomeCancelled is a node still outstanding when the quorum was reached or could no longer be reached
+	NodeOutcomeCancelled = "cancelled"
+	// NodeOutcomeFaulty is a node the robust combiner caught with a wrong partial, it is excluded from the next rounds
+	NodeOutcomeFaulty = "faulty"
+	// NodeOutcomeExcluded is a node that was not asked because it was found faulty in an earlier round
+	NodeOutcomeExcluded = "excluded"
+)
+
+const (
+	// ErrorClassTimeout is a node that did not answer within the client timeout
+	ErrorClassTimeout = "timeout"
+	// ErrorClassUnreachable is a node the gateway could not connect to
+	ErrorClassUnreachable = "unreachable"
+	// ErrorClassInvalidCiphertext is a node that refused the ciphertext as invalid
+	ErrorClassInvalidCiphertext = "invalid_ciphertext"
+	// ErrorClassNodeError is a node that answered with an error status
+	ErrorClassNodeError = "node_error"
+	// ErrorClassMalformedResponse is a node whose answer could not be decoded
+	ErrorClassMalformedResponse = "malformed_response"
+	// ErrorClassShareMismatch is a node that answered with another share than the one it is configured for
+	ErrorClassShareMismatch = "share_mismatch"
+	// ErrorClassStaleEpoch is a node whose share is from another refresh epoch than the KMS reports
+	ErrorClassStaleEpoch = "stale_epoch"
+	// ErrorClassInvalidProof is a node whose partial failed its Chaum-Pedersen proof
+	ErrorClassInvalidProof = "invalid_proof"
+	// ErrorClassInconsistentPartial is a node whose partial does not lie on the polynomial of the other partials
+	ErrorClassInconsistentPartial = "inconsistent_partial"
+)
+
+// errNodeFailed marks a node that answered a partial request with an error status
+var errNodeFailed = errors.New("decryption node answered with an error")
+
+// NodeStatus is how one decryption node did in a threshold operation
+type NodeStatus struct {
+	ShareID   int    `json:"share_id"`
+	Node      string `json:"node"`
+	LatencyMs int64  `json:"latency_ms"`
+	Outcome   string `json:"outcome"`
+	Error     string `json:"error,omitempty"`
+}
+
+// QuorumError is returned when fewer than t decryption nodes gave a valid partial. It carries the status of every node
+// and wraps the first failure, so errors.Is still sees an invalid ciphertext reported by the nodes.
+type QuorumError struct {
+	Threshold int
+	Nodes     []NodeStatus
+	err       error
+}
+
+// Error lists the failed nodes with their error classes
+func (e *QuorumError) Error() string {
+	var failed []string
+	for _, node := range DegradedNodes(e.Nodes) {
+		reason := node.Error
+		if reason == "" {
+			reason = node.Outcome
+		}
+		failed = append(failed, fmt.Sprintf("share %d %s", node.ShareID, reason))
+	}
+	return fmt.Sprintf("%d of %d decryption nodes failed, need %d valid partials (%s): %v", len(failed), len(e.Nodes), e.Threshold, strings.Join(failed, ", "), e.err)
+}
+
+// Unwrap returns the first failure of a node
+func (e *QuorumError) Unwrap() error {
+	return e.err
+}
+
+// DegradedNodes returns the nodes of a report that failed, were found faulty or are excluded, the ones that keep a
+// quorum from being reached
+func DegradedNodes(nodes []NodeStatus) []NodeStatus {
+	var degraded []NodeStatus
+	for _, node := range nodes {
+		switch node.Outcome {
+		case NodeOutcomeFailed, NodeOutcomeFaulty, NodeOutcomeExcluded:
+			degraded = append(degraded, node)
+		}
+	}
+	return degraded
+}
+
+// FaultyShares returns the ids of the shares whose nodes were found faulty in a round
+func FaultyShares(nodes []NodeStatus) []int {
+	var shareIDs []int
+	for _, node := range nodes {
+		if node.Outcome == NodeOutcomeFaulty {
+			shareIDs = append(shareIDs, node.ShareID)
+		}
+	}
+	return shareIDs
+}
+
+// partialResult is the outcome of the request to one decryption node
+type partialResult struct {
+	shareID int
+	partial PartialDecryption
+	class   string
+	err     error
+	faulty  bool
+	latency time.Duration
+}
+
+// preferredError returns the error worth reporting for a round out of the one kept so far and the next one.
+// A rejected ciphertext is the caller's error, not the node's, so it takes precedence over the first error.
+func preferredError(kept, next error) error {
+	if kept == nil || errors.Is(next, ErrInvalidCiphertext) && !errors.Is(kept, ErrInvalidCiphertext) {
+		return next
+	}
+	return kept
+}
+
+// nodeReport builds the status of every node, in the order of the share ids, from the results received so far.
+// The nodes without a result were cancelled, the excluded ones were not asked at all.
+func (ds *dsService) nodeReport(shareIDs, excluded []int, results []partialResult, started time.Time) []NodeStatus {
+	received := make(map[int]partialResult, len(results))
+	for _, result := range results {
+		received[result.shareID] = result
+	}
+	isExcluded := make(map[int]bool, len(excluded))
+	for _, shareID := range excluded {
+		isExcluded[shareID] = true
+	}
+
+	allShareIDs := append(append([]int{}, shareIDs...), excluded...)
+	sort.Ints(allShareIDs)
+
+	nodes := make([]NodeStatus, 0, len(allShareIDs))
+	for _, shareID := range allShareIDs {
+		status := NodeStatus{ShareID: shareID, Node: ds.nodes[shareID]}
+		result, ok := received[shareID]
+		switch {
+		case isExcluded[shareID]:
+			status.Outcome = NodeOutcomeExcluded
+		case !ok:
+			status.Outcome = NodeOutcomeCancelled
+			status.LatencyMs = time.Since(started).Milliseconds()
+		case result.faulty:
+			status.Outcome = NodeOutcomeFaulty
+			status.Error = result.class
+			status.LatencyMs = result.latency.Milliseconds()
+		case result.err != nil:
+			status.Outcome = NodeOutcomeFailed
+			status.Error = result.class
+			status.LatencyMs = result.latency.Milliseconds()
+		default:
+			status.Outcome = NodeOutcomeOK
+			status.LatencyMs = result.latency.Milliseconds()
+		}
+		nodes = append(nodes, status)
+	}
+	return nodes
+}
+
+// requestErrorClass classifies the error of a partial request that got no usable answer from a node
+func requestErrorClass(err error) string {
+	if errors.Is(err, ErrInvalidCiphertext) {
+		return ErrorClassInvalidCiphertext
+	}
+	if errors.Is(err, errNodeFailed) {
+		return ErrorClassNodeError
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTimeout
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return ErrorClassUnreachable
+	}
+	return ErrorClassMalformedResponse
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"fmt"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/group"
+	"github.com/pkg/errors"
+	"sort"
+	"time"
+)
+
+// maxRobustSubsets bounds the threshold subsets the robust combiner tries, C(n, t) grows quickly with many nodes
+const maxRobustSubsets = 10000
+
+// collectRobust waits for every node, since the partials beyond the threshold are what tells faulty partials apart,
+// and combines the candidates robustly. Nodes with a failed or missing proof or a partial off the polynomial of the others
+// are reported as faulty and excluded from the following rounds of the key version.
+func (ds *dsService) collectRobust(params PublicParams, element group.Element, shareIDs, excluded []int, resultChan <-chan partialResult, started time.Time) (group.Element, []NodeStatus, error) {
+	var results []partialResult
+	var candidates []PartialDecryption
+	var firstErr error
+	for range shareIDs {
+		result := <-resultChan
+		if result.err == nil {
+			candidates = append(candidates, result.partial)
+		} else {
+			// A partial whose proof fails or is missing was computed with a wrong share or tampered with, either way the
+			// node is faulty
+			result.faulty = result.class == ErrorClassInvalidProof
+			firstErr = preferredError(firstErr, result.err)
+		}
+		results = append(results, result)
+	}
+
+	var combined group.Element
+	var inconsistent []int
+	var err error
+	if len(candidates) < params.Threshold {
+		err = firstErr
+	} else {
+		combined, inconsistent, err = combineRobust(params, element, candidates, maxRobustSubsets)
+	}
+
+	faulty := make(map[int]bool, len(inconsistent))
+	for _, shareID := range inconsistent {
+		faulty[shareID] = true
+	}
+	var faultyIDs []int
+	for i := range results {
+		if faulty[results[i].shareID] {
+			results[i].faulty = true
+			results[i].class = ErrorClassInconsistentPartial
+			results[i].err = fmt.Errorf("partial of share %d does not lie on the polynomial of the other partials", results[i].shareID)
+		}
+		if results[i].faulty {
+			faultyIDs = append(faultyIDs, results[i].shareID)
+		}
+	}
+	ds.exclude(params, faultyIDs)
+
+	nodes := ds.nodeReport(shareIDs, excluded, results, started)
+	if err != nil {
+		return nil, nodes, &QuorumError{Threshold: params.Threshold, Nodes: nodes, err: err}
+	}
+	return combined, nodes, nil
+}
+
+// combineRobust combines partials without trusting any single one of them. It looks for a threshold subset whose
+// combination passes the check value e(element^s, g) = e(element, pk), and checks every other partial against the
+// polynomial that subset interpolates in the exponent. The subset most partials agree with wins and the partials off its
+// polynomial are returned as inconsistent. As long as fewer than half of the partials beyond the threshold are wrong,
+// the honest partials outnumber anything the wrong ones can agree on. At most maxSubsets subsets are tried.
+func combineRobust(params PublicParams, element group.Element, partials []PartialDecryption, maxSubsets int) (group.Element, []int, error) {
+	pairing := params.Pairing
+	threshold := params.Threshold
+	if threshold < 1 {
+		return nil, nil, errors.New("threshold must be greater than 0")
+	}
+	if len(partials) < threshold {
+		return nil, nil, fmt.Errorf("got %d partial decryptions, need %d", len(partials), threshold)
+	}
+
+	sorted := make([]PartialDecryption, len(partials))
+	copy(sorted, partials)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ShareID < sorted[j].ShareID })
+
+	checkValue := pairing.NewGT().Pair(element, params.PublicKey)
+
+	var best group.Element
+	var bestConsistent map[int]bool
+	tried := 0
+	for subset := firstSubset(threshold); subset != nil; subset = nextSubset(subset, len(sorted)) {
+		if tried++; tried > maxSubsets {
+			break
+		}
+
+		selected := make([]PartialDecryption, threshold)
+		for i, index := range subset {
+			selected[i] = sorted[index]
+		}
+
+		combined, err := interpolateAt(pairing, selected, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !pairing.NewGT().Pair(combined, params.Generator).Equals(checkValue) {
+			continue
+		}
+
+		consistent, err := consistentPartials(pairing, selected, sorted)
+		if err != nil {
+			return nil, nil, err
+		}
+		if best == nil || len(consistent) > len(bestConsistent) {
+			best, bestConsistent = combined, consistent
+		}
+		if len(consistent) == len(sorted) {
+			break
+		}
+	}
+
+	if best == nil {
+		if len(sorted) == threshold {
+			return nil, nil, fmt.Errorf("the %d partials do not combine to a valid result and there is no spare partial to find the wrong one", threshold)
+		}
+		if tried > maxSubsets {
+			return nil, nil, fmt.Errorf("none of the first %d subsets of %d of the %d partials combine to a valid result", maxSubsets, threshold, len(sorted))
+		}
+		return nil, nil, fmt.Errorf("no %d of the %d partials combine to a valid result", threshold, len(sorted))
+	}
+
+	var inconsistent []int
+	for _, partial := range sorted {
+		if !bestConsistent[partial.ShareID] {
+			inconsistent = append(inconsistent, partial.ShareID)
+		}
+	}
+	return best, inconsistent, nil
+}
+
+// consistentPartials returns the share ids of the partials that lie on the polynomial the selected partials interpolate
+func consistentPartials(pairing group.Pairing, selected, partials []PartialDecryption) (map[int]bool, error) {
+	consistent := make(map[int]bool, len(partials))
+	for _, partial := range selected {
+		consistent[partial.ShareID] = true
+	}
+
+	for _, partial := range partials {
+		if consistent[partial.ShareID] {
+			continue
+		}
+		expected, err := interpolateAt(pairing, selected, partial.ShareID)
+		if err != nil {
+			return nil, err
+		}
+		if expected.Equals(partial.Element) {
+			consistent[partial.ShareID] = true
+		}
+	}
+	return consistent, nil
+}
+
+// firstSubset returns the indices of the first subset of the given size in lexicographic order
+func firstSubset(size int) []int {
+	subset := make([]int, size)
+	for i := range subset {
+		subset[i] = i
+	}
+	return subset
+}
+
+// nextSubset advances the indices to the next subset of n elements in lexicographic order, nil after the last one
+func nextSubset(subset []int, n int) []int {
+	k := len(subset)
+	for i := k - 1; i >= 0; i-- {
+		if subset[i] < n-k+i {
+			subset[i]++
+			for j := i + 1; j < k; j++ {
+				subset[j] = subset[j-1] + 1
+			}
+			return subset
+		}
+	}
+	return nil
+}
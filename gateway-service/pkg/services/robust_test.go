@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/group"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// corrupt replaces the partials of the given shares with random elements, as a node with a wrong share would send
+func (f thresholdFixture) corrupt(partials []PartialDecryption, shareIDs ...int) {
+	for i := range partials {
+		for _, shareID := range shareIDs {
+			if partials[i].ShareID == shareID {
+				partials[i].Element = f.params.Pairing.NewG1().Rand()
+			}
+		}
+	}
+}
+
+func TestCombineRobust(t *testing.T) {
+	tests := []struct {
+		threshold int
+		n         int
+		corrupted []int
+	}{
+		{threshold: 2, n: 3},
+		{threshold: 2, n: 4, corrupted: []int{3}},
+		{threshold: 3, n: 5, corrupted: []int{1}},
+		{threshold: 2, n: 5, corrupted: []int{1, 4}},
+		{threshold: 1, n: 3, corrupted: []int{2}},
+	}
+
+	for _, test := range tests {
+		fixture := newThresholdFixture(t, test.threshold, test.n)
+		partials := fixture.partials(sequence(test.n)...)
+		fixture.corrupt(partials, test.corrupted...)
+
+		combined, inconsistent, err := combineRobust(fixture.params, fixture.header, partials, maxRobustSubsets)
+		if err != nil {
+			t.Fatalf("%d of %d with %v corrupted: %v", test.threshold, test.n, test.corrupted, err)
+		}
+		if !combined.Equals(fixture.decrypted()) {
+			t.Errorf("%d of %d with %v corrupted: combined partials differ from U^s", test.threshold, test.n, test.corrupted)
+		}
+		if !reflect.DeepEqual(inconsistent, test.corrupted) {
+			t.Errorf("%d of %d: inconsistent shares = %v, want %v", test.threshold, test.n, inconsistent, test.corrupted)
+		}
+	}
+}
+
+func TestCombineRobustWithoutSparePartials(t *testing.T) {
+	fixture := newThresholdFixture(t, 3, 3)
+	partials := fixture.partials(1, 2, 3)
+	fixture.corrupt(partials, 2)
+
+	if _, _, err := combineRobust(fixture.params, fixture.header, partials, maxRobustSubsets); err == nil {
+		t.Fatal("combined a corrupted partial without a spare one")
+	}
+}
+
+func TestCombineRobustSubsetCap(t *testing.T) {
+	fixture := newThresholdFixture(t, 2, 5)
+	partials := fixture.partials(1, 2, 3, 4, 5)
+	fixture.corrupt(partials, 1)
+
+	// The first four subsets in lexicographic order all contain share 1, the fifth is {2, 3}
+	if _, _, err := combineRobust(fixture.params, fixture.header, partials, 4); err == nil {
+		t.Fatal("found a valid subset beyond the cap")
+	}
+
+	combined, inconsistent, err := combineRobust(fixture.params, fixture.header, partials, 5)
+	if err != nil {
+		t.Fatalf("combineRobust: %v", err)
+	}
+	if !combined.Equals(fixture.decrypted()) || !reflect.DeepEqual(inconsistent, []int{1}) {
+		t.Errorf("combineRobust = inconsistent shares %v, want [1]", inconsistent)
+	}
+}
+
+func TestNextSubset(t *testing.T) {
+	var got [][]int
+	for subset := firstSubset(2); subset != nil; subset = nextSubset(subset, 4) {
+		got = append(got, append([]int(nil), subset...))
+	}
+	want := [][]int{{0, 1}, {0, 2}, {0, 3}, {1, 2}, {1, 3}, {2, 3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("subsets = %v, want %v", got, want)
+	}
+}
+
+// nodeBehaviour is how a fake decryption node answers a partial request
+type nodeBehaviour int
+
+const (
+	honestNode nodeBehaviour = iota
+	corruptNode
+	prooflessNode
+	// unreachableNode fails the request like a node that refuses the connection
+	unreachableNode
+	// blockingNode answers only once the request is cancelled, like a node slower than the rest of the quorum
+	blockingNode
+)
+
+// newRobustService returns a gateway in robust mode with a node per share, see fakeNodes for how they answer
+func newRobustService(n int, period time.Duration) *dsService {
+	nodes := make(map[int]string, n)
+	for _, shareID := range sequence(n) {
+		nodes[shareID] = fmt.Sprintf("http://ds-%d:9002", shareID)
+	}
+	return &dsService{
+		nodes:    nodes,
+		combine:  CombineOptions{Robust: true, ExclusionPeriod: period},
+		excluded: make(map[exclusionKey]time.Time),
+	}
+}
+
+// fakeNodes answers partial requests for the fixture's header the way the node of each share behaves
+func fakeNodes(fixture thresholdFixture, behaviour map[int]nodeBehaviour) func(ctx context.Context, nodeUrl string) (*PartialDecryptResponse, error) {
+	return func(ctx context.Context, nodeUrl string) (*PartialDecryptResponse, error) {
+		var shareID int
+		if _, err := fmt.Sscanf(nodeUrl, "http://ds-%d:9002", &shareID); err != nil {
+			return nil, err
+		}
+
+		partial := fixture.partial(shareID).Element
+		proof := fixture.prove(shareID)
+		switch behaviour[shareID] {
+		case unreachableNode:
+			return nil, &url.Error{Op: "Post", URL: nodeUrl, Err: errors.New("connection refused")}
+		case blockingNode:
+			<-ctx.Done()
+			return nil, ctx.Err()
+		case corruptNode:
+			partial = fixture.params.Pairing.NewG1().Rand()
+		case prooflessNode:
+			proof = ProofResponse{}
+		}
+		return &PartialDecryptResponse{
+			PartialDecryption: base64.StdEncoding.EncodeToString(partial.Bytes()),
+			Proof:             proof,
+			ShareID:           shareID,
+		}, nil
+	}
+}
+
+func TestRobustExclusion(t *testing.T) {
+	fixture := newThresholdFixture(t, 2, 5)
+	ds := newRobustService(5, time.Minute)
+	request := fakeNodes(fixture, map[int]nodeBehaviour{2: corruptNode, 4: prooflessNode})
+
+	combined, nodes, err := ds.combineShares(fixture.params, fixture.header, request)
+	if err != nil {
+		t.Fatalf("combineShares: %v", err)
+	}
+	if !combined.Equals(fixture.decrypted()) {
+		t.Error("combined partials differ from U^s")
+	}
+	if faulty := FaultyShares(nodes); !reflect.DeepEqual(faulty, []int{2, 4}) {
+		t.Errorf("faulty shares = %v, want [2 4]", faulty)
+	}
+
+	// The faulty nodes are excluded from the next round of the same key version
+	shareIDs, excluded, err := ds.nodesFor(fixture.params)
+	if err != nil {
+		t.Fatalf("nodesFor: %v", err)
+	}
+	if !reflect.DeepEqual(shareIDs, []int{1, 3, 5}) || !reflect.DeepEqual(excluded, []int{2, 4}) {
+		t.Errorf("nodesFor = %v asked and %v excluded, want [1 3 5] and [2 4]", shareIDs, excluded)
+	}
+	_, nodes, err = ds.combineShares(fixture.params, fixture.header, request)
+	if err != nil {
+		t.Fatalf("combineShares: %v", err)
+	}
+	for _, node := range nodes {
+		if (node.ShareID == 2 || node.ShareID == 4) != (node.Outcome == NodeOutcomeExcluded) {
+			t.Errorf("share %d: outcome %s", node.ShareID, node.Outcome)
+		}
+	}
+
+	// Other versions and other keys still ask them
+	for _, params := range []PublicParams{
+		func() PublicParams { params := fixture.params; params.Version = 2; return params }(),
+		func() PublicParams { params := fixture.params; params.KeyID = "payments"; return params }(),
+	} {
+		shareIDs, excluded, err := ds.nodesFor(params)
+		if err != nil {
+			t.Fatalf("nodesFor: %v", err)
+		}
+		if len(shareIDs) != 5 || len(excluded) != 0 {
+			t.Errorf("%s version %d: %v asked and %v excluded, want every node asked", params.KeyID, params.Version, shareIDs, excluded)
+		}
+	}
+}
+
+func TestExclusionFloor(t *testing.T) {
+	fixture := newThresholdFixture(t, 3, 4)
+	ds := newRobustService(4, time.Minute)
+
+	ds.exclude(fixture.params, []int{2})
+	time.Sleep(time.Millisecond)
+	ds.exclude(fixture.params, []int{4})
+
+	// Only two nodes would be left, so the node excluded the longest is asked again
+	shareIDs, excluded, err := ds.nodesFor(fixture.params)
+	if err != nil {
+		t.Fatalf("nodesFor: %v", err)
+	}
+	if !reflect.DeepEqual(shareIDs, []int{1, 2, 3}) || !reflect.DeepEqual(excluded, []int{4}) {
+		t.Errorf("nodesFor = %v asked and %v excluded, want [1 2 3] and [4]", shareIDs, excluded)
+	}
+}
+
+func TestExclusionPeriod(t *testing.T) {
+	fixture := newThresholdFixture(t, 2, 3)
+
+	expiring := newRobustService(3, 20*time.Millisecond)
+	expiring.exclude(fixture.params, []int{1})
+	if _, excluded, _ := expiring.nodesFor(fixture.params); !reflect.DeepEqual(excluded, []int{1}) {
+		t.Fatalf("excluded = %v, want [1]", excluded)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, excluded, _ := expiring.nodesFor(fixture.params); len(excluded) != 0 {
+		t.Errorf("excluded = %v after the exclusion period", excluded)
+	}
+
+	// A period of 0 turns exclusion off instead of excluding for good
+	disabled := newRobustService(3, 0)
+	disabled.exclude(fixture.params, []int{1})
+	if _, excluded, _ := disabled.nodesFor(fixture.params); len(excluded) != 0 {
+		t.Errorf("excluded = %v with exclusion turned off", excluded)
+	}
+}
+
+func TestMissingProofRejected(t *testing.T) {
+	fixture := newThresholdFixture(t, 2, 3)
+
+	for _, robust := range []bool{false, true} {
+		ds := newRobustService(3, time.Minute)
+		ds.combine.Robust = robust
+		request := fakeNodes(fixture, map[int]nodeBehaviour{1: prooflessNode})
+
+		_, class, err := ds.verifiedPartial(context.Background(), fixture.params, fixture.header, 1, ds.nodes[1], request)
+		if err == nil || class != ErrorClassInvalidProof {
+			t.Errorf("robust %v: partial without a proof gave class %q and error %v", robust, class, err)
+		}
+	}
+}
+
+// combineWithin runs combineShares and fails the test if it does not return within a second, as a combiner that waits
+// for a blocking node would
+func combineWithin(t *testing.T, ds *dsService, fixture thresholdFixture, request func(ctx context.Context, nodeUrl string) (*PartialDecryptResponse, error)) (group.Element, []NodeStatus, error) {
+	t.Helper()
+
+	type combination struct {
+		combined group.Element
+		nodes    []NodeStatus
+		err      error
+	}
+	done := make(chan combination, 1)
+	go func() {
+		combined, nodes, err := ds.combineShares(fixture.params, fixture.header, request)
+		done <- combination{combined, nodes, err}
+	}()
+	select {
+	case result := <-done:
+		return result.combined, result.nodes, result.err
+	case <-time.After(time.Second):
+		t.Fatal("combineShares is still waiting for the blocking nodes")
+		return nil, nil, nil
+	}
+}
+
+// outcomes returns the outcome of every node by share id
+func outcomes(nodes []NodeStatus) map[int]string {
+	outcomes := make(map[int]string, len(nodes))
+	for _, node := range nodes {
+		outcomes[node.ShareID] = node.Outcome
+	}
+	return outcomes
+}
+
+func TestCombineCompletesAtThreshold(t *testing.T) {
+	fixture := newThresholdFixture(t, 2, 4)
+	ds := newRobustService(4, time.Minute)
+	ds.combine.Robust = false
+
+	// The quorum is complete at the second verified partial, the slower nodes are cancelled instead of waited for
+	combined, nodes, err := combineWithin(t, ds, fixture, fakeNodes(fixture, map[int]nodeBehaviour{3: blockingNode, 4: blockingNode}))
+	if err != nil {
+		t.Fatalf("combineShares: %v", err)
+	}
+	if !combined.Equals(fixture.decrypted()) {
+		t.Error("combined partials differ from U^s")
+	}
+	want := map[int]string{1: NodeOutcomeOK, 2: NodeOutcomeOK, 3: NodeOutcomeCancelled, 4: NodeOutcomeCancelled}
+	if got := outcomes(nodes); !reflect.DeepEqual(got, want) {
+		t.Errorf("outcomes = %v, want %v", got, want)
+	}
+
+	// A partial that does not verify does not count towards the quorum
+	combined, nodes, err = combineWithin(t, ds, fixture, fakeNodes(fixture, map[int]nodeBehaviour{1: corruptNode, 4: blockingNode}))
+	if err != nil {
+		t.Fatalf("combineShares with a corrupt node: %v", err)
+	}
+	if !combined.Equals(fixture.decrypted()) {
+		t.Error("combined partials with a corrupt node differ from U^s")
+	}
+	got := outcomes(nodes)
+	if got[2] != NodeOutcomeOK || got[3] != NodeOutcomeOK || got[4] != NodeOutcomeCancelled {
+		t.Errorf("outcomes = %v, want shares 2 and 3 ok and share 4 cancelled", got)
+	}
+	if got[1] == NodeOutcomeOK {
+		t.Error("the corrupt partial of share 1 was counted")
+	}
+}
+
+func TestCombineFailsWithoutQuorum(t *testing.T) {
+	fixture := newThresholdFixture(t, 3, 5)
+	ds := newRobustService(5, time.Minute)
+	ds.combine.Robust = false
+
+	// Two failures leave exactly t nodes, enough for the quorum
+	combined, _, err := combineWithin(t, ds, fixture, fakeNodes(fixture, map[int]nodeBehaviour{1: unreachableNode, 2: corruptNode}))
+	if err != nil {
+		t.Fatalf("combineShares with two failed nodes: %v", err)
+	}
+	if !combined.Equals(fixture.decrypted()) {
+		t.Error("combined partials differ from U^s")
+	}
+
+	// The third failure leaves fewer than t nodes, so the combiner gives up without waiting for the blocking ones
+	_, nodes, err := combineWithin(t, ds, fixture, fakeNodes(fixture, map[int]nodeBehaviour{1: unreachableNode, 2: corruptNode, 3: prooflessNode, 4: blockingNode, 5: blockingNode}))
+	var quorumErr *QuorumError
+	if !errors.As(err, &quorumErr) {
+		t.Fatalf("combineShares: %v, want a QuorumError", err)
+	}
+	if quorumErr.Threshold != 3 || !strings.Contains(err.Error(), "3 of 5 decryption nodes failed, need 3 valid partials") {
+		t.Errorf("QuorumError threshold %d: %v", quorumErr.Threshold, err)
+	}
+	want := map[int]string{1: NodeOutcomeFailed, 2: NodeOutcomeFailed, 3: NodeOutcomeFailed, 4: NodeOutcomeCancelled, 5: NodeOutcomeCancelled}
+	if got := outcomes(nodes); !reflect.DeepEqual(got, want) {
+		t.Errorf("outcomes = %v, want %v", got, want)
+	}
+	for _, node := range nodes {
+		if node.ShareID == 1 && node.Error != ErrorClassUnreachable {
+			t.Errorf("share 1: error class %q, want %q", node.Error, ErrorClassUnreachable)
+		}
+	}
+}
+
+// sequence returns 1..n
+func sequence(n int) []int {
+	ids := make([]int, n)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	return ids
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/mdshahjahanmiah/gateway-service/pkg/group"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+// signatureDomain separates the hash of signed messages from identities.
+// It must match the decryption nodes, otherwise the proofs of their partial signatures do not verify.
+const signatureDomain = "threshold-bls:"
+
+// SignRequest is a message to sign under the latest version of a key, the default key of the KMS if the key id is empty.
+// The token is not part of the payload, it is the bearer token the caller authenticated with.
+type SignRequest struct {
+	KeyID   string `json:"key_id,omitempty"`
+	Message string `json:"message"`
+	Token   string `json:"-"`
+}
+
+// SignatureResponse is a BLS signature H(m)^s and the key version whose public key verifies it
+type SignatureResponse struct {
+	KeyID     string `json:"key_id"`
+	Version   int    `json:"version"`
+	Signature string `json:"signature"`
+}
+
+// VerifyRequest is a message and its signature, checked against the public key of the given key version
+type VerifyRequest struct {
+	KeyID     string `json:"key_id,omitempty"`
+	Version   int    `json:"version,omitempty"`
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+// VerifyResponse tells whether the signature is valid
+type VerifyResponse struct {
+	Valid bool `json:"valid"`
+}
+
+// PartialSignRequest is the payload sent to a decryption node for a partial signature under a key version
+type PartialSignRequest struct {
+	KeyID   string `json:"key_id"`
+	Version int    `json:"version"`
+	Message string `json:"message"`
+}
+
+// PartialSignResponse is a partial signature H(m)^{s_i} with the proof that share i computed it
+type PartialSignResponse struct {
+	PartialSignature string        `json:"partial_signature"`
+	Proof            ProofResponse `json:"proof"`
+	ShareID          int           `json:"share_id"`
+	Epoch            int           `json:"epoch"`
+}
+
+// hashMessage maps a message to H(m) in G1
+func hashMessage(pairing group.Pairing, message string) group.Element {
+	return pairing.NewG1().SetFromStringHash(signatureDomain+message, sha256.New())
+}
+
+// verifySignature checks the BLS equation e(sigma, g) = e(H(m), pk)
+func verifySignature(params PublicParams, message string, signature group.Element) bool {
+	left := params.Pairing.NewGT().Pair(signature, params.Generator)
+	right := params.Pairing.NewGT().Pair(hashMessage(params.Pairing, message), params.PublicKey)
+	return left.Equals(right)
+}
+
+// Sign combines t partial signatures of the decryption nodes into the BLS signature H(m)^s under the latest version of
+// the key, once the signing policy has authorized the caller for the key's tenant. No node ever holds s, and the
+// combined signature is checked against the public key before it is returned.
+func (ds *dsService) Sign(request SignRequest) (SignatureResponse, error) {
+	params, err := ds.keyMaterial(request.KeyID, 0)
+	if err != nil {
+		return SignatureResponse{}, err
+	}
+	if err := ds.signingPolicy.Authorize(request.Token, params.Tenant, params.KeyID); err != nil {
+		return SignatureResponse{}, err
+	}
+	message := request.Message
+
+	signature, _, err := ds.combineShares(params, hashMessage(params.Pairing, message), func(ctx context.Context, nodeUrl string) (*PartialDecryptResponse, error) {
+		return ds.sendPartialSignRequest(ctx, nodeUrl, PartialSignRequest{
+			KeyID:   params.KeyID,
+			Version: params.Version,
+			Message: message,
+		})
+	})
+	if err != nil {
+		return SignatureResponse{}, err
+	}
+
+	if !verifySignature(params, message, signature) {
+		return SignatureResponse{}, errors.New("combined signature does not verify against the public key")
+	}
+
+	return SignatureResponse{
+		KeyID:     params.KeyID,
+		Version:   params.Version,
+		Signature: base64.StdEncoding.EncodeToString(signature.Bytes()),
+	}, nil
+}
+
+// Verify checks a BLS signature against the public key of the given key version, version 0 is the latest
+func (ds *dsService) Verify(request VerifyRequest) (bool, error) {
+	params, err := ds.keyMaterial(request.KeyID, request.Version)
+	if err != nil {
+		return false, err
+	}
+
+	signatureBytes, err := base64.StdEncoding.DecodeString(request.Signature)
+	if err != nil {
+		return false, errors.Wrap(err, "decoding signature")
+	}
+	if len(signatureBytes) != int(params.Pairing.G1Length()) {
+		return false, nil
+	}
+
+	signature := params.Pairing.NewG1().SetBytes(signatureBytes)
+	if signature.Is0() {
+		return false, nil
+	}
+	return verifySignature(params, request.Message, signature), nil
+}
+
+// sendPartialSignRequest sends a partial sign request to a decryption node.
+// The partial signature is returned as a partial decryption, both are checked and combined the same way.
+func (ds *dsService) sendPartialSignRequest(ctx context.Context, nodeUrl string, req PartialSignRequest) (*PartialDecryptResponse, error) {
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ds.client.PostContext(ctx, nodeUrl+"/partial-sign", "application/json", bytes.NewBuffer(reqBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(errNodeFailed, "failed to get partial signature: status %d", resp.StatusCode)
+	}
+
+	var partialResp PartialSignResponse
+	if err := json.NewDecoder(resp.Body).Decode(&partialResp); err != nil {
+		return nil, err
+	}
+
+	return &PartialDecryptResponse{
+		PartialDecryption: partialResp.PartialSignature,
+		Proof:             partialResp.Proof,
+		ShareID:           partialResp.ShareID,
+		Epoch:             partialResp.Epoch,
+	}, nil
+}
@@ -0,0 +1,106 @@
+// Command keygen generates pairing parameters, a key and its shares offline, e.g. on an air-gapped machine or for
+// test fixtures. The KMS loads the key file with -key.file, each decryption node gets its own share file and every
+// node can load the pairing parameters with -pairing.params.file.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/keymanager"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// shareFile is the share of one decryption node, with the key and version it belongs to
+type shareFile struct {
+	KeyID   string `json:"key_id"`
+	ID      int    `json:"id"`
+	Share   string `json:"share"`
+	Version int    `json:"version"`
+	Epoch   int    `json:"epoch"`
+}
+
+func main() {
+	if err := run(); err != nil {
+		slog.Error("key generation failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+
+	out := fs.String("out", "keys", "directory the pairing parameters, the key file and the share files are written to")
+	keyID := fs.String("key.id", "default", "the id of the key, the KMS must be started with the same -key.id")
+	keyTenant := fs.String("key.tenant", "default", "the tenant owning the key")
+	securityLevel := fs.String("security.level", "medium", "the security level to use for the pairing parameters. Possible values are 'low', 'medium', 'high'")
+	pairingType := fs.String("pairing.type", "a", "the type of pairing. Possible values are 'a', 'd', 'f' and 'bls12-381'")
+	pairingParamsFile := fs.String("pairing.params.file", "", "reuse the plain pairing parameters in this file instead of generating new ones")
+
+	thresholdConfig := config.ThresholdConfig{Enabled: true}
+	fs.IntVar(&thresholdConfig.Threshold, "thresholdconfig.threshold", 4, "the threshold number of shares required to decrypt")
+	fs.IntVar(&thresholdConfig.TotalShares, "thresholdconfig.shares", 5, "the total number of shares to generate, one per decryption node")
+
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return err
+	}
+
+	spec := keymanager.KeySpec{
+		KeyID:           *keyID,
+		Tenant:          *keyTenant,
+		SecurityLevel:   *securityLevel,
+		PairingType:     *pairingType,
+		ThresholdConfig: thresholdConfig,
+	}
+	if *pairingParamsFile != "" {
+		params, err := keymanager.ReadPairingParams(*pairingParamsFile)
+		if err != nil {
+			return err
+		}
+		spec.PairingParams = params
+	} else if !keymanager.ValidPairingType(spec.PairingType) {
+		return fmt.Errorf("unknown pairing type %q", spec.PairingType)
+	}
+
+	logger, err := logging.NewLogger(logging.LoggerConfig{CommandHandler: "text", LogLevel: "info"})
+	if err != nil {
+		return err
+	}
+
+	key, err := keymanager.GenerateOfflineKey(spec, logger)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*out, 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(*out, "pairing.param"), []byte(key.PairingParams), 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(*out, spec.KeyID+".key.json"), key.KeyFile, 0o600); err != nil {
+		return err
+	}
+	for _, share := range key.Shares {
+		data, err := json.MarshalIndent(shareFile{
+			KeyID:   spec.KeyID,
+			ID:      share.ID,
+			Share:   share.Share,
+			Version: share.Version,
+			Epoch:   share.Epoch,
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(*out, fmt.Sprintf("share-%d.json", share.ID)), data, 0o600); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("key generated", "key_id", spec.KeyID, "shares", len(key.Shares), "out", *out)
+	return nil
+}
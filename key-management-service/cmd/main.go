@@ -1,11 +1,16 @@
 package main
 
 import (
+	"errors"
 	"github.com/mdshahjahanmiah/explore-go/di"
 	eHttp "github.com/mdshahjahanmiah/explore-go/http"
 	"github.com/mdshahjahanmiah/explore-go/logging"
 	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/dkg"
 	"github.com/mdshahjahanmiah/key-management-service/pkg/keymanager"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/keystore"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/refresh"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/seal"
 	"go.uber.org/dig"
 	"log/slog"
 )
@@ -38,17 +43,96 @@ func main() {
 		}
 	})
 
-	c.Provide(func(config config.Config, logger *logging.Logger) (keymanager.KeyManagementService, error) {
-		kms, err := keymanager.NewKeyManagementService(config, logger)
-		if err != nil {
-			logger.Error("initializing key manager service", "err", err)
-			return nil, err
+	// With sealed startup the keyring is only loaded once operators unseal the KMS, until then every key route is refused
+	c.Invoke(func(conf config.Config) {
+		if conf.SealConfig.Enabled {
+			c.Provide(func(config config.Config, logger *logging.Logger) (seal.Service, error) {
+				service, err := seal.NewService(config, logger)
+				if err != nil {
+					logger.Error("initializing seal", "err", err)
+					return nil, err
+				}
+				return service, nil
+			})
+			c.Provide(func(service seal.Service) keymanager.Keyring { return service })
+			c.Provide(seal.MakeHandler, dig.Group("endpoint"))
+			return
 		}
-		return kms, nil
+
+		c.Provide(func(config config.Config, logger *logging.Logger) (keymanager.Keyring, error) {
+			// Without a keystore path the keys live in memory only and a restart generates new ones
+			var store keystore.Keystore
+			if config.KeystoreConfig.Path != "" {
+				var err error
+				store, err = keystore.NewKeystore(config.KeystoreConfig.Path, config.KeystoreConfig.Passphrase)
+				if err != nil {
+					logger.Error("initializing keystore", "err", err)
+					return nil, err
+				}
+			} else {
+				logger.Warn("no keystore configured, keys are lost on restart")
+			}
+
+			keyring, err := keymanager.NewKeyring(config, store, logger)
+			if err != nil {
+				logger.Error("initializing keyring", "err", err)
+				return nil, err
+			}
+			return keyring, nil
+		})
+	})
+
+	// The DKG coordinator endpoints only exist when the decryption nodes generate the default key themselves.
+	// Scheduled refreshes re-randomize the shares held by the KMS and, in DKG mode, open a refresh session among the nodes.
+	c.Invoke(func(conf config.Config) {
+		if !conf.IsDistributedKeygen() {
+			c.Provide(func(config config.Config, logger *logging.Logger, keyring keymanager.Keyring) di.StartCloser {
+				return refresh.NewScheduler(config.RefreshInterval, keyring.RefreshShares, logger)
+			}, dig.Group("startclose"))
+			return
+		}
+
+		c.Provide(func(config config.Config, logger *logging.Logger, keyring keymanager.Keyring) (dkg.Coordinator, error) {
+			kms := keyring.Default()
+			coordinator, err := dkg.NewCoordinator(config, kms.GetPairing(), kms.GetGenerator(), kms, logger)
+			if err != nil {
+				logger.Error("initializing dkg coordinator", "err", err)
+				return nil, err
+			}
+
+			// A key loaded from the keystore was generated before the restart, there is nothing left to coordinate
+			if keyVersion, err := kms.GetKeyVersion(0); err == nil {
+				if err := coordinator.Resume(keyVersion.Epoch, len(keyVersion.VerificationKeys), keyVersion.Commitments); err != nil {
+					logger.Error("resuming dkg coordinator", "err", err)
+					return nil, err
+				}
+			}
+			return coordinator, nil
+		})
+
+		c.Provide(dkg.MakeHandler, dig.Group("endpoint"))
+
+		c.Provide(func(config config.Config, logger *logging.Logger, keyring keymanager.Keyring, coordinator dkg.Coordinator) di.StartCloser {
+			return refresh.NewScheduler(config.RefreshInterval, func() error {
+				return errors.Join(coordinator.StartRefresh(), keyring.RefreshShares())
+			}, logger)
+		}, dig.Group("startclose"))
 	})
 
 	c.ProvideMonitoringEndpoints("endpoint")
 
+	// Without tokens the routes that need them refuse every request, the KMS still serves the public key material
+	c.Invoke(func(conf config.Config, logger *logging.Logger) {
+		if len(conf.AuthConfig.NodeTokens) == 0 && conf.IsDistributedKeygen() {
+			logger.Warn("no node tokens in " + config.NodeTokensEnv + ", no decryption node can take part in the distributed key generation")
+		} else if len(conf.AuthConfig.NodeTokens) == 0 {
+			logger.Warn("no node tokens in " + config.NodeTokensEnv + ", key shares are only delivered as share files")
+		}
+		if len(conf.AuthConfig.AdminTokens) == 0 {
+			logger.Warn("no admin tokens in " + config.AdminTokensEnv + ", the keyring admin API refuses every request")
+		}
+	})
+
 	c.Provide(keymanager.MakeHandler, dig.Group("endpoint"))
 
 	c.Invoke(func(in struct {
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	kithttp "github.com/go-kit/kit/transport/http"
+	eError "github.com/mdshahjahanmiah/explore-go/error"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrUnauthenticated is returned when a request carries no bearer token or one the KMS does not know
+var ErrUnauthenticated = errors.New("missing or unknown bearer token")
+
+// ErrForbidden is returned when an authenticated caller asks for something that is not its own
+var ErrForbidden = errors.New("caller may not access this resource")
+
+// BearerToken returns the bearer token of the request, the transport has to run kithttp.PopulateRequestContext
+// before the endpoint so the Authorization header is in the context
+func BearerToken(ctx context.Context) string {
+	header, _ := ctx.Value(kithttp.ContextKeyRequestAuthorization).(string)
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// NodeTokens maps the id of every decryption node to the token it authenticates with
+type NodeTokens map[int]string
+
+// ParseNodeTokens parses comma-separated <node id>=<token> entries. Every node needs its own token, a token shared
+// by two nodes would let either one pass as the other.
+func ParseNodeTokens(value string) (NodeTokens, error) {
+	entries, err := parseTokens(value, "node")
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make(NodeTokens, len(entries))
+	for id, token := range entries {
+		nodeID, err := strconv.Atoi(id)
+		if err != nil || nodeID < 1 {
+			return nil, fmt.Errorf("invalid node id %q, expected <node id>=<token>", id)
+		}
+		if _, ok := tokens[nodeID]; ok {
+			return nil, fmt.Errorf("node %d has more than one token", nodeID)
+		}
+		tokens[nodeID] = token
+	}
+	return tokens, nil
+}
+
+// Authenticate returns the id of the node the bearer token of the request belongs to.
+// Without configured tokens no node authenticates.
+func (tokens NodeTokens) Authenticate(ctx context.Context) (int, error) {
+	token := BearerToken(ctx)
+	if token == "" {
+		return 0, ErrUnauthenticated
+	}
+
+	// Every token is compared so the time taken does not tell which node a guess came close to
+	nodeID := 0
+	for id, nodeToken := range tokens {
+		if equal(token, nodeToken) {
+			nodeID = id
+		}
+	}
+	if nodeID == 0 {
+		return 0, ErrUnauthenticated
+	}
+	return nodeID, nil
+}
+
+// AuthenticateNode checks the request is made by the given node
+func (tokens NodeTokens) AuthenticateNode(ctx context.Context, nodeID int) error {
+	caller, err := tokens.Authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	if caller != nodeID {
+		return fmt.Errorf("%w: node %d acting for node %d", ErrForbidden, caller, nodeID)
+	}
+	return nil
+}
+
+// OperatorTenant is the tenant of operator tokens, operators manage the keys of every tenant
+const OperatorTenant = "*"
+
+// AdminTokens maps every tenant to the token its administrators authenticate with to the keyring admin API
+type AdminTokens map[string]string
+
+// ParseAdminTokens parses comma-separated <tenant>=<token> entries, the tenant * is for operators
+func ParseAdminTokens(value string) (AdminTokens, error) {
+	entries, err := parseTokens(value, "tenant")
+	if err != nil {
+		return nil, err
+	}
+	return AdminTokens(entries), nil
+}
+
+// Caller is an authenticated administrator of a tenant, or an operator
+type Caller struct {
+	Tenant string
+}
+
+// IsOperator reports whether the caller manages the keys of every tenant
+func (c Caller) IsOperator() bool {
+	return c.Tenant == OperatorTenant
+}
+
+// Authorize checks the caller may manage the keys of the given tenant
+func (c Caller) Authorize(tenant string) error {
+	if c.IsOperator() || c.Tenant == tenant {
+		return nil
+	}
+	return fmt.Errorf("%w: tenant %q managing keys of tenant %q", ErrForbidden, c.Tenant, tenant)
+}
+
+// Authenticate returns the administrator the bearer token of the request belongs to.
+// Without configured tokens nobody authenticates.
+func (tokens AdminTokens) Authenticate(ctx context.Context) (Caller, error) {
+	token := BearerToken(ctx)
+	if token == "" {
+		return Caller{}, ErrUnauthenticated
+	}
+
+	tenant, found := "", false
+	for candidate, adminToken := range tokens {
+		if equal(token, adminToken) {
+			tenant, found = candidate, true
+		}
+	}
+	if !found {
+		return Caller{}, ErrUnauthenticated
+	}
+	return Caller{Tenant: tenant}, nil
+}
+
+// ToServiceError maps authentication errors to their HTTP status
+func ToServiceError(err error) error {
+	if errors.Is(err, ErrForbidden) {
+		return eError.NewServiceError(err, "forbidden", "authorization", http.StatusForbidden)
+	}
+	return eError.NewServiceError(err, "unauthorized", "authorization", http.StatusUnauthorized)
+}
+
+// parseTokens parses comma-separated <owner>=<token> entries, every owner has one token and no token has two owners
+func parseTokens(value, kind string) (map[string]string, error) {
+	tokens := make(map[string]string)
+	owners := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		owner, token, found := strings.Cut(entry, "=")
+		owner, token = strings.TrimSpace(owner), strings.TrimSpace(token)
+		if !found || owner == "" {
+			return nil, fmt.Errorf("invalid token entry for %s %q, expected <%s>=<token>", kind, owner, kind)
+		}
+		if token == "" {
+			return nil, fmt.Errorf("empty token for %s %s", kind, owner)
+		}
+		if _, ok := tokens[owner]; ok {
+			return nil, fmt.Errorf("%s %s has more than one token", kind, owner)
+		}
+		if other, ok := owners[token]; ok {
+			return nil, fmt.Errorf("%ss %s and %s share a token", kind, other, owner)
+		}
+		tokens[owner] = token
+		owners[token] = owner
+	}
+	return tokens, nil
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"reflect"
+	"testing"
+)
+
+func withAuthorization(header string) context.Context {
+	return context.WithValue(context.Background(), kithttp.ContextKeyRequestAuthorization, header)
+}
+
+func TestParseNodeTokens(t *testing.T) {
+	tokens, err := ParseNodeTokens(" 1=alpha, 2 = beta ,")
+	if err != nil {
+		t.Fatalf("ParseNodeTokens: %v", err)
+	}
+	if want := (NodeTokens{1: "alpha", 2: "beta"}); !reflect.DeepEqual(tokens, want) {
+		t.Errorf("ParseNodeTokens = %v, want %v", tokens, want)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "no node id", value: "alpha"},
+		{name: "node id 0", value: "0=alpha"},
+		{name: "empty token", value: "1="},
+		{name: "two tokens for a node", value: "1=alpha,1=beta"},
+		{name: "token shared by two nodes", value: "1=alpha,2=alpha"},
+		{name: "same node written twice", value: "1=alpha,01=beta"},
+	}
+	for _, test := range tests {
+		if _, err := ParseNodeTokens(test.value); err == nil {
+			t.Errorf("%s: parsed %q", test.name, test.value)
+		}
+	}
+}
+
+func TestParseAdminTokens(t *testing.T) {
+	tokens, err := ParseAdminTokens("acme=alpha,*=root")
+	if err != nil {
+		t.Fatalf("ParseAdminTokens: %v", err)
+	}
+	if want := (AdminTokens{"acme": "alpha", OperatorTenant: "root"}); !reflect.DeepEqual(tokens, want) {
+		t.Errorf("ParseAdminTokens = %v, want %v", tokens, want)
+	}
+
+	for _, value := range []string{"alpha", "=alpha", "acme=", "acme=alpha,acme=beta", "acme=alpha,globex=alpha"} {
+		if _, err := ParseAdminTokens(value); err == nil {
+			t.Errorf("parsed %q", value)
+		}
+	}
+}
+
+func TestAuthorizeTenant(t *testing.T) {
+	tokens := AdminTokens{"acme": "alpha", "globex": "beta", OperatorTenant: "root"}
+
+	tests := []struct {
+		name   string
+		header string
+		tenant string
+		want   error
+	}{
+		{name: "own tenant", header: "Bearer alpha", tenant: "acme"},
+		{name: "another tenant", header: "Bearer beta", tenant: "acme", want: ErrForbidden},
+		{name: "operator", header: "Bearer root", tenant: "acme"},
+		{name: "unknown token", header: "Bearer gamma", tenant: "acme", want: ErrUnauthenticated},
+		{name: "no token", tenant: "acme", want: ErrUnauthenticated},
+	}
+	for _, test := range tests {
+		caller, err := tokens.Authenticate(withAuthorization(test.header))
+		if err == nil {
+			err = caller.Authorize(test.tenant)
+		}
+		if test.want == nil && err != nil || test.want != nil && !errors.Is(err, test.want) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestAuthenticateNode(t *testing.T) {
+	tokens := NodeTokens{1: "alpha", 2: "beta"}
+
+	tests := []struct {
+		name   string
+		tokens NodeTokens
+		header string
+		nodeID int
+		want   error
+	}{
+		{name: "own share", tokens: tokens, header: "Bearer alpha", nodeID: 1},
+		{name: "share of another node", tokens: tokens, header: "Bearer beta", nodeID: 1, want: ErrForbidden},
+		{name: "unknown token", tokens: tokens, header: "Bearer gamma", nodeID: 1, want: ErrUnauthenticated},
+		{name: "no token", tokens: tokens, nodeID: 1, want: ErrUnauthenticated},
+		{name: "not a bearer token", tokens: tokens, header: "Basic alpha", nodeID: 1, want: ErrUnauthenticated},
+		{name: "no tokens configured", header: "Bearer alpha", nodeID: 1, want: ErrUnauthenticated},
+	}
+	for _, test := range tests {
+		err := test.tokens.AuthenticateNode(withAuthorization(test.header), test.nodeID)
+		if test.want == nil && err != nil || test.want != nil && !errors.Is(err, test.want) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.want)
+		}
+	}
+}
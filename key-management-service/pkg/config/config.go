@@ -3,13 +3,34 @@ package config
 import (
 	"flag"
 	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/auth"
+	"os"
+	"time"
+)
+
+const (
+	// KeygenModeDealer generates the key pair inside the KMS and splits it into shares
+	KeygenModeDealer = "dealer"
+	// KeygenModeDKG lets the decryption nodes generate the key pair jointly, the KMS only coordinates
+	KeygenModeDKG = "dkg"
 )
 
 type Config struct {
-	HttpAddress     string
-	SecurityLevel   string
-	ThresholdConfig ThresholdConfig
-	LoggerConfig    logging.LoggerConfig
+	HttpAddress   string
+	KeyID         string
+	KeyTenant     string
+	SecurityLevel string
+	PairingType   string
+	// PairingParamsFile and KeyFile hold material generated offline by the keygen command, see cmd/keygen
+	PairingParamsFile string
+	KeyFile           string
+	KeygenMode        string
+	RefreshInterval   time.Duration
+	ThresholdConfig   ThresholdConfig
+	KeystoreConfig    KeystoreConfig
+	SealConfig        SealConfig
+	AuthConfig        AuthConfig
+	LoggerConfig      logging.LoggerConfig
 }
 
 type ThresholdConfig struct {
@@ -18,27 +39,109 @@ type ThresholdConfig struct {
 	TotalShares int
 }
 
+// MaxShares caps the number of shares of a key. Every share costs a G2 verification key, and share indices have to stay
+// small integers.
+const MaxShares = 255
+
+// KeystoreConfig is where the keyring is persisted and the passphrase it is sealed under.
+// The passphrase comes from the environment so it never shows up in the process arguments.
+type KeystoreConfig struct {
+	Path       string
+	Passphrase string
+}
+
+// SealConfig enables the sealed startup. The keystore is then sealed under a master key that is split into unseal
+// shares for the operators, a quorum of them has to be posted before the KMS serves any key.
+// Threshold and TotalShares are the defaults when the KMS is initialized, rekeying can change them later.
+type SealConfig struct {
+	Enabled     bool
+	Threshold   int
+	TotalShares int
+}
+
+// AuthConfig holds the credentials callers authenticate with, they come from the environment like the keystore passphrase.
+// A decryption node is only handed its own share, and only with its token. The keyring admin API serves administrators
+// the keys of their own tenant, operators those of every tenant.
+type AuthConfig struct {
+	NodeTokens  auth.NodeTokens
+	AdminTokens auth.AdminTokens
+}
+
+// KeystorePassphraseEnv is the environment variable holding the keystore passphrase
+const KeystorePassphraseEnv = "KMS_KEYSTORE_PASSPHRASE"
+
+// NodeTokensEnv is the environment variable holding the decryption node tokens as <node id>=<token>, comma-separated
+const NodeTokensEnv = "KMS_NODE_TOKENS"
+
+// AdminTokensEnv is the environment variable holding the admin tokens as <tenant>=<token>, comma-separated.
+// The tenant * is for operators.
+const AdminTokensEnv = "KMS_ADMIN_TOKENS"
+
 func Load() (Config, error) {
 	fs := flag.NewFlagSet("", flag.ExitOnError)
 
 	httpAddress := fs.String("http.public.address", "0.0.0.0:9001", "HTTP listen address for all specified endpoints.")
+	keyID := fs.String("key.id", "default", "the name of the default key, it is embedded in every ciphertext together with the key version")
+	keyTenant := fs.String("key.tenant", "default", "the tenant owning the default key")
 	securityLevel := fs.String("security.level", "medium", "the security level to use for the pairing parameters. Possible values are 'low', 'medium', 'high'")
+	pairingType := fs.String("pairing.type", "a", "the type of pairing of the default key. Possible values are 'a' (symmetric, fast, large elements), 'd' (asymmetric MNT curve, small elements), 'f' (asymmetric Barreto-Naehrig curve, smallest elements, slowest) and 'bls12-381' (asymmetric, pure Go, no cgo needed)")
+	pairingParamsFile := fs.String("pairing.params.file", "", "file with plain pairing parameters for the default key, used instead of generating them. The pairing type is read from the file")
+	keyFile := fs.String("key.file", "", "key file written by the keygen command, the default key and its shares are loaded from it instead of being generated. Ignored once the keystore exists")
+	keygenMode := fs.String("keygen.mode", KeygenModeDealer, "how the key pair is generated. Possible values are 'dealer' (the KMS generates and splits the key) and 'dkg' (the decryption nodes run a distributed key generation)")
+	refreshInterval := fs.Duration("refresh.interval", 0, "how often the key shares are proactively refreshed, e.g. 24h. Zero disables scheduled refresh, it can still be triggered on demand")
 
 	thresholdConfig := ThresholdConfig{}
 	fs.BoolVar(&thresholdConfig.Enabled, "thresholdconfig.enabled", true, "whether threshold encryption is enabled or not")
 	fs.IntVar(&thresholdConfig.Threshold, "thresholdconfig.threshold", 4, "the threshold number of shares required to reconstruct the secret. For instance threshold 3 means that any 3 out of the total number of shares can be used to reconstruct the secret")
 	fs.IntVar(&thresholdConfig.TotalShares, "thresholdconfig.shares", 5, "the total number of shares to be generated for instance n = 5 means that the secret will be split into 5 shares")
 
+	keystoreConfig := KeystoreConfig{Passphrase: os.Getenv(KeystorePassphraseEnv)}
+	fs.StringVar(&keystoreConfig.Path, "keystore.path", "", "file the keyring is persisted to, sealed under the passphrase in "+KeystorePassphraseEnv+". Empty keeps the keys in memory only")
+
+	sealConfig := SealConfig{}
+	fs.BoolVar(&sealConfig.Enabled, "seal.enabled", false, "start sealed and only load the keystore once a quorum of operators has posted their unseal shares. Requires keystore.path, the passphrase is not used")
+	fs.IntVar(&sealConfig.Threshold, "seal.threshold", 3, "the number of unseal shares required to unseal the KMS, used when it is initialized")
+	fs.IntVar(&sealConfig.TotalShares, "seal.shares", 5, "the number of unseal shares handed to the operators, used when the KMS is initialized")
+
 	loggerConfig := logging.LoggerConfig{}
 	fs.StringVar(&loggerConfig.CommandHandler, "logger.handler.type", "json", "handler type e.g json, otherwise default will be text type")
 	fs.StringVar(&loggerConfig.LogLevel, "logger.log.level", "debug", "log level wise logging with fatal log")
 
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return Config{}, err
+	}
+
+	nodeTokens, err := auth.ParseNodeTokens(os.Getenv(NodeTokensEnv))
+	if err != nil {
+		return Config{}, err
+	}
+	adminTokens, err := auth.ParseAdminTokens(os.Getenv(AdminTokensEnv))
+	if err != nil {
+		return Config{}, err
+	}
+	authConfig := AuthConfig{NodeTokens: nodeTokens, AdminTokens: adminTokens}
+
 	config := Config{
-		HttpAddress:     *httpAddress,
-		SecurityLevel:   *securityLevel,
-		ThresholdConfig: thresholdConfig,
-		LoggerConfig:    loggerConfig,
+		HttpAddress:       *httpAddress,
+		KeyID:             *keyID,
+		KeyTenant:         *keyTenant,
+		SecurityLevel:     *securityLevel,
+		PairingType:       *pairingType,
+		PairingParamsFile: *pairingParamsFile,
+		KeyFile:           *keyFile,
+		KeygenMode:        *keygenMode,
+		RefreshInterval:   *refreshInterval,
+		ThresholdConfig:   thresholdConfig,
+		KeystoreConfig:    keystoreConfig,
+		SealConfig:        sealConfig,
+		AuthConfig:        authConfig,
+		LoggerConfig:      loggerConfig,
 	}
 
 	return config, nil
 }
+
+// IsDistributedKeygen reports whether the key pair comes from a distributed key generation among the decryption nodes
+func (c Config) IsDistributedKeygen() bool {
+	return c.KeygenMode == KeygenModeDKG
+}
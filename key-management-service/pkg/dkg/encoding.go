@@ -0,0 +1,114 @@
+package dkg
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	eError "github.com/mdshahjahanmiah/explore-go/error"
+)
+
+type RegisterRequest struct {
+	NodeID       int    `json:"node_id"`
+	TransportKey string `json:"transport_key"`
+}
+
+type DealRequest struct {
+	NodeID int `json:"node_id"`
+	Deal
+}
+
+type ComplaintRequest struct {
+	NodeID  int   `json:"node_id"`
+	Accused []int `json:"accused"`
+}
+
+type AnswerRequest struct {
+	NodeID  int               `json:"node_id"`
+	Answers map[int]SharePair `json:"answers"`
+}
+
+type RevealRequest struct {
+	NodeID      int      `json:"node_id"`
+	Commitments []string `json:"commitments"`
+}
+
+type VerificationRequest struct {
+	NodeID      int               `json:"node_id"`
+	Accusations map[int]SharePair `json:"accusations"`
+}
+
+type DisclosureRequest struct {
+	NodeID      int               `json:"node_id"`
+	Disclosures map[int]SharePair `json:"disclosures"`
+}
+
+// ReshareRequest is the threshold and the number of shares of the committee the key is handed to
+type ReshareRequest struct {
+	Threshold   int `json:"threshold"`
+	TotalShares int `json:"total_shares"`
+}
+
+func decodeRegisterRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var registerRequest RegisterRequest
+	if err := json.NewDecoder(request.Body).Decode(&registerRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode register request", "payload", http.StatusBadRequest)
+	}
+	return registerRequest, nil
+}
+
+func decodeDealRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var dealRequest DealRequest
+	if err := json.NewDecoder(request.Body).Decode(&dealRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode deal request", "payload", http.StatusBadRequest)
+	}
+	return dealRequest, nil
+}
+
+func decodeComplaintRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var complaintRequest ComplaintRequest
+	if err := json.NewDecoder(request.Body).Decode(&complaintRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode complaint request", "payload", http.StatusBadRequest)
+	}
+	return complaintRequest, nil
+}
+
+func decodeAnswerRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var answerRequest AnswerRequest
+	if err := json.NewDecoder(request.Body).Decode(&answerRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode answer request", "payload", http.StatusBadRequest)
+	}
+	return answerRequest, nil
+}
+
+func decodeRevealRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var revealRequest RevealRequest
+	if err := json.NewDecoder(request.Body).Decode(&revealRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode reveal request", "payload", http.StatusBadRequest)
+	}
+	return revealRequest, nil
+}
+
+func decodeVerificationRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var verificationRequest VerificationRequest
+	if err := json.NewDecoder(request.Body).Decode(&verificationRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode verification request", "payload", http.StatusBadRequest)
+	}
+	return verificationRequest, nil
+}
+
+func decodeDisclosureRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var disclosureRequest DisclosureRequest
+	if err := json.NewDecoder(request.Body).Decode(&disclosureRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode disclosure request", "payload", http.StatusBadRequest)
+	}
+	return disclosureRequest, nil
+}
+
+func decodeReshareRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var reshareRequest ReshareRequest
+	if err := json.NewDecoder(request.Body).Decode(&reshareRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode reshare request", "payload", http.StatusBadRequest)
+	}
+	return reshareRequest, nil
+}
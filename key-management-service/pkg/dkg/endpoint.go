@@ -0,0 +1,160 @@
+package dkg
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	eError "github.com/mdshahjahanmiah/explore-go/error"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/auth"
+	"net/http"
+)
+
+// AcceptedResponse acknowledges a message and reports the phase the session is in afterwards
+type AcceptedResponse struct {
+	Phase string `json:"phase"`
+}
+
+func getStateEndpoint(coordinator Coordinator) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return coordinator.State(), nil
+	}
+}
+
+// getRegisterEndpoint records a node's transport key. Like every message of a session it has to come from the node
+// itself, otherwise anybody could register a transport key in the name of a node and read the shares dealt to it.
+func getRegisterEndpoint(coordinator Coordinator, nodes auth.NodeTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(RegisterRequest)
+		if err := nodes.AuthenticateNode(ctx, req.NodeID); err != nil {
+			return nil, auth.ToServiceError(err)
+		}
+		if err := coordinator.Register(req.NodeID, req.TransportKey); err != nil {
+			return nil, toServiceError(err, "register")
+		}
+		return AcceptedResponse{Phase: coordinator.State().Phase}, nil
+	}
+}
+
+func getDealEndpoint(coordinator Coordinator, nodes auth.NodeTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(DealRequest)
+		if err := nodes.AuthenticateNode(ctx, req.NodeID); err != nil {
+			return nil, auth.ToServiceError(err)
+		}
+		if err := coordinator.SubmitDeal(req.NodeID, req.Deal); err != nil {
+			return nil, toServiceError(err, "deal")
+		}
+		return AcceptedResponse{Phase: coordinator.State().Phase}, nil
+	}
+}
+
+func getComplaintEndpoint(coordinator Coordinator, nodes auth.NodeTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ComplaintRequest)
+		if err := nodes.AuthenticateNode(ctx, req.NodeID); err != nil {
+			return nil, auth.ToServiceError(err)
+		}
+		if err := coordinator.SubmitComplaints(req.NodeID, req.Accused); err != nil {
+			return nil, toServiceError(err, "complaint")
+		}
+		return AcceptedResponse{Phase: coordinator.State().Phase}, nil
+	}
+}
+
+func getAnswerEndpoint(coordinator Coordinator, nodes auth.NodeTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(AnswerRequest)
+		if err := nodes.AuthenticateNode(ctx, req.NodeID); err != nil {
+			return nil, auth.ToServiceError(err)
+		}
+		if err := coordinator.SubmitAnswers(req.NodeID, req.Answers); err != nil {
+			return nil, toServiceError(err, "answer")
+		}
+		return AcceptedResponse{Phase: coordinator.State().Phase}, nil
+	}
+}
+
+func getRevealEndpoint(coordinator Coordinator, nodes auth.NodeTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(RevealRequest)
+		if err := nodes.AuthenticateNode(ctx, req.NodeID); err != nil {
+			return nil, auth.ToServiceError(err)
+		}
+		if err := coordinator.SubmitReveal(req.NodeID, req.Commitments); err != nil {
+			return nil, toServiceError(err, "reveal")
+		}
+		return AcceptedResponse{Phase: coordinator.State().Phase}, nil
+	}
+}
+
+func getVerificationEndpoint(coordinator Coordinator, nodes auth.NodeTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(VerificationRequest)
+		if err := nodes.AuthenticateNode(ctx, req.NodeID); err != nil {
+			return nil, auth.ToServiceError(err)
+		}
+		if err := coordinator.SubmitVerification(req.NodeID, req.Accusations); err != nil {
+			return nil, toServiceError(err, "verification")
+		}
+		return AcceptedResponse{Phase: coordinator.State().Phase}, nil
+	}
+}
+
+func getDisclosureEndpoint(coordinator Coordinator, nodes auth.NodeTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(DisclosureRequest)
+		if err := nodes.AuthenticateNode(ctx, req.NodeID); err != nil {
+			return nil, auth.ToServiceError(err)
+		}
+		if err := coordinator.SubmitDisclosures(req.NodeID, req.Disclosures); err != nil {
+			return nil, toServiceError(err, "disclosure")
+		}
+		return AcceptedResponse{Phase: coordinator.State().Phase}, nil
+	}
+}
+
+// getRefreshEndpoint opens a refresh session, only administrators of the tenant of the distributed key may
+func getRefreshEndpoint(coordinator Coordinator, admins auth.AdminTokens, tenant string) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if err := authorizeSession(ctx, admins, tenant); err != nil {
+			return nil, err
+		}
+		if err := coordinator.StartRefresh(); err != nil {
+			return nil, toServiceError(err, "refresh")
+		}
+		return AcceptedResponse{Phase: coordinator.State().Phase}, nil
+	}
+}
+
+func getReshareEndpoint(coordinator Coordinator, admins auth.AdminTokens, tenant string) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if err := authorizeSession(ctx, admins, tenant); err != nil {
+			return nil, err
+		}
+		req := request.(ReshareRequest)
+		if err := coordinator.StartReshare(req.Threshold, req.TotalShares); err != nil {
+			return nil, toServiceError(err, "reshare")
+		}
+		return AcceptedResponse{Phase: coordinator.State().Phase}, nil
+	}
+}
+
+// authorizeSession checks the caller administers the tenant of the distributed key
+func authorizeSession(ctx context.Context, admins auth.AdminTokens, tenant string) error {
+	caller, err := admins.Authenticate(ctx)
+	if err == nil {
+		err = caller.Authorize(tenant)
+	}
+	if err != nil {
+		return auth.ToServiceError(err)
+	}
+	return nil
+}
+
+// toServiceError maps a coordinator error to a conflict when the message is early or late, a bad request otherwise
+func toServiceError(err error, field string) error {
+	if errors.Is(err, ErrWrongPhase) {
+		return eError.NewServiceError(err, "wrong_phase", field, http.StatusConflict)
+	}
+	return eError.NewServiceError(err, "validation_error", field, http.StatusBadRequest)
+}
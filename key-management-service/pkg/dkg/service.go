@@ -0,0 +1,1009 @@
+package dkg
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/group"
+	"sort"
+	"sync"
+)
+
+// Phases of a distributed key generation session, in the order they happen.
+// Answering and reconstructing are skipped when nobody complains or no qualified dealer is caught cheating.
+const (
+	PhaseRegistering    = "registering"
+	PhaseDealing        = "dealing"
+	PhaseComplaining    = "complaining"
+	PhaseAnswering      = "answering"
+	PhaseRevealing      = "revealing"
+	PhaseVerifying      = "verifying"
+	PhaseReconstructing = "reconstructing"
+	PhaseCompleted      = "completed"
+	PhaseFailed         = "failed"
+)
+
+// Kinds of session. A keygen session creates the key pair, a refresh session re-randomizes the shares
+// of the existing key with polynomials whose constant term is zero, and a reshare session hands the
+// existing key to a new committee under a new threshold. The public key never changes after keygen.
+const (
+	KindKeygen  = "keygen"
+	KindRefresh = "refresh"
+	KindReshare = "reshare"
+)
+
+// ErrWrongPhase is returned when a message arrives in a phase that does not accept it
+var ErrWrongPhase = errors.New("message not accepted in the current phase")
+
+// pedersenBaseDomain separates the hash used to derive the second Pedersen base from any other use of the generator,
+// the decryption nodes derive the same base
+const pedersenBaseDomain = "threshold-decryption/dkg/pedersen-base"
+
+// Result is the public outcome of a distributed key generation
+type Result struct {
+	PublicKey        group.Element
+	Commitments      []group.Element
+	VerificationKeys map[int]group.Element
+	Threshold        int
+	TotalShares      int
+	Epoch            int
+}
+
+// KeyPublisher receives the public key material once the nodes have agreed on it
+type KeyPublisher interface {
+	PublishDistributedKey(result Result) error
+	// PublishRefresh receives the commitments g^{d_k} of the summed zero-constant refresh polynomial d,
+	// which are folded into the published commitments and verification keys.
+	PublishRefresh(result Result) error
+}
+
+// EncryptedShare is a dealer's share for one recipient, encrypted to the recipient's transport key
+// so the coordinator relaying it cannot read it.
+type EncryptedShare struct {
+	Recipient  int    `json:"recipient"`
+	Ephemeral  string `json:"ephemeral"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// Deal is what a node publishes in the dealing phase: Pedersen commitments g^{a_k} h^{b_k}
+// to its two polynomials and one encrypted share pair (f(j), f'(j)) for every node j.
+// In a refresh session a_0 = b_0 = 0 and the commitment to the constant term is left out,
+// in a reshare session a_0 is the dealer's current share.
+type Deal struct {
+	Commitments []string         `json:"commitments"`
+	Shares      []EncryptedShare `json:"shares"`
+}
+
+// SharePair is a dealer's share pair (f(j), f'(j)) for receiver j in the clear, as base64-encoded scalars.
+// Pairs are only published to settle a dispute, anyone can check them against the dealer's Pedersen commitments.
+type SharePair struct {
+	Share    string `json:"share"`
+	Blinding string `json:"blinding"`
+}
+
+// State is the public transcript of the session, nodes poll it to move from one round to the next
+type State struct {
+	Kind        string `json:"kind"`
+	Epoch       int    `json:"epoch"`
+	Phase       string `json:"phase"`
+	Generator   string `json:"generator"`
+	Threshold   int    `json:"threshold"`
+	TotalShares int    `json:"total_shares"`
+	// The committee handing over the key in a reshare session, its members 1..PreviousTotalShares are the dealers
+	PreviousThreshold   int            `json:"previous_threshold,omitempty"`
+	PreviousTotalShares int            `json:"previous_total_shares,omitempty"`
+	TransportKeys       map[int]string `json:"transport_keys"`
+	Deals               map[int]Deal   `json:"deals"`
+	Complaints          map[int][]int  `json:"complaints"`
+	// Answers holds the share pairs dealers published for the receivers complaining about them, by dealer and receiver
+	Answers   map[int]map[int]SharePair `json:"answers"`
+	Qualified []int                     `json:"qualified"`
+	Reveals   map[int][]string          `json:"reveals"`
+	// Accusations holds the share pairs receivers published because they do not match the dealer's reveal,
+	// by receiver and dealer. Only pairs that match the dealer's Pedersen commitments are kept.
+	Accusations map[int]map[int]SharePair `json:"accusations"`
+	// Reconstructed lists the qualified dealers caught cheating, their polynomials are rebuilt from the disclosed shares
+	Reconstructed []int                     `json:"reconstructed,omitempty"`
+	Disclosures   map[int]map[int]SharePair `json:"disclosures"`
+	PublicKey     string                    `json:"public_key,omitempty"`
+	Reason        string                    `json:"reason,omitempty"`
+}
+
+// Coordinator relays the rounds of the GJKR distributed key generation between the decryption nodes.
+// The qualified set is fixed on the hiding Pedersen commitments, before any dealer reveals its Feldman commitments,
+// so no dealer can choose its contribution after seeing the others'. A qualified dealer whose reveal does not match
+// its shares is reconstructed rather than dropped, except in a reshare where the key is fixed anyway. The coordinator only ever handles public or encrypted data, and the
+// shares published to settle disputes, the private key exists nowhere in one piece.
+type Coordinator interface {
+	State() State
+	Register(nodeID int, transportKey string) error
+	SubmitDeal(nodeID int, deal Deal) error
+	SubmitComplaints(nodeID int, accused []int) error
+	SubmitAnswers(nodeID int, answers map[int]SharePair) error
+	SubmitReveal(nodeID int, commitments []string) error
+	SubmitVerification(nodeID int, accusations map[int]SharePair) error
+	SubmitDisclosures(nodeID int, disclosures map[int]SharePair) error
+	StartRefresh() error
+	StartReshare(threshold, totalShares int) error
+	Resume(epoch, totalShares int, commitments []string) error
+}
+
+type coordinator struct {
+	mutex     sync.Mutex
+	pairing   group.Pairing
+	generator group.Element
+	base      group.Element
+	publisher KeyPublisher
+	logger    *logging.Logger
+	state     State
+
+	// The committee currently holding the key and the joint commitments to its sharing polynomial,
+	// they only change when a session completes.
+	threshold   int
+	totalShares int
+	commitments []group.Element
+}
+
+// NewCoordinator creates a coordinator for a threshold-of-total key generation session
+// The generator is the public G2 generator every commitment and the final public key are computed against.
+func NewCoordinator(config config.Config, pairing group.Pairing, generator group.Element, publisher KeyPublisher, logger *logging.Logger) (Coordinator, error) {
+	threshold, totalShares := config.ThresholdConfig.Threshold, config.ThresholdConfig.TotalShares
+	if err := checkQuorum(threshold, totalShares); err != nil {
+		return nil, err
+	}
+
+	// h is obtained by hashing, so nobody knows log_g(h) and the Pedersen commitments stay binding
+	hash := sha256.New()
+	hash.Write([]byte(pedersenBaseDomain))
+	hash.Write(generator.Bytes())
+
+	return &coordinator{
+		pairing:     pairing,
+		generator:   generator,
+		base:        pairing.NewG2().SetFromHash(hash.Sum(nil)),
+		publisher:   publisher,
+		logger:      logger,
+		threshold:   threshold,
+		totalShares: totalShares,
+		state: State{
+			Kind:          KindKeygen,
+			Phase:         PhaseRegistering,
+			Generator:     base64.StdEncoding.EncodeToString(generator.Bytes()),
+			Threshold:     threshold,
+			TotalShares:   totalShares,
+			TransportKeys: make(map[int]string),
+			Deals:         make(map[int]Deal),
+			Complaints:    make(map[int][]int),
+			Answers:       make(map[int]map[int]SharePair),
+			Reveals:       make(map[int][]string),
+			Accusations:   make(map[int]map[int]SharePair),
+			Disclosures:   make(map[int]map[int]SharePair),
+		},
+	}, nil
+}
+
+// State returns a snapshot of the current public transcript of the session
+func (c *coordinator) State() State {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	state := c.state
+	state.TransportKeys = make(map[int]string, len(c.state.TransportKeys))
+	for id, key := range c.state.TransportKeys {
+		state.TransportKeys[id] = key
+	}
+	state.Deals = make(map[int]Deal, len(c.state.Deals))
+	for id, deal := range c.state.Deals {
+		state.Deals[id] = deal
+	}
+	state.Complaints = make(map[int][]int, len(c.state.Complaints))
+	for id, accused := range c.state.Complaints {
+		state.Complaints[id] = accused
+	}
+	state.Answers = copyPairs(c.state.Answers)
+	state.Reveals = make(map[int][]string, len(c.state.Reveals))
+	for id, commitments := range c.state.Reveals {
+		state.Reveals[id] = commitments
+	}
+	state.Accusations = copyPairs(c.state.Accusations)
+	state.Disclosures = copyPairs(c.state.Disclosures)
+	return state
+}
+
+// Register records the transport key a node wants its shares encrypted to.
+// Dealing starts once every node of the session has registered.
+func (c *coordinator) Register(nodeID int, transportKey string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.checkMessage(PhaseRegistering, nodeID); err != nil {
+		return err
+	}
+	if _, ok := c.state.TransportKeys[nodeID]; ok {
+		return fmt.Errorf("node %d is already registered", nodeID)
+	}
+	if _, err := decodeG2(c.pairing, transportKey); err != nil {
+		return fmt.Errorf("invalid transport key: %w", err)
+	}
+
+	c.state.TransportKeys[nodeID] = transportKey
+	c.logger.Info("dkg node registered", "node_id", nodeID, "registered", len(c.state.TransportKeys))
+
+	if len(c.state.TransportKeys) == c.participants() {
+		c.state.Phase = PhaseDealing
+	}
+	return nil
+}
+
+// SubmitDeal records a node's commitments and encrypted shares.
+// Complaints open once every dealer has dealt.
+func (c *coordinator) SubmitDeal(nodeID int, deal Deal) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.checkMessage(PhaseDealing, nodeID); err != nil {
+		return err
+	}
+	if nodeID > c.dealers() {
+		return fmt.Errorf("node %d holds no share to deal", nodeID)
+	}
+	if _, ok := c.state.Deals[nodeID]; ok {
+		return fmt.Errorf("node %d has already dealt", nodeID)
+	}
+	if _, err := c.decodeCommitments(deal.Commitments); err != nil {
+		return err
+	}
+
+	recipients := make(map[int]bool, len(deal.Shares))
+	for _, share := range deal.Shares {
+		if share.Recipient < 1 || share.Recipient > c.state.TotalShares || recipients[share.Recipient] {
+			return fmt.Errorf("invalid or duplicate recipient %d", share.Recipient)
+		}
+		recipients[share.Recipient] = true
+	}
+	if len(recipients) != c.state.TotalShares {
+		return fmt.Errorf("expected a share for each of the %d nodes, got %d", c.state.TotalShares, len(recipients))
+	}
+
+	c.state.Deals[nodeID] = deal
+	c.logger.Info("dkg deal received", "node_id", nodeID, "deals", len(c.state.Deals))
+
+	if len(c.state.Deals) == c.dealers() {
+		c.state.Phase = PhaseComplaining
+	}
+	return nil
+}
+
+// SubmitComplaints records the dealers whose share did not match their commitments for this node.
+// Once every receiving node has answered, any accused dealer is disqualified and the rest form the qualified set.
+func (c *coordinator) SubmitComplaints(nodeID int, accused []int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.checkMessage(PhaseComplaining, nodeID); err != nil {
+		return err
+	}
+	if nodeID > c.state.TotalShares {
+		return fmt.Errorf("node %d receives no share in this session", nodeID)
+	}
+	if _, ok := c.state.Complaints[nodeID]; ok {
+		return fmt.Errorf("node %d has already submitted its complaints", nodeID)
+	}
+	seen := make(map[int]bool, len(accused))
+	for _, dealer := range accused {
+		if dealer < 1 || dealer > c.dealers() || seen[dealer] {
+			return fmt.Errorf("invalid or duplicate accused dealer %d", dealer)
+		}
+		seen[dealer] = true
+	}
+
+	c.state.Complaints[nodeID] = accused
+	if len(c.state.Complaints) < c.state.TotalShares {
+		return nil
+	}
+
+	// A dealer accused by a threshold of receivers is disqualified outright, answering would publish enough of its
+	// shares to give its polynomial away. The other accused dealers stay qualified if they answer every complaint.
+	qualified := make([]int, 0, c.dealers())
+	for dealer := 1; dealer <= c.dealers(); dealer++ {
+		if len(c.complainers(dealer)) < c.state.Threshold {
+			qualified = append(qualified, dealer)
+		}
+	}
+	c.state.Qualified = qualified
+	c.state.Phase = PhaseAnswering
+	c.closeAnswers()
+	return nil
+}
+
+// SubmitAnswers records the share pairs an accused dealer publishes for the receivers complaining about it.
+// A dealer that leaves out a complaint or answers one with a pair that does not match its commitments is disqualified.
+func (c *coordinator) SubmitAnswers(nodeID int, answers map[int]SharePair) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.checkMessage(PhaseAnswering, nodeID); err != nil {
+		return err
+	}
+	complainers := c.complainers(nodeID)
+	if !c.isQualified(nodeID) || len(complainers) == 0 {
+		return fmt.Errorf("node %d has no complaints to answer", nodeID)
+	}
+	if _, ok := c.state.Answers[nodeID]; ok {
+		return fmt.Errorf("node %d has already answered", nodeID)
+	}
+
+	valid := make(map[int]SharePair, len(complainers))
+	for _, receiver := range complainers {
+		pair, ok := answers[receiver]
+		if !ok {
+			c.disqualify(nodeID)
+			c.closeAnswers()
+			return fmt.Errorf("node %d did not answer the complaint of node %d", nodeID, receiver)
+		}
+		if _, err := c.checkPair(nodeID, receiver, pair); err != nil {
+			c.disqualify(nodeID)
+			c.closeAnswers()
+			return fmt.Errorf("answer of node %d to node %d: %w", nodeID, receiver, err)
+		}
+		valid[receiver] = pair
+	}
+
+	c.state.Answers[nodeID] = valid
+	c.logger.Info("dkg complaints answered", "node_id", nodeID, "complainers", complainers)
+	c.closeAnswers()
+	return nil
+}
+
+// closeAnswers fixes the qualified set once every accused dealer has answered or was disqualified
+func (c *coordinator) closeAnswers() {
+	if c.state.Phase != PhaseAnswering {
+		return
+	}
+	for _, dealer := range c.state.Qualified {
+		if _, answered := c.state.Answers[dealer]; !answered && len(c.complainers(dealer)) > 0 {
+			return
+		}
+	}
+
+	// With fewer than t honest dealers the joint secret could be known to the remaining ones,
+	// and a reshare needs t of the old shares to carry the key over
+	if len(c.state.Qualified) < c.minQualified() {
+		c.fail(fmt.Sprintf("only %d qualified dealers, need at least %d", len(c.state.Qualified), c.minQualified()))
+		return
+	}
+
+	c.logger.Info("dkg qualified set decided", "qualified", c.state.Qualified)
+	c.state.Phase = PhaseRevealing
+}
+
+// SubmitReveal records the Feldman commitments g^{a_k} of a qualified dealer.
+// Once all qualified dealers have revealed, the receivers check their shares against the reveals.
+func (c *coordinator) SubmitReveal(nodeID int, commitments []string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.checkMessage(PhaseRevealing, nodeID); err != nil {
+		return err
+	}
+	if !c.isQualified(nodeID) {
+		return fmt.Errorf("node %d is not a qualified dealer", nodeID)
+	}
+	if _, ok := c.state.Reveals[nodeID]; ok {
+		return fmt.Errorf("node %d has already revealed", nodeID)
+	}
+	decoded, err := c.decodeCommitments(commitments)
+	if err != nil {
+		return err
+	}
+
+	// A resharing dealer must deal its actual share, whose commitment is its current verification key.
+	// The other coefficients are bound by the receivers' shares in the verification round.
+	if c.state.Kind == KindReshare && !decoded[0].Equals(evaluateCommitments(c.pairing, c.commitments, nodeID)) {
+		c.disqualify(nodeID)
+		c.closeReveals()
+		return fmt.Errorf("node %d did not reshare its own share", nodeID)
+	}
+
+	c.state.Reveals[nodeID] = commitments
+	c.closeReveals()
+	return nil
+}
+
+// closeReveals opens the verification round once every qualified dealer has revealed
+func (c *coordinator) closeReveals() {
+	if c.state.Phase != PhaseRevealing {
+		return
+	}
+	for _, dealer := range c.state.Qualified {
+		if _, ok := c.state.Reveals[dealer]; !ok {
+			return
+		}
+	}
+	c.state.Phase = PhaseVerifying
+}
+
+// SubmitVerification records the qualified dealers whose reveal does not match the share this receiver holds,
+// each with the share pair as evidence. A pair proves the dealer cheated when it matches the dealer's Pedersen
+// commitments but not its reveal, accusations without such proof are ignored.
+// Once every receiver has answered, the outcome is published unless a dealer has to be reconstructed first.
+func (c *coordinator) SubmitVerification(nodeID int, accusations map[int]SharePair) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.checkMessage(PhaseVerifying, nodeID); err != nil {
+		return err
+	}
+	if nodeID > c.state.TotalShares {
+		return fmt.Errorf("node %d receives no share in this session", nodeID)
+	}
+	if _, ok := c.state.Accusations[nodeID]; ok {
+		return fmt.Errorf("node %d has already verified the reveals", nodeID)
+	}
+
+	proven := make(map[int]SharePair, len(accusations))
+	for dealer, pair := range accusations {
+		if !c.isQualified(dealer) {
+			return fmt.Errorf("invalid accused dealer %d", dealer)
+		}
+		if err := c.checkAccusation(dealer, nodeID, pair); err != nil {
+			c.logger.Warn("dkg accusation rejected", "node_id", nodeID, "dealer", dealer, "err", err)
+			continue
+		}
+		proven[dealer] = pair
+	}
+
+	c.state.Accusations[nodeID] = proven
+	if len(c.state.Accusations) < c.state.TotalShares {
+		return nil
+	}
+
+	cheaters := make([]int, 0)
+	for _, dealer := range c.state.Qualified {
+		for _, pairs := range c.state.Accusations {
+			if _, ok := pairs[dealer]; ok {
+				cheaters = append(cheaters, dealer)
+				break
+			}
+		}
+	}
+	switch {
+	case len(cheaters) == 0:
+		c.complete()
+	case c.state.Kind == KindReshare:
+		// The reshared key is fixed by the old shares, so dropping a dealer cannot bias it, while reconstructing
+		// its polynomial would publish its share of the key
+		for _, dealer := range cheaters {
+			c.disqualify(dealer)
+		}
+		c.complete()
+	default:
+		c.logger.Warn("dkg dealers caught cheating, reconstructing them", "dealers", cheaters)
+		c.state.Reconstructed = cheaters
+		c.state.Phase = PhaseReconstructing
+	}
+	return nil
+}
+
+// SubmitDisclosures records this receiver's share pairs of the dealers being reconstructed.
+// Once every receiver has disclosed, the polynomials of those dealers are interpolated from the pairs that match
+// their Pedersen commitments, their reveals are replaced with the commitments to the actual polynomials and the
+// outcome is published. Their contributions become public, the key stays secret as long as one qualified dealer is honest.
+func (c *coordinator) SubmitDisclosures(nodeID int, disclosures map[int]SharePair) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.checkMessage(PhaseReconstructing, nodeID); err != nil {
+		return err
+	}
+	if nodeID > c.state.TotalShares {
+		return fmt.Errorf("node %d receives no share in this session", nodeID)
+	}
+	if _, ok := c.state.Disclosures[nodeID]; ok {
+		return fmt.Errorf("node %d has already disclosed its shares", nodeID)
+	}
+
+	valid := make(map[int]SharePair, len(c.state.Reconstructed))
+	for _, dealer := range c.state.Reconstructed {
+		pair, ok := disclosures[dealer]
+		if !ok {
+			return fmt.Errorf("no share of dealer %d disclosed", dealer)
+		}
+		if _, err := c.checkPair(dealer, nodeID, pair); err != nil {
+			c.logger.Warn("dkg disclosure rejected", "node_id", nodeID, "dealer", dealer, "err", err)
+			continue
+		}
+		valid[dealer] = pair
+	}
+
+	c.state.Disclosures[nodeID] = valid
+	if len(c.state.Disclosures) < c.state.TotalShares {
+		return nil
+	}
+
+	for _, dealer := range c.state.Reconstructed {
+		shares := make(map[int]group.Element)
+		for receiver, pairs := range c.state.Disclosures {
+			if pair, ok := pairs[dealer]; ok {
+				shares[receiver], _ = c.checkPair(dealer, receiver, pair)
+			}
+		}
+		if len(shares) < c.state.Threshold {
+			c.fail(fmt.Sprintf("only %d shares of dealer %d disclosed, need %d to reconstruct it", len(shares), dealer, c.state.Threshold))
+			return nil
+		}
+
+		coefficients := interpolate(c.pairing, shares, c.state.Threshold)
+		reveal := make([]string, 0, len(coefficients))
+		for k := firstCommitted(c.state.Kind); k < len(coefficients); k++ {
+			reveal = append(reveal, base64.StdEncoding.EncodeToString(c.pairing.NewG2().PowZn(c.generator, coefficients[k]).Bytes()))
+		}
+		c.state.Reveals[dealer] = reveal
+		c.logger.Warn("dkg dealer reconstructed", "node_id", dealer)
+	}
+
+	c.complete()
+	return nil
+}
+
+// complete derives and publishes the outcome of the session
+func (c *coordinator) complete() {
+	if c.state.Phase == PhaseFailed {
+		return
+	}
+
+	result, err := c.aggregate()
+	if err != nil {
+		c.fail(err.Error())
+		return
+	}
+
+	if c.state.Kind == KindRefresh {
+		err = c.publisher.PublishRefresh(result)
+	} else {
+		err = c.publisher.PublishDistributedKey(result)
+	}
+	if err != nil {
+		c.fail(err.Error())
+		return
+	}
+
+	switch c.state.Kind {
+	case KindKeygen:
+		c.state.PublicKey = base64.StdEncoding.EncodeToString(result.PublicKey.Bytes())
+		c.commitments = result.Commitments
+	case KindRefresh:
+		for k, delta := range result.Commitments {
+			c.commitments[k] = c.pairing.NewG2().Mul(c.commitments[k], delta)
+		}
+	case KindReshare:
+		c.commitments = result.Commitments
+		c.threshold, c.totalShares = c.state.Threshold, c.state.TotalShares
+	}
+
+	c.state.Phase = PhaseCompleted
+	c.logger.Info("dkg completed", "kind", c.state.Kind, "epoch", c.state.Epoch, "qualified", c.state.Qualified)
+}
+
+// StartRefresh opens a refresh session for the next epoch once a key exists.
+// Every node deals a sharing of zero, adding the received values to its share re-randomizes it
+// without moving the secret, and shares of different epochs no longer lie on one polynomial.
+func (c *coordinator) StartRefresh() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.checkIdle(); err != nil {
+		return err
+	}
+
+	c.startSession(KindRefresh, c.threshold, c.totalShares)
+	c.logger.Info("dkg refresh started", "epoch", c.state.Epoch)
+	return nil
+}
+
+// StartReshare opens a session in which the current committee hands the key to nodes 1..totalShares
+// under the new threshold. Every old node deals a sharing of its own share, every new node combines
+// the sub-shares of the qualified dealers with the Lagrange weights of their IDs. The key never moves,
+// and since the new shares lie on a fresh polynomial they start a new epoch.
+func (c *coordinator) StartReshare(threshold, totalShares int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := checkQuorum(threshold, totalShares); err != nil {
+		return err
+	}
+	if err := c.checkIdle(); err != nil {
+		return err
+	}
+
+	c.startSession(KindReshare, threshold, totalShares)
+	c.state.PreviousThreshold = c.threshold
+	c.state.PreviousTotalShares = c.totalShares
+	c.logger.Info("dkg reshare started", "epoch", c.state.Epoch, "threshold", threshold, "shares", totalShares)
+	return nil
+}
+
+// Resume picks up a key generated before a restart of the KMS: the session of the given epoch is taken as completed,
+// with the joint commitments and the committee of totalShares nodes the keystore recorded for it.
+func (c *coordinator) Resume(epoch, totalShares int, commitments []string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.state.PublicKey != "" || c.state.Phase != PhaseRegistering || len(c.state.TransportKeys) > 0 {
+		return fmt.Errorf("%w: the coordinator has already started", ErrWrongPhase)
+	}
+	if len(commitments) < 1 || totalShares < len(commitments) {
+		return errors.New("invalid committee for the distributed key")
+	}
+
+	decoded := make([]group.Element, len(commitments))
+	for k, encoded := range commitments {
+		commitment, err := decodeG2(c.pairing, encoded)
+		if err != nil {
+			return fmt.Errorf("decoding commitment %d: %w", k, err)
+		}
+		decoded[k] = commitment
+	}
+
+	c.threshold, c.totalShares, c.commitments = len(decoded), totalShares, decoded
+	c.state.Epoch = epoch
+	c.state.Phase = PhaseCompleted
+	c.state.Threshold = c.threshold
+	c.state.TotalShares = c.totalShares
+	c.state.PublicKey = commitments[0]
+
+	c.logger.Info("dkg resumed", "epoch", epoch, "threshold", c.threshold, "shares", c.totalShares)
+	return nil
+}
+
+// checkIdle makes sure a key exists and no session is running
+func (c *coordinator) checkIdle() error {
+	if c.state.PublicKey == "" {
+		return fmt.Errorf("%w: no distributed key yet", ErrWrongPhase)
+	}
+	if c.state.Phase != PhaseCompleted && c.state.Phase != PhaseFailed {
+		return fmt.Errorf("%w: a %s session is still %s", ErrWrongPhase, c.state.Kind, c.state.Phase)
+	}
+	return nil
+}
+
+// startSession resets the transcript for a new session of the next epoch
+func (c *coordinator) startSession(kind string, threshold, totalShares int) {
+	c.state = State{
+		Kind:          kind,
+		Epoch:         c.state.Epoch + 1,
+		Phase:         PhaseRegistering,
+		Generator:     c.state.Generator,
+		Threshold:     threshold,
+		TotalShares:   totalShares,
+		TransportKeys: make(map[int]string),
+		Deals:         make(map[int]Deal),
+		Complaints:    make(map[int][]int),
+		Answers:       make(map[int]map[int]SharePair),
+		Reveals:       make(map[int][]string),
+		Accusations:   make(map[int]map[int]SharePair),
+		Disclosures:   make(map[int]map[int]SharePair),
+		PublicKey:     c.state.PublicKey,
+	}
+}
+
+// aggregate combines the revealed commitments of the qualified dealers.
+// The joint polynomial is the sum of theirs, so its commitments are the products A_k = prod_i A_ik,
+// the public key is A_0 (the identity in a refresh) and the verification key of node j is prod_k A_k^{j^k}.
+// In a reshare the joint polynomial is the Lagrange combination sum_i l_i f_i instead, so A_k = prod_i A_ik^{l_i}.
+func (c *coordinator) aggregate() (Result, error) {
+	commitments := make([]group.Element, c.state.Threshold)
+	for k := range commitments {
+		commitments[k] = c.pairing.NewG2().Set1()
+	}
+
+	var weights map[int]group.Element
+	if c.state.Kind == KindReshare {
+		weights = lagrangeAtZero(c.pairing, c.state.Qualified)
+	}
+
+	for _, dealer := range c.state.Qualified {
+		reveal, err := c.decodeCommitments(c.state.Reveals[dealer])
+		if err != nil {
+			return Result{}, err
+		}
+		for k, commitment := range reveal {
+			if weights != nil {
+				commitment = c.pairing.NewG2().PowZn(commitment, weights[dealer])
+			}
+			commitments[k].ThenMul(commitment)
+		}
+	}
+
+	if c.state.Kind == KindReshare && !commitments[0].Equals(c.commitments[0]) {
+		return Result{}, errors.New("reshared polynomial does not hide the public key")
+	}
+
+	verificationKeys := make(map[int]group.Element, c.state.TotalShares)
+	for id := 1; id <= c.state.TotalShares; id++ {
+		verificationKeys[id] = evaluateCommitments(c.pairing, commitments, id)
+	}
+
+	return Result{
+		PublicKey:        commitments[0],
+		Commitments:      commitments,
+		VerificationKeys: verificationKeys,
+		Threshold:        c.state.Threshold,
+		TotalShares:      c.state.TotalShares,
+		Epoch:            c.state.Epoch,
+	}, nil
+}
+
+// decodeCommitments decodes the commitments of one dealer to a polynomial of degree t-1.
+// Refresh dealers omit the constant term, it is the identity and is put back in front here.
+func (c *coordinator) decodeCommitments(encoded []string) ([]group.Element, error) {
+	commitments := make([]group.Element, 0, c.state.Threshold)
+	if c.state.Kind == KindRefresh {
+		commitments = append(commitments, c.pairing.NewG2().Set1())
+	}
+
+	if len(commitments)+len(encoded) != c.state.Threshold {
+		return nil, fmt.Errorf("expected %d commitments, got %d", c.state.Threshold-len(commitments), len(encoded))
+	}
+	for k, value := range encoded {
+		commitment, err := decodeG2(c.pairing, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid commitment %d: %w", k, err)
+		}
+		commitments = append(commitments, commitment)
+	}
+	return commitments, nil
+}
+
+// checkPair checks a published share pair of the dealer for the receiver against the dealer's Pedersen commitments,
+// g^s h^{s'} = prod_k C_k^{j^k}, and returns the share s
+func (c *coordinator) checkPair(dealer, receiver int, pair SharePair) (group.Element, error) {
+	commitments, err := c.decodeCommitments(c.state.Deals[dealer].Commitments)
+	if err != nil {
+		return nil, err
+	}
+	share, err := decodeZr(c.pairing, pair.Share)
+	if err != nil {
+		return nil, fmt.Errorf("invalid share: %w", err)
+	}
+	blinding, err := decodeZr(c.pairing, pair.Blinding)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blinding: %w", err)
+	}
+
+	actual := c.pairing.NewG2().PowZn(c.generator, share)
+	actual.ThenMul(c.pairing.NewG2().PowZn(c.base, blinding))
+	if !actual.Equals(evaluateCommitments(c.pairing, commitments, receiver)) {
+		return nil, errors.New("share pair does not match the dealer's commitments")
+	}
+	return share, nil
+}
+
+// checkAccusation checks the pair proves the dealer cheated: it is the dealer's share for the receiver according
+// to the Pedersen commitments, but g^s does not match the reveal
+func (c *coordinator) checkAccusation(dealer, receiver int, pair SharePair) error {
+	share, err := c.checkPair(dealer, receiver, pair)
+	if err != nil {
+		return err
+	}
+	reveal, err := c.decodeCommitments(c.state.Reveals[dealer])
+	if err != nil {
+		return err
+	}
+	if c.pairing.NewG2().PowZn(c.generator, share).Equals(evaluateCommitments(c.pairing, reveal, receiver)) {
+		return errors.New("share matches the dealer's reveal")
+	}
+	return nil
+}
+
+// complainers returns the receivers complaining about the dealer, in ascending order
+func (c *coordinator) complainers(dealer int) []int {
+	complainers := make([]int, 0)
+	for receiver, accused := range c.state.Complaints {
+		for _, accusedDealer := range accused {
+			if accusedDealer == dealer {
+				complainers = append(complainers, receiver)
+			}
+		}
+	}
+	sort.Ints(complainers)
+	return complainers
+}
+
+// checkMessage validates the phase and the sender of an incoming message
+func (c *coordinator) checkMessage(phase string, nodeID int) error {
+	if c.state.Phase != phase {
+		return fmt.Errorf("%w: expected %s, session is %s", ErrWrongPhase, phase, c.state.Phase)
+	}
+	if nodeID < 1 || nodeID > c.participants() {
+		return fmt.Errorf("node id must be between 1 and %d", c.participants())
+	}
+	return nil
+}
+
+// dealers is the number of nodes dealing in the session, the old committee in a reshare
+func (c *coordinator) dealers() int {
+	if c.state.Kind == KindReshare {
+		return c.state.PreviousTotalShares
+	}
+	return c.state.TotalShares
+}
+
+// participants is the number of nodes taking part in the session as dealer, receiver or both
+func (c *coordinator) participants() int {
+	if c.dealers() > c.state.TotalShares {
+		return c.dealers()
+	}
+	return c.state.TotalShares
+}
+
+// minQualified is the smallest qualified set that keeps the key safe, or in a reshare recoverable
+func (c *coordinator) minQualified() int {
+	if c.state.Kind == KindReshare {
+		return c.state.PreviousThreshold
+	}
+	return c.state.Threshold
+}
+
+// disqualify removes a dealer from the qualified set and fails the session if too few are left
+func (c *coordinator) disqualify(nodeID int) {
+	qualified := make([]int, 0, len(c.state.Qualified))
+	for _, dealer := range c.state.Qualified {
+		if dealer != nodeID {
+			qualified = append(qualified, dealer)
+		}
+	}
+	c.state.Qualified = qualified
+	c.logger.Warn("dkg dealer disqualified", "node_id", nodeID)
+
+	if len(qualified) < c.minQualified() {
+		c.fail(fmt.Sprintf("only %d qualified dealers, need at least %d", len(qualified), c.minQualified()))
+	}
+}
+
+func (c *coordinator) isQualified(nodeID int) bool {
+	i := sort.SearchInts(c.state.Qualified, nodeID)
+	return i < len(c.state.Qualified) && c.state.Qualified[i] == nodeID
+}
+
+func (c *coordinator) fail(reason string) {
+	c.logger.Error("dkg failed", "reason", reason)
+	c.state.Phase = PhaseFailed
+	c.state.Reason = reason
+}
+
+// firstCommitted is the index of the first coefficient a dealer commits to, refresh polynomials have no constant term
+func firstCommitted(kind string) int {
+	if kind == KindRefresh {
+		return 1
+	}
+	return 0
+}
+
+// interpolate returns the coefficients of the polynomial of degree threshold-1 through the first threshold points
+// (j, f(j)), as sum_j f(j) prod_{m != j} (x - m) / (j - m)
+func interpolate(pairing group.Pairing, points map[int]group.Element, threshold int) []group.Element {
+	ids := make([]int, 0, len(points))
+	for id := range points {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	ids = ids[:threshold]
+
+	coefficients := make([]group.Element, threshold)
+	for k := range coefficients {
+		coefficients[k] = pairing.NewZr().Set0()
+	}
+	for _, j := range ids {
+		// basis holds the coefficients of prod_{m != j} (x - m), built up one factor at a time
+		basis := []group.Element{pairing.NewZr().Set1()}
+		denominator := pairing.NewZr().Set1()
+		for _, m := range ids {
+			if m == j {
+				continue
+			}
+			root := pairing.NewZr().SetInt32(int32(m))
+			next := make([]group.Element, len(basis)+1)
+			for k := range next {
+				next[k] = pairing.NewZr().Set0()
+			}
+			for k, coefficient := range basis {
+				next[k+1].ThenAdd(coefficient)
+				next[k].ThenAdd(pairing.NewZr().Sub(pairing.NewZr().Set0(), pairing.NewZr().Mul(root, coefficient)))
+			}
+			basis = next
+			denominator.ThenMul(pairing.NewZr().SetInt32(int32(j - m)))
+		}
+
+		weight := pairing.NewZr().Div(points[j], denominator)
+		for k, coefficient := range basis {
+			coefficients[k].ThenAdd(pairing.NewZr().Mul(weight, coefficient))
+		}
+	}
+	return coefficients
+}
+
+// lagrangeAtZero returns the weights l_i = prod_{j != i} j / (j - i) that interpolate f(0) from the values f(i)
+func lagrangeAtZero(pairing group.Pairing, ids []int) map[int]group.Element {
+	weights := make(map[int]group.Element, len(ids))
+	for _, i := range ids {
+		numerator := pairing.NewZr().Set1()
+		denominator := pairing.NewZr().Set1()
+		for _, j := range ids {
+			if i == j {
+				continue
+			}
+			numerator.ThenMul(pairing.NewZr().SetInt32(int32(j)))
+			denominator.ThenMul(pairing.NewZr().SetInt32(int32(j - i)))
+		}
+		weights[i] = numerator.ThenDiv(denominator)
+	}
+	return weights
+}
+
+// evaluateCommitments computes prod_k C_k^{x^k}, i.e. g^{f(x)} for the committed polynomial f
+func evaluateCommitments(pairing group.Pairing, commitments []group.Element, x int) group.Element {
+	result := pairing.NewG2().Set1()
+	index := pairing.NewZr().SetInt32(int32(x))
+	power := pairing.NewZr().Set1()
+	for _, commitment := range commitments {
+		result.ThenMul(pairing.NewG2().PowZn(commitment, power))
+		power.ThenMul(index)
+	}
+	return result
+}
+
+// checkQuorum checks 1 <= threshold <= totalShares <= config.MaxShares
+func checkQuorum(threshold, totalShares int) error {
+	if threshold < 1 || totalShares < 1 {
+		return errors.New("threshold and total shares must be greater than 0")
+	}
+	if threshold > totalShares {
+		return errors.New("threshold cannot be greater than total shares")
+	}
+	if totalShares > config.MaxShares {
+		return fmt.Errorf("at most %d shares", config.MaxShares)
+	}
+	return nil
+}
+
+// decodeZr decodes a base64-encoded scalar
+func decodeZr(pairing group.Pairing, encoded string) (group.Element, error) {
+	scalarBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(scalarBytes) != int(pairing.ZrLength()) {
+		return nil, fmt.Errorf("expected %d bytes, got %d", pairing.ZrLength(), len(scalarBytes))
+	}
+	return pairing.NewZr().SetBytes(scalarBytes), nil
+}
+
+// copyPairs copies the outer map of published share pairs, the inner maps are never modified once recorded
+func copyPairs(pairs map[int]map[int]SharePair) map[int]map[int]SharePair {
+	copied := make(map[int]map[int]SharePair, len(pairs))
+	for id, inner := range pairs {
+		copied[id] = inner
+	}
+	return copied
+}
+
+// decodeG2 decodes a base64-encoded G2 element, checking its length before the pairing library reads it
+func decodeG2(pairing group.Pairing, encoded string) (group.Element, error) {
+	elementBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(elementBytes) != int(pairing.G2Length()) {
+		return nil, fmt.Errorf("expected %d bytes, got %d", pairing.G2Length(), len(elementBytes))
+	}
+
+	element := pairing.NewG2().SetBytes(elementBytes)
+	if element.Is0() {
+		return nil, errors.New("G2 element is zero after SetBytes")
+	}
+	return element, nil
+}
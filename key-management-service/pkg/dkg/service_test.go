@@ -0,0 +1,466 @@
+package dkg
+
+import (
+	"encoding/base64"
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/group"
+	"testing"
+)
+
+type testPublisher struct {
+	keys      []Result
+	refreshes []Result
+}
+
+func (p *testPublisher) PublishDistributedKey(result Result) error {
+	p.keys = append(p.keys, result)
+	return nil
+}
+
+func (p *testPublisher) PublishRefresh(result Result) error {
+	p.refreshes = append(p.refreshes, result)
+	return nil
+}
+
+// testSession plays every node of a session against the coordinator, with the dealers' polynomials in the clear
+type testSession struct {
+	t           *testing.T
+	pairing     group.Pairing
+	coordinator *coordinator
+	publisher   *testPublisher
+	secret      map[int][]group.Element
+	blinding    map[int][]group.Element
+}
+
+func newTestSession(t *testing.T, threshold, totalShares int) *testSession {
+	t.Helper()
+
+	pairing, err := group.NewPairing(group.BLS12381Params())
+	if err != nil {
+		t.Fatalf("NewPairing: %v", err)
+	}
+	logger, err := logging.NewLogger(logging.LoggerConfig{CommandHandler: "text", LogLevel: "error"})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	publisher := &testPublisher{}
+	conf := config.Config{ThresholdConfig: config.ThresholdConfig{Enabled: true, Threshold: threshold, TotalShares: totalShares}}
+	c, err := NewCoordinator(conf, pairing, pairing.NewG2().Rand(), publisher, logger)
+	if err != nil {
+		t.Fatalf("NewCoordinator: %v", err)
+	}
+	return &testSession{t: t, pairing: pairing, coordinator: c.(*coordinator), publisher: publisher}
+}
+
+// register registers every node and deals for every dealer, the given dealers share the given secrets
+func (s *testSession) register(secrets map[int]group.Element) {
+	s.t.Helper()
+	c := s.coordinator
+	for id := 1; id <= c.participants(); id++ {
+		transportKey := s.encodeG2(s.pairing.NewG2().PowZn(c.generator, s.pairing.NewZr().Rand()))
+		if err := c.Register(id, transportKey); err != nil {
+			s.t.Fatalf("Register(%d): %v", id, err)
+		}
+	}
+
+	s.secret, s.blinding = make(map[int][]group.Element), make(map[int][]group.Element)
+	for dealer := 1; dealer <= c.dealers(); dealer++ {
+		s.secret[dealer], s.blinding[dealer] = s.randomPolynomial(), s.randomPolynomial()
+		if secret, ok := secrets[dealer]; ok {
+			s.secret[dealer][0].Set(secret)
+		}
+		if c.state.Kind == KindRefresh {
+			s.secret[dealer][0].Set0()
+			s.blinding[dealer][0].Set0()
+		}
+
+		commitments := make([]string, 0, c.state.Threshold)
+		for k := firstCommitted(c.state.Kind); k < c.state.Threshold; k++ {
+			commitment := s.pairing.NewG2().PowZn(c.generator, s.secret[dealer][k])
+			commitment.ThenMul(s.pairing.NewG2().PowZn(c.base, s.blinding[dealer][k]))
+			commitments = append(commitments, s.encodeG2(commitment))
+		}
+		// The coordinator cannot read the encrypted shares, the tests publish the pairs they need in the clear
+		shares := make([]EncryptedShare, 0, c.state.TotalShares)
+		for recipient := 1; recipient <= c.state.TotalShares; recipient++ {
+			shares = append(shares, EncryptedShare{Recipient: recipient})
+		}
+		if err := c.SubmitDeal(dealer, Deal{Commitments: commitments, Shares: shares}); err != nil {
+			s.t.Fatalf("SubmitDeal(%d): %v", dealer, err)
+		}
+	}
+}
+
+// complain submits the complaints of every receiver, by receiver
+func (s *testSession) complain(complaints map[int][]int) {
+	s.t.Helper()
+	for receiver := 1; receiver <= s.coordinator.state.TotalShares; receiver++ {
+		if err := s.coordinator.SubmitComplaints(receiver, complaints[receiver]); err != nil {
+			s.t.Fatalf("SubmitComplaints(%d): %v", receiver, err)
+		}
+	}
+}
+
+// reveal submits the Feldman commitments of the qualified dealers, with the given dealers revealing other polynomials
+func (s *testSession) reveal(rogue map[int][]group.Element) {
+	s.t.Helper()
+	for _, dealer := range s.coordinator.state.Qualified {
+		polynomial := s.secret[dealer]
+		if rogue[dealer] != nil {
+			polynomial = rogue[dealer]
+		}
+		if err := s.coordinator.SubmitReveal(dealer, s.feldman(polynomial)); err != nil {
+			s.t.Fatalf("SubmitReveal(%d): %v", dealer, err)
+		}
+	}
+}
+
+// verify has every receiver check its shares against the reveals and accuse the dealers that do not match
+func (s *testSession) verify() {
+	s.t.Helper()
+	c := s.coordinator
+	for receiver := 1; receiver <= c.state.TotalShares; receiver++ {
+		accusations := make(map[int]SharePair)
+		for _, dealer := range c.state.Qualified {
+			reveal, err := c.decodeCommitments(c.state.Reveals[dealer])
+			if err != nil {
+				s.t.Fatalf("decoding reveal of %d: %v", dealer, err)
+			}
+			share := s.evaluate(s.secret[dealer], receiver)
+			if !s.pairing.NewG2().PowZn(c.generator, share).Equals(evaluateCommitments(s.pairing, reveal, receiver)) {
+				accusations[dealer] = s.pair(dealer, receiver)
+			}
+		}
+		if err := c.SubmitVerification(receiver, accusations); err != nil {
+			s.t.Fatalf("SubmitVerification(%d): %v", receiver, err)
+		}
+	}
+}
+
+// disclose has every receiver disclose its shares of the dealers being reconstructed
+func (s *testSession) disclose() {
+	s.t.Helper()
+	c := s.coordinator
+	for receiver := 1; receiver <= c.state.TotalShares; receiver++ {
+		disclosures := make(map[int]SharePair)
+		for _, dealer := range c.state.Reconstructed {
+			disclosures[dealer] = s.pair(dealer, receiver)
+		}
+		if err := c.SubmitDisclosures(receiver, disclosures); err != nil {
+			s.t.Fatalf("SubmitDisclosures(%d): %v", receiver, err)
+		}
+	}
+}
+
+// publicKey is g to the sum of the constant terms the given dealers actually shared
+func (s *testSession) publicKey(dealers []int) group.Element {
+	secret := s.pairing.NewZr().Set0()
+	for _, dealer := range dealers {
+		secret.ThenAdd(s.secret[dealer][0])
+	}
+	return s.pairing.NewG2().PowZn(s.coordinator.generator, secret)
+}
+
+func (s *testSession) pair(dealer, receiver int) SharePair {
+	return SharePair{
+		Share:    base64.StdEncoding.EncodeToString(s.evaluate(s.secret[dealer], receiver).Bytes()),
+		Blinding: base64.StdEncoding.EncodeToString(s.evaluate(s.blinding[dealer], receiver).Bytes()),
+	}
+}
+
+func (s *testSession) feldman(polynomial []group.Element) []string {
+	reveal := make([]string, 0, len(polynomial))
+	for k := firstCommitted(s.coordinator.state.Kind); k < len(polynomial); k++ {
+		reveal = append(reveal, s.encodeG2(s.pairing.NewG2().PowZn(s.coordinator.generator, polynomial[k])))
+	}
+	return reveal
+}
+
+func (s *testSession) randomPolynomial() []group.Element {
+	polynomial := make([]group.Element, s.coordinator.state.Threshold)
+	for k := range polynomial {
+		polynomial[k] = s.pairing.NewZr().Rand()
+	}
+	return polynomial
+}
+
+func (s *testSession) evaluate(polynomial []group.Element, x int) group.Element {
+	result := s.pairing.NewZr().Set0()
+	index := s.pairing.NewZr().SetInt32(int32(x))
+	for k := len(polynomial) - 1; k >= 0; k-- {
+		result.ThenMul(index)
+		result.ThenAdd(polynomial[k])
+	}
+	return result
+}
+
+func (s *testSession) encodeG2(element group.Element) string {
+	return base64.StdEncoding.EncodeToString(element.Bytes())
+}
+
+func (s *testSession) expectPhase(phase string) {
+	s.t.Helper()
+	if s.coordinator.state.Phase != phase {
+		s.t.Fatalf("phase = %s (%s), want %s", s.coordinator.state.Phase, s.coordinator.state.Reason, phase)
+	}
+}
+
+func TestKeygen(t *testing.T) {
+	s := newTestSession(t, 3, 5)
+	s.register(nil)
+	s.complain(nil)
+	s.expectPhase(PhaseRevealing)
+
+	s.reveal(nil)
+	s.expectPhase(PhaseVerifying)
+	if len(s.publisher.keys) != 0 {
+		t.Fatal("key published before the receivers verified the reveals")
+	}
+
+	s.verify()
+	s.expectPhase(PhaseCompleted)
+	if len(s.publisher.keys) != 1 || !s.publisher.keys[0].PublicKey.Equals(s.publicKey([]int{1, 2, 3, 4, 5})) {
+		t.Fatalf("published %d keys, want the joint key of all dealers", len(s.publisher.keys))
+	}
+}
+
+func TestRegisterChecksTransportKey(t *testing.T) {
+	s := newTestSession(t, 2, 3)
+	encoded := s.pairing.NewG2().PowZn(s.coordinator.generator, s.pairing.NewZr().Rand()).Bytes()
+
+	for name, transportKey := range map[string]string{
+		"empty":      "",
+		"too short":  base64.StdEncoding.EncodeToString(encoded[:len(encoded)-1]),
+		"too long":   base64.StdEncoding.EncodeToString(append(encoded, 0)),
+		"identity":   s.encodeG2(s.pairing.NewG2()),
+		"not base64": "transport key",
+	} {
+		if err := s.coordinator.Register(1, transportKey); err == nil {
+			t.Errorf("%s transport key registered", name)
+		}
+	}
+	if err := s.coordinator.Register(1, base64.StdEncoding.EncodeToString(encoded)); err != nil {
+		t.Errorf("Register: %v", err)
+	}
+}
+
+func TestComplaintAnswers(t *testing.T) {
+	tests := []struct {
+		name       string
+		complaints map[int][]int
+		answer     func(s *testSession) map[int]SharePair
+		qualified  []int
+	}{
+		{
+			name:       "answered with the disputed share",
+			complaints: map[int][]int{2: {1}, 4: {1}},
+			answer: func(s *testSession) map[int]SharePair {
+				return map[int]SharePair{2: s.pair(1, 2), 4: s.pair(1, 4)}
+			},
+			qualified: []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:       "answered with a share that does not match the commitments",
+			complaints: map[int][]int{2: {1}},
+			answer: func(s *testSession) map[int]SharePair {
+				return map[int]SharePair{2: s.pair(1, 3)}
+			},
+			qualified: []int{2, 3, 4, 5},
+		},
+		{
+			name:       "one complaint left unanswered",
+			complaints: map[int][]int{2: {1}, 4: {1}},
+			answer: func(s *testSession) map[int]SharePair {
+				return map[int]SharePair{2: s.pair(1, 2)}
+			},
+			qualified: []int{2, 3, 4, 5},
+		},
+		{
+			name:       "accused by a threshold of receivers",
+			complaints: map[int][]int{2: {1}, 3: {1}, 4: {1}},
+			qualified:  []int{2, 3, 4, 5},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestSession(t, 3, 5)
+			s.register(nil)
+			s.complain(test.complaints)
+
+			if test.answer != nil {
+				s.expectPhase(PhaseAnswering)
+				if err := s.coordinator.SubmitReveal(2, s.feldman(s.secret[2])); err == nil {
+					t.Error("reveal accepted before the complaints were answered")
+				}
+				err := s.coordinator.SubmitAnswers(1, test.answer(s))
+				if disqualified := len(test.qualified) < 5; disqualified != (err != nil) {
+					t.Errorf("SubmitAnswers: err = %v", err)
+				}
+			}
+			s.expectPhase(PhaseRevealing)
+			if got := s.coordinator.state.Qualified; len(got) != len(test.qualified) || got[0] != test.qualified[0] {
+				t.Fatalf("qualified = %v, want %v", got, test.qualified)
+			}
+
+			s.reveal(nil)
+			s.verify()
+			s.expectPhase(PhaseCompleted)
+			if !s.publisher.keys[0].PublicKey.Equals(s.publicKey(test.qualified)) {
+				t.Error("published key is not the joint key of the qualified dealers")
+			}
+		})
+	}
+}
+
+// A qualified dealer reveals a polynomial other than the one it dealt, chosen so that the public key becomes g^x
+// for an x it knows. The receivers' shares expose it and its actual polynomial is reconstructed instead.
+func TestRogueRevealIsReconstructed(t *testing.T) {
+	s := newTestSession(t, 3, 5)
+	s.register(nil)
+	s.complain(nil)
+
+	// With the honest reveals known, a_0 = x - sum of the others' constant terms makes the joint key g^x
+	x := s.pairing.NewZr().Rand()
+	rogue := s.randomPolynomial()
+	rogue[0].Set(x)
+	for dealer := 1; dealer <= 4; dealer++ {
+		rogue[0] = s.pairing.NewZr().Sub(rogue[0], s.secret[dealer][0])
+	}
+	s.reveal(map[int][]group.Element{5: rogue})
+	s.verify()
+
+	s.expectPhase(PhaseReconstructing)
+	if got := s.coordinator.state.Reconstructed; len(got) != 1 || got[0] != 5 {
+		t.Fatalf("reconstructed = %v, want [5]", got)
+	}
+	s.disclose()
+
+	s.expectPhase(PhaseCompleted)
+	publicKey := s.publisher.keys[0].PublicKey
+	if publicKey.Equals(s.pairing.NewG2().PowZn(s.coordinator.generator, x)) {
+		t.Fatal("rogue dealer chose the public key")
+	}
+	if !publicKey.Equals(s.publicKey([]int{1, 2, 3, 4, 5})) {
+		t.Error("published key is not the joint key of the dealt polynomials")
+	}
+	// Every receiver's share matches the published verification keys
+	for receiver := 1; receiver <= 5; receiver++ {
+		share := s.pairing.NewZr().Set0()
+		for dealer := 1; dealer <= 5; dealer++ {
+			share.ThenAdd(s.evaluate(s.secret[dealer], receiver))
+		}
+		if !s.pairing.NewG2().PowZn(s.coordinator.generator, share).Equals(s.publisher.keys[0].VerificationKeys[receiver]) {
+			t.Errorf("share of node %d does not match its verification key", receiver)
+		}
+	}
+}
+
+func TestUnprovenAccusationsAreIgnored(t *testing.T) {
+	s := newTestSession(t, 2, 3)
+	s.register(nil)
+	s.complain(nil)
+	s.reveal(nil)
+
+	c := s.coordinator
+	accusations := []map[int]SharePair{
+		// A share of another receiver does not match the commitments for this one
+		{1: s.pair(1, 2)},
+		// The actual share matches the reveal, so it proves nothing
+		{2: s.pair(2, 2)},
+		{},
+	}
+	for i, accusation := range accusations {
+		if err := c.SubmitVerification(i+1, accusation); err != nil {
+			t.Fatalf("SubmitVerification(%d): %v", i+1, err)
+		}
+	}
+	s.expectPhase(PhaseCompleted)
+	if len(c.state.Reconstructed) != 0 || len(c.state.Qualified) != 3 {
+		t.Errorf("honest dealers reconstructed %v or disqualified, qualified %v", c.state.Reconstructed, c.state.Qualified)
+	}
+}
+
+// In a reshare the key is fixed by the old shares, so a dealer whose reveal does not match is dropped
+func TestReshareDropsCheatingDealer(t *testing.T) {
+	s := newTestSession(t, 2, 3)
+	s.register(nil)
+	s.complain(nil)
+	s.reveal(nil)
+	s.verify()
+	s.expectPhase(PhaseCompleted)
+	publicKey := s.publisher.keys[0].PublicKey
+
+	shares := make(map[int]group.Element)
+	for node := 1; node <= 3; node++ {
+		shares[node] = s.pairing.NewZr().Set0()
+		for dealer := 1; dealer <= 3; dealer++ {
+			shares[node].ThenAdd(s.evaluate(s.secret[dealer], node))
+		}
+	}
+
+	if err := s.coordinator.StartReshare(3, 4); err != nil {
+		t.Fatalf("StartReshare: %v", err)
+	}
+	s.register(shares)
+	s.complain(nil)
+
+	// Dealer 2 reveals its own share as the constant term but binds nothing else
+	rogue := s.randomPolynomial()
+	rogue[0].Set(shares[2])
+	s.reveal(map[int][]group.Element{2: rogue})
+	s.verify()
+
+	s.expectPhase(PhaseCompleted)
+	if got := s.coordinator.state.Qualified; len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("qualified = %v, want [1 3]", got)
+	}
+	if result := s.publisher.keys[1]; !result.PublicKey.Equals(publicKey) || result.Threshold != 3 || result.TotalShares != 4 {
+		t.Errorf("reshare published threshold %d of %d under another key", result.Threshold, result.TotalShares)
+	}
+}
+
+func TestRefreshReconstructsCheatingDealer(t *testing.T) {
+	s := newTestSession(t, 2, 3)
+	s.register(nil)
+	s.complain(nil)
+	s.reveal(nil)
+	s.verify()
+
+	if err := s.coordinator.StartRefresh(); err != nil {
+		t.Fatalf("StartRefresh: %v", err)
+	}
+	s.register(nil)
+	s.complain(nil)
+	rogue := s.randomPolynomial()
+	rogue[0].Set0()
+	s.reveal(map[int][]group.Element{3: rogue})
+	s.verify()
+	s.disclose()
+
+	s.expectPhase(PhaseCompleted)
+	delta := s.publisher.refreshes[0]
+	for node := 1; node <= 3; node++ {
+		share := s.pairing.NewZr().Set0()
+		for dealer := 1; dealer <= 3; dealer++ {
+			share.ThenAdd(s.evaluate(s.secret[dealer], node))
+		}
+		if !s.pairing.NewG2().PowZn(s.coordinator.generator, share).Equals(delta.VerificationKeys[node]) {
+			t.Errorf("refresh of node %d does not match the published commitments", node)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	s := newTestSession(t, 3, 5)
+	polynomial := s.randomPolynomial()
+	points := map[int]group.Element{5: s.evaluate(polynomial, 5), 2: s.evaluate(polynomial, 2), 4: s.evaluate(polynomial, 4), 1: s.evaluate(polynomial, 1)}
+
+	coefficients := interpolate(s.pairing, points, 3)
+	for k := range polynomial {
+		if !coefficients[k].Equals(polynomial[k]) {
+			t.Errorf("coefficient %d differs", k)
+		}
+	}
+}
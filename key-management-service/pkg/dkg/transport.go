@@ -0,0 +1,101 @@
+package dkg
+
+import (
+	"github.com/go-chi/chi/v5"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/mdshahjahanmiah/explore-go/error"
+	"github.com/mdshahjahanmiah/explore-go/http"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+)
+
+func MakeHandler(config config.Config, coordinator Coordinator) http.Endpoint {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerBefore(kithttp.PopulateRequestContext),
+		kithttp.ServerErrorEncoder(error.EncodeError),
+	}
+	nodes, admins := config.AuthConfig.NodeTokens, config.AuthConfig.AdminTokens
+
+	handleState := kithttp.NewServer(
+		getStateEndpoint(coordinator),
+		kithttp.NopRequestDecoder,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleRegister := kithttp.NewServer(
+		getRegisterEndpoint(coordinator, nodes),
+		decodeRegisterRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleDeal := kithttp.NewServer(
+		getDealEndpoint(coordinator, nodes),
+		decodeDealRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleComplaint := kithttp.NewServer(
+		getComplaintEndpoint(coordinator, nodes),
+		decodeComplaintRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleAnswer := kithttp.NewServer(
+		getAnswerEndpoint(coordinator, nodes),
+		decodeAnswerRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleReveal := kithttp.NewServer(
+		getRevealEndpoint(coordinator, nodes),
+		decodeRevealRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleVerification := kithttp.NewServer(
+		getVerificationEndpoint(coordinator, nodes),
+		decodeVerificationRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleDisclosure := kithttp.NewServer(
+		getDisclosureEndpoint(coordinator, nodes),
+		decodeDisclosureRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleRefresh := kithttp.NewServer(
+		getRefreshEndpoint(coordinator, admins, config.KeyTenant),
+		kithttp.NopRequestDecoder,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleReshare := kithttp.NewServer(
+		getReshareEndpoint(coordinator, admins, config.KeyTenant),
+		decodeReshareRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	r := chi.NewRouter()
+	r.Method("GET", "/dkg/state", handleState)
+	r.Method("POST", "/dkg/register", handleRegister)
+	r.Method("POST", "/dkg/deal", handleDeal)
+	r.Method("POST", "/dkg/complaint", handleComplaint)
+	r.Method("POST", "/dkg/answer", handleAnswer)
+	r.Method("POST", "/dkg/reveal", handleReveal)
+	r.Method("POST", "/dkg/verification", handleVerification)
+	r.Method("POST", "/dkg/disclosure", handleDisclosure)
+	r.Method("POST", "/dkg/refresh", handleRefresh)
+	r.Method("POST", "/dkg/reshare", handleReshare)
+
+	return http.Endpoint{Pattern: "/dkg/*", Handler: r}
+}
@@ -0,0 +1,58 @@
+package dkg
+
+import (
+	"github.com/mdshahjahanmiah/key-management-service/pkg/auth"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMessagesNeedTokens(t *testing.T) {
+	s := newTestSession(t, 2, 3)
+	conf := config.Config{
+		KeyTenant: "acme",
+		AuthConfig: config.AuthConfig{
+			NodeTokens:  auth.NodeTokens{1: "node-1", 2: "node-2"},
+			AdminTokens: auth.AdminTokens{"acme": "acme-admin", "globex": "globex-admin"},
+		},
+	}
+	handler := MakeHandler(conf, s.coordinator).Handler
+	register := `{"node_id": 1, "transport_key": "` + s.encodeG2(s.coordinator.generator) + `"}`
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		body   string
+		status int
+	}{
+		{name: "register without a token", target: "/dkg/register", body: register, status: http.StatusUnauthorized},
+		{name: "register as another node", target: "/dkg/register", token: "node-2", body: register, status: http.StatusForbidden},
+		{name: "register with an admin token", target: "/dkg/register", token: "acme-admin", body: register, status: http.StatusUnauthorized},
+		{name: "register as itself", target: "/dkg/register", token: "node-1", body: register, status: http.StatusOK},
+		{name: "deal as another node", target: "/dkg/deal", token: "node-2", body: `{"node_id": 1}`, status: http.StatusForbidden},
+		{name: "answer without a token", target: "/dkg/answer", body: `{"node_id": 1}`, status: http.StatusUnauthorized},
+		{name: "accuse as another node", target: "/dkg/verification", token: "node-1", body: `{"node_id": 2}`, status: http.StatusForbidden},
+		{name: "disclose as another node", target: "/dkg/disclosure", token: "node-1", body: `{"node_id": 2}`, status: http.StatusForbidden},
+		{name: "refresh without a token", target: "/dkg/refresh", status: http.StatusUnauthorized},
+		{name: "refresh as another tenant", target: "/dkg/refresh", token: "globex-admin", status: http.StatusForbidden},
+		{name: "reshare with a node token", target: "/dkg/reshare", token: "node-1", body: `{"threshold": 2, "total_shares": 3}`, status: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodPost, test.target, strings.NewReader(test.body))
+		if test.token != "" {
+			request.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		if response.Code != test.status {
+			t.Errorf("%s: status %d, want %d: %s", test.name, response.Code, test.status, response.Body)
+		}
+	}
+
+	if _, ok := s.coordinator.State().TransportKeys[1]; !ok {
+		t.Error("node 1 is not registered")
+	}
+}
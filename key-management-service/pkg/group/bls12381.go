@@ -0,0 +1,341 @@
+package group
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/cloudflare/circl/ecc/bls12381"
+	"hash"
+	"math/big"
+)
+
+// Domain separation tags of hashing to the curve, following the naming of RFC 9380
+var (
+	dstG1 = []byte("THRESHOLD-EXPLORE-V01-CS01-with-BLS12381G1_XMD:SHA-256_SSWU_RO_")
+	dstG2 = []byte("THRESHOLD-EXPLORE-V01-CS01-with-BLS12381G2_XMD:SHA-256_SSWU_RO_")
+)
+
+// order is the order r of G1, G2, GT and Zr
+var order = new(big.Int).SetBytes(bls12381.Order())
+
+// groupKind tells which group a BLS12-381 element belongs to
+type groupKind int
+
+const (
+	kindG1 groupKind = iota
+	kindG2
+	kindGT
+	kindZr
+)
+
+// bls12381Pairing is the pure-Go backend, the optimal ate pairing on BLS12-381 of cloudflare/circl.
+// It is asymmetric with about 128 bits of security, so it has no parameters to generate.
+type bls12381Pairing struct{}
+
+func newBLS12381Pairing() Pairing {
+	return bls12381Pairing{}
+}
+
+func (bls12381Pairing) NewG1() Element { e := &blsElement{kind: kindG1}; e.g1.SetIdentity(); return e }
+func (bls12381Pairing) NewG2() Element { e := &blsElement{kind: kindG2}; e.g2.SetIdentity(); return e }
+func (bls12381Pairing) NewGT() Element { e := &blsElement{kind: kindGT}; e.gt.SetIdentity(); return e }
+func (bls12381Pairing) NewZr() Element { return &blsElement{kind: kindZr} }
+func (bls12381Pairing) G1Length() uint { return bls12381.G1Size }
+func (bls12381Pairing) G2Length() uint { return bls12381.G2Size }
+func (bls12381Pairing) ZrLength() uint { return bls12381.ScalarSize }
+
+// blsElement holds the value of its group only, the other fields stay zero
+type blsElement struct {
+	kind groupKind
+	g1   bls12381.G1
+	g2   bls12381.G2
+	gt   bls12381.Gt
+	zr   bls12381.Scalar
+}
+
+// same returns x as an element of the receiver's group, it panics like PBC on incompatible elements
+func (e *blsElement) same(x Element) *blsElement {
+	other, ok := x.(*blsElement)
+	if !ok || other.kind != e.kind {
+		panic("group: incompatible elements")
+	}
+	return other
+}
+
+// scalar returns i as a Zr element
+func scalar(i Element) *bls12381.Scalar {
+	other, ok := i.(*blsElement)
+	if !ok || other.kind != kindZr {
+		panic("group: exponent is not a Zr element")
+	}
+	return &other.zr
+}
+
+func (e *blsElement) Set0() Element {
+	switch e.kind {
+	case kindG1:
+		e.g1.SetIdentity()
+	case kindG2:
+		e.g2.SetIdentity()
+	case kindGT:
+		e.gt.SetIdentity()
+	case kindZr:
+		e.zr = bls12381.Scalar{}
+	}
+	return e
+}
+
+func (e *blsElement) Set1() Element {
+	if e.kind == kindZr {
+		e.zr.SetOne()
+		return e
+	}
+	return e.Set0()
+}
+
+func (e *blsElement) SetInt32(i int32) Element {
+	return e.SetBig(big.NewInt(int64(i)))
+}
+
+func (e *blsElement) SetBig(i *big.Int) Element {
+	if e.kind != kindZr {
+		panic("group: SetBig applies to Zr elements only")
+	}
+	e.zr.SetBytes(new(big.Int).Mod(i, order).Bytes())
+	return e
+}
+
+func (e *blsElement) Set(src Element) Element {
+	other := e.same(src)
+	*e = *other
+	return e
+}
+
+func (e *blsElement) SetBytes(buf []byte) Element {
+	var err error
+	switch e.kind {
+	case kindG1:
+		err = e.g1.SetBytes(buf)
+	case kindG2:
+		err = e.g2.SetBytes(buf)
+	case kindGT:
+		err = e.gt.UnmarshalBinary(buf)
+		if err == nil && !inGT(&e.gt) {
+			err = errors.New("group: not an element of GT")
+		}
+	case kindZr:
+		e.zr.SetBytes(buf)
+	}
+	if err != nil {
+		e.Set0()
+	}
+	return e
+}
+
+// inGT tells whether x lies in the subgroup of order r of Fp12, which UnmarshalBinary does not check: x^(r-1) x = 1
+func inGT(x *bls12381.Gt) bool {
+	var exponent bls12381.Scalar
+	exponent.SetBytes(new(big.Int).Sub(order, big.NewInt(1)).Bytes())
+	var power bls12381.Gt
+	power.Exp(x, &exponent)
+	power.Mul(&power, x)
+	return power.IsIdentity()
+}
+
+func (e *blsElement) SetFromHash(digest []byte) Element {
+	switch e.kind {
+	case kindG1:
+		e.g1.Hash(digest, dstG1)
+	case kindG2:
+		e.g2.Hash(digest, dstG2)
+	case kindZr:
+		e.zr.SetBytes(digest)
+	default:
+		panic("group: GT elements cannot be hashed to")
+	}
+	return e
+}
+
+func (e *blsElement) SetFromStringHash(s string, h hash.Hash) Element {
+	h.Reset()
+	h.Write([]byte(s))
+	return e.SetFromHash(h.Sum(nil))
+}
+
+func (e *blsElement) Rand() Element {
+	var r bls12381.Scalar
+	if err := r.Random(rand.Reader); err != nil {
+		panic(err)
+	}
+	switch e.kind {
+	case kindG1:
+		e.g1.ScalarMult(&r, bls12381.G1Generator())
+	case kindG2:
+		e.g2.ScalarMult(&r, bls12381.G2Generator())
+	case kindGT:
+		e.gt.Exp(bls12381.Pair(bls12381.G1Generator(), bls12381.G2Generator()), &r)
+	case kindZr:
+		e.zr = r
+	}
+	return e
+}
+
+func (e *blsElement) Add(x, y Element) Element {
+	if e.kind == kindZr {
+		e.zr.Add(&e.same(x).zr, &e.same(y).zr)
+		return e
+	}
+	return e.Mul(x, y)
+}
+
+func (e *blsElement) Sub(x, y Element) Element {
+	if e.kind == kindZr {
+		e.zr.Sub(&e.same(x).zr, &e.same(y).zr)
+		return e
+	}
+	return e.Div(x, y)
+}
+
+func (e *blsElement) Mul(x, y Element) Element {
+	a, b := e.same(x), e.same(y)
+	switch e.kind {
+	case kindG1:
+		e.g1.Add(&a.g1, &b.g1)
+	case kindG2:
+		e.g2.Add(&a.g2, &b.g2)
+	case kindGT:
+		e.gt.Mul(&a.gt, &b.gt)
+	case kindZr:
+		e.zr.Mul(&a.zr, &b.zr)
+	}
+	return e
+}
+
+func (e *blsElement) Div(x, y Element) Element {
+	a, b := e.same(x), e.same(y)
+	switch e.kind {
+	case kindG1:
+		inverse := b.g1
+		inverse.Neg()
+		e.g1.Add(&a.g1, &inverse)
+	case kindG2:
+		inverse := b.g2
+		inverse.Neg()
+		e.g2.Add(&a.g2, &inverse)
+	case kindGT:
+		var inverse bls12381.Gt
+		inverse.Inv(&b.gt)
+		e.gt.Mul(&a.gt, &inverse)
+	case kindZr:
+		var inverse bls12381.Scalar
+		inverse.Inv(&b.zr)
+		e.zr.Mul(&a.zr, &inverse)
+	}
+	return e
+}
+
+func (e *blsElement) PowZn(x, i Element) Element {
+	a, k := e.same(x), scalar(i)
+	switch e.kind {
+	case kindG1:
+		e.g1.ScalarMult(k, &a.g1)
+	case kindG2:
+		e.g2.ScalarMult(k, &a.g2)
+	case kindGT:
+		e.gt.Exp(&a.gt, k)
+	case kindZr:
+		exponent, _ := k.MarshalBinary()
+		base, _ := a.zr.MarshalBinary()
+		power := new(big.Int).Exp(new(big.Int).SetBytes(base), new(big.Int).SetBytes(exponent), order)
+		e.zr.SetBytes(power.Bytes())
+	}
+	return e
+}
+
+func (e *blsElement) Pair(x, y Element) Element {
+	p, ok1 := x.(*blsElement)
+	q, ok2 := y.(*blsElement)
+	if e.kind != kindGT || !ok1 || !ok2 || p.kind != kindG1 || q.kind != kindG2 {
+		panic("group: the pairing maps G1 x G2 to GT")
+	}
+	// Pair normalizes its G1 argument, work on a copy so x is left as it is
+	point := p.g1
+	e.gt = *bls12381.Pair(&point, &q.g2)
+	return e
+}
+
+func (e *blsElement) ThenAdd(y Element) Element   { return e.Add(e, y) }
+func (e *blsElement) ThenMul(y Element) Element   { return e.Mul(e, y) }
+func (e *blsElement) ThenDiv(y Element) Element   { return e.Div(e, y) }
+func (e *blsElement) ThenPowZn(i Element) Element { return e.PowZn(e, i) }
+
+func (e *blsElement) Is0() bool {
+	switch e.kind {
+	case kindG1:
+		return e.g1.IsIdentity()
+	case kindG2:
+		return e.g2.IsIdentity()
+	case kindZr:
+		return e.zr.IsZero() == 1
+	default:
+		return false
+	}
+}
+
+func (e *blsElement) Equals(x Element) bool {
+	other := e.same(x)
+	switch e.kind {
+	case kindG1:
+		return e.g1.IsEqual(&other.g1)
+	case kindG2:
+		return e.g2.IsEqual(&other.g2)
+	case kindGT:
+		return e.gt.IsEqual(&other.gt)
+	default:
+		return e.zr.IsEqual(&other.zr) == 1
+	}
+}
+
+func (e *blsElement) Bytes() []byte {
+	switch e.kind {
+	case kindG1:
+		return e.g1.Bytes()
+	case kindG2:
+		return e.g2.Bytes()
+	case kindGT:
+		encoded, _ := e.gt.MarshalBinary()
+		return encoded
+	default:
+		encoded, _ := e.zr.MarshalBinary()
+		return encoded
+	}
+}
+
+func (e *blsElement) String() string {
+	if e.kind == kindZr {
+		return new(big.Int).SetBytes(e.Bytes()).String()
+	}
+	return hex.EncodeToString(e.Bytes())
+}
+
+// X returns the x coordinate of a point. A G2 coordinate lies in Fp2 and is returned as the integer of its encoding.
+func (e *blsElement) X() *big.Int {
+	encoded := e.point()
+	coordinate := append([]byte(nil), encoded[:len(encoded)/2]...)
+	coordinate[0] &= 0x1F // drop the encoding flags
+	return new(big.Int).SetBytes(coordinate)
+}
+
+// Y returns the y coordinate of a point, see X
+func (e *blsElement) Y() *big.Int {
+	encoded := e.point()
+	return new(big.Int).SetBytes(encoded[len(encoded)/2:])
+}
+
+// point returns the uncompressed encoding x || y of a point of G1 or G2
+func (e *blsElement) point() []byte {
+	if e.kind != kindG1 && e.kind != kindG2 {
+		panic("group: coordinates apply to points of G1 and G2 only")
+	}
+	return e.Bytes()
+}
@@ -0,0 +1,8 @@
+package group
+
+import "errors"
+
+// Only the KMS generates pairing parameters, so the generators live apart from the files every service shares
+
+// ErrNoSuitableCurve is returned by GenerateD when no curve of the requested size exists for the discriminant
+var ErrNoSuitableCurve = errors.New("no suitable curve was found")
@@ -0,0 +1,18 @@
+//go:build !cgo
+
+package group
+
+// GenerateA needs PBC, see the cgo build
+func GenerateA(rbits, qbits uint32) (string, error) {
+	return "", ErrPBCUnavailable
+}
+
+// GenerateD needs PBC, see the cgo build
+func GenerateD(d, rbits, qbits, bitlimit uint32) (string, error) {
+	return "", ErrPBCUnavailable
+}
+
+// GenerateF needs PBC, see the cgo build
+func GenerateF(bits uint32) (string, error) {
+	return "", ErrPBCUnavailable
+}
@@ -0,0 +1,42 @@
+//go:build cgo
+
+package group
+
+import (
+	"errors"
+	"github.com/Nik-U/pbc"
+)
+
+// errNoCurve is returned when no curve of the requested size exists for a discriminant
+var errNoCurve = pbc.ErrNoSuitableCurves
+
+// GenerateA generates the parameters of a symmetric Type A pairing
+func GenerateA(rbits, qbits uint32) (string, error) {
+	params := pbc.GenerateA(rbits, qbits)
+	if params == nil {
+		return "", errors.New("failed to generate pairing parameters")
+	}
+	return params.String(), nil
+}
+
+// GenerateD generates the parameters of a Type D pairing for the discriminant d. It returns ErrNoSuitableCurve when no
+// curve of the requested size exists for d.
+func GenerateD(d, rbits, qbits, bitlimit uint32) (string, error) {
+	params, err := pbc.GenerateD(d, rbits, qbits, bitlimit)
+	if errors.Is(err, errNoCurve) {
+		return "", ErrNoSuitableCurve
+	}
+	if err != nil {
+		return "", err
+	}
+	return params.String(), nil
+}
+
+// GenerateF generates the parameters of a Type F pairing
+func GenerateF(bits uint32) (string, error) {
+	params := pbc.GenerateF(bits)
+	if params == nil {
+		return "", errors.New("failed to generate pairing parameters")
+	}
+	return params.String(), nil
+}
@@ -0,0 +1,109 @@
+// Package group abstracts the pairing groups G1, G2, GT and the scalar field Zr behind interfaces, so the key material
+// and the threshold protocols do not depend on one pairing library.
+//
+// Two backends implement it. PBC, through cgo, provides the Type A, D and F pairings, and is only built with cgo.
+// A pure-Go BLS12-381 backend needs neither cgo nor libpbc and libgmp, so the whole pipeline also builds and runs
+// with CGO_ENABLED=0. The first line of the pairing parameters, "type <name>", selects the backend.
+package group
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+)
+
+// TypeBLS12381 is the pairing type of the pure-Go backend, it has no parameters besides its type
+const TypeBLS12381 = "bls12-381"
+
+// ErrPBCUnavailable is returned for PBC pairing parameters when the binary was built without cgo
+var ErrPBCUnavailable = errors.New("pbc pairings need a build with cgo")
+
+// Element is an element of G1, G2, GT or Zr of a pairing. As with PBC, the group operation of G1, G2 and GT is
+// written multiplicatively, every setter and operation stores its result in the receiver and returns it so calls chain,
+// and mixing elements of different groups or pairings panics.
+type Element interface {
+	// Set0 sets the element to zero, the identity for G1 and G2
+	Set0() Element
+	// Set1 sets the element to one, the identity for G1, G2 and GT
+	Set1() Element
+	// SetInt32 sets a Zr element to the integer i
+	SetInt32(i int32) Element
+	// SetBig sets a Zr element to i modulo the group order
+	SetBig(i *big.Int) Element
+	// Set copies src, which must belong to the same group
+	Set(src Element) Element
+	// SetBytes decodes an element encoded by Bytes. Malformed input gives the identity (zero for Zr).
+	SetBytes(buf []byte) Element
+	// SetFromHash deterministically maps a hash to an element
+	SetFromHash(hash []byte) Element
+	// SetFromStringHash hashes s with h and maps the hash to an element
+	SetFromStringHash(s string, h hash.Hash) Element
+	// Rand sets the element to a uniformly random one
+	Rand() Element
+
+	Add(x, y Element) Element
+	Sub(x, y Element) Element
+	Mul(x, y Element) Element
+	Div(x, y Element) Element
+	// PowZn sets the element to x^i for a Zr element i
+	PowZn(x, i Element) Element
+	// Pair sets a GT element to the pairing e(x, y) of a G1 element x and a G2 element y
+	Pair(x, y Element) Element
+
+	ThenAdd(y Element) Element
+	ThenMul(y Element) Element
+	ThenDiv(y Element) Element
+	ThenPowZn(i Element) Element
+
+	Is0() bool
+	Equals(x Element) bool
+	Bytes() []byte
+	String() string
+	// X and Y return the affine coordinates of a point of G1 or G2
+	X() *big.Int
+	Y() *big.Int
+}
+
+// Pairing creates the elements of its groups and tells the length of their encoding
+type Pairing interface {
+	NewG1() Element
+	NewG2() Element
+	NewGT() Element
+	NewZr() Element
+	G1Length() uint
+	G2Length() uint
+	ZrLength() uint
+}
+
+// ParamsType returns the pairing type named on the first line of the parameters, e.g. "a" or "bls12-381"
+func ParamsType(params string) (string, error) {
+	fields := strings.Fields(params)
+	if len(fields) < 2 || fields[0] != "type" {
+		return "", errors.New("pairing parameters do not start with their type")
+	}
+	return strings.ToLower(fields[1]), nil
+}
+
+// NewPairing builds the pairing described by the parameters with the backend of its type
+func NewPairing(params string) (Pairing, error) {
+	pairingType, err := ParamsType(params)
+	if err != nil {
+		return nil, err
+	}
+	if pairingType == TypeBLS12381 {
+		return newBLS12381Pairing(), nil
+	}
+
+	pairing, err := newPBCPairing(params)
+	if err != nil {
+		return nil, fmt.Errorf("pairing type %q: %w", pairingType, err)
+	}
+	return pairing, nil
+}
+
+// BLS12381Params are the parameters of the pure-Go pairing, the curve is fixed
+func BLS12381Params() string {
+	return "type " + TypeBLS12381 + "\n"
+}
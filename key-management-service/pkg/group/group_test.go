@@ -0,0 +1,251 @@
+package group
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+func newTestPairing(t *testing.T) Pairing {
+	t.Helper()
+	pairing, err := NewPairing(BLS12381Params())
+	if err != nil {
+		t.Fatalf("NewPairing: %v", err)
+	}
+	return pairing
+}
+
+func TestNewPairing(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		want   string
+	}{
+		{name: "bls12-381", params: BLS12381Params(), want: TypeBLS12381},
+		{name: "type written in capitals", params: "type BLS12-381\n", want: TypeBLS12381},
+		{name: "pbc type a", params: "type a\nq 8780710799663312522437781984754049815806883199414208211028653399266475630880222957078625179422662221423155858769582317459277713367317481324925129998224791\n", want: "a"},
+	}
+	for _, test := range tests {
+		if got, err := ParamsType(test.params); err != nil || got != test.want {
+			t.Errorf("%s: ParamsType = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+
+	for _, params := range []string{"", "bls12-381", "q 87807"} {
+		if _, err := NewPairing(params); err == nil {
+			t.Errorf("NewPairing(%q) did not fail", params)
+		}
+	}
+}
+
+// TestGroupLaws checks the group axioms on random elements of every group, written multiplicatively for G1, G2 and GT
+func TestGroupLaws(t *testing.T) {
+	pairing := newTestPairing(t)
+
+	groups := []struct {
+		name string
+		new  func() Element
+	}{
+		{name: "G1", new: pairing.NewG1},
+		{name: "G2", new: pairing.NewG2},
+		{name: "GT", new: pairing.NewGT},
+		{name: "Zr", new: pairing.NewZr},
+	}
+	for _, g := range groups {
+		x, y, z := g.new().Rand(), g.new().Rand(), g.new().Rand()
+		identity := g.new().Set1()
+		if g.name == "Zr" {
+			identity = g.new().Set0()
+		}
+		op := func(a, b Element) Element {
+			if g.name == "Zr" {
+				return g.new().Add(a, b)
+			}
+			return g.new().Mul(a, b)
+		}
+		inverse := func(a Element) Element {
+			if g.name == "Zr" {
+				return g.new().Sub(identity, a)
+			}
+			return g.new().Div(identity, a)
+		}
+
+		if !op(op(x, y), z).Equals(op(x, op(y, z))) {
+			t.Errorf("%s: not associative", g.name)
+		}
+		if !op(x, y).Equals(op(y, x)) {
+			t.Errorf("%s: not commutative", g.name)
+		}
+		if !op(x, identity).Equals(x) {
+			t.Errorf("%s: identity is not neutral", g.name)
+		}
+		if !op(x, inverse(x)).Equals(identity) {
+			t.Errorf("%s: x times its inverse is not the identity", g.name)
+		}
+		if x.Equals(y) {
+			t.Errorf("%s: two random elements are equal", g.name)
+		}
+
+		if g.name == "Zr" {
+			// PowZn raises a Zr element to a power, x^3 = x x x
+			if !g.new().PowZn(x, pairing.NewZr().SetInt32(3)).Equals(g.new().Mul(x, x).ThenMul(x)) {
+				t.Errorf("%s: x^3 != x x x", g.name)
+			}
+			continue
+		}
+
+		// x^a x^b = x^(a+b) and (x^a)^b = x^(ab)
+		a, b := pairing.NewZr().Rand(), pairing.NewZr().Rand()
+		sum, product := pairing.NewZr().Add(a, b), pairing.NewZr().Mul(a, b)
+		if !op(g.new().PowZn(x, a), g.new().PowZn(x, b)).Equals(g.new().PowZn(x, sum)) {
+			t.Errorf("%s: x^a x^b != x^(a+b)", g.name)
+		}
+		if !g.new().PowZn(x, a).ThenPowZn(b).Equals(g.new().PowZn(x, product)) {
+			t.Errorf("%s: (x^a)^b != x^(ab)", g.name)
+		}
+	}
+
+	// Zr is a field
+	x, y := pairing.NewZr().Rand(), pairing.NewZr().Rand()
+	if !pairing.NewZr().Mul(x, y).ThenDiv(y).Equals(x) {
+		t.Error("Zr: x y / y != x")
+	}
+	if !pairing.NewZr().SetInt32(-1).Equals(pairing.NewZr().SetBig(new(big.Int).Sub(order, big.NewInt(1)))) {
+		t.Error("Zr: -1 is not r - 1")
+	}
+	if !pairing.NewZr().SetInt32(0).Is0() || pairing.NewZr().SetInt32(1).Is0() {
+		t.Error("Zr: Is0")
+	}
+	if !pairing.NewG1().Is0() || pairing.NewG1().Rand().Is0() {
+		t.Error("G1: Is0")
+	}
+}
+
+func TestPairingBilinearity(t *testing.T) {
+	pairing := newTestPairing(t)
+	p, q := pairing.NewG1().Rand(), pairing.NewG2().Rand()
+	a, b := pairing.NewZr().Rand(), pairing.NewZr().Rand()
+
+	// e(P^a, Q^b) = e(P, Q)^(ab)
+	left := pairing.NewGT().Pair(pairing.NewG1().PowZn(p, a), pairing.NewG2().PowZn(q, b))
+	right := pairing.NewGT().Pair(p, q).ThenPowZn(pairing.NewZr().Mul(a, b))
+	if !left.Equals(right) {
+		t.Error("e(P^a, Q^b) != e(P, Q)^(ab)")
+	}
+
+	// e(P1 P2, Q) = e(P1, Q) e(P2, Q)
+	p2 := pairing.NewG1().Rand()
+	left = pairing.NewGT().Pair(pairing.NewG1().Mul(p, p2), q)
+	right = pairing.NewGT().Pair(p, q).ThenMul(pairing.NewGT().Pair(p2, q))
+	if !left.Equals(right) {
+		t.Error("e(P1 P2, Q) != e(P1, Q) e(P2, Q)")
+	}
+
+	// Non-degenerate
+	if pairing.NewGT().Pair(p, q).Equals(pairing.NewGT().Set1()) {
+		t.Error("e(P, Q) is the identity")
+	}
+	if !pairing.NewGT().Pair(pairing.NewG1(), q).Equals(pairing.NewGT().Set1()) {
+		t.Error("e(1, Q) is not the identity")
+	}
+
+	// Pair leaves its arguments as they are
+	before := p.Bytes()
+	pairing.NewGT().Pair(p, q)
+	if !bytes.Equal(before, p.Bytes()) {
+		t.Error("Pair changed its G1 argument")
+	}
+}
+
+func TestHashToCurve(t *testing.T) {
+	pairing := newTestPairing(t)
+	first, second := sha256.Sum256([]byte("first")), sha256.Sum256([]byte("second"))
+
+	for _, g := range []struct {
+		name string
+		new  func() Element
+	}{
+		{name: "G1", new: pairing.NewG1},
+		{name: "G2", new: pairing.NewG2},
+	} {
+		h := g.new().SetFromHash(first[:])
+		if !h.Equals(g.new().SetFromHash(first[:])) {
+			t.Errorf("%s: hashing is not deterministic", g.name)
+		}
+		if h.Equals(g.new().SetFromHash(second[:])) {
+			t.Errorf("%s: two hashes map to the same point", g.name)
+		}
+		if h.Is0() {
+			t.Errorf("%s: hash maps to the identity", g.name)
+		}
+		if !g.new().SetFromStringHash("first", sha256.New()).Equals(h) {
+			t.Errorf("%s: SetFromStringHash differs from SetFromHash of the digest", g.name)
+		}
+		// A point in the group of order r
+		if !g.new().PowZn(h, pairing.NewZr().SetBig(order)).Is0() {
+			t.Errorf("%s: h^r is not the identity", g.name)
+		}
+	}
+
+	// Points of G1 and G2 use distinct domains
+	p := pairing.NewG1().SetFromHash(first[:])
+	q := pairing.NewG2().SetFromHash(first[:])
+	if pairing.NewGT().Pair(p, q).Equals(pairing.NewGT().Set1()) {
+		t.Error("e(H1(m), H2(m)) is the identity")
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	pairing := newTestPairing(t)
+
+	tests := []struct {
+		name   string
+		new    func() Element
+		length int
+	}{
+		{name: "G1", new: pairing.NewG1, length: int(pairing.G1Length())},
+		{name: "G2", new: pairing.NewG2, length: int(pairing.G2Length())},
+		{name: "GT", new: pairing.NewGT},
+		{name: "Zr", new: pairing.NewZr, length: int(pairing.ZrLength())},
+	}
+	for _, test := range tests {
+		x := test.new().Rand()
+		encoded := x.Bytes()
+		if test.length != 0 && len(encoded) != test.length {
+			t.Errorf("%s: encoding has %d bytes, want %d", test.name, len(encoded), test.length)
+		}
+		if decoded := test.new().SetBytes(encoded); !decoded.Equals(x) {
+			t.Errorf("%s: SetBytes(Bytes()) != x", test.name)
+		}
+		if copied := test.new().Set(x); !copied.Equals(x) || !bytes.Equal(copied.Bytes(), encoded) {
+			t.Errorf("%s: Set does not copy", test.name)
+		}
+		if identity := test.new(); !test.new().SetBytes(identity.Bytes()).Equals(identity) {
+			t.Errorf("%s: identity does not round trip", test.name)
+		}
+		if test.name == "Zr" {
+			continue
+		}
+
+		// Malformed input gives the identity
+		malformed := append([]byte(nil), encoded...)
+		malformed[len(malformed)-1] ^= 0xFF
+		for _, buf := range [][]byte{nil, encoded[:len(encoded)-1], malformed} {
+			if decoded := test.new().Rand().SetBytes(buf); !decoded.Equals(test.new().Set1()) {
+				t.Errorf("%s: SetBytes of %d malformed bytes is not the identity", test.name, len(buf))
+			}
+		}
+	}
+
+	// The coordinates of a G1 point are those of its uncompressed encoding
+	p := pairing.NewG1().Rand()
+	encoded := p.Bytes()
+	half := len(encoded) / 2
+	if p.Y().Cmp(new(big.Int).SetBytes(encoded[half:])) != 0 {
+		t.Error("G1: Y is not the second half of the encoding")
+	}
+	if p.X().BitLen() > 381 || p.Y().BitLen() > 381 {
+		t.Error("G1: coordinates exceed the field")
+	}
+}
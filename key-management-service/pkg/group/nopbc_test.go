@@ -0,0 +1,14 @@
+//go:build !cgo
+
+package group
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPBCUnavailable(t *testing.T) {
+	if _, err := NewPairing("type a\n"); !errors.Is(err, ErrPBCUnavailable) {
+		t.Errorf("NewPairing of a pbc pairing: err = %v, want %v", err, ErrPBCUnavailable)
+	}
+}
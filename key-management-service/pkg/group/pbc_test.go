@@ -0,0 +1,37 @@
+//go:build cgo
+
+package group
+
+import (
+	"github.com/Nik-U/pbc"
+	"testing"
+)
+
+func TestPBCSetBytesLength(t *testing.T) {
+	pairing, err := NewPairing(pbc.GenerateA(160, 512).String())
+	if err != nil {
+		t.Fatalf("NewPairing: %v", err)
+	}
+
+	for _, g := range []struct {
+		name string
+		new  func() Element
+	}{
+		{name: "G1", new: pairing.NewG1},
+		{name: "G2", new: pairing.NewG2},
+		{name: "Zr", new: pairing.NewZr},
+	} {
+		x := g.new().Rand()
+		encoded := x.Bytes()
+		if !g.new().SetBytes(encoded).Equals(x) {
+			t.Errorf("%s: SetBytes(Bytes()) != x", g.name)
+		}
+
+		// PBC itself would read past the end of a short buffer and panic on an empty one
+		for _, buf := range [][]byte{nil, {}, encoded[:len(encoded)-1], append(encoded, 0)} {
+			if decoded := g.new().Rand().SetBytes(buf); !decoded.Is0() {
+				t.Errorf("%s: SetBytes of %d bytes is not the identity", g.name, len(buf))
+			}
+		}
+	}
+}
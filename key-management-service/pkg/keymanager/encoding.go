@@ -0,0 +1,122 @@
+package keymanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	eError "github.com/mdshahjahanmiah/explore-go/error"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+)
+
+// KeyRequest selects a key of the keyring, the empty key id is the default key
+type KeyRequest struct {
+	KeyID string
+}
+
+// VersionRequest selects a version of a key, version 0 is the latest
+type VersionRequest struct {
+	KeyID   string
+	Version int
+}
+
+// ShareRequest selects the share of one decryption node in a version of a key
+type ShareRequest struct {
+	VersionRequest
+	ShareID int
+}
+
+// ReshareRequest is the threshold and the number of shares the key is handed to
+type ReshareRequest struct {
+	KeyID       string `json:"-"`
+	Threshold   int    `json:"threshold"`
+	TotalShares int    `json:"total_shares"`
+}
+
+// CreateKeyRequest describes a new key of a tenant
+type CreateKeyRequest struct {
+	KeyID         string `json:"key_id"`
+	Tenant        string `json:"tenant"`
+	SecurityLevel string `json:"security_level"`
+	PairingType   string `json:"pairing_type"`
+	Threshold     int    `json:"threshold"`
+	TotalShares   int    `json:"total_shares"`
+}
+
+// ListKeysRequest filters the keys by tenant, the empty tenant lists all keys
+type ListKeysRequest struct {
+	Tenant string
+}
+
+func decodeKeyRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	return KeyRequest{KeyID: chi.URLParam(request, "keyID")}, nil
+}
+
+func decodeVersionRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	versionRequest := VersionRequest{KeyID: chi.URLParam(request, "keyID")}
+	if version := request.URL.Query().Get("version"); version != "" {
+		parsed, err := strconv.Atoi(version)
+		if err != nil || parsed < 1 {
+			return nil, eError.NewServiceError(errors.New("version must be a positive integer"), "validation_error", "version", http.StatusBadRequest)
+		}
+		versionRequest.Version = parsed
+	}
+	return versionRequest, nil
+}
+
+func decodeShareRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	versionRequest, err := decodeVersionRequest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	shareID, err := strconv.Atoi(chi.URLParam(request, "shareID"))
+	if err != nil || shareID < 1 {
+		return nil, eError.NewServiceError(errors.New("share id must be a positive integer"), "validation_error", "share_id", http.StatusBadRequest)
+	}
+	return ShareRequest{VersionRequest: versionRequest.(VersionRequest), ShareID: shareID}, nil
+}
+
+func decodeReshareRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var reshareRequest ReshareRequest
+	if err := json.NewDecoder(request.Body).Decode(&reshareRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode reshare request", "payload", http.StatusBadRequest)
+	}
+	if err := checkQuorum(reshareRequest.Threshold, reshareRequest.TotalShares); err != nil {
+		return nil, err
+	}
+	reshareRequest.KeyID = chi.URLParam(request, "keyID")
+	return reshareRequest, nil
+}
+
+func decodeCreateKeyRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var createKeyRequest CreateKeyRequest
+	if err := json.NewDecoder(request.Body).Decode(&createKeyRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode create key request", "payload", http.StatusBadRequest)
+	}
+	if createKeyRequest.SecurityLevel == "" {
+		createKeyRequest.SecurityLevel = "medium"
+	}
+	if createKeyRequest.PairingType == "" {
+		createKeyRequest.PairingType = PairingTypeA
+	}
+	if err := checkQuorum(createKeyRequest.Threshold, createKeyRequest.TotalShares); err != nil {
+		return nil, err
+	}
+	return createKeyRequest, nil
+}
+
+// checkQuorum checks a requested threshold and number of shares before the KMS computes any share
+func checkQuorum(threshold, totalShares int) error {
+	if threshold < 1 || totalShares < threshold || totalShares > config.MaxShares {
+		return eError.NewServiceError(fmt.Errorf("threshold must be between 1 and total shares, at most %d shares", config.MaxShares), "validation_error", "threshold", http.StatusBadRequest)
+	}
+	return nil
+}
+
+func decodeListKeysRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	return ListKeysRequest{Tenant: request.URL.Query().Get("tenant")}, nil
+}
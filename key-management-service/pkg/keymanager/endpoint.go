@@ -2,55 +2,412 @@ package keymanager
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"github.com/go-kit/kit/endpoint"
 	eError "github.com/mdshahjahanmiah/explore-go/error"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/auth"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
 	"net/http"
 )
 
 type PublicKeyResponse struct {
-	X string `json:"x"`
-	Y string `json:"y"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	Key       string `json:"key"`
+	Generator string `json:"generator"`
+	KeyID     string `json:"key_id"`
+	Tenant    string `json:"tenant"`
+	Version   int    `json:"version"`
+	Threshold int    `json:"threshold"`
+	Epoch     int    `json:"epoch"`
+}
+
+type CommitmentsResponse struct {
+	Commitments []string `json:"commitments"`
+	Version     int      `json:"version"`
+	Epoch       int      `json:"epoch"`
+}
+
+type RotateResponse struct {
+	KeyID   string `json:"key_id"`
+	Version int    `json:"version"`
+}
+
+type RefreshResponse struct {
+	Epoch int `json:"epoch"`
+}
+
+type ReshareResponse struct {
+	Epoch       int `json:"epoch"`
+	Threshold   int `json:"threshold"`
+	TotalShares int `json:"total_shares"`
 }
 
 type PairingParamResponse struct {
 	Params string `json:"params"`
+	Type   string `json:"type"`
 }
 
-func getPublicKeyEndpoint(service KeyManagementService) endpoint.Endpoint {
+type ListKeysResponse struct {
+	Keys []KeyDescription `json:"keys"`
+}
+
+type DeleteKeyResponse struct {
+	KeyID string `json:"key_id"`
+}
+
+func getPublicKeyEndpoint(keyring Keyring) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		publicKey := service.GetPublicKey()
-		if publicKey == nil {
-			return nil, eError.NewServiceError(errors.New("failed to get public key"), "Internal_Error", "NONE", http.StatusInternalServerError)
+		versionRequest := request.(VersionRequest)
+		service, err := getKey(keyring, versionRequest.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		keyVersion, err := getKeyVersion(service, versionRequest.Version)
+		if err != nil {
+			return nil, err
+		}
+		publicKey := keyVersion.PublicKey
+		// The tenant tells the gateway whose signers may sign under the key
+		description, err := keyring.Describe(versionRequest.KeyID)
+		if err != nil {
+			return nil, toKeyringError(err)
 		}
 
 		// elliptic curve cryptography (ECC), a public key is a point on the elliptic curve
 		// represented by the X and Y coordinates of the point
+		// The raw element bytes are what the other services need to rebuild the key and the generator
 		return PublicKeyResponse{
-			X: publicKey.X().String(),
-			Y: publicKey.Y().String(),
+			X:         publicKey.X().String(),
+			Y:         publicKey.Y().String(),
+			Key:       base64.StdEncoding.EncodeToString(publicKey.Bytes()),
+			Generator: base64.StdEncoding.EncodeToString(service.GetGenerator().Bytes()),
+			KeyID:     keyVersion.KeyID,
+			Tenant:    description.Tenant,
+			Version:   keyVersion.Version,
+			Threshold: keyVersion.Threshold,
+			Epoch:     keyVersion.Epoch,
+		}, nil
+	}
+}
+
+// getShareKeyEndpoint hands a decryption node its own share, no route returns the shares of several nodes at once.
+// The node has to authenticate with its token, without configured tokens the shares are only delivered as share files.
+func getShareKeyEndpoint(keyring Keyring, nodes auth.NodeTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		shareRequest := request.(ShareRequest)
+		if err := nodes.AuthenticateNode(ctx, shareRequest.ShareID); err != nil {
+			return nil, auth.ToServiceError(err)
+		}
+		service, err := getKey(keyring, shareRequest.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		keyVersion, err := getKeyVersion(service, shareRequest.Version)
+		if err != nil {
+			return nil, err
+		}
+		for _, share := range keyVersion.Shares {
+			if share.ID == shareRequest.ShareID {
+				return share, nil
+			}
+		}
+		return nil, eError.NewServiceError(fmt.Errorf("key version %d has no share %d", keyVersion.Version, shareRequest.ShareID), "share not found", "share_id", http.StatusNotFound)
+	}
+}
+
+func getVerificationKeysEndpoint(keyring Keyring) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		versionRequest := request.(VersionRequest)
+		service, err := getKey(keyring, versionRequest.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		keyVersion, err := getKeyVersion(service, versionRequest.Version)
+		if err != nil {
+			return nil, err
+		}
+		if len(keyVersion.VerificationKeys) < 1 {
+			return nil, eError.NewServiceError(errors.New("failed to get verification keys"), "Internal_Error", "NONE", http.StatusInternalServerError)
+		}
+		return keyVersion.VerificationKeys, nil
+	}
+}
+
+func getCommitmentsEndpoint(keyring Keyring) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		versionRequest := request.(VersionRequest)
+		service, err := getKey(keyring, versionRequest.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		keyVersion, err := getKeyVersion(service, versionRequest.Version)
+		if err != nil {
+			return nil, err
+		}
+		if len(keyVersion.Commitments) < 1 {
+			return nil, eError.NewServiceError(errors.New("failed to get commitments"), "Internal_Error", "NONE", http.StatusInternalServerError)
+		}
+		return CommitmentsResponse{
+			Commitments: keyVersion.Commitments,
+			Version:     keyVersion.Version,
+			Epoch:       keyVersion.Epoch,
+		}, nil
+	}
+}
+
+func getRotateEndpoint(keyring Keyring, admins auth.AdminTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		keyID := request.(KeyRequest).KeyID
+		if err := authorizeKey(ctx, admins, keyring, keyID); err != nil {
+			return nil, err
+		}
+		service, err := getKey(keyring, keyID)
+		if err != nil {
+			return nil, err
+		}
+
+		version, err := service.Rotate()
+		if errors.Is(err, ErrSharesHeldByNodes) {
+			return nil, eError.NewServiceError(err, "rotation is not supported with distributed key generation", "NONE", http.StatusConflict)
+		}
+		if err != nil {
+			return nil, eError.NewServiceError(err, "Internal_Error", "NONE", http.StatusInternalServerError)
+		}
+		return RotateResponse{
+			KeyID:   service.GetKeyID(),
+			Version: version,
 		}, nil
 	}
 }
 
-func getShareKeyEndpoint(service KeyManagementService) endpoint.Endpoint {
+func getRefreshEndpoint(keyring Keyring, admins auth.AdminTokens) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
-		shares := service.GetKeyShares()
-		if len(shares) < 1 {
-			return nil, eError.NewServiceError(errors.New("failed to get key shares"), "Internal_Error", "NONE", http.StatusInternalServerError)
+		keyID := request.(KeyRequest).KeyID
+		if err := authorizeKey(ctx, admins, keyring, keyID); err != nil {
+			return nil, err
+		}
+		service, err := getKey(keyring, keyID)
+		if err != nil {
+			return nil, err
+		}
+
+		epoch, err := service.RefreshShares()
+		if errors.Is(err, ErrSharesHeldByNodes) {
+			return nil, eError.NewServiceError(err, "refresh through the dkg coordinator", "NONE", http.StatusConflict)
+		}
+		if err != nil {
+			return nil, eError.NewServiceError(err, "Internal_Error", "NONE", http.StatusInternalServerError)
 		}
-		return shares, nil
+		return RefreshResponse{
+			Epoch: epoch,
+		}, nil
 	}
 }
 
-func getPairingParamsEndpoint(service KeyManagementService) endpoint.Endpoint {
+func getReshareEndpoint(keyring Keyring, admins auth.AdminTokens) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		reshareRequest := request.(ReshareRequest)
+		if err := authorizeKey(ctx, admins, keyring, reshareRequest.KeyID); err != nil {
+			return nil, err
+		}
+		service, err := getKey(keyring, reshareRequest.KeyID)
+		if err != nil {
+			return nil, err
+		}
+
+		epoch, err := service.Reshare(reshareRequest.Threshold, reshareRequest.TotalShares)
+		if errors.Is(err, ErrSharesHeldByNodes) {
+			return nil, eError.NewServiceError(err, "reshare through the dkg coordinator", "NONE", http.StatusConflict)
+		}
+		if err != nil {
+			return nil, eError.NewServiceError(err, "validation_error", "threshold", http.StatusBadRequest)
+		}
+		return ReshareResponse{
+			Epoch:       epoch,
+			Threshold:   reshareRequest.Threshold,
+			TotalShares: reshareRequest.TotalShares,
+		}, nil
+	}
+}
+
+func getPairingParamsEndpoint(keyring Keyring) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		service, err := getKey(keyring, request.(KeyRequest).KeyID)
+		if err != nil {
+			return nil, err
+		}
+
 		pairingParam := service.GetPairingParams()
 		if pairingParam == "" {
 			return nil, eError.NewServiceError(errors.New("failed to get pairing params"), "Internal_Error", "NONE", http.StatusInternalServerError)
 		}
 		return PairingParamResponse{
 			Params: pairingParam,
+			Type:   service.GetPairingType(),
+		}, nil
+	}
+}
+
+func createKeyEndpoint(keyring Keyring, admins auth.AdminTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		createKeyRequest := request.(CreateKeyRequest)
+		caller, err := admins.Authenticate(ctx)
+		if err != nil {
+			return nil, auth.ToServiceError(err)
+		}
+		// Administrators create keys of their own tenant, only operators have to name it
+		if createKeyRequest.Tenant == "" && !caller.IsOperator() {
+			createKeyRequest.Tenant = caller.Tenant
+		}
+		if err := caller.Authorize(createKeyRequest.Tenant); err != nil {
+			return nil, auth.ToServiceError(err)
+		}
+
+		description, err := keyring.Create(KeySpec{
+			KeyID:         createKeyRequest.KeyID,
+			Tenant:        createKeyRequest.Tenant,
+			SecurityLevel: createKeyRequest.SecurityLevel,
+			PairingType:   createKeyRequest.PairingType,
+			ThresholdConfig: config.ThresholdConfig{
+				Enabled:     true,
+				Threshold:   createKeyRequest.Threshold,
+				TotalShares: createKeyRequest.TotalShares,
+			},
+		})
+		if errors.Is(err, ErrKeyExists) {
+			return nil, eError.NewServiceError(err, "key already exists", "key_id", http.StatusConflict)
+		}
+		if errors.Is(err, ErrSealed) {
+			return nil, toKeyringError(err)
+		}
+		if err != nil {
+			return nil, eError.NewServiceError(err, "validation_error", "payload", http.StatusBadRequest)
+		}
+		return description, nil
+	}
+}
+
+func listKeysEndpoint(keyring Keyring, admins auth.AdminTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		tenant := request.(ListKeysRequest).Tenant
+		caller, err := admins.Authenticate(ctx)
+		if err != nil {
+			return nil, auth.ToServiceError(err)
+		}
+		// Administrators only see the keys of their own tenant, operators those of any or every tenant
+		if tenant == "" && !caller.IsOperator() {
+			tenant = caller.Tenant
+		}
+		if err := caller.Authorize(tenant); err != nil {
+			return nil, auth.ToServiceError(err)
+		}
+
+		keys, err := keyring.List(tenant)
+		if err != nil {
+			return nil, toKeyringError(err)
+		}
+		return ListKeysResponse{
+			Keys: keys,
 		}, nil
 	}
 }
+
+func describeKeyEndpoint(keyring Keyring, admins auth.AdminTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		keyID := request.(KeyRequest).KeyID
+		if err := authorizeKey(ctx, admins, keyring, keyID); err != nil {
+			return nil, err
+		}
+		description, err := keyring.Describe(keyID)
+		if err != nil {
+			return nil, toKeyringError(err)
+		}
+		return description, nil
+	}
+}
+
+func disableKeyEndpoint(keyring Keyring, admins auth.AdminTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		keyID := request.(KeyRequest).KeyID
+		if err := authorizeKey(ctx, admins, keyring, keyID); err != nil {
+			return nil, err
+		}
+		description, err := keyring.Disable(keyID)
+		if err != nil {
+			return nil, toKeyringError(err)
+		}
+		return description, nil
+	}
+}
+
+func deleteKeyEndpoint(keyring Keyring, admins auth.AdminTokens) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		keyID := request.(KeyRequest).KeyID
+		if err := authorizeKey(ctx, admins, keyring, keyID); err != nil {
+			return nil, err
+		}
+		if err := keyring.Delete(keyID); err != nil {
+			return nil, toKeyringError(err)
+		}
+		return DeleteKeyResponse{
+			KeyID: keyID,
+		}, nil
+	}
+}
+
+// authorizeKey authenticates an administrator and checks the key belongs to their tenant, the empty key id is the
+// default key. A key of another tenant answers like a missing one, so administrators cannot probe the key ids of others.
+func authorizeKey(ctx context.Context, admins auth.AdminTokens, keyring Keyring, keyID string) error {
+	caller, err := admins.Authenticate(ctx)
+	if err != nil {
+		return auth.ToServiceError(err)
+	}
+	description, err := keyring.Describe(keyID)
+	if err != nil {
+		return toKeyringError(err)
+	}
+	if caller.Authorize(description.Tenant) != nil {
+		return toKeyringError(fmt.Errorf("%w: %s", ErrKeyNotFound, keyID))
+	}
+	return nil
+}
+
+// getKey looks up an enabled key of the keyring
+func getKey(keyring Keyring, keyID string) (KeyManagementService, error) {
+	service, err := keyring.Get(keyID)
+	if err != nil {
+		return nil, toKeyringError(err)
+	}
+	return service, nil
+}
+
+// toKeyringError maps keyring errors to their HTTP status
+func toKeyringError(err error) error {
+	switch {
+	case errors.Is(err, ErrKeyNotFound):
+		return eError.NewServiceError(err, "key not found", "key_id", http.StatusNotFound)
+	case errors.Is(err, ErrKeyDisabled):
+		return eError.NewServiceError(err, "key is disabled", "key_id", http.StatusConflict)
+	case errors.Is(err, ErrDefaultKey):
+		return eError.NewServiceError(err, "default key", "key_id", http.StatusConflict)
+	case errors.Is(err, ErrSealed):
+		return eError.NewServiceError(err, "sealed", "NONE", http.StatusServiceUnavailable)
+	default:
+		return eError.NewServiceError(err, "Internal_Error", "NONE", http.StatusInternalServerError)
+	}
+}
+
+// getKeyVersion looks up the requested key version and maps a missing version to 404
+func getKeyVersion(service KeyManagementService, version int) (KeyVersion, error) {
+	keyVersion, err := service.GetKeyVersion(version)
+	if errors.Is(err, ErrVersionNotFound) {
+		return KeyVersion{}, eError.NewServiceError(err, "key version not found", "version", http.StatusNotFound)
+	}
+	if err != nil {
+		return KeyVersion{}, eError.NewServiceError(err, "Internal_Error", "NONE", http.StatusInternalServerError)
+	}
+	return keyVersion, nil
+}
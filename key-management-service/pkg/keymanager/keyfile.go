@@ -0,0 +1,94 @@
+package keymanager
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/group"
+	"os"
+	"time"
+)
+
+// OfflineKey is a key generated outside a running KMS, e.g. on an air-gapped machine. The pairing parameters are the
+// plain text the decryption nodes load, the key file is what the KMS loads and the shares go to the nodes.
+type OfflineKey struct {
+	PairingParams string
+	KeyFile       []byte
+	Shares        []KeyShare
+}
+
+// GenerateOfflineKey generates the pairing parameters, when the spec does not carry them, and the first version of a
+// dealt key with its shares. The key file holds the same record the keystore keeps for the key.
+func GenerateOfflineKey(spec KeySpec, logger *logging.Logger) (OfflineKey, error) {
+	if !keyIDPattern.MatchString(spec.KeyID) {
+		return OfflineKey{}, fmt.Errorf("invalid key id %q", spec.KeyID)
+	}
+	spec.Distributed = false
+
+	manager, err := newKeyManagementService(spec, logger)
+	if err != nil {
+		return OfflineKey{}, err
+	}
+	entry := &keyEntry{spec: spec, status: KeyStatusEnabled, createdAt: time.Now().UTC(), manager: manager}
+
+	keyFile, err := json.MarshalIndent(manager.record(entry), "", "  ")
+	if err != nil {
+		return OfflineKey{}, err
+	}
+	firstVersion, err := manager.GetKeyVersion(1)
+	if err != nil {
+		return OfflineKey{}, err
+	}
+	paramsText, err := base64.StdEncoding.DecodeString(manager.encodedParams)
+	if err != nil {
+		return OfflineKey{}, err
+	}
+
+	return OfflineKey{PairingParams: string(paramsText), KeyFile: keyFile, Shares: firstVersion.Shares}, nil
+}
+
+// loadKeyFile reads a key file written by GenerateOfflineKey and rebuilds the key from it, nothing is generated
+func loadKeyFile(path string, logger *logging.Logger) (*keyEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var record keyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("decoding key file: %w", err)
+	}
+	if record.Distributed {
+		return nil, fmt.Errorf("key file holds a distributed key, its shares are not in the file")
+	}
+	return restoreKey(record, logger)
+}
+
+// ReadPairingParams reads plain pairing parameters from a file, such as the one written next to a key file
+func ReadPairingParams(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := parsePairingParams(string(data)); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return string(data), nil
+}
+
+// parsePairingParams checks plain pairing parameters and returns their type, the first line names it
+func parsePairingParams(text string) (string, error) {
+	pairingType, err := group.ParamsType(text)
+	if err != nil {
+		return "", err
+	}
+	if !ValidPairingType(pairingType) {
+		return "", fmt.Errorf("unsupported pairing type %q", pairingType)
+	}
+
+	if _, err := group.NewPairing(text); err != nil {
+		return "", err
+	}
+	return pairingType, nil
+}
@@ -0,0 +1,407 @@
+package keymanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/keystore"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrKeyNotFound is returned when no key with the requested id exists
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrKeyExists is returned when a key is created under an id that is already taken
+	ErrKeyExists = errors.New("key already exists")
+	// ErrKeyDisabled is returned when a disabled key is used for encryption or decryption
+	ErrKeyDisabled = errors.New("key is disabled")
+	// ErrDefaultKey is returned when the default key, which the decryption nodes depend on, would be deleted
+	ErrDefaultKey = errors.New("the default key cannot be deleted")
+	// ErrSealed is returned by a sealed keyring, no key can be used until operators unseal the KMS
+	ErrSealed = errors.New("kms is sealed")
+)
+
+// keyIDPattern keeps key ids usable in URLs and short enough for the ciphertext header
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// KeyStatus tells whether a key can be used
+type KeyStatus string
+
+const (
+	KeyStatusEnabled  KeyStatus = "enabled"
+	KeyStatusDisabled KeyStatus = "disabled"
+)
+
+// KeyDescription is the metadata of a key of the keyring, it never contains key material
+type KeyDescription struct {
+	KeyID         string    `json:"key_id"`
+	Tenant        string    `json:"tenant"`
+	SecurityLevel string    `json:"security_level"`
+	PairingType   string    `json:"pairing_type"`
+	Status        KeyStatus `json:"status"`
+	Distributed   bool      `json:"distributed"`
+	Threshold     int       `json:"threshold"`
+	TotalShares   int       `json:"total_shares"`
+	Version       int       `json:"version"`
+	Epoch         int       `json:"epoch"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type keyEntry struct {
+	spec      KeySpec
+	status    KeyStatus
+	createdAt time.Time
+	manager   *keyManagementService
+}
+
+type keyring struct {
+	mutex        sync.RWMutex
+	keys         map[string]*keyEntry
+	defaultKeyID string
+	store        keystore.Keystore
+	logger       *logging.Logger
+}
+
+// Keyring holds the keys of all tenants. Each key has its own pairing, versions and shares,
+// the default key comes from the configuration and is the one the decryption nodes are started with.
+type Keyring interface {
+	Create(spec KeySpec) (KeyDescription, error)
+	List(tenant string) ([]KeyDescription, error)
+	Describe(keyID string) (KeyDescription, error)
+	Disable(keyID string) (KeyDescription, error)
+	Delete(keyID string) error
+	Get(keyID string) (KeyManagementService, error)
+	Default() KeyManagementService
+	RefreshShares() error
+}
+
+// NewKeyring initializes the keyring. With a keystore, the keys saved in it are loaded and new material is only
+// generated when the keystore does not exist yet. Without one, or for a new keystore, the keyring starts with the
+// default key described by the configuration.
+func NewKeyring(config config.Config, store keystore.Keystore, logger *logging.Logger) (Keyring, error) {
+	k := &keyring{
+		keys:         make(map[string]*keyEntry),
+		defaultKeyID: config.KeyID,
+		store:        store,
+		logger:       logger,
+	}
+
+	if store != nil {
+		data, err := store.Load()
+		if err == nil {
+			if err := k.restore(data); err != nil {
+				return nil, fmt.Errorf("restoring keyring from keystore: %w", err)
+			}
+			if k.defaultKeyID != config.KeyID {
+				return nil, fmt.Errorf("keystore default key %q does not match the configured key %q", k.defaultKeyID, config.KeyID)
+			}
+			logger.Info("keyring loaded from keystore", "keys", len(k.keys), "default_key_id", k.defaultKeyID)
+			return k, nil
+		}
+		if !errors.Is(err, keystore.ErrNotFound) {
+			return nil, err
+		}
+		logger.Info("keystore does not exist yet, generating a new default key")
+	}
+
+	// A key generated offline is loaded as it is, the keystore takes it over from then on
+	if config.KeyFile != "" {
+		if config.IsDistributedKeygen() {
+			return nil, errors.New("a key file cannot be loaded in dkg mode, the decryption nodes generate the key")
+		}
+		entry, err := loadKeyFile(config.KeyFile, logger)
+		if err != nil {
+			return nil, fmt.Errorf("loading key file: %w", err)
+		}
+		if entry.spec.KeyID != config.KeyID {
+			return nil, fmt.Errorf("key file holds key %q, not the configured key %q", entry.spec.KeyID, config.KeyID)
+		}
+		entry.manager.onChange = k.save
+		k.keys[entry.spec.KeyID] = entry
+		logger.Info("default key loaded from key file", "key_id", entry.spec.KeyID, "pairing_type", entry.spec.PairingType)
+
+		if err := k.save(); err != nil {
+			return nil, fmt.Errorf("saving keystore: %w", err)
+		}
+		return k, nil
+	}
+
+	spec := KeySpec{
+		KeyID:           config.KeyID,
+		Tenant:          config.KeyTenant,
+		SecurityLevel:   config.SecurityLevel,
+		PairingType:     strings.ToLower(config.PairingType),
+		ThresholdConfig: config.ThresholdConfig,
+		Distributed:     config.IsDistributedKeygen(),
+	}
+	if !keyIDPattern.MatchString(spec.KeyID) {
+		return nil, fmt.Errorf("invalid default key id %q", spec.KeyID)
+	}
+	if config.PairingParamsFile != "" {
+		params, err := ReadPairingParams(config.PairingParamsFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading pairing parameters: %w", err)
+		}
+		spec.PairingParams = params
+	} else if !ValidPairingType(spec.PairingType) {
+		return nil, fmt.Errorf("unknown pairing type %q", config.PairingType)
+	}
+
+	manager, err := newKeyManagementService(spec, logger)
+	if err != nil {
+		return nil, err
+	}
+	manager.onChange = k.save
+	k.keys[spec.KeyID] = &keyEntry{spec: spec, status: KeyStatusEnabled, createdAt: time.Now().UTC(), manager: manager}
+
+	if err := k.save(); err != nil {
+		return nil, fmt.Errorf("saving keystore: %w", err)
+	}
+	return k, nil
+}
+
+// Create generates a new key for a tenant. Keys created at runtime are always dealt by the KMS,
+// only the default key can come from a distributed key generation.
+func (k *keyring) Create(spec KeySpec) (description KeyDescription, err error) {
+	if !keyIDPattern.MatchString(spec.KeyID) {
+		return KeyDescription{}, errors.New("key id must be 1 to 64 letters, digits, '.', '_' or '-'")
+	}
+	if spec.Tenant == "" {
+		return KeyDescription{}, errors.New("tenant is empty")
+	}
+	switch strings.ToLower(spec.SecurityLevel) {
+	case "low", "medium", "high":
+	default:
+		return KeyDescription{}, fmt.Errorf("unknown security level %q", spec.SecurityLevel)
+	}
+	if !ValidPairingType(spec.PairingType) {
+		return KeyDescription{}, fmt.Errorf("unknown pairing type %q", spec.PairingType)
+	}
+	spec.PairingType = strings.ToLower(spec.PairingType)
+	spec.Distributed = false
+
+	k.mutex.RLock()
+	_, exists := k.keys[spec.KeyID]
+	k.mutex.RUnlock()
+	if exists {
+		return KeyDescription{}, fmt.Errorf("%w: %s", ErrKeyExists, spec.KeyID)
+	}
+
+	// Generating pairing parameters takes a while, so it happens outside the lock
+	manager, err := newKeyManagementService(spec, k.logger)
+	if err != nil {
+		return KeyDescription{}, err
+	}
+	manager.onChange = k.save
+
+	defer k.persist(&err)
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if _, exists := k.keys[spec.KeyID]; exists {
+		return KeyDescription{}, fmt.Errorf("%w: %s", ErrKeyExists, spec.KeyID)
+	}
+	entry := &keyEntry{spec: spec, status: KeyStatusEnabled, createdAt: time.Now().UTC(), manager: manager}
+	k.keys[spec.KeyID] = entry
+
+	k.logger.Info("key created", "key_id", spec.KeyID, "tenant", spec.Tenant, "security_level", spec.SecurityLevel, "pairing_type", spec.PairingType)
+	return describe(entry), nil
+}
+
+// List describes the keys of the given tenant, or of all tenants if the tenant is empty, ordered by key id
+func (k *keyring) List(tenant string) ([]KeyDescription, error) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	descriptions := make([]KeyDescription, 0, len(k.keys))
+	for _, entry := range k.keys {
+		if tenant != "" && entry.spec.Tenant != tenant {
+			continue
+		}
+		descriptions = append(descriptions, describe(entry))
+	}
+	sort.Slice(descriptions, func(i, j int) bool { return descriptions[i].KeyID < descriptions[j].KeyID })
+	return descriptions, nil
+}
+
+// Describe returns the metadata of a key, disabled keys included
+func (k *keyring) Describe(keyID string) (KeyDescription, error) {
+	if keyID == "" {
+		keyID = k.defaultKeyID
+	}
+
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	entry, ok := k.keys[keyID]
+	if !ok {
+		return KeyDescription{}, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+	}
+	return describe(entry), nil
+}
+
+// Disable stops a key from being used for encryption and decryption, its material is kept
+func (k *keyring) Disable(keyID string) (description KeyDescription, err error) {
+	defer k.persist(&err)
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	entry, ok := k.keys[keyID]
+	if !ok {
+		return KeyDescription{}, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+	}
+	entry.status = KeyStatusDisabled
+
+	k.logger.Info("key disabled", "key_id", keyID, "tenant", entry.spec.Tenant)
+	return describe(entry), nil
+}
+
+// Delete removes a key and all its versions. Ciphertexts encrypted under it can no longer be decrypted.
+func (k *keyring) Delete(keyID string) (err error) {
+	defer k.persist(&err)
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	entry, ok := k.keys[keyID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+	}
+	if keyID == k.defaultKeyID {
+		return ErrDefaultKey
+	}
+	delete(k.keys, keyID)
+
+	k.logger.Info("key deleted", "key_id", keyID, "tenant", entry.spec.Tenant)
+	return nil
+}
+
+// Get returns an enabled key, the empty key id selects the default key
+func (k *keyring) Get(keyID string) (KeyManagementService, error) {
+	if keyID == "" {
+		keyID = k.defaultKeyID
+	}
+
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	entry, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+	}
+	if entry.status != KeyStatusEnabled {
+		return nil, fmt.Errorf("%w: %s", ErrKeyDisabled, keyID)
+	}
+	return entry.manager, nil
+}
+
+// Default returns the default key regardless of its status, the DKG coordinator publishes into it
+func (k *keyring) Default() KeyManagementService {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.keys[k.defaultKeyID].manager
+}
+
+// RefreshShares refreshes the shares of every enabled key the KMS holds the shares of.
+// A failing key does not stop the others from being refreshed.
+func (k *keyring) RefreshShares() error {
+	k.mutex.RLock()
+	entries := make([]*keyEntry, 0, len(k.keys))
+	for _, entry := range k.keys {
+		if entry.status == KeyStatusEnabled && !entry.spec.Distributed && entry.spec.ThresholdConfig.Enabled {
+			entries = append(entries, entry)
+		}
+	}
+	k.mutex.RUnlock()
+
+	var errs []error
+	for _, entry := range entries {
+		if _, err := entry.manager.RefreshShares(); err != nil {
+			errs = append(errs, fmt.Errorf("refreshing key %s: %w", entry.spec.KeyID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// describe summarizes a key from its spec and its latest version
+func describe(entry *keyEntry) KeyDescription {
+	description := KeyDescription{
+		KeyID:         entry.spec.KeyID,
+		Tenant:        entry.spec.Tenant,
+		SecurityLevel: entry.spec.SecurityLevel,
+		PairingType:   entry.spec.PairingType,
+		Status:        entry.status,
+		Distributed:   entry.spec.Distributed,
+		Threshold:     entry.spec.ThresholdConfig.Threshold,
+		TotalShares:   entry.spec.ThresholdConfig.TotalShares,
+		CreatedAt:     entry.createdAt,
+	}
+
+	// Reshares change the threshold and the number of shares, the latest version has the current ones
+	if latest, err := entry.manager.GetKeyVersion(0); err == nil {
+		description.Threshold = latest.Threshold
+		description.TotalShares = len(latest.VerificationKeys)
+		description.Version = latest.Version
+		description.Epoch = latest.Epoch
+	}
+	return description
+}
+
+// persist saves the keystore after a successful change, it must be deferred before the lock is taken
+func (k *keyring) persist(err *error) {
+	if *err != nil {
+		return
+	}
+	if saveErr := k.save(); saveErr != nil {
+		k.logger.Error("failed to persist keyring", "err", saveErr)
+		*err = saveErr
+	}
+}
+
+// save writes every key of the keyring to the keystore, it is a no-op without a keystore
+func (k *keyring) save() error {
+	if k.store == nil {
+		return nil
+	}
+
+	k.mutex.RLock()
+	record := keyringRecord{DefaultKeyID: k.defaultKeyID}
+	for _, entry := range k.keys {
+		record.Keys = append(record.Keys, entry.manager.record(entry))
+	}
+	k.mutex.RUnlock()
+
+	sort.Slice(record.Keys, func(i, j int) bool { return record.Keys[i].KeyID < record.Keys[j].KeyID })
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return k.store.Save(data)
+}
+
+// restore rebuilds the keys saved in the keystore
+func (k *keyring) restore(data []byte) error {
+	var record keyringRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+
+	for _, keyRecord := range record.Keys {
+		entry, err := restoreKey(keyRecord, k.logger)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", keyRecord.KeyID, err)
+		}
+		entry.manager.onChange = k.save
+		k.keys[keyRecord.KeyID] = entry
+	}
+
+	if _, ok := k.keys[record.DefaultKeyID]; !ok {
+		return fmt.Errorf("default key %q is missing", record.DefaultKeyID)
+	}
+	k.defaultKeyID = record.DefaultKeyID
+	return nil
+}
@@ -0,0 +1,168 @@
+package keymanager
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/group"
+	"time"
+)
+
+// keyringRecord is the content of the keystore: every key of the keyring with its pairing, versions and shares
+type keyringRecord struct {
+	DefaultKeyID string      `json:"default_key_id"`
+	Keys         []keyRecord `json:"keys"`
+}
+
+type keyRecord struct {
+	KeyID          string          `json:"key_id"`
+	Tenant         string          `json:"tenant"`
+	SecurityLevel  string          `json:"security_level"`
+	PairingType    string          `json:"pairing_type,omitempty"`
+	Status         KeyStatus       `json:"status"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Distributed    bool            `json:"distributed"`
+	SharingEnabled bool            `json:"sharing_enabled"`
+	Threshold      int             `json:"threshold"`
+	TotalShares    int             `json:"total_shares"`
+	PairingParams  string          `json:"pairing_params"`
+	Generator      string          `json:"generator"`
+	Versions       []versionRecord `json:"versions"`
+}
+
+type versionRecord struct {
+	Version          int               `json:"version"`
+	PublicKey        string            `json:"public_key"`
+	Threshold        int               `json:"threshold"`
+	Epoch            int               `json:"epoch"`
+	Shares           []KeyShare        `json:"shares"`
+	VerificationKeys []VerificationKey `json:"verification_keys"`
+	Commitments      []string          `json:"commitments"`
+}
+
+// record captures the key with all its versions for the keystore
+func (kms *keyManagementService) record(entry *keyEntry) keyRecord {
+	kms.mutex.RLock()
+	defer kms.mutex.RUnlock()
+
+	versions := make([]versionRecord, len(kms.versions))
+	for i, keyVersion := range kms.versions {
+		versions[i] = versionRecord{
+			Version:          keyVersion.Version,
+			PublicKey:        base64.StdEncoding.EncodeToString(keyVersion.PublicKey.Bytes()),
+			Threshold:        keyVersion.Threshold,
+			Epoch:            keyVersion.Epoch,
+			Shares:           keyVersion.Shares,
+			VerificationKeys: keyVersion.VerificationKeys,
+			Commitments:      keyVersion.Commitments,
+		}
+	}
+
+	return keyRecord{
+		KeyID:          kms.keyID,
+		Tenant:         entry.spec.Tenant,
+		SecurityLevel:  entry.spec.SecurityLevel,
+		PairingType:    kms.pairingType,
+		Status:         entry.status,
+		CreatedAt:      entry.createdAt,
+		Distributed:    kms.distributed,
+		SharingEnabled: kms.sharing.Enabled,
+		Threshold:      kms.sharing.Threshold,
+		TotalShares:    kms.sharing.TotalShares,
+		PairingParams:  kms.encodedParams,
+		Generator:      base64.StdEncoding.EncodeToString(kms.generator.Bytes()),
+		Versions:       versions,
+	}
+}
+
+// restoreKey rebuilds a key and its keyring entry from the keystore, no new material is generated
+func restoreKey(record keyRecord, logger *logging.Logger) (*keyEntry, error) {
+	// Keystores written before pairing types were selectable only hold Type A keys
+	pairingType := record.PairingType
+	if pairingType == "" {
+		pairingType = PairingTypeA
+	}
+
+	paramsBytes, err := base64.StdEncoding.DecodeString(record.PairingParams)
+	if err != nil {
+		return nil, fmt.Errorf("decoding pairing parameters: %w", err)
+	}
+	pairing, err := group.NewPairing(string(paramsBytes))
+	if err != nil {
+		return nil, fmt.Errorf("creating pairing: %w", err)
+	}
+
+	generator, err := decodeStoredG2(pairing, record.Generator)
+	if err != nil {
+		return nil, fmt.Errorf("decoding generator: %w", err)
+	}
+
+	sharing := config.ThresholdConfig{
+		Enabled:     record.SharingEnabled,
+		Threshold:   record.Threshold,
+		TotalShares: record.TotalShares,
+	}
+
+	versions := make([]KeyVersion, len(record.Versions))
+	for i, version := range record.Versions {
+		if version.Version != i+1 {
+			return nil, fmt.Errorf("version %d stored at position %d", version.Version, i+1)
+		}
+		publicKey, err := decodeStoredG2(pairing, version.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("decoding public key of version %d: %w", version.Version, err)
+		}
+		versions[i] = KeyVersion{
+			KeyID:            record.KeyID,
+			Version:          version.Version,
+			PublicKey:        publicKey,
+			Threshold:        version.Threshold,
+			Epoch:            version.Epoch,
+			Shares:           version.Shares,
+			VerificationKeys: version.VerificationKeys,
+			Commitments:      version.Commitments,
+		}
+	}
+
+	manager := &keyManagementService{
+		keyID:         record.KeyID,
+		pairingType:   pairingType,
+		encodedParams: record.PairingParams,
+		pairing:       pairing,
+		generator:     generator,
+		versions:      versions,
+		sharing:       sharing,
+		distributed:   record.Distributed,
+		logger:        logger,
+	}
+
+	return &keyEntry{
+		spec: KeySpec{
+			KeyID:           record.KeyID,
+			Tenant:          record.Tenant,
+			SecurityLevel:   record.SecurityLevel,
+			PairingType:     pairingType,
+			ThresholdConfig: sharing,
+			Distributed:     record.Distributed,
+		},
+		status:    record.Status,
+		createdAt: record.CreatedAt,
+		manager:   manager,
+	}, nil
+}
+
+// decodeStoredG2 decodes a base64-encoded G2 element of the keystore
+func decodeStoredG2(pairing group.Pairing, encoded string) (group.Element, error) {
+	elementBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	element := pairing.NewG2().SetBytes(elementBytes)
+	if element.Is0() {
+		return nil, errors.New("G2 element is zero after SetBytes")
+	}
+	return element, nil
+}
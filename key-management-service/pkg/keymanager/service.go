@@ -3,139 +3,282 @@ package keymanager
 import (
 	"encoding/base64"
 	"errors"
-	"github.com/Nik-U/pbc"
-	"github.com/hashicorp/vault/shamir"
+	"fmt"
 	"github.com/mdshahjahanmiah/explore-go/logging"
 	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/dkg"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/group"
+	"sync"
 )
 
+// ErrSharesHeldByNodes is returned for share operations the KMS cannot perform because the decryption nodes hold the shares
+var ErrSharesHeldByNodes = errors.New("key shares are held by the decryption nodes")
+
+// ErrVersionNotFound is returned when the requested key version does not exist (yet)
+var ErrVersionNotFound = errors.New("key version not found")
+
+// KeyShare is a share of the private key of one key version. The epoch counts the refreshes the share
+// has gone through, shares only combine with shares of the same version and epoch.
 type KeyShare struct {
-	ID    int    `json:"id"`
-	Share string `json:"share"`
+	ID      int    `json:"id"`
+	Share   string `json:"share"`
+	Version int    `json:"version"`
+	Epoch   int    `json:"epoch"`
+}
+
+// VerificationKey is the public counterpart g^{s_i} of the key share with the same ID, version and epoch.
+type VerificationKey struct {
+	ID      int    `json:"id"`
+	Key     string `json:"key"`
+	Version int    `json:"version"`
+	Epoch   int    `json:"epoch"`
+}
+
+// KeyVersion is one version of the key with its own key pair, shares and commitments.
+// Rotation adds a version, refresh and reshare move every version to its next epoch.
+type KeyVersion struct {
+	KeyID            string
+	Version          int
+	PublicKey        group.Element
+	Threshold        int
+	Epoch            int
+	Shares           []KeyShare
+	VerificationKeys []VerificationKey
+	Commitments      []string
 }
 
 type keyManagementService struct {
+	keyID         string
+	pairingType   string
 	encodedParams string
-	publicKey     *pbc.Element
-	shares        []KeyShare
+	pairing       group.Pairing
+	generator     group.Element
+	mutex         sync.RWMutex
+	versions      []KeyVersion
+	sharing       config.ThresholdConfig
+	distributed   bool
 	logger        *logging.Logger
+
+	// onChange is called after every change of the key material, the keyring uses it to persist the keystore
+	onChange func() error
 }
 
 type KeyManagementService interface {
-	GetPublicKey() *pbc.Element
+	GetKeyID() string
+	GetKeyVersion(version int) (KeyVersion, error)
+	GetGenerator() group.Element
 	GetPairingParams() string
-	GetKeyShares() []KeyShare
+	GetPairingType() string
+	GetPairing() group.Pairing
+	IsDistributed() bool
+	Rotate() (int, error)
+	RefreshShares() (int, error)
+	Reshare(threshold, totalShares int) (int, error)
+	PublishDistributedKey(result dkg.Result) error
+	PublishRefresh(result dkg.Result) error
 }
 
-// NewKeyManagementService initializes the key management service
-func NewKeyManagementService(config config.Config, logger *logging.Logger) (KeyManagementService, error) {
-	// Determine security parameters based on the security level from the configuration
-	baseFieldSize, subgroupOrder := ToSecurityMeasures(config.SecurityLevel)
-
-	// Generate pairing parameters using the determined security parameters
-	params := pbc.GenerateA(baseFieldSize, subgroupOrder)
-	if params == nil {
-		logger.Fatal("failed to generate pairing parameters")
-	}
+// KeySpec describes a key of the keyring: who owns it, the type and security level of its pairing and how it is shared.
+// A distributed key is generated by the decryption nodes, the KMS only publishes its public outcome.
+// PairingParams are plain pairing parameters generated beforehand, they replace the type and security level when set.
+type KeySpec struct {
+	KeyID           string
+	Tenant          string
+	SecurityLevel   string
+	PairingType     string
+	PairingParams   string
+	ThresholdConfig config.ThresholdConfig
+	Distributed     bool
+}
 
-	// Convert pairing parameters to a string and then encode in base64 for storage
-	encodedParams := base64.StdEncoding.EncodeToString([]byte(params.String()))
+// NewKeyManagementService initializes the key management service of a single key
+func NewKeyManagementService(spec KeySpec, logger *logging.Logger) (KeyManagementService, error) {
+	return newKeyManagementService(spec, logger)
+}
 
-	// Create a new pairing using the generated parameters
-	pairing := params.NewPairing()
-	if pairing == nil {
-		logger.Fatal("failed to create pairing")
+func newKeyManagementService(spec KeySpec, logger *logging.Logger) (*keyManagementService, error) {
+	// Generate pairing parameters of the key's pairing type, sized for its security level, unless they were given
+	params := spec.PairingParams
+	var err error
+	if params != "" {
+		spec.PairingType, err = parsePairingParams(params)
+		if err != nil {
+			return nil, fmt.Errorf("parsing pairing parameters: %w", err)
+		}
+	} else {
+		params, err = GeneratePairingParams(spec.PairingType, spec.SecurityLevel)
+		if err != nil {
+			return nil, fmt.Errorf("generating pairing parameters: %w", err)
+		}
 	}
 
-	// Generate a random private key in the pairing's Zr field
-	privateKey := pairing.NewZr().Rand()
-	if privateKey == nil {
-		logger.Fatal("failed to generate private key")
+	// Encode the pairing parameters in base64 for storage
+	encodedParams := base64.StdEncoding.EncodeToString([]byte(params))
+
+	// Create a new pairing of the backend the parameters select
+	pairing, err := group.NewPairing(params)
+	if err != nil {
+		return nil, fmt.Errorf("creating pairing: %w", err)
 	}
 
-	// Generate a random G2 element to be used as the generator
+	// Generate a random G2 element to be used as the generator, it is shared by all versions of the key
 	g2Gen := pairing.NewG2().Rand()
 	if g2Gen == nil {
-		logger.Fatal("failed to generate G2 element")
+		return nil, errors.New("failed to generate G2 element")
 	}
 
-	// Generate the public key by raising the G2 generator to the power of the private key
-	publicKey := pairing.NewG2().PowZn(g2Gen, privateKey)
-	if publicKey == nil {
-		logger.Fatal("failed to generate public key")
+	service := &keyManagementService{
+		keyID:         spec.KeyID,
+		pairingType:   spec.PairingType,
+		encodedParams: encodedParams,
+		pairing:       pairing,
+		generator:     g2Gen,
+		sharing:       spec.ThresholdConfig,
+		distributed:   spec.Distributed,
+		logger:        logger,
+	}
+
+	// In DKG mode the decryption nodes generate the key pair jointly, the KMS only publishes the outcome
+	if spec.Distributed {
+		logger.Info("waiting for distributed key generation", "key_id", spec.KeyID, "threshold", spec.ThresholdConfig.Threshold, "shares", spec.ThresholdConfig.TotalShares)
+		return service, nil
+	}
+
+	firstVersion, err := service.generateVersion(1)
+	if err != nil {
+		return nil, err
 	}
+	service.versions = append(service.versions, firstVersion)
+
+	return service, nil
+}
+
+// generateVersion generates a fresh key pair and shares it under the current sharing configuration
+func (kms *keyManagementService) generateVersion(version int) (KeyVersion, error) {
+	// Generate a random private key in the pairing's Zr field
+	privateKey := kms.pairing.NewZr().Rand()
+
+	// Generate the public key by raising the G2 generator to the power of the private key
+	publicKey := kms.pairing.NewG2().PowZn(kms.generator, privateKey)
 
 	// Check if the public key is correctly generated
 	if publicKey.Is0() {
-		logger.Fatal("public key is zero")
+		return KeyVersion{}, errors.New("public key is zero")
 	}
 
-	// Convert the private key to a byte slice for further processing
-	privateKeyBytes := privateKey.Bytes()
-	if privateKeyBytes == nil {
-		logger.Fatal("failed to convert private key to bytes")
+	// Prepare key shares as points of a polynomial over Zr whose constant term is the private key
+	shareElements, coefficients, err := prepareShares(kms.sharing, kms.pairing, privateKey)
+	if err != nil {
+		return KeyVersion{}, fmt.Errorf("preparing key shares: %w", err)
 	}
 
-	// Prepare key shares using Shamir's Secret Sharing or other configuration
-	shares, err := prepareShares(config, logger, privateKeyBytes)
-	if err != nil {
-		logger.Error("failed to prepare key shares", "err", err)
-		return nil, err
+	// Without threshold sharing the single share is enough on its own
+	threshold := 1
+	if kms.sharing.Enabled {
+		threshold = kms.sharing.Threshold
 	}
 
-	return &keyManagementService{
-		encodedParams: encodedParams,
-		publicKey:     publicKey,
-		shares:        shares,
-		logger:        logger,
-	}, nil
+	keyVersion := KeyVersion{
+		KeyID:     kms.keyID,
+		Version:   version,
+		PublicKey: publicKey,
+		Threshold: threshold,
+	}
+
+	// Commit to the sharing polynomial so every node can check its share against the public key
+	kms.setShares(&keyVersion, shareElements, commitPolynomial(kms.pairing, kms.generator, coefficients), 0)
+
+	return keyVersion, nil
+}
+
+// setShares replaces the shares, their verification keys and the commitments of the key version with those of the given epoch.
+func (kms *keyManagementService) setShares(keyVersion *KeyVersion, shareElements []group.Element, commitmentElements []group.Element, epoch int) {
+	commitments := make([]string, len(commitmentElements))
+	for k, commitment := range commitmentElements {
+		commitments[k] = base64.StdEncoding.EncodeToString(commitment.Bytes())
+	}
+
+	// Convert the shares to KeyShare structs, the ID is the evaluation point of the share,
+	// and publish g^{s_i} for each of them so every node's contribution can be checked
+	shares := make([]KeyShare, len(shareElements))
+	verificationKeys := make([]VerificationKey, len(shareElements))
+	for i, share := range shareElements {
+		shares[i] = KeyShare{
+			ID:      i + 1,
+			Share:   base64.StdEncoding.EncodeToString(share.Bytes()),
+			Version: keyVersion.Version,
+			Epoch:   epoch,
+		}
+		verificationKeys[i] = VerificationKey{
+			ID:      i + 1,
+			Key:     base64.StdEncoding.EncodeToString(kms.pairing.NewG2().PowZn(kms.generator, share).Bytes()),
+			Version: keyVersion.Version,
+			Epoch:   epoch,
+		}
+	}
+
+	keyVersion.Shares = shares
+	keyVersion.VerificationKeys = verificationKeys
+	keyVersion.Commitments = commitments
+	keyVersion.Epoch = epoch
 }
 
-// prepareShares generates key shares from the private key bytes based on the configuration.
-// If threshold sharing is enabled, it splits the private key into multiple shares using Shamir's Secret Sharing.
+// prepareShares generates key shares from the private key based on the sharing configuration.
+// If threshold sharing is enabled, it splits the private key with Shamir's Secret Sharing over the Zr field,
+// so share i is f(i) for a random polynomial f with f(0) equal to the private key.
 // Otherwise, it returns the private key as a single share.
-func prepareShares(config config.Config, logger *logging.Logger, privateKeyBytes []byte) ([]KeyShare, error) {
+// The share with ID i is at position i-1 of the result, followed by the coefficients of the sharing polynomial.
+func prepareShares(thresholdConfig config.ThresholdConfig, pairing group.Pairing, privateKey group.Element) ([]group.Element, []group.Element, error) {
 	// Check if threshold sharing is enabled
-	if config.ThresholdConfig.Enabled {
+	if thresholdConfig.Enabled {
 		// Validate that the threshold is not greater than the total shares
-		if config.ThresholdConfig.Threshold > config.ThresholdConfig.TotalShares {
-			return nil, errors.New("threshold cannot be greater than total shares")
+		if thresholdConfig.Threshold > thresholdConfig.TotalShares {
+			return nil, nil, errors.New("threshold cannot be greater than total shares")
 		}
 		// Validate that the threshold and total shares are greater than 0
-		if config.ThresholdConfig.Threshold < 1 || config.ThresholdConfig.TotalShares < 1 {
-			return nil, errors.New("threshold and total shares must be greater than 0")
+		if thresholdConfig.Threshold < 1 || thresholdConfig.TotalShares < 1 {
+			return nil, nil, errors.New("threshold and total shares must be greater than 0")
 		}
-
-		// Split the private key into shares using Shamir's Secret Sharing
-		sharesBytes, err := shamir.Split(privateKeyBytes, config.ThresholdConfig.TotalShares, config.ThresholdConfig.Threshold)
-		if err != nil {
-			return nil, errors.New("failed to split private key into shares: " + err.Error())
+		if thresholdConfig.TotalShares > config.MaxShares {
+			return nil, nil, fmt.Errorf("at most %d shares", config.MaxShares)
 		}
 
-		// Convert the shares to a slice of KeyShare structs
-		shares := make([]KeyShare, len(sharesBytes))
-		for i, share := range sharesBytes {
-			shares[i] = KeyShare{
-				ID:    i + 1,
-				Share: base64.StdEncoding.EncodeToString(share),
-			}
-		}
-		return shares, nil
+		// Split the private key into Zr shares f(1), ..., f(n)
+		shares, coefficients := splitSecret(pairing, privateKey, thresholdConfig.Threshold, thresholdConfig.TotalShares)
+		return shares, coefficients, nil
 	}
 
-	// If threshold sharing is not enabled, return the single key share
-	shares := []KeyShare{
-		{
-			ID:    1,
-			Share: base64.StdEncoding.EncodeToString(privateKeyBytes),
-		},
+	// If threshold sharing is not enabled, the single key share is the constant polynomial f(x) = private key
+	return []group.Element{pairing.NewZr().Set(privateKey)}, []group.Element{pairing.NewZr().Set(privateKey)}, nil
+}
+
+// GetKeyID returns the name of the key, it is embedded in every ciphertext together with the key version.
+func (kms *keyManagementService) GetKeyID() string {
+	return kms.keyID
+}
+
+// GetKeyVersion returns the given version of the key, or the latest version for version 0.
+// In DKG mode there is no version until the decryption nodes have completed key generation.
+func (kms *keyManagementService) GetKeyVersion(version int) (KeyVersion, error) {
+	kms.mutex.RLock()
+	defer kms.mutex.RUnlock()
+
+	if len(kms.versions) == 0 {
+		return KeyVersion{}, ErrVersionNotFound
 	}
-	return shares, nil
+	if version == 0 {
+		return kms.versions[len(kms.versions)-1], nil
+	}
+	if version < 1 || version > len(kms.versions) {
+		return KeyVersion{}, fmt.Errorf("%w: %s version %d", ErrVersionNotFound, kms.keyID, version)
+	}
+	return kms.versions[version-1], nil
 }
 
-// GetPublicKey returns the public key of the key management service.
-func (kms *keyManagementService) GetPublicKey() *pbc.Element {
-	return kms.publicKey
+// GetGenerator returns the G2 generator the public keys were derived from.
+// Encryption and decryption both pair against it, so it is public alongside the keys.
+func (kms *keyManagementService) GetGenerator() group.Element {
+	return kms.generator
 }
 
 // GetPairingParams returns the base64-encoded pairing parameters of the key management service.
@@ -143,8 +286,276 @@ func (kms *keyManagementService) GetPairingParams() string {
 	return kms.encodedParams
 }
 
-// GetKeyShares returns the key shares of the private key.
-// The key shares are used in threshold cryptography, allowing a private key to be distributed among multiple parties.
-func (kms *keyManagementService) GetKeyShares() []KeyShare {
-	return kms.shares
+// GetPairingType returns the type of the key's pairing, "a", "d", "f" or "bls12-381".
+func (kms *keyManagementService) GetPairingType() string {
+	return kms.pairingType
+}
+
+// GetPairing returns the pairing the key material lives in.
+func (kms *keyManagementService) GetPairing() group.Pairing {
+	return kms.pairing
+}
+
+// IsDistributed reports whether the decryption nodes hold the shares of the key rather than the KMS
+func (kms *keyManagementService) IsDistributed() bool {
+	return kms.distributed
+}
+
+// Rotate generates a new version of the key and returns its number.
+// New encryptions use the latest version, older versions stay available for decrypting existing ciphertexts.
+func (kms *keyManagementService) Rotate() (version int, err error) {
+	if kms.distributed {
+		return 0, ErrSharesHeldByNodes
+	}
+
+	defer kms.persist(&err)
+	kms.mutex.Lock()
+	defer kms.mutex.Unlock()
+
+	keyVersion, err := kms.generateVersion(len(kms.versions) + 1)
+	if err != nil {
+		return 0, err
+	}
+	kms.versions = append(kms.versions, keyVersion)
+
+	kms.logger.Info("key rotated", "key_id", kms.keyID, "version", keyVersion.Version)
+	return keyVersion.Version, nil
+}
+
+// PublishDistributedKey installs the public outcome of a distributed key generation or reshare as the latest key version.
+// The KMS never sees the private key or any share, only the public key, the commitments and the verification keys.
+func (kms *keyManagementService) PublishDistributedKey(result dkg.Result) (err error) {
+	if result.PublicKey == nil || result.PublicKey.Is0() {
+		return errors.New("distributed public key is empty")
+	}
+
+	defer kms.persist(&err)
+	kms.mutex.Lock()
+	defer kms.mutex.Unlock()
+
+	version := 1
+	if len(kms.versions) > 0 {
+		version = len(kms.versions)
+	}
+
+	commitments := make([]string, len(result.Commitments))
+	for k, commitment := range result.Commitments {
+		commitments[k] = base64.StdEncoding.EncodeToString(commitment.Bytes())
+	}
+
+	verificationKeys := make([]VerificationKey, 0, len(result.VerificationKeys))
+	for id := 1; id <= result.TotalShares; id++ {
+		verificationKeys = append(verificationKeys, VerificationKey{
+			ID:      id,
+			Key:     base64.StdEncoding.EncodeToString(result.VerificationKeys[id].Bytes()),
+			Version: version,
+			Epoch:   result.Epoch,
+		})
+	}
+
+	keyVersion := KeyVersion{
+		KeyID:            kms.keyID,
+		Version:          version,
+		PublicKey:        result.PublicKey,
+		Threshold:        result.Threshold,
+		Epoch:            result.Epoch,
+		VerificationKeys: verificationKeys,
+		Commitments:      commitments,
+	}
+	if len(kms.versions) == 0 {
+		kms.versions = append(kms.versions, keyVersion)
+	} else {
+		kms.versions[version-1] = keyVersion
+	}
+
+	kms.logger.Info("distributed key published", "key_id", kms.keyID, "version", version, "threshold", result.Threshold, "shares", result.TotalShares)
+	return nil
+}
+
+// RefreshShares re-randomizes the shares of every key version with a polynomial whose constant term is zero
+// and returns the new epoch of the latest version. The private keys and so the public keys stay the same,
+// but the refreshed shares lie on new polynomials: shares collected before the refresh are useless
+// together with shares collected after it.
+func (kms *keyManagementService) RefreshShares() (epoch int, err error) {
+	if kms.distributed {
+		return 0, ErrSharesHeldByNodes
+	}
+
+	defer kms.persist(&err)
+	kms.mutex.Lock()
+	defer kms.mutex.Unlock()
+
+	if !kms.sharing.Enabled {
+		return 0, errors.New("a single key share cannot be refreshed")
+	}
+
+	versions := make([]KeyVersion, len(kms.versions))
+	for i, keyVersion := range kms.versions {
+		shareElements, err := kms.decodeShares(keyVersion)
+		if err != nil {
+			return 0, err
+		}
+		commitmentElements, err := kms.decodeCommitments(keyVersion)
+		if err != nil {
+			return 0, err
+		}
+
+		refreshed, coefficients := refreshShares(kms.pairing, shareElements, keyVersion.Threshold)
+
+		// g^{a_k + d_k} = g^{a_k} g^{d_k}, and d_0 = 0 keeps the first commitment equal to the public key
+		for k, delta := range commitPolynomial(kms.pairing, kms.generator, coefficients) {
+			commitmentElements[k].ThenMul(delta)
+		}
+
+		kms.setShares(&keyVersion, refreshed, commitmentElements, keyVersion.Epoch+1)
+		versions[i] = keyVersion
+	}
+	kms.versions = versions
+
+	latest := kms.versions[len(kms.versions)-1]
+	kms.logger.Info("key shares refreshed", "key_id", kms.keyID, "versions", len(kms.versions), "epoch", latest.Epoch)
+	return latest.Epoch, nil
+}
+
+// Reshare hands every key version to a new set of totalShares shares under the new threshold and returns
+// the new epoch of the latest version. The first threshold current holders each share their own share,
+// the new shares are the Lagrange combination of those sub-shares. The public keys are unchanged,
+// so existing ciphertexts stay decryptable, and later rotations use the new threshold as well.
+func (kms *keyManagementService) Reshare(threshold, totalShares int) (epoch int, err error) {
+	if kms.distributed {
+		return 0, ErrSharesHeldByNodes
+	}
+	if threshold < 1 || totalShares < 1 {
+		return 0, errors.New("threshold and total shares must be greater than 0")
+	}
+	if threshold > totalShares {
+		return 0, errors.New("threshold cannot be greater than total shares")
+	}
+	if totalShares > config.MaxShares {
+		return 0, fmt.Errorf("at most %d shares", config.MaxShares)
+	}
+
+	defer kms.persist(&err)
+	kms.mutex.Lock()
+	defer kms.mutex.Unlock()
+
+	versions := make([]KeyVersion, len(kms.versions))
+	for i, keyVersion := range kms.versions {
+		shareElements, err := kms.decodeShares(keyVersion)
+		if err != nil {
+			return 0, err
+		}
+
+		holders := make(map[int]group.Element, keyVersion.Threshold)
+		for j := 0; j < keyVersion.Threshold; j++ {
+			holders[keyVersion.Shares[j].ID] = shareElements[j]
+		}
+
+		shares, commitments := reshareSecret(kms.pairing, kms.generator, holders, threshold, totalShares)
+		if !commitments[0].Equals(keyVersion.PublicKey) {
+			return 0, fmt.Errorf("reshared polynomial of version %d does not hide the public key", keyVersion.Version)
+		}
+
+		keyVersion.Threshold = threshold
+		kms.setShares(&keyVersion, shares, commitments, keyVersion.Epoch+1)
+		versions[i] = keyVersion
+	}
+	kms.versions = versions
+	kms.sharing = config.ThresholdConfig{Enabled: true, Threshold: threshold, TotalShares: totalShares}
+
+	latest := kms.versions[len(kms.versions)-1]
+	kms.logger.Info("key reshared", "key_id", kms.keyID, "versions", len(kms.versions), "epoch", latest.Epoch, "threshold", threshold, "shares", totalShares)
+	return latest.Epoch, nil
+}
+
+// PublishRefresh folds the outcome of a distributed refresh into the latest key version.
+// The result carries g^{d_k} and g^{d(j)} for the summed zero-constant polynomial d of the qualified dealers.
+func (kms *keyManagementService) PublishRefresh(result dkg.Result) (err error) {
+	defer kms.persist(&err)
+	kms.mutex.Lock()
+	defer kms.mutex.Unlock()
+
+	if len(kms.versions) == 0 {
+		return errors.New("no distributed key to refresh")
+	}
+	keyVersion := kms.versions[len(kms.versions)-1]
+
+	commitmentElements, err := kms.decodeCommitments(keyVersion)
+	if err != nil {
+		return err
+	}
+	if len(commitmentElements) != len(result.Commitments) {
+		return errors.New("refresh does not match the threshold of the key")
+	}
+	for k, delta := range result.Commitments {
+		commitmentElements[k].ThenMul(delta)
+	}
+
+	commitments := make([]string, len(commitmentElements))
+	for k, commitment := range commitmentElements {
+		commitments[k] = base64.StdEncoding.EncodeToString(commitment.Bytes())
+	}
+
+	verificationKeys := make([]VerificationKey, len(keyVersion.VerificationKeys))
+	for i, verificationKey := range keyVersion.VerificationKeys {
+		keyBytes, err := base64.StdEncoding.DecodeString(verificationKey.Key)
+		if err != nil {
+			return err
+		}
+		key := kms.pairing.NewG2().SetBytes(keyBytes)
+		key.ThenMul(result.VerificationKeys[verificationKey.ID])
+
+		verificationKeys[i] = VerificationKey{
+			ID:      verificationKey.ID,
+			Key:     base64.StdEncoding.EncodeToString(key.Bytes()),
+			Version: keyVersion.Version,
+			Epoch:   result.Epoch,
+		}
+	}
+
+	keyVersion.Commitments = commitments
+	keyVersion.VerificationKeys = verificationKeys
+	keyVersion.Epoch = result.Epoch
+	kms.versions[len(kms.versions)-1] = keyVersion
+
+	kms.logger.Info("distributed refresh published", "key_id", kms.keyID, "version", keyVersion.Version, "epoch", result.Epoch)
+	return nil
+}
+
+// persist hands a successful change to the onChange hook, it must be deferred before the lock is taken
+// so that it runs once the lock has been released.
+func (kms *keyManagementService) persist(err *error) {
+	if *err != nil || kms.onChange == nil {
+		return
+	}
+	if persistErr := kms.onChange(); persistErr != nil {
+		kms.logger.Error("failed to persist key", "key_id", kms.keyID, "err", persistErr)
+		*err = persistErr
+	}
+}
+
+// decodeShares decodes the key shares of a version
+func (kms *keyManagementService) decodeShares(keyVersion KeyVersion) ([]group.Element, error) {
+	shares := make([]group.Element, len(keyVersion.Shares))
+	for i, share := range keyVersion.Shares {
+		shareBytes, err := base64.StdEncoding.DecodeString(share.Share)
+		if err != nil {
+			return nil, err
+		}
+		shares[i] = kms.pairing.NewZr().SetBytes(shareBytes)
+	}
+	return shares, nil
+}
+
+// decodeCommitments decodes the commitments of a version
+func (kms *keyManagementService) decodeCommitments(keyVersion KeyVersion) ([]group.Element, error) {
+	commitments := make([]group.Element, len(keyVersion.Commitments))
+	for k, encoded := range keyVersion.Commitments {
+		commitmentBytes, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		commitments[k] = kms.pairing.NewG2().SetBytes(commitmentBytes)
+	}
+	return commitments, nil
 }
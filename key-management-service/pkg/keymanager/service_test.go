@@ -0,0 +1,178 @@
+package keymanager
+
+import (
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/group"
+	"testing"
+)
+
+// newTestService creates a key on the pure-Go pairing, shared t of n by the KMS
+func newTestService(t *testing.T, threshold, n int) *keyManagementService {
+	t.Helper()
+
+	logger, err := logging.NewLogger(logging.LoggerConfig{CommandHandler: "text", LogLevel: "error"})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	spec := KeySpec{
+		KeyID:           "default",
+		Tenant:          "test",
+		SecurityLevel:   "medium",
+		PairingType:     PairingTypeBLS12381,
+		ThresholdConfig: config.ThresholdConfig{Enabled: true, Threshold: threshold, TotalShares: n},
+	}
+	kms, err := newKeyManagementService(spec, logger)
+	if err != nil {
+		t.Fatalf("newKeyManagementService: %v", err)
+	}
+	return kms
+}
+
+// checkSharing checks that a key version is a consistent t of n sharing of its private key: every share matches the
+// commitments and its verification key, the first commitment is the public key and any t shares recover the key
+func checkSharing(t *testing.T, kms *keyManagementService, keyVersion KeyVersion, threshold, n int) []group.Element {
+	t.Helper()
+	pairing := kms.pairing
+
+	shares, err := kms.decodeShares(keyVersion)
+	if err != nil {
+		t.Fatalf("decodeShares: %v", err)
+	}
+	commitments, err := kms.decodeCommitments(keyVersion)
+	if err != nil {
+		t.Fatalf("decodeCommitments: %v", err)
+	}
+	if len(shares) != n || len(commitments) != threshold || keyVersion.Threshold != threshold {
+		t.Fatalf("version %d: %d shares, %d commitments and threshold %d, want %d of %d",
+			keyVersion.Version, len(shares), len(commitments), keyVersion.Threshold, threshold, n)
+	}
+	if !commitments[0].Equals(keyVersion.PublicKey) {
+		t.Errorf("version %d: first commitment is not the public key", keyVersion.Version)
+	}
+
+	for i, share := range shares {
+		if !consistentShare(pairing, kms.generator, commitments, i+1, share) {
+			t.Errorf("version %d: share %d does not match the commitments", keyVersion.Version, i+1)
+		}
+		if keyVersion.Shares[i].Epoch != keyVersion.Epoch || keyVersion.VerificationKeys[i].Epoch != keyVersion.Epoch {
+			t.Errorf("version %d: share %d is not of epoch %d", keyVersion.Version, i+1, keyVersion.Epoch)
+		}
+	}
+
+	subsets(threshold, n, func(ids []int) {
+		secret := reconstruct(pairing, shares, ids)
+		if !pairing.NewG2().PowZn(kms.generator, secret).Equals(keyVersion.PublicKey) {
+			t.Errorf("version %d: shares %v do not recover the private key", keyVersion.Version, ids)
+		}
+	})
+	return shares
+}
+
+func TestRefreshShares(t *testing.T) {
+	pairing := newTestPairing(t)
+	secret := pairing.NewZr().Rand()
+	shares, _ := splitSecret(pairing, secret, 3, 5)
+
+	refreshed, coefficients := refreshShares(pairing, shares, 3)
+	if !coefficients[0].Is0() {
+		t.Error("refresh polynomial has a non-zero constant term")
+	}
+	for i := range shares {
+		if refreshed[i].Equals(shares[i]) {
+			t.Errorf("share %d did not change", i+1)
+		}
+	}
+	subsets(3, 5, func(ids []int) {
+		if !reconstruct(pairing, refreshed, ids).Equals(secret) {
+			t.Errorf("refreshed shares %v do not recover the secret", ids)
+		}
+	})
+
+	// Old and refreshed shares lie on different polynomials, mixing them gives a wrong secret
+	mixed := []group.Element{shares[0], refreshed[1], refreshed[2]}
+	if reconstruct(pairing, mixed, []int{1, 2, 3}).Equals(secret) {
+		t.Error("old and refreshed shares combine to the secret")
+	}
+}
+
+func TestServiceRefreshShares(t *testing.T) {
+	kms := newTestService(t, 2, 4)
+	if _, err := kms.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	before := make([][]group.Element, len(kms.versions))
+	for i, keyVersion := range kms.versions {
+		before[i] = checkSharing(t, kms, keyVersion, 2, 4)
+	}
+
+	epoch, err := kms.RefreshShares()
+	if err != nil {
+		t.Fatalf("RefreshShares: %v", err)
+	}
+	if epoch != 1 {
+		t.Errorf("epoch = %d, want 1", epoch)
+	}
+
+	// Every version moves to the next epoch, its public key stays and its shares change
+	for i, keyVersion := range kms.versions {
+		if keyVersion.Epoch != 1 {
+			t.Errorf("version %d: epoch = %d, want 1", keyVersion.Version, keyVersion.Epoch)
+		}
+		after := checkSharing(t, kms, keyVersion, 2, 4)
+		for j := range after {
+			if after[j].Equals(before[i][j]) {
+				t.Errorf("version %d: share %d did not change", keyVersion.Version, j+1)
+			}
+		}
+	}
+}
+
+func TestServiceReshare(t *testing.T) {
+	kms := newTestService(t, 2, 3)
+	if _, err := kms.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	publicKeys := make([]group.Element, len(kms.versions))
+	for i, keyVersion := range kms.versions {
+		publicKeys[i] = keyVersion.PublicKey
+	}
+
+	tests := []struct {
+		threshold int
+		n         int
+	}{
+		{threshold: 3, n: 5},
+		{threshold: 2, n: 2},
+		{threshold: 1, n: 3},
+	}
+
+	for round, test := range tests {
+		epoch, err := kms.Reshare(test.threshold, test.n)
+		if err != nil {
+			t.Fatalf("Reshare(%d, %d): %v", test.threshold, test.n, err)
+		}
+		if epoch != round+1 {
+			t.Errorf("Reshare(%d, %d): epoch = %d, want %d", test.threshold, test.n, epoch, round+1)
+		}
+		for i, keyVersion := range kms.versions {
+			if !keyVersion.PublicKey.Equals(publicKeys[i]) {
+				t.Errorf("Reshare(%d, %d): public key of version %d changed", test.threshold, test.n, keyVersion.Version)
+			}
+			checkSharing(t, kms, keyVersion, test.threshold, test.n)
+		}
+	}
+
+	// Versions rotated in after a reshare use the new sharing
+	if _, err := kms.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	checkSharing(t, kms, kms.versions[len(kms.versions)-1], 1, 3)
+
+	for _, invalid := range [][2]int{{0, 3}, {4, 3}, {1, 0}} {
+		if _, err := kms.Reshare(invalid[0], invalid[1]); err == nil {
+			t.Errorf("Reshare(%d, %d) succeeded", invalid[0], invalid[1])
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package keymanager
+
+import "github.com/mdshahjahanmiah/key-management-service/pkg/group"
+
+// newPolynomial returns the coefficients of a random polynomial f over Zr of the given degree with f(0) = secret.
+// coefficients[k] is the coefficient of x^k.
+func newPolynomial(pairing group.Pairing, secret group.Element, degree int) []group.Element {
+	coefficients := make([]group.Element, degree+1)
+	coefficients[0] = pairing.NewZr().Set(secret)
+	for k := 1; k <= degree; k++ {
+		coefficients[k] = pairing.NewZr().Rand()
+	}
+	return coefficients
+}
+
+// evaluatePolynomial evaluates f(x) in Zr using Horner's rule.
+func evaluatePolynomial(pairing group.Pairing, coefficients []group.Element, x int) group.Element {
+	xElement := pairing.NewZr().SetInt32(int32(x))
+	result := pairing.NewZr().Set0()
+	for k := len(coefficients) - 1; k >= 0; k-- {
+		result.ThenMul(xElement).ThenAdd(coefficients[k])
+	}
+	return result
+}
+
+// splitSecret splits the secret into totalShares points of a random polynomial of degree threshold-1,
+// so that share i is f(i) and any threshold of them recover f(0) by Lagrange interpolation.
+// The share for index i is at position i-1 of the result, the polynomial coefficients are returned
+// alongside so they can be committed to.
+func splitSecret(pairing group.Pairing, secret group.Element, threshold, totalShares int) ([]group.Element, []group.Element) {
+	coefficients := newPolynomial(pairing, secret, threshold-1)
+
+	shares := make([]group.Element, totalShares)
+	for i := 1; i <= totalShares; i++ {
+		shares[i-1] = evaluatePolynomial(pairing, coefficients, i)
+	}
+	return shares, coefficients
+}
+
+// refreshShares adds the evaluations of a random polynomial with a zero constant term to the shares.
+// The secret f(0) stays the same while every share moves to a fresh, independent point, the returned
+// coefficients of the zero polynomial are needed to update the commitments.
+func refreshShares(pairing group.Pairing, shares []group.Element, threshold int) ([]group.Element, []group.Element) {
+	coefficients := newPolynomial(pairing, pairing.NewZr().Set0(), threshold-1)
+
+	refreshed := make([]group.Element, len(shares))
+	for i, share := range shares {
+		refreshed[i] = pairing.NewZr().Add(share, evaluatePolynomial(pairing, coefficients, i+1))
+	}
+	return refreshed, coefficients
+}
+
+// reshareSecret hands the secret behind the shares of the given holders to a new sharing of degree threshold-1
+// without interpolating it: holder i shares its own share with a fresh polynomial g_i, and new share j is
+// sum_i l_i g_i(j) for the Lagrange weights l_i of the holders. The commitments to the new polynomial are
+// combined in the group as prod_i (g^{g_ik})^{l_i}, so their constant term is still the public key.
+func reshareSecret(pairing group.Pairing, generator group.Element, holders map[int]group.Element, threshold, totalShares int) ([]group.Element, []group.Element) {
+	ids := make([]int, 0, len(holders))
+	for id := range holders {
+		ids = append(ids, id)
+	}
+	weights := lagrangeAtZero(pairing, ids)
+
+	shares := make([]group.Element, totalShares)
+	for j := range shares {
+		shares[j] = pairing.NewZr().Set0()
+	}
+	commitments := make([]group.Element, threshold)
+	for k := range commitments {
+		commitments[k] = pairing.NewG2().Set1()
+	}
+
+	for id, share := range holders {
+		subShares, coefficients := splitSecret(pairing, share, threshold, totalShares)
+		for j, subShare := range subShares {
+			shares[j].ThenAdd(pairing.NewZr().Mul(weights[id], subShare))
+		}
+		for k, commitment := range commitPolynomial(pairing, generator, coefficients) {
+			commitments[k].ThenMul(pairing.NewG2().PowZn(commitment, weights[id]))
+		}
+	}
+	return shares, commitments
+}
+
+// lagrangeAtZero returns the weights l_i = prod_{j != i} j / (j - i) that interpolate f(0) from the values f(i)
+func lagrangeAtZero(pairing group.Pairing, ids []int) map[int]group.Element {
+	weights := make(map[int]group.Element, len(ids))
+	for _, i := range ids {
+		numerator := pairing.NewZr().Set1()
+		denominator := pairing.NewZr().Set1()
+		for _, j := range ids {
+			if i == j {
+				continue
+			}
+			numerator.ThenMul(pairing.NewZr().SetInt32(int32(j)))
+			denominator.ThenMul(pairing.NewZr().SetInt32(int32(j - i)))
+		}
+		weights[i] = numerator.ThenDiv(denominator)
+	}
+	return weights
+}
+
+// commitPolynomial returns the Feldman commitments g^{a_k} to the polynomial coefficients.
+// Share i is consistent with them when g^{f(i)} = prod_k (g^{a_k})^{i^k}, and the first commitment is the public key.
+func commitPolynomial(pairing group.Pairing, generator group.Element, coefficients []group.Element) []group.Element {
+	commitments := make([]group.Element, len(coefficients))
+	for k, coefficient := range coefficients {
+		commitments[k] = pairing.NewG2().PowZn(generator, coefficient)
+	}
+	return commitments
+}
@@ -0,0 +1,187 @@
+package keymanager
+
+import (
+	"github.com/mdshahjahanmiah/key-management-service/pkg/group"
+	"testing"
+)
+
+func newTestPairing(t *testing.T) group.Pairing {
+	t.Helper()
+	pairing, err := group.NewPairing(group.BLS12381Params())
+	if err != nil {
+		t.Fatalf("NewPairing: %v", err)
+	}
+	return pairing
+}
+
+// reconstruct interpolates f(0) from the shares with the given ids, share i is at position i-1
+func reconstruct(pairing group.Pairing, shares []group.Element, ids []int) group.Element {
+	weights := lagrangeAtZero(pairing, ids)
+	secret := pairing.NewZr().Set0()
+	for _, id := range ids {
+		secret.ThenAdd(pairing.NewZr().Mul(weights[id], shares[id-1]))
+	}
+	return secret
+}
+
+// consistentShare reports whether g^{share} = prod_k C_k^{id^k}, the Feldman check a node runs on its share
+func consistentShare(pairing group.Pairing, generator group.Element, commitments []group.Element, id int, share group.Element) bool {
+	expected := pairing.NewG2().Set1()
+	power := pairing.NewZr().Set1()
+	x := pairing.NewZr().SetInt32(int32(id))
+	for _, commitment := range commitments {
+		expected.ThenMul(pairing.NewG2().PowZn(commitment, power))
+		power.ThenMul(x)
+	}
+	return pairing.NewG2().PowZn(generator, share).Equals(expected)
+}
+
+// subsets calls visit with the ids 1..n of every subset of the given size
+func subsets(size, n int, visit func(ids []int)) {
+	ids := make([]int, size)
+	var next func(position, from int)
+	next = func(position, from int) {
+		if position == size {
+			visit(append([]int(nil), ids...))
+			return
+		}
+		for id := from; id <= n; id++ {
+			ids[position] = id
+			next(position+1, id+1)
+		}
+	}
+	next(0, 1)
+}
+
+func TestSplitSecret(t *testing.T) {
+	pairing := newTestPairing(t)
+
+	tests := []struct {
+		threshold int
+		n         int
+	}{
+		{threshold: 1, n: 1},
+		{threshold: 1, n: 3},
+		{threshold: 2, n: 3},
+		{threshold: 3, n: 5},
+		{threshold: 4, n: 4},
+	}
+
+	for _, test := range tests {
+		secret := pairing.NewZr().Rand()
+		shares, coefficients := splitSecret(pairing, secret, test.threshold, test.n)
+		if len(shares) != test.n || len(coefficients) != test.threshold {
+			t.Fatalf("%d of %d: got %d shares and %d coefficients", test.threshold, test.n, len(shares), len(coefficients))
+		}
+		if !coefficients[0].Equals(secret) {
+			t.Errorf("%d of %d: constant term is not the secret", test.threshold, test.n)
+		}
+
+		subsets(test.threshold, test.n, func(ids []int) {
+			if !reconstruct(pairing, shares, ids).Equals(secret) {
+				t.Errorf("%d of %d: shares %v do not recover the secret", test.threshold, test.n, ids)
+			}
+		})
+		if test.threshold > 1 {
+			subsets(test.threshold-1, test.n, func(ids []int) {
+				if reconstruct(pairing, shares, ids).Equals(secret) {
+					t.Errorf("%d of %d: %d shares %v recover the secret", test.threshold, test.n, len(ids), ids)
+				}
+			})
+		}
+	}
+}
+
+func TestSharesMatchCommitments(t *testing.T) {
+	pairing := newTestPairing(t)
+	generator := pairing.NewG2().Rand()
+	secret := pairing.NewZr().Rand()
+
+	shares, coefficients := splitSecret(pairing, secret, 3, 5)
+	commitments := commitPolynomial(pairing, generator, coefficients)
+	if !commitments[0].Equals(pairing.NewG2().PowZn(generator, secret)) {
+		t.Error("first commitment is not the public key")
+	}
+
+	for i, share := range shares {
+		if !consistentShare(pairing, generator, commitments, i+1, share) {
+			t.Errorf("share %d does not match the commitments", i+1)
+		}
+	}
+
+	tampered := pairing.NewZr().Add(shares[1], pairing.NewZr().Set1())
+	tests := []struct {
+		name  string
+		id    int
+		share group.Element
+	}{
+		{name: "tampered share", id: 2, share: tampered},
+		{name: "share of another id", id: 2, share: shares[2]},
+		{name: "random share", id: 4, share: pairing.NewZr().Rand()},
+	}
+	for _, test := range tests {
+		if consistentShare(pairing, generator, commitments, test.id, test.share) {
+			t.Errorf("%s passes the commitment check", test.name)
+		}
+	}
+
+	// A tampered share also changes the secret the shares reconstruct
+	withTampered := append([]group.Element(nil), shares...)
+	withTampered[1] = tampered
+	if reconstruct(pairing, withTampered, []int{1, 2, 3}).Equals(secret) {
+		t.Error("tampered share still recovers the secret")
+	}
+}
+
+func TestReshareSecret(t *testing.T) {
+	pairing := newTestPairing(t)
+	generator := pairing.NewG2().Rand()
+
+	tests := []struct {
+		name         string
+		oldThreshold int
+		holders      []int
+		threshold    int
+		n            int
+	}{
+		{name: "same committee", oldThreshold: 2, holders: []int{1, 2}, threshold: 2, n: 3},
+		{name: "raise threshold", oldThreshold: 2, holders: []int{2, 3}, threshold: 3, n: 5},
+		{name: "lower threshold", oldThreshold: 3, holders: []int{1, 3, 5}, threshold: 2, n: 2},
+		{name: "more holders than needed", oldThreshold: 2, holders: []int{1, 2, 3, 4}, threshold: 3, n: 4},
+	}
+
+	for _, test := range tests {
+		secret := pairing.NewZr().Rand()
+		oldShares, _ := splitSecret(pairing, secret, test.oldThreshold, 5)
+		holders := make(map[int]group.Element, len(test.holders))
+		for _, id := range test.holders {
+			holders[id] = oldShares[id-1]
+		}
+
+		shares, commitments := reshareSecret(pairing, generator, holders, test.threshold, test.n)
+		if len(shares) != test.n || len(commitments) != test.threshold {
+			t.Fatalf("%s: got %d shares and %d commitments", test.name, len(shares), len(commitments))
+		}
+		if !commitments[0].Equals(pairing.NewG2().PowZn(generator, secret)) {
+			t.Errorf("%s: first commitment is not the public key", test.name)
+		}
+		for i, share := range shares {
+			if !consistentShare(pairing, generator, commitments, i+1, share) {
+				t.Errorf("%s: share %d does not match the commitments", test.name, i+1)
+			}
+		}
+
+		subsets(test.threshold, test.n, func(ids []int) {
+			if !reconstruct(pairing, shares, ids).Equals(secret) {
+				t.Errorf("%s: reshared shares %v do not recover the secret", test.name, ids)
+			}
+		})
+		if test.threshold > 1 {
+			subsets(test.threshold-1, test.n, func(ids []int) {
+				if reconstruct(pairing, shares, ids).Equals(secret) {
+					t.Errorf("%s: %d reshared shares %v recover the secret", test.name, len(ids), ids)
+				}
+			})
+		}
+	}
+}
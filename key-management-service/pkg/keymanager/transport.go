@@ -5,38 +5,130 @@ import (
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/mdshahjahanmiah/explore-go/error"
 	"github.com/mdshahjahanmiah/explore-go/http"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
 )
 
-func MakeHandler(service KeyManagementService) http.Endpoint {
+func MakeHandler(config config.Config, keyring Keyring) http.Endpoint {
 	opts := []kithttp.ServerOption{
+		kithttp.ServerBefore(kithttp.PopulateRequestContext),
 		kithttp.ServerErrorEncoder(error.EncodeError),
 	}
 
 	handlePublicKey := kithttp.NewServer(
-		getPublicKeyEndpoint(service),
-		kithttp.NopRequestDecoder,
+		getPublicKeyEndpoint(keyring),
+		decodeVersionRequest,
 		kithttp.EncodeJSONResponse,
 		opts...,
 	)
 
 	handleShare := kithttp.NewServer(
-		getShareKeyEndpoint(service),
-		kithttp.NopRequestDecoder,
+		getShareKeyEndpoint(keyring, config.AuthConfig.NodeTokens),
+		decodeShareRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleVerificationKeys := kithttp.NewServer(
+		getVerificationKeysEndpoint(keyring),
+		decodeVersionRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleCommitments := kithttp.NewServer(
+		getCommitmentsEndpoint(keyring),
+		decodeVersionRequest,
 		kithttp.EncodeJSONResponse,
 		opts...,
 	)
 
 	handlePairingParam := kithttp.NewServer(
-		getPairingParamsEndpoint(service),
-		kithttp.NopRequestDecoder,
+		getPairingParamsEndpoint(keyring),
+		decodeKeyRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleRotate := kithttp.NewServer(
+		getRotateEndpoint(keyring, config.AuthConfig.AdminTokens),
+		decodeKeyRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleRefresh := kithttp.NewServer(
+		getRefreshEndpoint(keyring, config.AuthConfig.AdminTokens),
+		decodeKeyRequest,
 		kithttp.EncodeJSONResponse,
 		opts...,
 	)
 
+	handleReshare := kithttp.NewServer(
+		getReshareEndpoint(keyring, config.AuthConfig.AdminTokens),
+		decodeReshareRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleCreateKey := kithttp.NewServer(
+		createKeyEndpoint(keyring, config.AuthConfig.AdminTokens),
+		decodeCreateKeyRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleListKeys := kithttp.NewServer(
+		listKeysEndpoint(keyring, config.AuthConfig.AdminTokens),
+		decodeListKeysRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleDescribeKey := kithttp.NewServer(
+		describeKeyEndpoint(keyring, config.AuthConfig.AdminTokens),
+		decodeKeyRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleDisableKey := kithttp.NewServer(
+		disableKeyEndpoint(keyring, config.AuthConfig.AdminTokens),
+		decodeKeyRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleDeleteKey := kithttp.NewServer(
+		deleteKeyEndpoint(keyring, config.AuthConfig.AdminTokens),
+		decodeKeyRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	// The key routes serve the default key at the root and every key of the keyring under /keys/{keyID}
+	keyRoutes := func(r chi.Router) {
+		r.Method("GET", "/public-key", handlePublicKey)
+		r.Method("GET", "/key-shares/{shareID}", handleShare)
+		r.Method("GET", "/verification-keys", handleVerificationKeys)
+		r.Method("GET", "/commitments", handleCommitments)
+		r.Method("GET", "/pairing-param", handlePairingParam)
+		r.Method("POST", "/rotate", handleRotate)
+		r.Method("POST", "/refresh", handleRefresh)
+		r.Method("POST", "/reshare", handleReshare)
+	}
+
 	r := chi.NewRouter()
-	r.Method("GET", "/public-key", handlePublicKey)
-	r.Method("GET", "/key-shares", handleShare)
-	r.Method("GET", "/pairing-param", handlePairingParam)
+	keyRoutes(r)
+
+	// Keyring admin API
+	r.Method("POST", "/keys", handleCreateKey)
+	r.Method("GET", "/keys", handleListKeys)
+	r.Route("/keys/{keyID}", func(r chi.Router) {
+		r.Method("GET", "/", handleDescribeKey)
+		r.Method("DELETE", "/", handleDeleteKey)
+		r.Method("POST", "/disable", handleDisableKey)
+		keyRoutes(r)
+	})
 
 	return http.Endpoint{Pattern: "/*", Handler: r}
 }
@@ -0,0 +1,154 @@
+package keymanager
+
+import (
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/auth"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestHandler serves a keyring with the default key of tenant acme and the key payments of tenant globex
+func newTestHandler(t *testing.T) http.Handler {
+	t.Helper()
+
+	logger, err := logging.NewLogger(logging.LoggerConfig{CommandHandler: "text", LogLevel: "error"})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	conf := config.Config{
+		KeyID:           "default",
+		KeyTenant:       "acme",
+		SecurityLevel:   "medium",
+		PairingType:     PairingTypeBLS12381,
+		KeygenMode:      config.KeygenModeDealer,
+		ThresholdConfig: config.ThresholdConfig{Enabled: true, Threshold: 2, TotalShares: 3},
+		AuthConfig: config.AuthConfig{
+			NodeTokens:  auth.NodeTokens{1: "node-1", 2: "node-2"},
+			AdminTokens: auth.AdminTokens{"acme": "acme-admin", "globex": "globex-admin", auth.OperatorTenant: "operator"},
+		},
+	}
+	keyring, err := NewKeyring(conf, nil, logger)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	if _, err := keyring.Create(KeySpec{
+		KeyID:           "payments",
+		Tenant:          "globex",
+		SecurityLevel:   "medium",
+		PairingType:     PairingTypeBLS12381,
+		ThresholdConfig: config.ThresholdConfig{Enabled: true, Threshold: 2, TotalShares: 3},
+	}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return MakeHandler(conf, keyring).Handler
+}
+
+func serve(handler http.Handler, method, target, token, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestKeyShareAuthentication(t *testing.T) {
+	handler := newTestHandler(t)
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		status int
+	}{
+		{name: "own share", target: "/key-shares/1", token: "node-1", status: http.StatusOK},
+		{name: "own share of another key", target: "/keys/payments/key-shares/2", token: "node-2", status: http.StatusOK},
+		{name: "share of another node", target: "/key-shares/2", token: "node-1", status: http.StatusForbidden},
+		{name: "no token", target: "/key-shares/1", status: http.StatusUnauthorized},
+		{name: "admin token", target: "/key-shares/1", token: "operator", status: http.StatusUnauthorized},
+		{name: "node without a token", target: "/key-shares/3", token: "node-3", status: http.StatusUnauthorized},
+		{name: "public key needs no token", target: "/public-key", status: http.StatusOK},
+	}
+	for _, test := range tests {
+		if response := serve(handler, http.MethodGet, test.target, test.token, ""); response.Code != test.status {
+			t.Errorf("%s: status %d, want %d: %s", test.name, response.Code, test.status, response.Body)
+		}
+	}
+}
+
+func TestAdminTenantIsolation(t *testing.T) {
+	handler := newTestHandler(t)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		body   string
+		status int
+		want   string
+	}{
+		{name: "describe own key", method: http.MethodGet, target: "/keys/payments", token: "globex-admin", status: http.StatusOK},
+		{name: "describe key of another tenant", method: http.MethodGet, target: "/keys/payments", token: "acme-admin", status: http.StatusNotFound},
+		{name: "operator describes any key", method: http.MethodGet, target: "/keys/payments", token: "operator", status: http.StatusOK},
+		{name: "describe without a token", method: http.MethodGet, target: "/keys/payments", status: http.StatusUnauthorized},
+		{name: "describe with a node token", method: http.MethodGet, target: "/keys/payments", token: "node-1", status: http.StatusUnauthorized},
+		{name: "rotate key of another tenant", method: http.MethodPost, target: "/keys/payments/rotate", token: "acme-admin", status: http.StatusNotFound},
+		{name: "rotate default key of another tenant", method: http.MethodPost, target: "/rotate", token: "globex-admin", status: http.StatusNotFound},
+		{name: "refresh key of another tenant", method: http.MethodPost, target: "/keys/payments/refresh", token: "acme-admin", status: http.StatusNotFound},
+		{name: "reshare key of another tenant", method: http.MethodPost, target: "/keys/payments/reshare", token: "acme-admin", body: `{"threshold": 2, "total_shares": 3}`, status: http.StatusNotFound},
+		{name: "disable key of another tenant", method: http.MethodPost, target: "/keys/payments/disable", token: "acme-admin", status: http.StatusNotFound},
+		{name: "delete key of another tenant", method: http.MethodDelete, target: "/keys/payments", token: "acme-admin", status: http.StatusNotFound},
+		{name: "rotate own default key", method: http.MethodPost, target: "/rotate", token: "acme-admin", status: http.StatusOK},
+		{name: "refresh own key", method: http.MethodPost, target: "/keys/payments/refresh", token: "globex-admin", status: http.StatusOK},
+		{name: "list own keys", method: http.MethodGet, target: "/keys", token: "acme-admin", status: http.StatusOK, want: `"key_id":"default"`},
+		{name: "list keys of another tenant", method: http.MethodGet, target: "/keys?tenant=globex", token: "acme-admin", status: http.StatusForbidden},
+		{name: "operator lists a tenant", method: http.MethodGet, target: "/keys?tenant=globex", token: "operator", status: http.StatusOK, want: `"key_id":"payments"`},
+		{name: "list without a token", method: http.MethodGet, target: "/keys", status: http.StatusUnauthorized},
+		{name: "create key for another tenant", method: http.MethodPost, target: "/keys", token: "acme-admin", body: `{"key_id": "ledger", "tenant": "globex", "pairing_type": "bls12-381", "threshold": 2, "total_shares": 3}`, status: http.StatusForbidden},
+		{name: "create key for own tenant", method: http.MethodPost, target: "/keys", token: "acme-admin", body: `{"key_id": "ledger", "pairing_type": "bls12-381", "threshold": 2, "total_shares": 3}`, status: http.StatusOK, want: `"tenant":"acme"`},
+		{name: "create key without a token", method: http.MethodPost, target: "/keys", body: `{"key_id": "audit", "tenant": "acme", "pairing_type": "bls12-381", "threshold": 2, "total_shares": 3}`, status: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		response := serve(handler, test.method, test.target, test.token, test.body)
+		if response.Code != test.status {
+			t.Errorf("%s: status %d, want %d: %s", test.name, response.Code, test.status, response.Body)
+			continue
+		}
+		if test.want != "" && !strings.Contains(response.Body.String(), test.want) {
+			t.Errorf("%s: response %s does not contain %s", test.name, response.Body, test.want)
+		}
+	}
+
+	// Listing never shows the keys of another tenant
+	if body := serve(handler, http.MethodGet, "/keys", "globex-admin", "").Body.String(); strings.Contains(body, `"tenant":"acme"`) {
+		t.Errorf("globex lists keys of acme: %s", body)
+	}
+}
+
+func TestQuorumLimits(t *testing.T) {
+	handler := newTestHandler(t)
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+	}{
+		{name: "create key with too many shares", target: "/keys", body: `{"key_id": "huge", "pairing_type": "bls12-381", "threshold": 2, "total_shares": 100000000}`, status: http.StatusBadRequest},
+		{name: "create key with a threshold above the shares", target: "/keys", body: `{"key_id": "huge", "pairing_type": "bls12-381", "threshold": 4, "total_shares": 3}`, status: http.StatusBadRequest},
+		{name: "create key with the most shares", target: "/keys", body: `{"key_id": "wide", "pairing_type": "bls12-381", "threshold": 2, "total_shares": 255}`, status: http.StatusOK},
+		{name: "reshare to too many shares", target: "/keys/payments/reshare", body: `{"threshold": 2, "total_shares": 256}`, status: http.StatusBadRequest},
+		{name: "reshare with a threshold of 0", target: "/keys/payments/reshare", body: `{"threshold": 0, "total_shares": 3}`, status: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		response := serve(handler, http.MethodPost, test.target, "globex-admin", test.body)
+		if response.Code != test.status {
+			t.Errorf("%s: status %d, want %d: %s", test.name, response.Code, test.status, response.Body)
+		}
+	}
+}
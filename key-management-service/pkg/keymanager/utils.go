@@ -1,6 +1,33 @@
 package keymanager
 
-import "strings"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/group"
+	"strings"
+	"time"
+)
+
+const (
+	// PairingTypeA is a symmetric pairing on a supersingular curve, fast but with large elements
+	PairingTypeA = "a"
+	// PairingTypeD is an asymmetric pairing on an MNT curve of embedding degree 6, with small elements
+	PairingTypeD = "d"
+	// PairingTypeF is an asymmetric pairing on a Barreto-Naehrig curve of embedding degree 12, with the smallest elements
+	PairingTypeF = "f"
+	// PairingTypeBLS12381 is the asymmetric BLS12-381 pairing of the pure-Go backend, it does not need cgo
+	PairingTypeBLS12381 = group.TypeBLS12381
+)
+
+// maxDiscriminantTries bounds the search for a discriminant that yields a Type D curve of the requested size
+const maxDiscriminantTries = 100000
+
+// typeDSearchTimeout bounds the time the search for a Type D curve may take, it runs while a key is being created
+const typeDSearchTimeout = 30 * time.Second
+
+// generateTypeD generates the parameters of a Type D pairing for one discriminant
+var generateTypeD = group.GenerateD
 
 // ToSecurityMeasures returns the base field size and subgroup order based on the security level
 func ToSecurityMeasures(level string) (uint32, uint32) {
@@ -16,3 +43,98 @@ func ToSecurityMeasures(level string) (uint32, uint32) {
 		return 160, 512 // Default to Balanced level of security and performance with 160-bit base field and 512-bit subgroup order
 	}
 }
+
+// ToTypeDMeasures returns the group order size, the base field size and the cap on the curve order for a Type D pairing.
+// The embedding degree is 6, so the base field only needs a sixth of the size a Type A pairing needs for its extension field.
+func ToTypeDMeasures(level string) (uint32, uint32, uint32) {
+	switch strings.ToLower(level) {
+	case "low":
+		return 160, 171, 500
+	case "high":
+		return 256, 256, 768
+	default:
+		return 224, 224, 672
+	}
+}
+
+// ToTypeFMeasures returns the size of the group order and base field of a Type F pairing.
+// The embedding degree is 12, so 256 bits already match the finite field security of a 3072-bit field.
+func ToTypeFMeasures(level string) uint32 {
+	switch strings.ToLower(level) {
+	case "low":
+		return 160
+	case "high":
+		return 384
+	default:
+		return 256
+	}
+}
+
+// ValidPairingType reports whether the pairing type is one the KMS can generate
+func ValidPairingType(pairingType string) bool {
+	switch strings.ToLower(pairingType) {
+	case PairingTypeA, PairingTypeD, PairingTypeF, PairingTypeBLS12381:
+		return true
+	default:
+		return false
+	}
+}
+
+// GeneratePairingParams generates pairing parameters of the given type, sized for the security level.
+// BLS12-381 has a fixed curve, the security level does not apply to it.
+func GeneratePairingParams(pairingType, level string) (string, error) {
+	switch strings.ToLower(pairingType) {
+	case PairingTypeA:
+		baseFieldSize, subgroupOrder := ToSecurityMeasures(level)
+		return group.GenerateA(baseFieldSize, subgroupOrder)
+	case PairingTypeD:
+		ctx, cancel := context.WithTimeout(context.Background(), typeDSearchTimeout)
+		defer cancel()
+		rbits, qbits, bitlimit := ToTypeDMeasures(level)
+		return generateD(ctx, rbits, qbits, bitlimit)
+	case PairingTypeF:
+		return group.GenerateF(ToTypeFMeasures(level))
+	case PairingTypeBLS12381:
+		return group.BLS12381Params(), nil
+	default:
+		return "", fmt.Errorf("unknown pairing type %q", pairingType)
+	}
+}
+
+// generateD searches discriminants for an MNT curve with the requested sizes. Curves only exist for some discriminants,
+// so the search starts at one known to yield a curve of the smallest size and moves on until one fits. The search gives
+// up after maxDiscriminantTries discriminants or when the context is done, whichever comes first.
+func generateD(ctx context.Context, rbits, qbits, bitlimit uint32) (string, error) {
+	d := uint32(9563)
+	for tries := 0; tries < maxDiscriminantTries; d++ {
+		if !validDiscriminant(d) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("no Type D curve with a %d-bit group order found after %d discriminants: %w", rbits, tries, err)
+		}
+		tries++
+
+		params, err := generateTypeD(d, rbits, qbits, bitlimit)
+		if err == nil {
+			return params, nil
+		}
+		if !errors.Is(err, group.ErrNoSuitableCurve) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no Type D curve with a %d-bit group order found", rbits)
+}
+
+// validDiscriminant reports whether d can be used by the CM method: d = 0 or 3 mod 4 and no odd prime square divides d
+func validDiscriminant(d uint32) bool {
+	if d%4 != 0 && d%4 != 3 {
+		return false
+	}
+	for p := uint32(3); p*p <= d; p += 2 {
+		if d%(p*p) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package keymanager
+
+import (
+	"context"
+	"errors"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/group"
+	"testing"
+	"time"
+)
+
+func TestValidDiscriminant(t *testing.T) {
+	tests := []struct {
+		d    uint32
+		want bool
+	}{
+		{d: 3, want: true},
+		{d: 4, want: true},
+		{d: 5, want: false},
+		{d: 9563, want: true},
+		{d: 9564, want: true},
+		{d: 9565, want: false},
+		// 36 = 0 mod 4 but divisible by 3^2
+		{d: 36, want: false},
+		// 99 = 3 mod 4 but divisible by 3^2
+		{d: 99, want: false},
+	}
+
+	for _, test := range tests {
+		if got := validDiscriminant(test.d); got != test.want {
+			t.Errorf("validDiscriminant(%d) = %v, want %v", test.d, got, test.want)
+		}
+	}
+}
+
+// stubTypeD replaces the Type D generator for the duration of a test
+func stubTypeD(t *testing.T, generate func(d, rbits, qbits, bitlimit uint32) (string, error)) {
+	t.Helper()
+	original := generateTypeD
+	generateTypeD = generate
+	t.Cleanup(func() { generateTypeD = original })
+}
+
+// generateLowD searches a Type D curve of the low security level
+func generateLowD(ctx context.Context) (string, error) {
+	rbits, qbits, bitlimit := ToTypeDMeasures("low")
+	return generateD(ctx, rbits, qbits, bitlimit)
+}
+
+func TestGenerateDFindsCurve(t *testing.T) {
+	var tried []uint32
+	stubTypeD(t, func(d, rbits, qbits, bitlimit uint32) (string, error) {
+		tried = append(tried, d)
+		if len(tried) < 3 {
+			return "", group.ErrNoSuitableCurve
+		}
+		return "type d", nil
+	})
+
+	params, err := generateLowD(context.Background())
+	if err != nil {
+		t.Fatalf("generateD: %v", err)
+	}
+	if params != "type d" {
+		t.Errorf("params = %q, want %q", params, "type d")
+	}
+	for _, d := range tried {
+		if !validDiscriminant(d) {
+			t.Errorf("tried invalid discriminant %d", d)
+		}
+	}
+}
+
+func TestGenerateDStopsAtTheTryLimit(t *testing.T) {
+	calls := 0
+	stubTypeD(t, func(d, rbits, qbits, bitlimit uint32) (string, error) {
+		calls++
+		return "", group.ErrNoSuitableCurve
+	})
+
+	if _, err := generateLowD(context.Background()); err == nil {
+		t.Fatal("generateD found a curve where there is none")
+	}
+	if calls != maxDiscriminantTries {
+		t.Errorf("tried %d discriminants, want %d", calls, maxDiscriminantTries)
+	}
+}
+
+func TestGenerateDStopsAtTheDeadline(t *testing.T) {
+	stubTypeD(t, func(d, rbits, qbits, bitlimit uint32) (string, error) {
+		time.Sleep(time.Millisecond)
+		return "", group.ErrNoSuitableCurve
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	_, err := generateLowD(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("search took %s after a 20ms deadline", elapsed)
+	}
+}
+
+func TestGenerateDStopsAtOtherErrors(t *testing.T) {
+	failure := errors.New("backend failure")
+	stubTypeD(t, func(d, rbits, qbits, bitlimit uint32) (string, error) {
+		return "", failure
+	})
+
+	if _, err := generateLowD(context.Background()); !errors.Is(err, failure) {
+		t.Fatalf("err = %v, want %v", err, failure)
+	}
+}
+
+// TestGenerateDTerminates runs the real search for the low security level, it needs the PBC backend of the cgo build
+func TestGenerateDTerminates(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), typeDSearchTimeout)
+	defer cancel()
+
+	params, err := generateLowD(ctx)
+	if errors.Is(err, group.ErrPBCUnavailable) {
+		t.Skip("PBC is not available without cgo")
+	}
+	if err != nil {
+		t.Fatalf("generateD: %v", err)
+	}
+	if _, err := group.NewPairing(params); err != nil {
+		t.Fatalf("generated parameters do not make a pairing: %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/pbkdf2"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// formatVersion is the layout of the keystore file
+	formatVersion = 1
+	// kdfPBKDF2 derives the keystore key from an operator passphrase
+	kdfPBKDF2 = "pbkdf2-sha256"
+	// kdfNone uses the given key as is, e.g. a master key reconstructed from unseal shares
+	kdfNone = "none"
+	// iterations of PBKDF2 for new keystores, loading uses whatever the file says
+	iterations = 600000
+	saltSize   = 16
+	keySize    = 32
+)
+
+var (
+	// ErrNotFound is returned by Load when no keystore has been saved yet
+	ErrNotFound = errors.New("keystore does not exist")
+	// ErrWrongPassphrase is returned when the keystore cannot be opened with the passphrase or master key
+	ErrWrongPassphrase = errors.New("keystore passphrase is wrong or the keystore is corrupted")
+)
+
+// sealedFile is the keystore on disk. Everything but the header is encrypted with AES-256-GCM under a key
+// derived from the operator passphrase or under a master key, the header is authenticated as additional data.
+type sealedFile struct {
+	Format     int    `json:"format"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Keystore keeps a single blob encrypted at rest in a file
+type Keystore interface {
+	Load() ([]byte, error)
+	Save(data []byte) error
+	Rekey(key []byte) error
+}
+
+type keystore struct {
+	mutex      sync.Mutex
+	path       string
+	kdf        string
+	passphrase []byte
+
+	// The derived key is cached after the first load or save, deriving it is deliberately slow
+	salt       []byte
+	iterations int
+	key        []byte
+}
+
+// NewKeystore creates a keystore in the given file, sealed under the given passphrase
+func NewKeystore(path, passphrase string) (Keystore, error) {
+	if path == "" {
+		return nil, errors.New("keystore path is empty")
+	}
+	if passphrase == "" {
+		return nil, errors.New("keystore passphrase is empty")
+	}
+	return &keystore{path: path, kdf: kdfPBKDF2, passphrase: []byte(passphrase)}, nil
+}
+
+// NewKeystoreWithKey creates a keystore in the given file, sealed directly under a 32-byte master key
+func NewKeystoreWithKey(path string, key []byte) (Keystore, error) {
+	if path == "" {
+		return nil, errors.New("keystore path is empty")
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("keystore key must be %d bytes", keySize)
+	}
+	return &keystore{path: path, kdf: kdfNone, key: append([]byte(nil), key...)}, nil
+}
+
+// Exists reports whether a keystore has been saved at the given path
+func Exists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Load reads and decrypts the keystore, ErrNotFound means nothing has been saved yet
+func (k *keystore) Load() ([]byte, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	raw, err := os.ReadFile(k.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sealed sealedFile
+	if err := json.Unmarshal(raw, &sealed); err != nil {
+		return nil, fmt.Errorf("decoding keystore: %w", err)
+	}
+	if sealed.Format != formatVersion || sealed.KDF != k.kdf {
+		return nil, fmt.Errorf("unsupported keystore format %d with kdf %q", sealed.Format, sealed.KDF)
+	}
+
+	key := k.key
+	if k.kdf == kdfPBKDF2 {
+		if sealed.Iterations < 1 || len(sealed.Salt) == 0 {
+			return nil, errors.New("keystore has no key derivation parameters")
+		}
+		key = pbkdf2.Key(k.passphrase, sealed.Salt, sealed.Iterations, keySize, sha256.New)
+	}
+
+	data, err := open(key, sealed)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	k.salt, k.iterations, k.key = sealed.Salt, sealed.Iterations, key
+	return data, nil
+}
+
+// Save encrypts the data and replaces the keystore file atomically
+func (k *keystore) Save(data []byte) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.key == nil {
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		k.salt, k.iterations = salt, iterations
+		k.key = pbkdf2.Key(k.passphrase, salt, iterations, keySize, sha256.New)
+	}
+
+	return k.write(k.key, data)
+}
+
+// Rekey re-encrypts the keystore under a new master key, the old key no longer opens it afterwards.
+// Only keystores sealed under a master key can be rekeyed, a passphrase keystore keeps its passphrase.
+func (k *keystore) Rekey(key []byte) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if k.kdf != kdfNone {
+		return errors.New("only keystores sealed under a master key can be rekeyed")
+	}
+	if len(key) != keySize {
+		return fmt.Errorf("keystore key must be %d bytes", keySize)
+	}
+
+	raw, err := os.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+	var sealed sealedFile
+	if err := json.Unmarshal(raw, &sealed); err != nil {
+		return fmt.Errorf("decoding keystore: %w", err)
+	}
+	data, err := open(k.key, sealed)
+	if err != nil {
+		return ErrWrongPassphrase
+	}
+
+	if err := k.write(key, data); err != nil {
+		// The error may come after the new file was renamed into place, e.g. from syncing the directory.
+		// The keystore then keeps the new key, so later saves do not go back to the old one.
+		if raw, readErr := os.ReadFile(k.path); readErr == nil && json.Unmarshal(raw, &sealed) == nil {
+			if _, openErr := open(key, sealed); openErr == nil {
+				k.key = append([]byte(nil), key...)
+			}
+		}
+		return err
+	}
+	k.key = append([]byte(nil), key...)
+	return nil
+}
+
+// write encrypts the data under the key and replaces the keystore file
+func (k *keystore) write(key, data []byte) error {
+	sealed := sealedFile{
+		Format:     formatVersion,
+		KDF:        k.kdf,
+		Iterations: k.iterations,
+		Salt:       k.salt,
+	}
+	if err := seal(key, &sealed, data); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(sealed)
+	if err != nil {
+		return err
+	}
+
+	return WriteFile(k.path, raw)
+}
+
+// WriteFile replaces a file atomically and durably. The data is written and synced next to the file and renamed over it,
+// and the directory is synced after the rename, so a crash leaves either the old or the new file behind, never a
+// half-written one or a rename that is lost.
+func WriteFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir syncs a directory, which makes the renames in it durable
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// seal encrypts the data into the file with a fresh nonce
+func seal(key []byte, sealed *sealedFile, data []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sealed.Nonce = nonce
+	sealed.Ciphertext = aead.Seal(nil, nonce, data, header(*sealed))
+	return nil
+}
+
+// open decrypts the data of the file and checks its header
+func open(key []byte, sealed sealedFile) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+	return aead.Open(nil, sealed.Nonce, sealed.Ciphertext, header(sealed))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// header is the additional data binding the key derivation parameters to the ciphertext
+func header(sealed sealedFile) []byte {
+	return []byte(fmt.Sprintf("%d|%s|%d|%x", sealed.Format, sealed.KDF, sealed.Iterations, sealed.Salt))
+}
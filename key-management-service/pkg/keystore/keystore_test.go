@@ -0,0 +1,175 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"golang.org/x/crypto/pbkdf2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPBKDF2Vector pins the key derivation to the PBKDF2-HMAC-SHA256 test vectors of RFC 7914, keystores saved by earlier
+// releases must keep opening
+func TestPBKDF2Vector(t *testing.T) {
+	tests := []struct {
+		passphrase string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{passphrase: "passwd", salt: "salt", iterations: 1, want: "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"},
+		{passphrase: "Password", salt: "NaCl", iterations: 80000, want: "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56"},
+	}
+
+	for _, test := range tests {
+		key := pbkdf2.Key([]byte(test.passphrase), []byte(test.salt), test.iterations, keySize, sha256.New)
+		if got := hex.EncodeToString(key); got != test.want {
+			t.Errorf("pbkdf2(%q, %q, %d) = %s, want %s", test.passphrase, test.salt, test.iterations, got, test.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	data := []byte(`{"keys":["default"]}`)
+
+	store, err := NewKeystore(path, "correct horse")
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	if _, err := store.Load(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Load of a new keystore = %v, want %v", err, ErrNotFound)
+	}
+	if err := store.Save(data); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	reopened, err := NewKeystore(path, "correct horse")
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	loaded, err := reopened.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !bytes.Equal(loaded, data) {
+		t.Errorf("Load = %q, want %q", loaded, data)
+	}
+
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("keystore mode = %o, want 600", mode)
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+
+	store, err := NewKeystore(path, "correct horse")
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	if err := store.Save([]byte("secret")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	reopened, err := NewKeystore(path, "battery staple")
+	if err != nil {
+		t.Fatalf("NewKeystore: %v", err)
+	}
+	if _, err := reopened.Load(); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("Load with the wrong passphrase = %v, want %v", err, ErrWrongPassphrase)
+	}
+}
+
+func TestTamperedKeystore(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, keySize)
+
+	tests := []struct {
+		name   string
+		tamper func(sealed *sealedFile)
+	}{
+		{name: "ciphertext", tamper: func(sealed *sealedFile) { sealed.Ciphertext[0] ^= 1 }},
+		{name: "authentication tag", tamper: func(sealed *sealedFile) { sealed.Ciphertext[len(sealed.Ciphertext)-1] ^= 1 }},
+		{name: "nonce", tamper: func(sealed *sealedFile) { sealed.Nonce[0] ^= 1 }},
+		{name: "header", tamper: func(sealed *sealedFile) { sealed.Iterations++ }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keystore.json")
+			store, err := NewKeystoreWithKey(path, key)
+			if err != nil {
+				t.Fatalf("NewKeystoreWithKey: %v", err)
+			}
+			if err := store.Save([]byte("secret")); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile: %v", err)
+			}
+			var sealed sealedFile
+			if err := json.Unmarshal(raw, &sealed); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			test.tamper(&sealed)
+			raw, err = json.Marshal(sealed)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if err := os.WriteFile(path, raw, 0600); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+
+			reopened, err := NewKeystoreWithKey(path, key)
+			if err != nil {
+				t.Fatalf("NewKeystoreWithKey: %v", err)
+			}
+			if _, err := reopened.Load(); !errors.Is(err, ErrWrongPassphrase) {
+				t.Fatalf("Load of a tampered keystore = %v, want %v", err, ErrWrongPassphrase)
+			}
+		})
+	}
+}
+
+func TestRekey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	oldKey := bytes.Repeat([]byte{1}, keySize)
+	newKey := bytes.Repeat([]byte{2}, keySize)
+
+	store, err := NewKeystoreWithKey(path, oldKey)
+	if err != nil {
+		t.Fatalf("NewKeystoreWithKey: %v", err)
+	}
+	if err := store.Save([]byte("secret")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := store.Rekey(newKey); err != nil {
+		t.Fatalf("Rekey: %v", err)
+	}
+
+	withOldKey, _ := NewKeystoreWithKey(path, oldKey)
+	if _, err := withOldKey.Load(); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Load with the old key = %v, want %v", err, ErrWrongPassphrase)
+	}
+	withNewKey, _ := NewKeystoreWithKey(path, newKey)
+	data, err := withNewKey.Load()
+	if err != nil {
+		t.Fatalf("Load with the new key: %v", err)
+	}
+	if string(data) != "secret" {
+		t.Errorf("Load = %q, want %q", data, "secret")
+	}
+}
@@ -0,0 +1,59 @@
+package refresh
+
+import (
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"sync"
+	"time"
+)
+
+// Scheduler triggers a share refresh at a fixed interval so shares leaked over a long period stop being useful.
+// It is started and closed together with the HTTP server.
+type Scheduler struct {
+	interval time.Duration
+	refresh  func() error
+	logger   *logging.Logger
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewScheduler creates a scheduler that calls refresh every interval, an interval of zero disables it
+func NewScheduler(interval time.Duration, refresh func() error, logger *logging.Logger) *Scheduler {
+	return &Scheduler{
+		interval: interval,
+		refresh:  refresh,
+		logger:   logger,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start runs the refresh loop in the background
+func (s *Scheduler) Start() error {
+	if s.interval <= 0 {
+		s.logger.Info("scheduled share refresh is disabled")
+		return nil
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.refresh(); err != nil {
+					s.logger.Error("scheduled share refresh failed", "err", err)
+				}
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+
+	s.logger.Info("scheduled share refresh is started", "interval", s.interval)
+	return nil
+}
+
+// Close stops the refresh loop
+func (s *Scheduler) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
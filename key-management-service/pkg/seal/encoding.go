@@ -0,0 +1,77 @@
+package seal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	eError "github.com/mdshahjahanmiah/explore-go/error"
+)
+
+// InitRequest is the quorum the master key is split for, zero values select the configured defaults
+type InitRequest struct {
+	Threshold   int `json:"threshold"`
+	TotalShares int `json:"total_shares"`
+}
+
+// UnsealRequest carries the unseal share of one operator
+type UnsealRequest struct {
+	Share string `json:"share"`
+}
+
+// SealRequest carries a quorum of the current unseal shares
+type SealRequest struct {
+	UnsealShares []string `json:"unseal_shares"`
+}
+
+// RekeyRequest carries a quorum of the current unseal shares and the new quorum, zero values keep the current one
+type RekeyRequest struct {
+	UnsealShares []string `json:"unseal_shares"`
+	Threshold    int      `json:"threshold"`
+	TotalShares  int      `json:"total_shares"`
+}
+
+func decodeInitRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var initRequest InitRequest
+	// The body is optional, the configured quorum is used without one
+	if request.ContentLength != 0 {
+		if err := json.NewDecoder(request.Body).Decode(&initRequest); err != nil {
+			return nil, eError.NewServiceError(err, "decode init request", "payload", http.StatusBadRequest)
+		}
+	}
+	return initRequest, nil
+}
+
+func decodeUnsealRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var unsealRequest UnsealRequest
+	if err := json.NewDecoder(request.Body).Decode(&unsealRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode unseal request", "payload", http.StatusBadRequest)
+	}
+	if unsealRequest.Share == "" {
+		return nil, eError.NewServiceError(errors.New("share is empty"), "validation_error", "share", http.StatusBadRequest)
+	}
+	return unsealRequest, nil
+}
+
+func decodeSealRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var sealRequest SealRequest
+	if err := json.NewDecoder(request.Body).Decode(&sealRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode seal request", "payload", http.StatusBadRequest)
+	}
+	if len(sealRequest.UnsealShares) == 0 {
+		return nil, eError.NewServiceError(errors.New("unseal shares are empty"), "validation_error", "unseal_shares", http.StatusBadRequest)
+	}
+	return sealRequest, nil
+}
+
+func decodeRekeyRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var rekeyRequest RekeyRequest
+	if err := json.NewDecoder(request.Body).Decode(&rekeyRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode rekey request", "payload", http.StatusBadRequest)
+	}
+	if len(rekeyRequest.UnsealShares) == 0 {
+		return nil, eError.NewServiceError(errors.New("unseal shares are empty"), "validation_error", "unseal_shares", http.StatusBadRequest)
+	}
+	return rekeyRequest, nil
+}
@@ -0,0 +1,90 @@
+package seal
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/endpoint"
+	eError "github.com/mdshahjahanmiah/explore-go/error"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/keymanager"
+	"net/http"
+)
+
+// SharesResponse hands out unseal shares, one per operator. They are not stored anywhere and cannot be requested again.
+type SharesResponse struct {
+	UnsealShares []string `json:"unseal_shares"`
+	Threshold    int      `json:"threshold"`
+	TotalShares  int      `json:"total_shares"`
+}
+
+func getStatusEndpoint(service Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return service.Status(), nil
+	}
+}
+
+func getInitEndpoint(service Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		initRequest := request.(InitRequest)
+		shares, err := service.Init(initRequest.Threshold, initRequest.TotalShares)
+		if err != nil {
+			return nil, toServiceError(err)
+		}
+		status := service.Status()
+		return SharesResponse{
+			UnsealShares: shares,
+			Threshold:    status.Threshold,
+			TotalShares:  status.TotalShares,
+		}, nil
+	}
+}
+
+func getUnsealEndpoint(service Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		status, err := service.Unseal(request.(UnsealRequest).Share)
+		if err != nil {
+			return nil, toServiceError(err)
+		}
+		return status, nil
+	}
+}
+
+func getSealEndpoint(service Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		if err := service.Seal(request.(SealRequest).UnsealShares); err != nil {
+			return nil, toServiceError(err)
+		}
+		return service.Status(), nil
+	}
+}
+
+func getRekeyEndpoint(service Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		rekeyRequest := request.(RekeyRequest)
+		shares, err := service.Rekey(rekeyRequest.UnsealShares, rekeyRequest.Threshold, rekeyRequest.TotalShares)
+		if err != nil {
+			return nil, toServiceError(err)
+		}
+		status := service.Status()
+		return SharesResponse{
+			UnsealShares: shares,
+			Threshold:    status.Threshold,
+			TotalShares:  status.TotalShares,
+		}, nil
+	}
+}
+
+// toServiceError maps seal errors to their HTTP status, a sealed KMS is unavailable like any sealed key route
+func toServiceError(err error) error {
+	switch {
+	case errors.Is(err, keymanager.ErrSealed):
+		return eError.NewServiceError(err, "sealed", "NONE", http.StatusServiceUnavailable)
+	case errors.Is(err, ErrNotInitialized), errors.Is(err, ErrAlreadyInitialized):
+		return eError.NewServiceError(err, "wrong_state", "NONE", http.StatusConflict)
+	case errors.Is(err, ErrInvalidQuorum):
+		return eError.NewServiceError(err, "validation_error", "threshold", http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidShare), errors.Is(err, ErrWrongShares):
+		return eError.NewServiceError(err, "validation_error", "share", http.StatusBadRequest)
+	default:
+		return eError.NewServiceError(err, "Internal_Error", "NONE", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,70 @@
+package seal
+
+import "github.com/mdshahjahanmiah/key-management-service/pkg/keymanager"
+
+// The sealer is the keyring the endpoints see, every call goes to the unsealed keyring or fails with keymanager.ErrSealed
+
+func (s *sealer) Create(spec keymanager.KeySpec) (keymanager.KeyDescription, error) {
+	keyring, err := s.unsealed()
+	if err != nil {
+		return keymanager.KeyDescription{}, err
+	}
+	return keyring.Create(spec)
+}
+
+func (s *sealer) List(tenant string) ([]keymanager.KeyDescription, error) {
+	keyring, err := s.unsealed()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.List(tenant)
+}
+
+func (s *sealer) Describe(keyID string) (keymanager.KeyDescription, error) {
+	keyring, err := s.unsealed()
+	if err != nil {
+		return keymanager.KeyDescription{}, err
+	}
+	return keyring.Describe(keyID)
+}
+
+func (s *sealer) Disable(keyID string) (keymanager.KeyDescription, error) {
+	keyring, err := s.unsealed()
+	if err != nil {
+		return keymanager.KeyDescription{}, err
+	}
+	return keyring.Disable(keyID)
+}
+
+func (s *sealer) Delete(keyID string) error {
+	keyring, err := s.unsealed()
+	if err != nil {
+		return err
+	}
+	return keyring.Delete(keyID)
+}
+
+func (s *sealer) Get(keyID string) (keymanager.KeyManagementService, error) {
+	keyring, err := s.unsealed()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Get(keyID)
+}
+
+// Default is only used by the DKG coordinator, which sealed startup does not support, so it is nil while sealed
+func (s *sealer) Default() keymanager.KeyManagementService {
+	keyring, err := s.unsealed()
+	if err != nil {
+		return nil
+	}
+	return keyring.Default()
+}
+
+func (s *sealer) RefreshShares() error {
+	keyring, err := s.unsealed()
+	if err != nil {
+		return err
+	}
+	return keyring.RefreshShares()
+}
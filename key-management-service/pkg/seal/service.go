@@ -0,0 +1,474 @@
+package seal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/keymanager"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/keystore"
+	"os"
+	"sync"
+)
+
+var (
+	// ErrNotInitialized is returned when the KMS has to be initialized before it can be unsealed
+	ErrNotInitialized = errors.New("kms is not initialized")
+	// ErrAlreadyInitialized is returned when an initialized KMS is initialized again
+	ErrAlreadyInitialized = errors.New("kms is already initialized")
+	// ErrInvalidQuorum is returned for a threshold or number of unseal shares that cannot be used
+	ErrInvalidQuorum = errors.New("invalid unseal quorum")
+	// ErrInvalidShare is returned for an unseal share that cannot be decoded
+	ErrInvalidShare = errors.New("invalid unseal share")
+	// ErrWrongShares is returned when a quorum of unseal shares does not reconstruct the master key
+	ErrWrongShares = errors.New("unseal shares do not open the keystore")
+)
+
+// Status is what the operators see of the seal, it never contains key material
+type Status struct {
+	Initialized bool `json:"initialized"`
+	Sealed      bool `json:"sealed"`
+	Threshold   int  `json:"threshold"`
+	TotalShares int  `json:"total_shares"`
+	Progress    int  `json:"progress"`
+	// RekeyInterrupted is set when the KMS stopped during a rekey, either the old or the new unseal shares open it
+	RekeyInterrupted bool `json:"rekey_interrupted,omitempty"`
+}
+
+// quorum is kept in plain text next to the keystore, so the progress can be reported while sealed
+type quorum struct {
+	Threshold   int `json:"threshold"`
+	TotalShares int `json:"total_shares"`
+	// KeyCheck identifies the master key of a staged rekey, so an interrupted rekey can tell whether it reached the keystore
+	KeyCheck []byte `json:"key_check,omitempty"`
+}
+
+// Service seals the keyring. The keystore is encrypted under a random master key that only exists in memory while
+// the KMS is unsealed; at rest it is split into unseal shares held by the operators. While sealed every keyring
+// call fails with keymanager.ErrSealed.
+type Service interface {
+	keymanager.Keyring
+	Status() Status
+	Init(threshold, totalShares int) ([]string, error)
+	Unseal(share string) (Status, error)
+	Seal(shares []string) error
+	Rekey(shares []string, threshold, totalShares int) ([]string, error)
+}
+
+type sealer struct {
+	mutex       sync.RWMutex
+	config      config.Config
+	logger      *logging.Logger
+	initialized bool
+	quorum      quorum
+	staged      *quorum
+	pending     map[int]unsealShare
+	masterKey   []byte
+	store       keystore.Keystore
+	keyring     keymanager.Keyring
+}
+
+// NewService starts sealed. The KMS counts as initialized when the keystore and its quorum file exist,
+// otherwise operators have to initialize it first.
+func NewService(config config.Config, logger *logging.Logger) (Service, error) {
+	if config.KeystoreConfig.Path == "" {
+		return nil, errors.New("sealed startup needs a keystore path")
+	}
+	if config.IsDistributedKeygen() {
+		return nil, errors.New("sealed startup is not supported with distributed key generation")
+	}
+
+	s := &sealer{
+		config:  config,
+		logger:  logger,
+		pending: make(map[int]unsealShare),
+	}
+
+	storeExists, err := keystore.Exists(config.KeystoreConfig.Path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(quorumPath(config.KeystoreConfig.Path))
+	switch {
+	case errors.Is(err, os.ErrNotExist) && !storeExists:
+		logger.Info("kms is not initialized, waiting for operators to initialize it")
+		return s, nil
+	case errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("keystore %s has no unseal quorum, it was not initialized for sealed startup", config.KeystoreConfig.Path)
+	case err != nil:
+		return nil, err
+	case !storeExists:
+		return nil, fmt.Errorf("unseal quorum exists but keystore %s is missing", config.KeystoreConfig.Path)
+	}
+
+	if s.quorum, err = decodeQuorum(raw); err != nil {
+		return nil, err
+	}
+	s.initialized = true
+
+	// A staged quorum is left behind by a rekey that stopped before it replaced the quorum file
+	raw, err = os.ReadFile(stagedQuorumPath(config.KeystoreConfig.Path))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		staged, err := decodeQuorum(raw)
+		if err != nil {
+			return nil, fmt.Errorf("staged unseal quorum: %w", err)
+		}
+		s.staged = &staged
+		logger.Warn("rekey was interrupted, the old or the new unseal shares open the kms", "threshold", staged.Threshold, "total_shares", staged.TotalShares)
+	}
+
+	logger.Info("kms is sealed, waiting for unseal shares", "threshold", s.quorum.Threshold, "total_shares", s.quorum.TotalShares)
+	return s, nil
+}
+
+// Status reports whether the KMS is sealed and how many unseal shares have been posted so far
+func (s *sealer) Status() Status {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.status()
+}
+
+// Init generates the master key and the default key, seals the keystore under the master key and returns the
+// unseal shares. They are only ever returned here, the KMS keeps nothing but the master key while unsealed.
+// A zero threshold or number of shares selects the configured default.
+func (s *sealer) Init(threshold, totalShares int) ([]string, error) {
+	if threshold == 0 {
+		threshold = s.config.SealConfig.Threshold
+	}
+	if totalShares == 0 {
+		totalShares = s.config.SealConfig.TotalShares
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.initialized {
+		return nil, ErrAlreadyInitialized
+	}
+
+	masterKey := make([]byte, masterKeySize)
+	if _, err := rand.Read(masterKey); err != nil {
+		return nil, err
+	}
+	shares, err := splitKey(masterKey, threshold, totalShares)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := keystore.NewKeystoreWithKey(s.config.KeystoreConfig.Path, masterKey)
+	if err != nil {
+		return nil, err
+	}
+	q := quorum{Threshold: threshold, TotalShares: totalShares}
+	if err := writeQuorum(quorumPath(s.config.KeystoreConfig.Path), q); err != nil {
+		return nil, err
+	}
+	// A new keystore makes the keyring generate the default key and save it
+	keyring, err := keymanager.NewKeyring(s.config, store, s.logger)
+	if err != nil {
+		os.Remove(quorumPath(s.config.KeystoreConfig.Path))
+		return nil, err
+	}
+
+	s.initialized, s.quorum = true, q
+	s.masterKey, s.store, s.keyring = masterKey, store, keyring
+
+	s.logger.Info("kms initialized and unsealed", "threshold", threshold, "total_shares", totalShares)
+	return encodeShares(shares), nil
+}
+
+// Unseal adds an operator's share. Once the quorum is reached the master key is reconstructed and the keyring is
+// loaded from the keystore. Shares that do not reconstruct the master key are all discarded and have to be posted again.
+// After an interrupted rekey the shares of either quorum open the keystore, and unsealing completes or drops the rekey.
+func (s *sealer) Unseal(encoded string) (Status, error) {
+	share, err := decodeShare(encoded)
+	if err != nil {
+		return Status{}, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.initialized {
+		return Status{}, ErrNotInitialized
+	}
+	if s.keyring != nil {
+		return s.status(), nil
+	}
+	// Both quorums of an interrupted rekey are tried, the lower threshold as soon as it is reached
+	threshold, ceiling, totalShares := s.quorum.Threshold, s.quorum.Threshold, s.quorum.TotalShares
+	if s.staged != nil {
+		threshold, ceiling, totalShares = min(threshold, s.staged.Threshold), max(ceiling, s.staged.Threshold), max(totalShares, s.staged.TotalShares)
+	}
+	if share.index > totalShares {
+		return Status{}, fmt.Errorf("%w: index %d out of %d shares", ErrInvalidShare, share.index, totalShares)
+	}
+
+	s.pending[share.index] = share
+	if len(s.pending) < threshold {
+		s.logger.Info("unseal share accepted", "progress", len(s.pending), "threshold", threshold)
+		return s.status(), nil
+	}
+
+	shares := make([]unsealShare, 0, len(s.pending))
+	for _, pending := range s.pending {
+		shares = append(shares, pending)
+	}
+
+	masterKey, err := combineKey(shares)
+	var store keystore.Keystore
+	var keyring keymanager.Keyring
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrWrongShares, err)
+	} else {
+		store, keyring, err = s.open(masterKey)
+	}
+	if errors.Is(err, ErrWrongShares) && len(s.pending) < ceiling {
+		// The shares may belong to the quorum with the higher threshold
+		s.logger.Info("unseal share accepted", "progress", len(s.pending), "threshold", ceiling)
+		return s.status(), nil
+	}
+	s.pending = make(map[int]unsealShare)
+	if errors.Is(err, ErrWrongShares) {
+		s.logger.Warn("unseal failed, shares discarded", "err", err)
+		return s.status(), ErrWrongShares
+	}
+	if err != nil {
+		return s.status(), err
+	}
+
+	s.masterKey, s.store, s.keyring = masterKey, store, keyring
+	if s.staged != nil {
+		s.resolveRekey()
+	}
+
+	s.logger.Info("kms unsealed")
+	return s.status(), nil
+}
+
+// open loads the keyring from the keystore sealed under the master key, ErrWrongShares means the key does not open it
+func (s *sealer) open(masterKey []byte) (keystore.Keystore, keymanager.Keyring, error) {
+	// NewKeyring would start over with a new default key if the keystore disappeared after startup
+	if exists, err := keystore.Exists(s.config.KeystoreConfig.Path); err != nil || !exists {
+		return nil, nil, fmt.Errorf("keystore %s is missing", s.config.KeystoreConfig.Path)
+	}
+	store, err := keystore.NewKeystoreWithKey(s.config.KeystoreConfig.Path, masterKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyring, err := keymanager.NewKeyring(s.config, store, s.logger)
+	if errors.Is(err, keystore.ErrWrongPassphrase) {
+		return nil, nil, fmt.Errorf("%w: %v", ErrWrongShares, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, keyring, nil
+}
+
+// resolveRekey finishes the rekey interrupted before the last start. If the keystore is sealed under the master key
+// of the staged quorum, the rekey reached the keystore and the staged quorum replaces the current one, otherwise the
+// rekey never happened and the staged quorum is dropped. Failing here leaves the staged quorum for the next unseal.
+func (s *sealer) resolveRekey() {
+	path := s.config.KeystoreConfig.Path
+	if subtle.ConstantTimeCompare(keyCheck(s.masterKey), s.staged.KeyCheck) == 1 {
+		q := quorum{Threshold: s.staged.Threshold, TotalShares: s.staged.TotalShares}
+		if err := writeQuorum(quorumPath(path), q); err != nil {
+			s.logger.Error("failed to complete interrupted rekey", "err", err)
+			return
+		}
+		s.quorum = q
+		s.logger.Info("interrupted rekey completed", "threshold", q.Threshold, "total_shares", q.TotalShares)
+	} else {
+		s.logger.Info("interrupted rekey dropped, the keystore was never rekeyed")
+	}
+
+	if err := os.Remove(stagedQuorumPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Error("failed to remove staged unseal quorum", "err", err)
+		return
+	}
+	s.staged = nil
+}
+
+// Seal drops the keyring and the master key from memory, the KMS has to be unsealed again to serve keys.
+// Like rekeying it needs a quorum of the current unseal shares, so nobody can take the KMS offline on their own.
+// A sealed KMS stays as it is, including the unseal shares posted so far.
+func (s *sealer) Seal(encoded []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.initialized {
+		return ErrNotInitialized
+	}
+	if s.keyring == nil {
+		return keymanager.ErrSealed
+	}
+	if err := s.checkQuorum(encoded); err != nil {
+		return err
+	}
+	clear(s.masterKey)
+	s.masterKey, s.store, s.keyring = nil, nil, nil
+	s.pending = make(map[int]unsealShare)
+
+	s.logger.Info("kms sealed")
+	return nil
+}
+
+// Rekey replaces the master key and its unseal shares, optionally with a new quorum. It needs a quorum of the current
+// shares, so a single operator cannot take over the seal, and the old shares no longer open the keystore afterwards.
+//
+// The new quorum is staged next to the keystore first, then the keystore is re-encrypted, then the staged quorum
+// replaces the current one. Each step replaces a file atomically, so a crash in between leaves the staged quorum
+// behind and the next unseal completes or drops the rekey, whichever matches the keystore, see resolveRekey.
+func (s *sealer) Rekey(encoded []string, threshold, totalShares int) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.keyring == nil {
+		return nil, keymanager.ErrSealed
+	}
+	if err := s.checkQuorum(encoded); err != nil {
+		return nil, err
+	}
+	if threshold == 0 {
+		threshold = s.quorum.Threshold
+	}
+	if totalShares == 0 {
+		totalShares = s.quorum.TotalShares
+	}
+
+	masterKey := make([]byte, masterKeySize)
+	if _, err := rand.Read(masterKey); err != nil {
+		return nil, err
+	}
+	newShares, err := splitKey(masterKey, threshold, totalShares)
+	if err != nil {
+		return nil, err
+	}
+
+	path := s.config.KeystoreConfig.Path
+	staged := quorum{Threshold: threshold, TotalShares: totalShares, KeyCheck: keyCheck(masterKey)}
+	if err := writeQuorum(stagedQuorumPath(path), staged); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Rekey(masterKey); err != nil {
+		// The keystore is replaced atomically, but the error may come after the rename, e.g. from syncing the directory
+		if probe, probeErr := keystore.NewKeystoreWithKey(path, masterKey); probeErr != nil || !opens(probe) {
+			if removeErr := os.Remove(stagedQuorumPath(path)); removeErr != nil {
+				s.logger.Error("failed to remove staged unseal quorum", "err", removeErr)
+			}
+			return nil, err
+		}
+		s.logger.Warn("keystore rekeyed despite an error", "err", err)
+	}
+
+	// From here on only the new shares open the keystore, so they are returned even if the quorum cannot be replaced
+	clear(s.masterKey)
+	s.masterKey, s.staged = masterKey, &staged
+	s.resolveRekey()
+
+	s.logger.Info("kms rekeyed", "threshold", threshold, "total_shares", totalShares)
+	return encodeShares(newShares), nil
+}
+
+// checkQuorum checks the encoded shares are a quorum of the current unseal shares, they have to reconstruct the master key
+func (s *sealer) checkQuorum(encoded []string) error {
+	shares := make([]unsealShare, len(encoded))
+	for i, share := range encoded {
+		decoded, err := decodeShare(share)
+		if err != nil {
+			return err
+		}
+		shares[i] = decoded
+	}
+	if len(shares) < s.quorum.Threshold {
+		return fmt.Errorf("%w: %d unseal shares needed, got %d", ErrInvalidShare, s.quorum.Threshold, len(shares))
+	}
+
+	currentKey, err := combineKey(shares)
+	if err != nil || subtle.ConstantTimeCompare(currentKey, s.masterKey) != 1 {
+		return ErrWrongShares
+	}
+	return nil
+}
+
+// opens reports whether the keystore can be opened
+func opens(store keystore.Keystore) bool {
+	_, err := store.Load()
+	return err == nil
+}
+
+func (s *sealer) status() Status {
+	return Status{
+		Initialized: s.initialized,
+		Sealed:      s.keyring == nil,
+		Threshold:   s.quorum.Threshold,
+		TotalShares: s.quorum.TotalShares,
+		Progress:    len(s.pending),
+
+		RekeyInterrupted: s.staged != nil,
+	}
+}
+
+// unsealed returns the keyring, or keymanager.ErrSealed while the KMS is sealed
+func (s *sealer) unsealed() (keymanager.Keyring, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.keyring == nil {
+		return nil, keymanager.ErrSealed
+	}
+	return s.keyring, nil
+}
+
+// quorumPath is the file next to the keystore holding its unseal quorum
+func quorumPath(keystorePath string) string {
+	return keystorePath + ".seal"
+}
+
+// stagedQuorumPath holds the quorum of a rekey until it replaces the current quorum
+func stagedQuorumPath(keystorePath string) string {
+	return keystorePath + ".seal.next"
+}
+
+// writeQuorum replaces a quorum file atomically and durably, like the keystore itself
+func writeQuorum(path string, q quorum) error {
+	raw, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	return keystore.WriteFile(path, raw)
+}
+
+func decodeQuorum(raw []byte) (quorum, error) {
+	var q quorum
+	if err := json.Unmarshal(raw, &q); err != nil {
+		return quorum{}, fmt.Errorf("decoding unseal quorum: %w", err)
+	}
+	if q.Threshold < 1 || q.TotalShares < q.Threshold || q.TotalShares > maxShares {
+		return quorum{}, fmt.Errorf("%w: %d of %d", ErrInvalidQuorum, q.Threshold, q.TotalShares)
+	}
+	return q, nil
+}
+
+// keyCheck identifies a master key without revealing it
+func keyCheck(masterKey []byte) []byte {
+	check := sha256.Sum256(append([]byte("kms-seal-key-check:"), masterKey...))
+	return check[:]
+}
+
+func encodeShares(shares []unsealShare) []string {
+	encoded := make([]string, len(shares))
+	for i, share := range shares {
+		encoded[i] = share.encode()
+	}
+	return encoded
+}
@@ -0,0 +1,212 @@
+package seal
+
+import (
+	"crypto/rand"
+	"errors"
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/config"
+	"github.com/mdshahjahanmiah/key-management-service/pkg/keymanager"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestConfig is a sealed KMS with a 2 of 3 unseal quorum and a keystore in a temporary directory
+func newTestConfig(t *testing.T) (config.Config, *logging.Logger) {
+	t.Helper()
+
+	logger, err := logging.NewLogger(logging.LoggerConfig{CommandHandler: "text", LogLevel: "error"})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	return config.Config{
+		KeyID:           "default",
+		KeyTenant:       "test",
+		SecurityLevel:   "medium",
+		PairingType:     keymanager.PairingTypeBLS12381,
+		KeygenMode:      config.KeygenModeDealer,
+		ThresholdConfig: config.ThresholdConfig{Enabled: true, Threshold: 2, TotalShares: 3},
+		KeystoreConfig:  config.KeystoreConfig{Path: filepath.Join(t.TempDir(), "keystore.json")},
+		SealConfig:      config.SealConfig{Enabled: true, Threshold: 2, TotalShares: 3},
+	}, logger
+}
+
+// restart starts a new sealed service on the keystore of the configuration, as after a restart of the KMS
+func restart(t *testing.T, conf config.Config, logger *logging.Logger) Service {
+	t.Helper()
+	service, err := NewService(conf, logger)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return service
+}
+
+// unseal posts the shares one by one and returns the status after the last one
+func unseal(t *testing.T, service Service, shares []string) (Status, error) {
+	t.Helper()
+	var status Status
+	for _, share := range shares {
+		var err error
+		if status, err = service.Unseal(share); err != nil {
+			return status, err
+		}
+	}
+	return status, nil
+}
+
+func TestSealNeedsQuorum(t *testing.T) {
+	conf, logger := newTestConfig(t)
+	service := restart(t, conf, logger)
+	shares, err := service.Init(0, 0)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	otherKey := make([]byte, masterKeySize)
+	rand.Read(otherKey)
+	other, err := splitKey(otherKey, 2, 3)
+	if err != nil {
+		t.Fatalf("splitKey: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		shares []string
+		want   error
+	}{
+		{name: "no shares", want: ErrInvalidShare},
+		{name: "below the threshold", shares: shares[:1], want: ErrInvalidShare},
+		{name: "the same share twice", shares: []string{shares[0], shares[0]}, want: ErrWrongShares},
+		{name: "shares of another master key", shares: encodeShares(other[:2]), want: ErrWrongShares},
+		{name: "not a share", shares: []string{"share", "share"}, want: ErrInvalidShare},
+	}
+	for _, test := range tests {
+		if err := service.Seal(test.shares); !errors.Is(err, test.want) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, test.want)
+		}
+		if service.Status().Sealed {
+			t.Fatalf("%s: sealed the kms", test.name)
+		}
+	}
+
+	if err := service.Seal(shares[1:]); err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if !service.Status().Sealed {
+		t.Fatal("kms is not sealed")
+	}
+
+	// Sealing a sealed KMS keeps the unseal shares posted so far
+	if _, err := service.Unseal(shares[0]); err != nil {
+		t.Fatalf("Unseal: %v", err)
+	}
+	if err := service.Seal(shares); !errors.Is(err, keymanager.ErrSealed) {
+		t.Errorf("Seal while sealed: err = %v, want %v", err, keymanager.ErrSealed)
+	}
+	if progress := service.Status().Progress; progress != 1 {
+		t.Errorf("progress = %d after sealing a sealed kms, want 1", progress)
+	}
+}
+
+func TestRekey(t *testing.T) {
+	conf, logger := newTestConfig(t)
+	service := restart(t, conf, logger)
+	shares, err := service.Init(0, 0)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	if _, err := service.Rekey(shares[:1], 3, 4); !errors.Is(err, ErrInvalidShare) {
+		t.Errorf("rekey below the threshold: err = %v, want %v", err, ErrInvalidShare)
+	}
+	newShares, err := service.Rekey(shares[1:], 3, 4)
+	if err != nil {
+		t.Fatalf("Rekey: %v", err)
+	}
+	if status := service.Status(); len(newShares) != 4 || status.Threshold != 3 || status.TotalShares != 4 || status.RekeyInterrupted {
+		t.Errorf("after rekey: %d shares and status %+v", len(newShares), status)
+	}
+	if _, err := os.Stat(stagedQuorumPath(conf.KeystoreConfig.Path)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("staged quorum left behind: %v", err)
+	}
+	if err := service.Seal(shares); !errors.Is(err, ErrWrongShares) {
+		t.Errorf("seal with the old shares: err = %v, want %v", err, ErrWrongShares)
+	}
+
+	// After a restart the old shares no longer open the keystore and the new ones do
+	restarted := restart(t, conf, logger)
+	if _, err := unseal(t, restarted, shares); !errors.Is(err, ErrInvalidShare) && !errors.Is(err, ErrWrongShares) {
+		t.Errorf("unseal with the old shares: err = %v", err)
+	}
+	status, err := unseal(t, restarted, newShares[1:])
+	if err != nil || status.Sealed {
+		t.Errorf("unseal with the new shares: status %+v, err %v", status, err)
+	}
+}
+
+func TestInterruptedRekey(t *testing.T) {
+	tests := []struct {
+		name string
+		// reachedKeystore is whether the KMS stopped after the keystore was re-encrypted
+		reachedKeystore bool
+		threshold       int
+	}{
+		{name: "stopped before the keystore, lower threshold", threshold: 1},
+		{name: "stopped before the keystore, higher threshold", threshold: 3},
+		{name: "stopped after the keystore, lower threshold", reachedKeystore: true, threshold: 1},
+		{name: "stopped after the keystore, higher threshold", reachedKeystore: true, threshold: 3},
+	}
+
+	for _, test := range tests {
+		conf, logger := newTestConfig(t)
+		service := restart(t, conf, logger)
+		shares, err := service.Init(0, 0)
+		if err != nil {
+			t.Fatalf("Init: %v", err)
+		}
+
+		// The first steps of Rekey, up to where the KMS stops
+		s := service.(*sealer)
+		masterKey := make([]byte, masterKeySize)
+		rand.Read(masterKey)
+		newShares, err := splitKey(masterKey, test.threshold, 3)
+		if err != nil {
+			t.Fatalf("splitKey: %v", err)
+		}
+		staged := quorum{Threshold: test.threshold, TotalShares: 3, KeyCheck: keyCheck(masterKey)}
+		if err := writeQuorum(stagedQuorumPath(conf.KeystoreConfig.Path), staged); err != nil {
+			t.Fatalf("writeQuorum: %v", err)
+		}
+		if test.reachedKeystore {
+			if err := s.store.Rekey(masterKey); err != nil {
+				t.Fatalf("Rekey: %v", err)
+			}
+		}
+
+		restarted := restart(t, conf, logger)
+		if !restarted.Status().RekeyInterrupted {
+			t.Errorf("%s: interrupted rekey not reported", test.name)
+		}
+
+		valid, wantQuorum := shares, quorum{Threshold: 2, TotalShares: 3}
+		if test.reachedKeystore {
+			valid, wantQuorum = encodeShares(newShares), quorum{Threshold: test.threshold, TotalShares: 3}
+		}
+		status, err := unseal(t, restarted, valid)
+		if err != nil || status.Sealed {
+			t.Fatalf("%s: unseal: status %+v, err %v", test.name, status, err)
+		}
+		if status.RekeyInterrupted || status.Threshold != wantQuorum.Threshold || status.TotalShares != wantQuorum.TotalShares {
+			t.Errorf("%s: status %+v, want the quorum %+v", test.name, status, wantQuorum)
+		}
+		if _, err := os.Stat(stagedQuorumPath(conf.KeystoreConfig.Path)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: staged quorum left behind: %v", test.name, err)
+		}
+
+		// The quorum file now matches the keystore for every later start
+		again := restart(t, conf, logger)
+		if status := again.Status(); status.RekeyInterrupted || status.Threshold != wantQuorum.Threshold {
+			t.Errorf("%s: status after another restart %+v", test.name, status)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package seal
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// The master key is shared over the prime field of the Mersenne prime 2^521-1, large enough for any 32-byte key
+var prime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 521), big.NewInt(1))
+
+const (
+	// masterKeySize is the size of the master key the keystore is sealed under
+	masterKeySize = 32
+	// fieldSize is the size of a field element in bytes
+	fieldSize = 66
+	// maxShares keeps the share index in a single byte
+	maxShares = 255
+)
+
+// unsealShare is the point (index, f(index)) of the polynomial hiding the master key in f(0)
+type unsealShare struct {
+	index int
+	value *big.Int
+}
+
+// splitKey splits the master key into totalShares points of a random polynomial of degree threshold-1,
+// any threshold of them recover the key by Lagrange interpolation
+func splitKey(key []byte, threshold, totalShares int) ([]unsealShare, error) {
+	if threshold < 1 || totalShares < threshold || totalShares > maxShares {
+		return nil, fmt.Errorf("%w: threshold must be between 1 and total shares, at most %d shares", ErrInvalidQuorum, maxShares)
+	}
+
+	coefficients := make([]*big.Int, threshold)
+	coefficients[0] = new(big.Int).SetBytes(key)
+	for k := 1; k < threshold; k++ {
+		coefficient, err := rand.Int(rand.Reader, prime)
+		if err != nil {
+			return nil, err
+		}
+		coefficients[k] = coefficient
+	}
+
+	shares := make([]unsealShare, totalShares)
+	for i := 1; i <= totalShares; i++ {
+		// Horner's rule
+		x := big.NewInt(int64(i))
+		value := new(big.Int)
+		for k := len(coefficients) - 1; k >= 0; k-- {
+			value.Mul(value, x).Add(value, coefficients[k]).Mod(value, prime)
+		}
+		shares[i-1] = unsealShare{index: i, value: value}
+	}
+	return shares, nil
+}
+
+// combineKey interpolates f(0) from shares with distinct indices
+func combineKey(shares []unsealShare) ([]byte, error) {
+	secret := new(big.Int)
+	for i, share := range shares {
+		numerator, denominator := big.NewInt(1), big.NewInt(1)
+		for j, other := range shares {
+			if i == j {
+				continue
+			}
+			if other.index == share.index {
+				return nil, fmt.Errorf("%w: duplicate index %d", ErrInvalidShare, share.index)
+			}
+			numerator.Mul(numerator, big.NewInt(int64(-other.index))).Mod(numerator, prime)
+			denominator.Mul(denominator, big.NewInt(int64(share.index-other.index))).Mod(denominator, prime)
+		}
+		weight := numerator.Mul(numerator, denominator.ModInverse(denominator, prime))
+		secret.Add(secret, weight.Mul(weight, share.value)).Mod(secret, prime)
+	}
+
+	// Shares of another polynomial interpolate to an arbitrary field element, which cannot be a master key
+	if secret.BitLen() > masterKeySize*8 {
+		return nil, errors.New("unseal shares do not belong together")
+	}
+	return secret.FillBytes(make([]byte, masterKeySize)), nil
+}
+
+// encode formats the share for an operator as base64 of the index byte followed by the field element
+func (share unsealShare) encode() string {
+	raw := make([]byte, 1+fieldSize)
+	raw[0] = byte(share.index)
+	share.value.FillBytes(raw[1:])
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// decodeShare parses an unseal share posted by an operator
+func decodeShare(encoded string) (unsealShare, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return unsealShare{}, fmt.Errorf("%w: %v", ErrInvalidShare, err)
+	}
+	if len(raw) != 1+fieldSize || raw[0] == 0 {
+		return unsealShare{}, fmt.Errorf("%w: malformed share", ErrInvalidShare)
+	}
+
+	value := new(big.Int).SetBytes(raw[1:])
+	if value.Cmp(prime) >= 0 {
+		return unsealShare{}, fmt.Errorf("%w: share is not a field element", ErrInvalidShare)
+	}
+	return unsealShare{index: int(raw[0]), value: value}, nil
+}
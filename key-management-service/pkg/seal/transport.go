@@ -0,0 +1,58 @@
+package seal
+
+import (
+	"github.com/go-chi/chi/v5"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/mdshahjahanmiah/explore-go/error"
+	"github.com/mdshahjahanmiah/explore-go/http"
+)
+
+func MakeHandler(service Service) http.Endpoint {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorEncoder(error.EncodeError),
+	}
+
+	handleStatus := kithttp.NewServer(
+		getStatusEndpoint(service),
+		kithttp.NopRequestDecoder,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleInit := kithttp.NewServer(
+		getInitEndpoint(service),
+		decodeInitRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleUnseal := kithttp.NewServer(
+		getUnsealEndpoint(service),
+		decodeUnsealRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleSeal := kithttp.NewServer(
+		getSealEndpoint(service),
+		decodeSealRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handleRekey := kithttp.NewServer(
+		getRekeyEndpoint(service),
+		decodeRekeyRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	r := chi.NewRouter()
+	r.Method("GET", "/sys/unseal-status", handleStatus)
+	r.Method("POST", "/sys/init", handleInit)
+	r.Method("POST", "/sys/unseal", handleUnseal)
+	r.Method("POST", "/sys/seal", handleSeal)
+	r.Method("POST", "/sys/rekey", handleRekey)
+
+	return http.Endpoint{Pattern: "/sys/*", Handler: r}
+}
@@ -25,8 +25,8 @@ if ! command -v jq &> /dev/null; then
     install_jq
 fi
 
-# Step 1: Call the ciphertext endpoint and save the response to response.json
-curl -X GET http://localhost:9000/ds/ciphertext -H "Content-Type: application/json" -o response.json
+# Step 1: Encrypt a plaintext under the KMS public key and save the response to response.json
+curl -X POST http://localhost:9000/ds/encrypt -H "Content-Type: application/json" -d '{"plaintext": "hello threshold decryption"}' -o response.json
 
 # Step 2: Extract the ciphertext value from the response.json file
 ciphertext=$(jq -r '.ciphertext' response.json)
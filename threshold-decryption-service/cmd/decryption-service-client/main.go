@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/base64"
 	"fmt"
 	"github.com/mdshahjahanmiah/explore-go/logging"
 	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/config"
@@ -20,12 +19,12 @@ func main() {
 	if err != nil {
 		logger.Fatal("initializing decryption service", "err", err)
 	}
-	pairing := service.PairingParams()
 
-	// Generate a random G1 element for the ciphertext
-	ciphertextElement := pairing.NewG1().Rand()
-	ciphertextBytes := ciphertextElement.Bytes()
-	ciphertext := base64.StdEncoding.EncodeToString(ciphertextBytes)
+	// Encrypt a sample plaintext under the default key of the KMS
+	ciphertext, err := service.Encrypt("", "hello threshold decryption")
+	if err != nil {
+		logger.Fatal("encrypting sample plaintext", "err", err)
+	}
 
 	// Print the generated values
 	fmt.Println("Testing Ciphertext: ", ciphertext)
@@ -7,6 +7,7 @@ toolchain go1.22.3
 require github.com/Nik-U/pbc v0.0.0-20181205041846-3e516ca0c5d6
 
 require (
+	github.com/cloudflare/circl v1.3.7
 	github.com/go-chi/chi/v5 v5.0.12
 	github.com/go-kit/kit v0.13.0
 	github.com/mdshahjahanmiah/explore-go v1.1.0
@@ -17,4 +18,6 @@ require (
 require (
 	github.com/go-kit/log v0.2.0 // indirect
 	github.com/go-logfmt/logfmt v0.5.1 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
 )
@@ -0,0 +1,181 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// DkgEncryptedShare is a dealer's share pair for one recipient, encrypted to the recipient's transport key
+type DkgEncryptedShare struct {
+	Recipient  int    `json:"recipient"`
+	Ephemeral  string `json:"ephemeral"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// DkgDeal is a node's Pedersen commitments and encrypted shares for the dealing round
+type DkgDeal struct {
+	Commitments []string            `json:"commitments"`
+	Shares      []DkgEncryptedShare `json:"shares"`
+}
+
+// DkgSharePair is a dealer's share pair for one receiver in the clear, published only to settle a dispute
+type DkgSharePair struct {
+	Share    string `json:"share"`
+	Blinding string `json:"blinding"`
+}
+
+// DkgState is the public transcript of the distributed key generation session kept by the KMS
+type DkgState struct {
+	Kind        string `json:"kind"`
+	Epoch       int    `json:"epoch"`
+	Phase       string `json:"phase"`
+	Generator   string `json:"generator"`
+	Threshold   int    `json:"threshold"`
+	TotalShares int    `json:"total_shares"`
+	// The committee handing over the key in a reshare session
+	PreviousThreshold   int             `json:"previous_threshold,omitempty"`
+	PreviousTotalShares int             `json:"previous_total_shares,omitempty"`
+	TransportKeys       map[int]string  `json:"transport_keys"`
+	Deals               map[int]DkgDeal `json:"deals"`
+	Complaints          map[int][]int   `json:"complaints"`
+	// The share pairs dealers published to answer complaints, by dealer and receiver
+	Answers   map[int]map[int]DkgSharePair `json:"answers"`
+	Qualified []int                        `json:"qualified"`
+	Reveals   map[int][]string             `json:"reveals"`
+	// The share pairs receivers published because they do not match the reveal, by receiver and dealer
+	Accusations map[int]map[int]DkgSharePair `json:"accusations"`
+	// The qualified dealers caught cheating, every receiver discloses its shares of them
+	Reconstructed []int                        `json:"reconstructed,omitempty"`
+	Disclosures   map[int]map[int]DkgSharePair `json:"disclosures"`
+	PublicKey     string                       `json:"public_key,omitempty"`
+	Reason        string                       `json:"reason,omitempty"`
+}
+
+type dkgRegisterRequest struct {
+	NodeID       int    `json:"node_id"`
+	TransportKey string `json:"transport_key"`
+}
+
+type dkgDealRequest struct {
+	NodeID int `json:"node_id"`
+	DkgDeal
+}
+
+type dkgComplaintRequest struct {
+	NodeID  int   `json:"node_id"`
+	Accused []int `json:"accused"`
+}
+
+type dkgAnswerRequest struct {
+	NodeID  int                  `json:"node_id"`
+	Answers map[int]DkgSharePair `json:"answers"`
+}
+
+type dkgRevealRequest struct {
+	NodeID      int      `json:"node_id"`
+	Commitments []string `json:"commitments"`
+}
+
+type dkgVerificationRequest struct {
+	NodeID      int                  `json:"node_id"`
+	Accusations map[int]DkgSharePair `json:"accusations"`
+}
+
+type dkgDisclosureRequest struct {
+	NodeID      int                  `json:"node_id"`
+	Disclosures map[int]DkgSharePair `json:"disclosures"`
+}
+
+// FetchDkgState fetches the current state of the distributed key generation from the Key Management Service
+func FetchDkgState(kmsURL string) (DkgState, error) {
+	resp, err := http.Get(kmsURL + "/dkg/state")
+	if err != nil {
+		return DkgState{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return DkgState{}, fmt.Errorf("failed to fetch dkg state from KMS, status %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return DkgState{}, err
+	}
+
+	var state DkgState
+	if err := json.Unmarshal(body, &state); err != nil {
+		return DkgState{}, err
+	}
+
+	return state, nil
+}
+
+// RegisterDkgNode registers the node's transport key for the dealing round.
+// Every message is sent with the node's token, the KMS only accepts the messages of a node from the node itself.
+func RegisterDkgNode(kmsURL string, nodeID int, transportKey, token string) error {
+	return postDkgMessage(kmsURL+"/dkg/register", token, dkgRegisterRequest{NodeID: nodeID, TransportKey: transportKey})
+}
+
+// SubmitDkgDeal publishes the node's commitments and encrypted shares
+func SubmitDkgDeal(kmsURL string, nodeID int, deal DkgDeal, token string) error {
+	return postDkgMessage(kmsURL+"/dkg/deal", token, dkgDealRequest{NodeID: nodeID, DkgDeal: deal})
+}
+
+// SubmitDkgComplaints reports the dealers whose shares did not verify
+func SubmitDkgComplaints(kmsURL string, nodeID int, accused []int, token string) error {
+	return postDkgMessage(kmsURL+"/dkg/complaint", token, dkgComplaintRequest{NodeID: nodeID, Accused: accused})
+}
+
+// SubmitDkgAnswers publishes the share pairs of the receivers complaining about this dealer
+func SubmitDkgAnswers(kmsURL string, nodeID int, answers map[int]DkgSharePair, token string) error {
+	return postDkgMessage(kmsURL+"/dkg/answer", token, dkgAnswerRequest{NodeID: nodeID, Answers: answers})
+}
+
+// SubmitDkgReveal publishes the Feldman commitments of a qualified dealer
+func SubmitDkgReveal(kmsURL string, nodeID int, commitments []string, token string) error {
+	return postDkgMessage(kmsURL+"/dkg/reveal", token, dkgRevealRequest{NodeID: nodeID, Commitments: commitments})
+}
+
+// SubmitDkgVerification reports the dealers whose reveal does not match the share received from them
+func SubmitDkgVerification(kmsURL string, nodeID int, accusations map[int]DkgSharePair, token string) error {
+	return postDkgMessage(kmsURL+"/dkg/verification", token, dkgVerificationRequest{NodeID: nodeID, Accusations: accusations})
+}
+
+// SubmitDkgDisclosures publishes the node's shares of the dealers being reconstructed
+func SubmitDkgDisclosures(kmsURL string, nodeID int, disclosures map[int]DkgSharePair, token string) error {
+	return postDkgMessage(kmsURL+"/dkg/disclosure", token, dkgDisclosureRequest{NodeID: nodeID, Disclosures: disclosures})
+}
+
+func postDkgMessage(url, token string, message interface{}) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("KMS refused dkg message to %s with status %d, check the node token", url, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("dkg message to %s rejected with status %d: %s", url, resp.StatusCode, body)
+	}
+
+	return nil
+}
@@ -3,18 +3,37 @@ package client
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
 )
 
+// keyURL is the KMS URL of a resource of the given key, the empty key id is the default key
+func keyURL(kmsURL, keyID, resource string) string {
+	if keyID == "" {
+		return kmsURL + resource
+	}
+	return kmsURL + "/keys/" + url.PathEscape(keyID) + resource
+}
+
+// versionQuery selects a key version in a KMS request, the KMS answers with the latest version without it
+func versionQuery(version int) string {
+	if version == 0 {
+		return ""
+	}
+	return "?version=" + strconv.Itoa(version)
+}
+
 // PairingParamResponse represents the response structure for pairing parameters
 type PairingParamResponse struct {
 	Params string `json:"params"`
 }
 
-// FetchPairingParams fetches the pairing parameters from the Key Management Service
-func FetchPairingParams(kmsURL string) (string, error) {
-	resp, err := http.Get(kmsURL + "/pairing-param")
+// FetchPairingParams fetches the pairing parameters of a key from the Key Management Service
+func FetchPairingParams(kmsURL, keyID string) (string, error) {
+	resp, err := http.Get(keyURL(kmsURL, keyID, "/pairing-param"))
 	if err != nil {
 		return "", err
 	}
@@ -38,3 +57,117 @@ func FetchPairingParams(kmsURL string) (string, error) {
 	// Return the base64-encoded pairing parameters
 	return response.Params, nil
 }
+
+// PublicKeyResponse represents the response structure for the public key
+type PublicKeyResponse struct {
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	Key       string `json:"key"`
+	Generator string `json:"generator"`
+	KeyID     string `json:"key_id"`
+	Version   int    `json:"version"`
+	Epoch     int    `json:"epoch"`
+}
+
+// FetchPublicKey fetches the latest version of the public key of a key and its generator from the Key Management Service
+func FetchPublicKey(kmsURL, keyID string) (PublicKeyResponse, error) {
+	return FetchPublicKeyVersion(kmsURL, keyID, 0)
+}
+
+// FetchPublicKeyVersion fetches the public key of the given version of a key, version 0 is the latest
+func FetchPublicKeyVersion(kmsURL, keyID string, version int) (PublicKeyResponse, error) {
+	resp, err := http.Get(keyURL(kmsURL, keyID, "/public-key") + versionQuery(version))
+	if err != nil {
+		return PublicKeyResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return PublicKeyResponse{}, errors.New("failed to fetch public key from KMS")
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return PublicKeyResponse{}, err
+	}
+
+	var response PublicKeyResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return PublicKeyResponse{}, err
+	}
+
+	return response, nil
+}
+
+// CommitmentsResponse represents the response structure for the Feldman commitments
+type CommitmentsResponse struct {
+	Commitments []string `json:"commitments"`
+}
+
+// KeyShareResponse represents the key share of one decryption node, with the key version and refresh epoch it belongs to
+type KeyShareResponse struct {
+	ID      int    `json:"id"`
+	Share   string `json:"share"`
+	Version int    `json:"version"`
+	Epoch   int    `json:"epoch"`
+}
+
+// FetchCommitments fetches the Feldman commitments to the sharing polynomial of a key version from the Key Management Service
+func FetchCommitments(kmsURL, keyID string, version int) ([]string, error) {
+	resp, err := http.Get(keyURL(kmsURL, keyID, "/commitments") + versionQuery(version))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("failed to fetch commitments from KMS")
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var response CommitmentsResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Commitments, nil
+}
+
+// FetchKeyShare fetches the share of the given decryption node in a key version from the Key Management Service.
+// The KMS only hands out the share of the node the token belongs to.
+func FetchKeyShare(kmsURL, keyID string, version, shareID int, token string) (KeyShareResponse, error) {
+	request, err := http.NewRequest(http.MethodGet, keyURL(kmsURL, keyID, "/key-shares/"+strconv.Itoa(shareID))+versionQuery(version), nil)
+	if err != nil {
+		return KeyShareResponse{}, err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return KeyShareResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return KeyShareResponse{}, fmt.Errorf("KMS refused key share %d with status %d, check the node token", shareID, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return KeyShareResponse{}, fmt.Errorf("failed to fetch key share %d from KMS", shareID)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return KeyShareResponse{}, err
+	}
+
+	var response KeyShareResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return KeyShareResponse{}, err
+	}
+
+	return response, nil
+}
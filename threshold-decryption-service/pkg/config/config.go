@@ -3,28 +3,69 @@ package config
 import (
 	"flag"
 	"github.com/mdshahjahanmiah/explore-go/logging"
+	"os"
+	"time"
 )
 
 type Config struct {
-	HttpAddress    string
-	KmsHttpAddress string
-	LoggerConfig   logging.LoggerConfig
+	HttpAddress     string
+	KmsHttpAddress  string
+	NodeID          int
+	DkgEnabled      bool
+	DkgPollInterval time.Duration
+	// LegacyCiphertexts lets nodes decrypt ciphertexts made before the validity tag, which are open to chosen-ciphertext attacks
+	LegacyCiphertexts bool
+	// PairingParamsFile holds the pairing parameters of the default key, e.g. written by the KMS keygen command
+	PairingParamsFile string
+	// ShareFile holds the share of this node written by the KMS keygen command, otherwise the node fetches its share from the KMS
+	ShareFile string
+	// NodeToken authenticates this node to the KMS, which only hands a node its own share
+	// and only accepts the distributed key generation messages of a node from the node itself
+	NodeToken string
+	// GatewayToken authenticates the gateway, which authorizes identity key extraction and signing, to this node
+	GatewayToken string
+	LoggerConfig logging.LoggerConfig
 }
 
+// NodeTokenEnv is the environment variable holding the token of this node, so it never shows up in the process arguments
+const NodeTokenEnv = "DS_NODE_TOKEN"
+
+// GatewayTokenEnv is the environment variable holding the token the gateway authenticates with.
+// Partial identity keys and partial signatures are only computed for requests carrying it.
+const GatewayTokenEnv = "DS_GATEWAY_TOKEN"
+
 func Load() (Config, error) {
 	fs := flag.NewFlagSet("", flag.ExitOnError)
 
 	httpAddress := fs.String("http.public.address", "0.0.0.0:9002", "HTTP listen address for all specified endpoints.")
 	kmsHttpAddress := fs.String("kms.http.public.address", "http://localhost:9001", "KMS HTTP listen address for all specified endpoints.")
+	nodeID := fs.Int("node.id", 1, "Share index of this decryption node, between 1 and the total number of shares.")
+	dkgEnabled := fs.Bool("dkg.enabled", false, "Take part in the distributed key generation coordinated by the KMS instead of using dealt shares.")
+	dkgPollInterval := fs.Duration("dkg.poll.interval", time.Second, "How often to poll the KMS for the next distributed key generation round.")
+	pairingParamsFile := fs.String("pairing.params.file", "", "file with plain pairing parameters of the default key, loaded instead of fetching them from the KMS.")
+	shareFile := fs.String("share.file", "", "file with the share of this node, e.g. share-<node.id>.json written by the KMS keygen command. Without it the node fetches its own share from the KMS.")
+	legacyCiphertexts := fs.Bool("decrypt.legacy.ciphertexts", false, "Also decrypt ciphertexts without a validity tag, only while migrating old ciphertexts.")
 
 	loggerConfig := logging.LoggerConfig{}
 	fs.StringVar(&loggerConfig.CommandHandler, "logger.handler.type", "json", "handler type e.g json, otherwise default will be text type")
 	fs.StringVar(&loggerConfig.LogLevel, "logger.log.level", "info", "log level wise logging with fatal log")
 
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return Config{}, err
+	}
+
 	config := Config{
-		HttpAddress:    *httpAddress,
-		KmsHttpAddress: *kmsHttpAddress,
-		LoggerConfig:   loggerConfig,
+		HttpAddress:       *httpAddress,
+		KmsHttpAddress:    *kmsHttpAddress,
+		NodeID:            *nodeID,
+		DkgEnabled:        *dkgEnabled,
+		DkgPollInterval:   *dkgPollInterval,
+		LegacyCiphertexts: *legacyCiphertexts,
+		PairingParamsFile: *pairingParamsFile,
+		ShareFile:         *shareFile,
+		NodeToken:         os.Getenv(NodeTokenEnv),
+		GatewayToken:      os.Getenv(GatewayTokenEnv),
+		LoggerConfig:      loggerConfig,
 	}
 
 	return config, nil
@@ -0,0 +1,24 @@
+package decrypt
+
+import (
+	"context"
+	"crypto/subtle"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// ErrUnauthenticatedGateway is returned when a request the node only serves to the gateway comes without the gateway token
+var ErrUnauthenticatedGateway = errors.New("request is not authenticated as the gateway")
+
+// authenticateGateway checks the request carries the gateway token as a bearer token. The gateway authorizes the
+// requester before it asks the nodes, so a node computes those partials for nobody else. Without a configured
+// token no request passes. The transport has to run kithttp.PopulateRequestContext before the endpoint.
+func authenticateGateway(ctx context.Context, gatewayToken string) error {
+	header, _ := ctx.Value(kithttp.ContextKeyRequestAuthorization).(string)
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found || gatewayToken == "" || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(gatewayToken)) != 1 {
+		return ErrUnauthenticatedGateway
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package decrypt
+
+import (
+	"context"
+	"errors"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"testing"
+)
+
+func TestAuthenticateGateway(t *testing.T) {
+	tests := []struct {
+		name         string
+		gatewayToken string
+		header       string
+		ok           bool
+	}{
+		{name: "gateway token", gatewayToken: "secret", header: "Bearer secret", ok: true},
+		{name: "wrong token", gatewayToken: "secret", header: "Bearer guess"},
+		{name: "no token", gatewayToken: "secret"},
+		{name: "not a bearer token", gatewayToken: "secret", header: "secret"},
+		{name: "no token configured", header: "Bearer "},
+	}
+	for _, test := range tests {
+		ctx := context.WithValue(context.Background(), kithttp.ContextKeyRequestAuthorization, test.header)
+		err := authenticateGateway(ctx, test.gatewayToken)
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !test.ok && !errors.Is(err, ErrUnauthenticatedGateway) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, ErrUnauthenticatedGateway)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package decrypt
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/group"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCiphertext is returned, before any share is used, for a ciphertext that does not decode or whose validity tag
+// does not check out. It tells a malformed or tampered ciphertext apart from a node that failed to decrypt a valid one.
+var ErrInvalidCiphertext = errors.New("ciphertext validity check failed")
+
+// ccaDomain separates the hash of ciphertexts into G2 from every other use of hashing
+const ccaDomain = "threshold-cca:"
+
+// ccaBase returns the fixed G1 element h the header U = h^r is a power of. Nobody knows its discrete logarithm to any
+// other element, it is hashed from a constant so that every node and the gateway agree on it for a given pairing.
+func ccaBase(pairing group.Pairing) group.Element {
+	return pairing.NewG1().SetFromStringHash(ccaDomain+"generator", sha256.New())
+}
+
+// validityPoint hashes everything the tag binds, the key id, the key version, the header U and the payload V, into G2
+func validityPoint(pairing group.Pairing, keyID string, version int, header, payload []byte) group.Element {
+	hash := sha256.New()
+	hash.Write([]byte(ccaDomain))
+	hash.Write([]byte{byte(len(keyID))})
+	hash.Write([]byte(keyID))
+	hash.Write(binary.BigEndian.AppendUint32(nil, uint32(version)))
+	hash.Write(header)
+	hash.Write(payload)
+	return pairing.NewG2().SetFromHash(hash.Sum(nil))
+}
+
+// checkValidity checks the Baek-Zheng validity tag of a ciphertext: U = h^r and W = H(key id, version, U, V)^r must
+// share the exponent r, i.e. e(U, H) = e(h, W). Only the encryptor knows r, so a ciphertext that passes was produced
+// as a whole by someone who also knows the plaintext, and a partial decryption of it reveals nothing new. A header
+// lifted into a ciphertext of one's own, or a payload swapped under a header, fails the check.
+func checkValidity(pairing group.Pairing, sealed envelope, header group.Element, tagBytes, payload []byte) error {
+	tag := pairing.NewG2().SetBytes(tagBytes)
+	if tag.Is0() || header.Is0() {
+		return ErrInvalidCiphertext
+	}
+
+	point := validityPoint(pairing, sealed.KeyID, sealed.Version, header.Bytes(), payload)
+	left := pairing.NewGT().Pair(header, point)
+	right := pairing.NewGT().Pair(ccaBase(pairing), tag)
+	if !left.Equals(right) {
+		return ErrInvalidCiphertext
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package decrypt
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/group"
+)
+
+// MaxPlaintextSize is the largest plaintext, in bytes, that fits in a single ciphertext.
+const MaxPlaintextSize = 256
+
+// legacyCiphertextFormat is the leading byte of ciphertexts without a validity tag, they are only decrypted on request.
+const legacyCiphertextFormat = 0x01
+
+// ciphertextFormat is the leading byte of every ciphertext, it lets the layout change without breaking old ciphertexts.
+// Ciphertexts of this format carry the validity tag W between U and V.
+const ciphertextFormat = 0x04
+
+// identityCiphertextFormat is the leading byte of ciphertexts encrypted to an identity rather than to the key itself
+const identityCiphertextFormat = 0x02
+
+// envelope is a parsed ciphertext: the key and the key version it was encrypted under, followed by U || W || V,
+// or by U || V for the legacy format.
+type envelope struct {
+	Format  byte
+	KeyID   string
+	Version int
+	Body    []byte
+}
+
+// deriveMask expands the shared GT element into a keystream of the given size.
+// Each block is SHA-256(counter || key), so the mask is bound to the pairing value only.
+func deriveMask(sharedKey group.Element, size int) []byte {
+	keyBytes := sharedKey.Bytes()
+	mask := make([]byte, 0, size+sha256.Size)
+
+	var counter [4]byte
+	for i := uint32(0); len(mask) < size; i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		hash := sha256.New()
+		hash.Write(counter[:])
+		hash.Write(keyBytes)
+		mask = hash.Sum(mask)
+	}
+
+	return mask[:size]
+}
+
+// xorBytes returns a XOR b, both slices must have the same length.
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+// splitCiphertext separates the body of the envelope into the G1 header U, the G2 validity tag W and the masked payload V.
+// The tag is nil for the legacy format.
+func splitCiphertext(pairing group.Pairing, sealed envelope) ([]byte, []byte, []byte, error) {
+	headerLength := int(pairing.G1Length())
+	tagLength := 0
+	if sealed.Format == ciphertextFormat {
+		tagLength = int(pairing.G2Length())
+	}
+	if len(sealed.Body) <= headerLength+tagLength {
+		return nil, nil, nil, fmt.Errorf("ciphertext is too short, expected more than %d bytes: %w", headerLength+tagLength, ErrInvalidCiphertext)
+	}
+
+	var tag []byte
+	if tagLength > 0 {
+		tag = sealed.Body[headerLength : headerLength+tagLength]
+	}
+	return sealed.Body[:headerLength], tag, sealed.Body[headerLength+tagLength:], nil
+}
+
+// sealEnvelope lays out a ciphertext as format || len(key id) || key id || version (uint32, big endian) || U || W || V.
+// The key id and version tell the gateway which shares can decrypt it after the key has been rotated.
+func sealEnvelope(keyID string, version int, header, tag, payload []byte) ([]byte, error) {
+	if len(keyID) == 0 || len(keyID) > 255 {
+		return nil, fmt.Errorf("key id must be between 1 and 255 bytes")
+	}
+
+	ciphertext := make([]byte, 0, 2+len(keyID)+4+len(header)+len(tag)+len(payload))
+	ciphertext = append(ciphertext, ciphertextFormat, byte(len(keyID)))
+	ciphertext = append(ciphertext, keyID...)
+	ciphertext = binary.BigEndian.AppendUint32(ciphertext, uint32(version))
+	ciphertext = append(ciphertext, header...)
+	ciphertext = append(ciphertext, tag...)
+	return append(ciphertext, payload...), nil
+}
+
+// openEnvelope reads the key id and version in front of a ciphertext laid out by sealEnvelope, or of the legacy format.
+// The body is left for splitCiphertext, which needs the pairing of that key.
+func openEnvelope(ciphertext []byte) (envelope, error) {
+	if len(ciphertext) < 2 || (ciphertext[0] != ciphertextFormat && ciphertext[0] != legacyCiphertextFormat) {
+		return envelope{}, fmt.Errorf("unknown ciphertext format: %w", ErrInvalidCiphertext)
+	}
+
+	keyIDLength := int(ciphertext[1])
+	if len(ciphertext) < 2+keyIDLength+4 {
+		return envelope{}, fmt.Errorf("ciphertext is too short for its key id and version: %w", ErrInvalidCiphertext)
+	}
+
+	return envelope{
+		Format:  ciphertext[0],
+		KeyID:   string(ciphertext[2 : 2+keyIDLength]),
+		Version: int(binary.BigEndian.Uint32(ciphertext[2+keyIDLength:])),
+		Body:    ciphertext[2+keyIDLength+4:],
+	}, nil
+}
+
+// identityEnvelope is a parsed identity ciphertext: the key, its version and the identity it was encrypted to, followed by U || V.
+type identityEnvelope struct {
+	KeyID    string
+	Version  int
+	Identity string
+	Body     []byte
+}
+
+// sealIdentityEnvelope lays out an identity ciphertext as
+// format || len(key id) || key id || version (uint32, big endian) || len(identity) || identity || U || V.
+// U is a G2 element here, the identity tells its holder which identity key opens the ciphertext.
+func sealIdentityEnvelope(keyID string, version int, identity string, header, payload []byte) ([]byte, error) {
+	if len(keyID) == 0 || len(keyID) > 255 {
+		return nil, fmt.Errorf("key id must be between 1 and 255 bytes")
+	}
+	if len(identity) == 0 || len(identity) > MaxIdentitySize {
+		return nil, fmt.Errorf("identity must be between 1 and %d bytes", MaxIdentitySize)
+	}
+
+	ciphertext := make([]byte, 0, 2+len(keyID)+4+1+len(identity)+len(header)+len(payload))
+	ciphertext = append(ciphertext, identityCiphertextFormat, byte(len(keyID)))
+	ciphertext = append(ciphertext, keyID...)
+	ciphertext = binary.BigEndian.AppendUint32(ciphertext, uint32(version))
+	ciphertext = append(ciphertext, byte(len(identity)))
+	ciphertext = append(ciphertext, identity...)
+	ciphertext = append(ciphertext, header...)
+	return append(ciphertext, payload...), nil
+}
+
+// openIdentityEnvelope reads the key id, version and identity in front of a ciphertext laid out by sealIdentityEnvelope
+func openIdentityEnvelope(ciphertext []byte) (identityEnvelope, error) {
+	if len(ciphertext) < 2 || ciphertext[0] != identityCiphertextFormat {
+		return identityEnvelope{}, fmt.Errorf("not an identity ciphertext: %w", ErrInvalidCiphertext)
+	}
+
+	keyIDLength := int(ciphertext[1])
+	offset := 2 + keyIDLength + 4
+	if len(ciphertext) < offset+1 {
+		return identityEnvelope{}, fmt.Errorf("ciphertext is too short for its key id and version: %w", ErrInvalidCiphertext)
+	}
+	identityLength := int(ciphertext[offset])
+	if len(ciphertext) < offset+1+identityLength {
+		return identityEnvelope{}, fmt.Errorf("ciphertext is too short for its identity: %w", ErrInvalidCiphertext)
+	}
+
+	return identityEnvelope{
+		KeyID:    string(ciphertext[2 : 2+keyIDLength]),
+		Version:  int(binary.BigEndian.Uint32(ciphertext[2+keyIDLength:])),
+		Identity: string(ciphertext[offset+1 : offset+1+identityLength]),
+		Body:     ciphertext[offset+1+identityLength:],
+	}, nil
+}
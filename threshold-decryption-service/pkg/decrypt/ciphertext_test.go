@@ -0,0 +1,128 @@
+package decrypt
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	raw, err := sealEnvelope("payments", 3, []byte("U"), []byte("W"), []byte("V"))
+	if err != nil {
+		t.Fatalf("sealEnvelope: %v", err)
+	}
+	sealed, err := openEnvelope(raw)
+	if err != nil {
+		t.Fatalf("openEnvelope: %v", err)
+	}
+	if sealed.Format != ciphertextFormat || sealed.KeyID != "payments" || sealed.Version != 3 || string(sealed.Body) != "UWV" {
+		t.Errorf("openEnvelope = %+v", sealed)
+	}
+
+	if _, err := sealEnvelope("", 1, nil, nil, nil); err == nil {
+		t.Error("sealed an envelope without a key id")
+	}
+}
+
+func TestOpenEnvelopeMalformed(t *testing.T) {
+	valid, err := sealEnvelope("payments", 3, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("sealEnvelope: %v", err)
+	}
+	identity, err := sealIdentityEnvelope("payments", 3, "alice", []byte("U"), []byte("V"))
+	if err != nil {
+		t.Fatalf("sealIdentityEnvelope: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{name: "empty", ciphertext: nil},
+		{name: "format byte only", ciphertext: []byte{ciphertextFormat}},
+		{name: "unknown format", ciphertext: append([]byte{0x7f}, valid[1:]...)},
+		{name: "identity format", ciphertext: identity},
+		{name: "key id longer than the ciphertext", ciphertext: []byte{ciphertextFormat, 200, 'a'}},
+		{name: "truncated version", ciphertext: valid[:len(valid)-1]},
+	}
+	for _, test := range tests {
+		if _, err := openEnvelope(test.ciphertext); !errors.Is(err, ErrInvalidCiphertext) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, ErrInvalidCiphertext)
+		}
+	}
+}
+
+func TestSplitCiphertext(t *testing.T) {
+	pairing := newTestPairing(t)
+	headerLength := int(pairing.G1Length())
+	tagLength := int(pairing.G2Length())
+	body := make([]byte, headerLength+tagLength+1)
+
+	if _, _, _, err := splitCiphertext(pairing, envelope{Format: ciphertextFormat, Body: body}); err != nil {
+		t.Fatalf("splitCiphertext: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		sealed envelope
+	}{
+		{name: "empty body", sealed: envelope{Format: ciphertextFormat}},
+		{name: "no payload", sealed: envelope{Format: ciphertextFormat, Body: body[:headerLength+tagLength]}},
+		{name: "legacy header only", sealed: envelope{Format: legacyCiphertextFormat, Body: body[:headerLength]}},
+	}
+	for _, test := range tests {
+		if _, _, _, err := splitCiphertext(pairing, test.sealed); !errors.Is(err, ErrInvalidCiphertext) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, ErrInvalidCiphertext)
+		}
+	}
+}
+
+func TestIdentityEnvelope(t *testing.T) {
+	raw, err := sealIdentityEnvelope("payments", 3, "alice", []byte("U"), []byte("V"))
+	if err != nil {
+		t.Fatalf("sealIdentityEnvelope: %v", err)
+	}
+	sealed, err := openIdentityEnvelope(raw)
+	if err != nil {
+		t.Fatalf("openIdentityEnvelope: %v", err)
+	}
+	if sealed.KeyID != "payments" || sealed.Version != 3 || sealed.Identity != "alice" || string(sealed.Body) != "UV" {
+		t.Errorf("openIdentityEnvelope = %+v", sealed)
+	}
+
+	direct, err := sealEnvelope("payments", 3, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("sealEnvelope: %v", err)
+	}
+	tests := []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{name: "empty", ciphertext: nil},
+		{name: "direct format", ciphertext: direct},
+		{name: "truncated identity length", ciphertext: raw[:2+len("payments")+4]},
+		{name: "truncated identity", ciphertext: raw[:2+len("payments")+4+1+2]},
+	}
+	for _, test := range tests {
+		if _, err := openIdentityEnvelope(test.ciphertext); !errors.Is(err, ErrInvalidCiphertext) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, ErrInvalidCiphertext)
+		}
+	}
+}
+
+func TestHybridEnvelopeMalformed(t *testing.T) {
+	tests := []struct {
+		name       string
+		ciphertext string
+	}{
+		{name: "not base64", ciphertext: "%%%"},
+		{name: "too short", ciphertext: base64.StdEncoding.EncodeToString([]byte{hybridCiphertextFormat, 0})},
+		{name: "direct format", ciphertext: base64.StdEncoding.EncodeToString([]byte{ciphertextFormat, 0, 0, 0, 0})},
+		{name: "KEM header longer than the ciphertext", ciphertext: base64.StdEncoding.EncodeToString([]byte{hybridCiphertextFormat, 0xff, 0xff, 1})},
+	}
+	for _, test := range tests {
+		if _, err := SplitHybrid(test.ciphertext); !errors.Is(err, ErrInvalidCiphertext) {
+			t.Errorf("%s: err = %v, want %v", test.name, err, ErrInvalidCiphertext)
+		}
+	}
+}
@@ -10,9 +10,109 @@ import (
 	eError "github.com/mdshahjahanmiah/explore-go/error"
 )
 
+const (
+	// ModeDirect masks the plaintext with the pairing value itself, for plaintexts up to MaxPlaintextSize
+	ModeDirect = "direct"
+	// ModeHybrid wraps a random AES-256-GCM key in the KEM header and encrypts the plaintext with it
+	ModeHybrid = "hybrid"
+)
+
+// EncryptRequest is a plaintext and the key to encrypt it under, the default key if the key id is empty.
+// The mode is direct unless hybrid is asked for.
+type EncryptRequest struct {
+	KeyID     string `json:"key_id"`
+	Mode      string `json:"mode"`
+	Plaintext string `json:"plaintext"`
+}
+
+// IdentityEncryptRequest is a plaintext and the identity to encrypt it to under the given key, the default key if empty
+type IdentityEncryptRequest struct {
+	KeyID     string `json:"key_id"`
+	Identity  string `json:"identity"`
+	Plaintext string `json:"plaintext"`
+}
+
+// PartialIdentityKeyRequest asks for this node's part of the private key of an identity under a key version,
+// computed with the node's own share
+type PartialIdentityKeyRequest struct {
+	KeyID    string `json:"key_id"`
+	Version  int    `json:"version"`
+	Identity string `json:"identity"`
+}
+
+// PartialSignRequest asks for this node's BLS partial signature of a message under a key version,
+// computed with the node's own share
+type PartialSignRequest struct {
+	KeyID   string `json:"key_id"`
+	Version int    `json:"version"`
+	Message string `json:"message"`
+}
+
+// Request is a ciphertext to partially decrypt, the node picks its share from the key and version the ciphertext names
 type Request struct {
 	Ciphertext string `json:"ciphertext"`
-	Share      string `json:"share"`
+}
+
+func decodeEncryptRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	decoder := json.NewDecoder(request.Body)
+
+	var encryptRequest EncryptRequest
+	err := decoder.Decode(&encryptRequest)
+	if err != nil {
+		slog.Error("decode encrypt request", "err", err)
+		return nil, eError.NewServiceError(err, "decode encrypt request", "payload", http.StatusBadRequest)
+	}
+
+	if encryptRequest.Plaintext == "" {
+		slog.Error("missing plaintext")
+		return nil, eError.NewServiceError(errors.New("plaintext is empty"), "validation_error", "plaintext", http.StatusBadRequest)
+	}
+
+	switch encryptRequest.Mode {
+	case "":
+		encryptRequest.Mode = ModeDirect
+	case ModeDirect, ModeHybrid:
+	default:
+		return nil, eError.NewServiceError(errors.New("mode must be 'direct' or 'hybrid'"), "validation_error", "mode", http.StatusBadRequest)
+	}
+
+	return encryptRequest, nil
+}
+
+func decodeIdentityEncryptRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var encryptRequest IdentityEncryptRequest
+	if err := json.NewDecoder(request.Body).Decode(&encryptRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode identity encrypt request", "payload", http.StatusBadRequest)
+	}
+	if encryptRequest.Identity == "" {
+		return nil, eError.NewServiceError(errors.New("identity is empty"), "validation_error", "identity", http.StatusBadRequest)
+	}
+	if encryptRequest.Plaintext == "" {
+		return nil, eError.NewServiceError(errors.New("plaintext is empty"), "validation_error", "plaintext", http.StatusBadRequest)
+	}
+	return encryptRequest, nil
+}
+
+func decodePartialIdentityKeyRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var partialRequest PartialIdentityKeyRequest
+	if err := json.NewDecoder(request.Body).Decode(&partialRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode partial identity key request", "payload", http.StatusBadRequest)
+	}
+	if partialRequest.Identity == "" {
+		return nil, eError.NewServiceError(errors.New("identity is empty"), "validation_error", "identity", http.StatusBadRequest)
+	}
+	return partialRequest, nil
+}
+
+func decodePartialSignRequest(ctx context.Context, request *http.Request) (interface{}, error) {
+	var signRequest PartialSignRequest
+	if err := json.NewDecoder(request.Body).Decode(&signRequest); err != nil {
+		return nil, eError.NewServiceError(err, "decode partial sign request", "payload", http.StatusBadRequest)
+	}
+	if signRequest.Message == "" {
+		return nil, eError.NewServiceError(errors.New("message is empty"), "validation_error", "message", http.StatusBadRequest)
+	}
+	return signRequest, nil
 }
 
 func decodeDecryptRequest(ctx context.Context, request *http.Request) (interface{}, error) {
@@ -21,24 +121,17 @@ func decodeDecryptRequest(ctx context.Context, request *http.Request) (interface
 	var decryptRequest Request
 	err := decoder.Decode(&decryptRequest)
 	if err != nil {
-		slog.Error("decode decrypt request", "err", err)
+		slog.Warn("decode decrypt request", "err", err)
 		return nil, eError.NewServiceError(err, "decode decrypt request", "payload", http.StatusBadRequest)
 	}
 
 	if decryptRequest.Ciphertext == "" {
-		slog.Error("missing ciphertext")
+		slog.Warn("missing ciphertext")
 		return nil, eError.NewServiceError(errors.New("ciphertext is empty"), "validation_error", "ciphertext", http.StatusBadRequest)
 	}
 	slog.Info("ciphertext", "ciphertext", decryptRequest.Ciphertext)
 
-	if decryptRequest.Share == "" {
-		slog.Error("missing share")
-		return nil, eError.NewServiceError(errors.New("partial share is empty"), "validation_error", "share", http.StatusBadRequest)
-	}
-	slog.Info("ciphertext", "share", decryptRequest.Share)
-
 	return Decrypt{
 		Ciphertext: decryptRequest.Ciphertext,
-		Share:      decryptRequest.Share,
 	}, nil
 }
@@ -6,26 +6,58 @@ import (
 	"github.com/go-kit/kit/endpoint"
 	eError "github.com/mdshahjahanmiah/explore-go/error"
 	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/pkg/errors"
 	"net/http"
 )
 
-// CiphertextResponse is a response object for the generate ciphertext endpoint.
+// CiphertextResponse is a response object for the encrypt endpoint.
 type CiphertextResponse struct {
 	Ciphertext string `json:"ciphertext"`
 }
 
 // PartialDecryptResponse is a response object for the partial decryption endpoint.
 type PartialDecryptResponse struct {
-	PartialDecryption string `json:"partial_decryption"`
+	PartialDecryption string        `json:"partial_decryption"`
+	Proof             ProofResponse `json:"proof"`
+	ShareID           int           `json:"share_id"`
+	Epoch             int           `json:"epoch"`
 }
 
-func getCiphertextEndpoint(logger *logging.Logger, service Service) endpoint.Endpoint {
+// PartialIdentityKeyResponse is a response object for the partial identity key endpoint.
+type PartialIdentityKeyResponse struct {
+	PartialKey string        `json:"partial_key"`
+	Proof      ProofResponse `json:"proof"`
+	ShareID    int           `json:"share_id"`
+	Epoch      int           `json:"epoch"`
+}
+
+// PartialSignResponse is a response object for the partial sign endpoint.
+type PartialSignResponse struct {
+	PartialSignature string        `json:"partial_signature"`
+	Proof            ProofResponse `json:"proof"`
+	ShareID          int           `json:"share_id"`
+	Epoch            int           `json:"epoch"`
+}
+
+// ProofResponse is the base64-encoded Chaum-Pedersen proof attached to a partial decryption.
+type ProofResponse struct {
+	Challenge string `json:"challenge"`
+	Response  string `json:"response"`
+}
+
+func getEncryptEndpoint(logger *logging.Logger, service Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		encryptRequest := request.(EncryptRequest)
 
-		ciphertext := service.GetCiphertext()
-		if ciphertext == "" {
-			logger.Error("fail to generate ciphertext")
-			return nil, eError.NewServiceError(err, "fail to generate ciphertext", "ciphertext", http.StatusInternalServerError)
+		encrypt := service.Encrypt
+		if encryptRequest.Mode == ModeHybrid {
+			encrypt = service.EncryptHybrid
+		}
+
+		ciphertext, err := encrypt(encryptRequest.KeyID, encryptRequest.Plaintext)
+		if err != nil {
+			logger.Error("fail to encrypt plaintext", "err", err)
+			return nil, eError.NewServiceError(err, "fail to encrypt plaintext", "plaintext", http.StatusUnprocessableEntity)
 		}
 
 		return CiphertextResponse{
@@ -34,24 +66,103 @@ func getCiphertextEndpoint(logger *logging.Logger, service Service) endpoint.End
 	}
 }
 
+func getIdentityEncryptEndpoint(logger *logging.Logger, service Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		encryptRequest := request.(IdentityEncryptRequest)
+
+		ciphertext, err := service.EncryptIdentity(encryptRequest.KeyID, encryptRequest.Identity, encryptRequest.Plaintext)
+		if err != nil {
+			logger.Error("fail to encrypt plaintext to identity", "err", err)
+			return nil, eError.NewServiceError(err, "fail to encrypt plaintext", "plaintext", http.StatusUnprocessableEntity)
+		}
+
+		return CiphertextResponse{
+			Ciphertext: ciphertext,
+		}, nil
+	}
+}
+
+// getPartialIdentityKeyEndpoint serves the gateway only, a partial identity key from anyone else would bypass the identity policy
+func getPartialIdentityKeyEndpoint(logger *logging.Logger, service Service, gatewayToken string) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		partialRequest := request.(PartialIdentityKeyRequest)
+		if err := authenticateGateway(ctx, gatewayToken); err != nil {
+			logger.Warn("partial identity key refused", "err", err)
+			return nil, eError.NewServiceError(err, "unauthorized", "authorization", http.StatusUnauthorized)
+		}
+
+		result, err := service.PartialIdentityKey(partialRequest.KeyID, partialRequest.Version, partialRequest.Identity)
+		if err != nil {
+			logger.Error("partial identity key failed", "err", err)
+			return nil, eError.NewServiceError(err, "partial identity key could not be computed", "identity_request", http.StatusUnprocessableEntity)
+		}
+
+		return PartialIdentityKeyResponse{
+			PartialKey: base64.StdEncoding.EncodeToString(result.Element.Bytes()),
+			Proof: ProofResponse{
+				Challenge: base64.StdEncoding.EncodeToString(result.Proof.Challenge.Bytes()),
+				Response:  base64.StdEncoding.EncodeToString(result.Proof.Response.Bytes()),
+			},
+			ShareID: result.ShareID,
+			Epoch:   result.Epoch,
+		}, nil
+	}
+}
+
+// getPartialSignEndpoint serves the gateway only, otherwise anyone reaching t nodes could sign any message under the key
+func getPartialSignEndpoint(logger *logging.Logger, service Service, gatewayToken string) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		signRequest := request.(PartialSignRequest)
+		if err := authenticateGateway(ctx, gatewayToken); err != nil {
+			logger.Warn("partial signature refused", "err", err)
+			return nil, eError.NewServiceError(err, "unauthorized", "authorization", http.StatusUnauthorized)
+		}
+
+		result, err := service.PartialSign(signRequest.KeyID, signRequest.Version, signRequest.Message)
+		if err != nil {
+			logger.Error("partial signature failed", "err", err)
+			return nil, eError.NewServiceError(err, "message could not be signed", "sign_request", http.StatusUnprocessableEntity)
+		}
+
+		return PartialSignResponse{
+			PartialSignature: base64.StdEncoding.EncodeToString(result.Element.Bytes()),
+			Proof: ProofResponse{
+				Challenge: base64.StdEncoding.EncodeToString(result.Proof.Challenge.Bytes()),
+				Response:  base64.StdEncoding.EncodeToString(result.Proof.Response.Bytes()),
+			},
+			ShareID: result.ShareID,
+			Epoch:   result.Epoch,
+		}, nil
+	}
+}
+
 func getPartialDecryptEndpoint(logger *logging.Logger, service Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		decryptRequest := request.(Decrypt)
 
-		logger.Info("decrypt request", "ciphertext", decryptRequest.Ciphertext, "share", decryptRequest.Share)
+		logger.Info("decrypt request", "ciphertext", decryptRequest.Ciphertext)
 
-		result, err := service.PartialDecryption(decryptRequest.Ciphertext, decryptRequest.Share)
+		result, err := service.PartialDecryption(decryptRequest.Ciphertext)
+		if errors.Is(err, ErrInvalidCiphertext) {
+			return nil, eError.NewServiceError(err, "invalid_ciphertext", "ciphertext", http.StatusBadRequest)
+		}
 		if err != nil {
 			logger.Error("partial decryption failed", "err", err)
 			return nil, eError.NewServiceError(err, "provided data could not be decrypted", "decrypt_request", http.StatusUnprocessableEntity)
 		}
 
 		// Encode the result as a base64 string
-		partialDecryptionBytes := result.Bytes()
+		partialDecryptionBytes := result.Element.Bytes()
 		encodedPartialDecryption := base64.StdEncoding.EncodeToString(partialDecryptionBytes)
 
 		return PartialDecryptResponse{
 			PartialDecryption: encodedPartialDecryption,
+			Proof: ProofResponse{
+				Challenge: base64.StdEncoding.EncodeToString(result.Proof.Challenge.Bytes()),
+				Response:  base64.StdEncoding.EncodeToString(result.Proof.Response.Bytes()),
+			},
+			ShareID: result.ShareID,
+			Epoch:   result.Epoch,
 		}, nil
 	}
 }
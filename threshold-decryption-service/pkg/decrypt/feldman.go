@@ -0,0 +1,68 @@
+package decrypt
+
+import (
+	"fmt"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/client"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/group"
+)
+
+// verifyShare checks a share against the Feldman commitments C_k = g^{a_k} of the sharing polynomial:
+// g^{s_i} must equal prod_k C_k^{i^k}.
+func verifyShare(pairing group.Pairing, generator group.Element, commitments []group.Element, id int, share group.Element) bool {
+	expected := pairing.NewG2().Set1()
+	index := pairing.NewZr().SetInt32(int32(id))
+	power := pairing.NewZr().Set1()
+
+	for _, commitment := range commitments {
+		expected.ThenMul(pairing.NewG2().PowZn(commitment, power))
+		power.ThenMul(index)
+	}
+
+	return pairing.NewG2().PowZn(generator, share).Equals(expected)
+}
+
+// verifyLocalShare checks the share this node obtained from the distributed key generation
+// against the joint commitments published by the KMS.
+func (ds *decryptionService) verifyLocalShare() error {
+	commitments, err := ds.fetchCommitments(ds.Pairing, ds.keyID, 0, ds.publicKey)
+	if err != nil {
+		return err
+	}
+
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+	if !verifyShare(ds.Pairing, ds.generator, commitments, ds.config.NodeID, ds.localShare) {
+		return fmt.Errorf("local share %d is not consistent with the commitments", ds.config.NodeID)
+	}
+
+	ds.logger.Info("local key share verified against commitments", "share_id", ds.config.NodeID, "threshold", len(commitments))
+	return nil
+}
+
+// fetchCommitments fetches and decodes the Feldman commitments of a key version, version 0 is the latest,
+// and checks C_0 against the public key of that version
+func (ds *decryptionService) fetchCommitments(pairing group.Pairing, keyID string, version int, publicKey group.Element) ([]group.Element, error) {
+	encodedCommitments, err := client.FetchCommitments(ds.config.KmsHttpAddress, keyID, version)
+	if err != nil {
+		return nil, err
+	}
+	if len(encodedCommitments) < 1 {
+		return nil, fmt.Errorf("no commitments published by KMS")
+	}
+
+	commitments := make([]group.Element, len(encodedCommitments))
+	for k, encoded := range encodedCommitments {
+		commitment, err := decodeG2(pairing, encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decoding commitment %d: %w", k, err)
+		}
+		commitments[k] = commitment
+	}
+
+	// f(0) is the private key, so the constant term commitment must be the public key itself
+	if !commitments[0].Equals(publicKey) {
+		return nil, fmt.Errorf("commitments do not match the public key")
+	}
+
+	return commitments, nil
+}
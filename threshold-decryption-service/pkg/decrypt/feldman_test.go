@@ -0,0 +1,61 @@
+package decrypt
+
+import (
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/group"
+	"testing"
+)
+
+// dealShares plays the KMS: it shares a random secret with a polynomial of degree t - 1 and commits to the coefficients
+func dealShares(pairing group.Pairing, generator group.Element, threshold, n int) (map[int]group.Element, []group.Element) {
+	coefficients := make([]group.Element, threshold)
+	commitments := make([]group.Element, threshold)
+	for k := range coefficients {
+		coefficients[k] = pairing.NewZr().Rand()
+		commitments[k] = pairing.NewG2().PowZn(generator, coefficients[k])
+	}
+
+	shares := make(map[int]group.Element, n)
+	for id := 1; id <= n; id++ {
+		x := pairing.NewZr().SetInt32(int32(id))
+		share := pairing.NewZr().Set0()
+		for k := len(coefficients) - 1; k >= 0; k-- {
+			share.ThenMul(x).ThenAdd(coefficients[k])
+		}
+		shares[id] = share
+	}
+	return shares, commitments
+}
+
+func TestVerifyShare(t *testing.T) {
+	pairing := newTestPairing(t)
+	generator := pairing.NewG2().Rand()
+	shares, commitments := dealShares(pairing, generator, 3, 5)
+
+	for id, share := range shares {
+		if !verifyShare(pairing, generator, commitments, id, share) {
+			t.Errorf("share %d does not match the commitments", id)
+		}
+	}
+
+	_, otherCommitments := dealShares(pairing, generator, 3, 5)
+	tests := []struct {
+		name        string
+		commitments []group.Element
+		generator   group.Element
+		id          int
+		share       group.Element
+	}{
+		{name: "tampered share", commitments: commitments, generator: generator, id: 2, share: pairing.NewZr().Add(shares[2], pairing.NewZr().Set1())},
+		{name: "share of another id", commitments: commitments, generator: generator, id: 2, share: shares[3]},
+		{name: "id beyond the sharing", commitments: commitments, generator: generator, id: 6, share: shares[5]},
+		{name: "commitments of another sharing", commitments: otherCommitments, generator: generator, id: 1, share: shares[1]},
+		{name: "missing commitment", commitments: commitments[:2], generator: generator, id: 1, share: shares[1]},
+		{name: "other generator", commitments: commitments, generator: pairing.NewG2().Rand(), id: 1, share: shares[1]},
+	}
+
+	for _, test := range tests {
+		if verifyShare(pairing, test.generator, test.commitments, test.id, test.share) {
+			t.Errorf("%s passes the commitment check", test.name)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package decrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// MaxHybridPlaintextSize is the largest plaintext, in bytes, a hybrid ciphertext carries
+const MaxHybridPlaintextSize = 16 << 20
+
+// hybridCiphertextFormat is the leading byte of hybrid ciphertexts, a KEM header followed by an AES-256-GCM payload
+const hybridCiphertextFormat = 0x03
+
+// dataKeySize is the size of the AES-256 key the KEM header wraps
+const dataKeySize = 32
+
+// EncryptHybrid encrypts a plaintext of any size up to MaxHybridPlaintextSize. A random AES-256 data key encrypts the
+// plaintext with GCM, and the key itself is encrypted like any short plaintext under the latest version of the given key.
+// That KEM header is all the decryption nodes ever see. The layout is
+// format || len(KEM header) (uint16, big endian) || KEM header || nonce || AES-GCM ciphertext,
+// and the KEM header is authenticated as additional data so it cannot be swapped for another one.
+func (ds *decryptionService) EncryptHybrid(keyID, plaintext string) (string, error) {
+	if len(plaintext) == 0 {
+		return "", errors.New("plaintext is empty")
+	}
+	if len(plaintext) > MaxHybridPlaintextSize {
+		return "", fmt.Errorf("plaintext exceeds %d bytes", MaxHybridPlaintextSize)
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	kem, err := ds.encryptDirect(keyID, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newDataCipher(dataKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := make([]byte, 0, 1+2+len(kem)+len(nonce)+len(plaintext)+aead.Overhead())
+	ciphertext = append(ciphertext, hybridCiphertextFormat)
+	ciphertext = binary.BigEndian.AppendUint16(ciphertext, uint16(len(kem)))
+	ciphertext = append(ciphertext, kem...)
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = aead.Seal(ciphertext, nonce, []byte(plaintext), kem)
+
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// SplitHybrid returns the base64-encoded KEM header of a hybrid ciphertext. A client that keeps the payload to itself
+// has the gateway unwrap the header into the data key and opens the payload with OpenHybrid.
+func SplitHybrid(ciphertext string) (string, error) {
+	kem, _, _, err := openHybridEnvelope(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(kem), nil
+}
+
+// OpenHybrid decrypts the payload of a hybrid ciphertext with the data key unwrapped from its KEM header
+func OpenHybrid(ciphertext string, dataKey []byte) (string, error) {
+	kem, nonce, sealed, err := openHybridEnvelope(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newDataCipher(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := aead.Open(nil, nonce, sealed, kem)
+	if err != nil {
+		return "", errors.Wrap(ErrInvalidCiphertext, "hybrid payload does not authenticate under the data key")
+	}
+	return string(plaintext), nil
+}
+
+// openHybridEnvelope splits a hybrid ciphertext into the KEM header, the GCM nonce and the sealed payload
+func openHybridEnvelope(ciphertext string) ([]byte, []byte, []byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, nil, nil, errors.Wrapf(ErrInvalidCiphertext, "decoding ciphertext base64: %v", err)
+	}
+	if len(raw) < 3 || raw[0] != hybridCiphertextFormat {
+		return nil, nil, nil, errors.Wrap(ErrInvalidCiphertext, "not a hybrid ciphertext")
+	}
+
+	kemLength := int(binary.BigEndian.Uint16(raw[1:]))
+	nonceOffset := 3 + kemLength
+	if len(raw) < nonceOffset+12 {
+		return nil, nil, nil, errors.Wrap(ErrInvalidCiphertext, "hybrid ciphertext is too short for its KEM header and nonce")
+	}
+	return raw[3:nonceOffset], raw[nonceOffset : nonceOffset+12], raw[nonceOffset+12:], nil
+}
+
+// newDataCipher returns AES-256-GCM under the data key
+func newDataCipher(dataKey []byte) (cipher.AEAD, error) {
+	if len(dataKey) != dataKeySize {
+		return nil, fmt.Errorf("data key must be %d bytes", dataKeySize)
+	}
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,130 @@
+package decrypt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/client"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/group"
+	"github.com/pkg/errors"
+)
+
+// MaxIdentitySize is the longest identity, in bytes, a ciphertext can be encrypted to
+const MaxIdentitySize = 255
+
+// identityDomain separates the hash of identities from every other use of hashing into G1
+const identityDomain = "threshold-ibe:"
+
+// hashIdentity maps an identity string to its public point Q_id = H(id) in G1.
+// It must match the hash the gateway uses to check partial identity keys.
+func hashIdentity(pairing group.Pairing, identity string) group.Element {
+	return pairing.NewG1().SetFromStringHash(identityDomain+identity, sha256.New())
+}
+
+// EncryptIdentity encrypts the plaintext to an identity with Boneh-Franklin IBE under the latest version of the given key,
+// only the master public key pk = g^s and the pairing parameters are needed. With a random r the ciphertext is
+// U = g^r in G2 and V = plaintext XOR mask(e(Q_id, pk)^r). The private key of the identity, Q_id^s, opens it since
+// e(Q_id^s, U) = e(Q_id, pk)^r.
+func (ds *decryptionService) EncryptIdentity(keyID, identity, plaintext string) (string, error) {
+	if len(plaintext) == 0 {
+		return "", errors.New("plaintext is empty")
+	}
+	if len(plaintext) > MaxPlaintextSize {
+		return "", fmt.Errorf("plaintext exceeds %d bytes", MaxPlaintextSize)
+	}
+	if len(identity) == 0 || len(identity) > MaxIdentitySize {
+		return "", fmt.Errorf("identity must be between 1 and %d bytes", MaxIdentitySize)
+	}
+
+	publicKeyResponse, err := client.FetchPublicKey(ds.config.KmsHttpAddress, keyID)
+	if err != nil {
+		return "", errors.Wrap(err, "fetching public key")
+	}
+	params, err := ds.keyParams(publicKeyResponse.KeyID)
+	if err != nil {
+		return "", err
+	}
+	publicKey, err := decodeG2(params.pairing, publicKeyResponse.Key)
+	if err != nil {
+		return "", errors.Wrap(err, "decoding public key")
+	}
+
+	r := params.pairing.NewZr().Rand()
+	header := params.pairing.NewG2().PowZn(params.generator, r)
+	sharedKey := params.pairing.NewGT().Pair(hashIdentity(params.pairing, identity), publicKey)
+	sharedKey.ThenPowZn(r)
+
+	payload := xorBytes([]byte(plaintext), deriveMask(sharedKey, len(plaintext)))
+	ciphertext, err := sealIdentityEnvelope(publicKeyResponse.KeyID, publicKeyResponse.Version, identity, header.Bytes(), payload)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptIdentity opens an identity ciphertext with the private key of its identity, as combined by the gateway.
+// It needs no key share, so it is meant for the holder of the identity key and has no endpoint of its own.
+func (ds *decryptionService) DecryptIdentity(ciphertext, identityKey string) (string, error) {
+	ciphertextBytes, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", errors.Wrapf(ErrInvalidCiphertext, "decoding ciphertext base64: %v", err)
+	}
+	sealed, err := openIdentityEnvelope(ciphertextBytes)
+	if err != nil {
+		return "", err
+	}
+	params, err := ds.keyParams(sealed.KeyID)
+	if err != nil {
+		return "", err
+	}
+
+	headerLength := int(params.pairing.G2Length())
+	if len(sealed.Body) <= headerLength {
+		return "", errors.Wrapf(ErrInvalidCiphertext, "ciphertext is too short, expected more than %d bytes", headerLength)
+	}
+	header := params.pairing.NewG2().SetBytes(sealed.Body[:headerLength])
+	if header.Is0() {
+		return "", errors.Wrap(ErrInvalidCiphertext, "ciphertext header is zero")
+	}
+
+	keyBytes, err := base64.StdEncoding.DecodeString(identityKey)
+	if err != nil {
+		return "", errors.Wrap(err, "decoding identity key")
+	}
+	privateKey := params.pairing.NewG1().SetBytes(keyBytes)
+
+	payload := sealed.Body[headerLength:]
+	sharedKey := params.pairing.NewGT().Pair(privateKey, header)
+	return string(xorBytes(payload, deriveMask(sharedKey, len(payload)))), nil
+}
+
+// PartialIdentityKey computes this node's part Q_id^{s_i} of the private key of an identity under the given key
+// version, version 0 being the latest, with the node's own share of it. The same Chaum-Pedersen proof as
+// for partial decryptions ties it to the verification key g^{s_i}, Q_id simply takes the place of the header U.
+func (ds *decryptionService) PartialIdentityKey(keyID string, version int, identity string) (Partial, error) {
+	if len(identity) == 0 || len(identity) > MaxIdentitySize {
+		return Partial{}, fmt.Errorf("identity must be between 1 and %d bytes", MaxIdentitySize)
+	}
+	if keyID == "" {
+		keyID = ds.keyID
+	}
+
+	params, err := ds.keyParams(keyID)
+	if err != nil {
+		return Partial{}, err
+	}
+	shareElement, epoch, err := ds.share(keyID, version)
+	if err != nil {
+		return Partial{}, err
+	}
+
+	point := hashIdentity(params.pairing, identity)
+	part := params.pairing.NewG1().PowZn(point, shareElement)
+
+	verificationKey := params.pairing.NewG2().PowZn(params.generator, shareElement)
+	proof := proveEqualDiscreteLog(params.pairing, point, part, params.generator, verificationKey, shareElement)
+
+	ds.logger.Debug("partial identity key computed", "key_id", keyID, "identity", identity)
+	return Partial{Element: part, Proof: proof, ShareID: ds.config.NodeID, Epoch: epoch}, nil
+}
@@ -0,0 +1,42 @@
+package decrypt
+
+import (
+	"crypto/sha256"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/group"
+)
+
+// Proof is a non-interactive Chaum-Pedersen proof that log_U(U^{s_i}) = log_g(g^{s_i}),
+// i.e. the partial decryption was computed with the same share the verification key commits to.
+type Proof struct {
+	Challenge group.Element
+	Response  group.Element
+}
+
+// challengeHash hashes the given group elements, in order, into a Zr challenge (Fiat-Shamir).
+func challengeHash(pairing group.Pairing, elements ...group.Element) group.Element {
+	hash := sha256.New()
+	for _, element := range elements {
+		hash.Write(element.Bytes())
+	}
+	return pairing.NewZr().SetFromHash(hash.Sum(nil))
+}
+
+// proveEqualDiscreteLog proves that partial = header^share and verificationKey = generator^share
+// without revealing the share. header and partial live in G1, generator and verificationKey in G2.
+func proveEqualDiscreteLog(pairing group.Pairing, header, partial, generator, verificationKey, share group.Element) Proof {
+	// Commit to a random nonce in both groups
+	nonce := pairing.NewZr().Rand()
+	commitmentG1 := pairing.NewG1().PowZn(header, nonce)
+	commitmentG2 := pairing.NewG2().PowZn(generator, nonce)
+
+	challenge := challengeHash(pairing, header, partial, generator, verificationKey, commitmentG1, commitmentG2)
+
+	// response = nonce + challenge * share
+	response := pairing.NewZr().Mul(challenge, share)
+	response.ThenAdd(nonce)
+
+	return Proof{
+		Challenge: challenge,
+		Response:  response,
+	}
+}
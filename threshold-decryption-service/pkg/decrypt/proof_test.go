@@ -0,0 +1,63 @@
+package decrypt
+
+import (
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/group"
+	"testing"
+)
+
+func newTestPairing(t *testing.T) group.Pairing {
+	t.Helper()
+	pairing, err := group.NewPairing(group.BLS12381Params())
+	if err != nil {
+		t.Fatalf("NewPairing: %v", err)
+	}
+	return pairing
+}
+
+// checkProof recomputes the commitments U^z / W^c and g^z / VK^c the way the gateway does and checks the challenge
+func checkProof(pairing group.Pairing, header, partial, generator, verificationKey group.Element, proof Proof) bool {
+	commitmentG1 := pairing.NewG1().PowZn(header, proof.Response)
+	commitmentG1.ThenDiv(pairing.NewG1().PowZn(partial, proof.Challenge))
+
+	commitmentG2 := pairing.NewG2().PowZn(generator, proof.Response)
+	commitmentG2.ThenDiv(pairing.NewG2().PowZn(verificationKey, proof.Challenge))
+
+	return challengeHash(pairing, header, partial, generator, verificationKey, commitmentG1, commitmentG2).Equals(proof.Challenge)
+}
+
+func TestProveEqualDiscreteLog(t *testing.T) {
+	pairing := newTestPairing(t)
+	generator := pairing.NewG2().Rand()
+	header := pairing.NewG1().Rand()
+	share := pairing.NewZr().Rand()
+	otherShare := pairing.NewZr().Rand()
+
+	partial := pairing.NewG1().PowZn(header, share)
+	verificationKey := pairing.NewG2().PowZn(generator, share)
+	proof := proveEqualDiscreteLog(pairing, header, partial, generator, verificationKey, share)
+
+	tests := []struct {
+		name            string
+		partial         group.Element
+		verificationKey group.Element
+		proof           Proof
+		valid           bool
+	}{
+		{name: "valid proof", partial: partial, verificationKey: verificationKey, proof: proof, valid: true},
+		{name: "tampered challenge", partial: partial, verificationKey: verificationKey,
+			proof: Proof{Challenge: pairing.NewZr().Add(proof.Challenge, pairing.NewZr().Set1()), Response: proof.Response}},
+		{name: "tampered response", partial: partial, verificationKey: verificationKey,
+			proof: Proof{Challenge: proof.Challenge, Response: pairing.NewZr().Add(proof.Response, pairing.NewZr().Set1())}},
+		{name: "partial of another share", partial: pairing.NewG1().PowZn(header, otherShare), verificationKey: verificationKey, proof: proof},
+		{name: "verification key of another share", partial: partial, verificationKey: pairing.NewG2().PowZn(generator, otherShare), proof: proof},
+		// A proof made with the wrong share for a partial of that wrong share does not match the published verification key
+		{name: "proof with another share", partial: pairing.NewG1().PowZn(header, otherShare), verificationKey: verificationKey,
+			proof: proveEqualDiscreteLog(pairing, header, pairing.NewG1().PowZn(header, otherShare), generator, verificationKey, otherShare)},
+	}
+
+	for _, test := range tests {
+		if valid := checkProof(pairing, header, test.partial, generator, test.verificationKey, test.proof); valid != test.valid {
+			t.Errorf("%s: proof valid = %v, want %v", test.name, valid, test.valid)
+		}
+	}
+}
@@ -3,161 +3,482 @@ package decrypt
 import (
 	"encoding/base64"
 	"fmt"
-	"github.com/Nik-U/pbc"
 	"github.com/mdshahjahanmiah/explore-go/logging"
 	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/client"
 	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/config"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/dkg"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/group"
 	"github.com/pkg/errors"
 	"log/slog"
 	"math/big"
+	"os"
+	"sync"
+	"time"
 )
 
 type Decrypt struct {
 	Ciphertext string
-	Share      string
+}
+
+// Partial is a partial decryption together with its proof, the id of the node's share behind it and the refresh epoch
+// of that share
+type Partial struct {
+	Element group.Element
+	Proof   Proof
+	ShareID int
+	Epoch   int
 }
 
 type Service interface {
-	GetCiphertext() string
-	PartialDecryption(ciphertext string, share string) (*pbc.Element, error)
-	PairingParams() *pbc.Pairing
+	Encrypt(keyID, plaintext string) (string, error)
+	EncryptHybrid(keyID, plaintext string) (string, error)
+	PartialDecryption(ciphertext string) (Partial, error)
+	EncryptIdentity(keyID, identity, plaintext string) (string, error)
+	DecryptIdentity(ciphertext, identityKey string) (string, error)
+	PartialIdentityKey(keyID string, version int, identity string) (Partial, error)
+	PartialSign(keyID string, version int, message string) (Partial, error)
+	PairingParams() group.Pairing
+}
+
+// keyParams is the pairing and the generator of a key of the KMS keyring, each key has its own
+type keyParams struct {
+	pairing   group.Pairing
+	generator group.Element
 }
 
 type decryptionService struct {
-	config  config.Config
-	logger  *logging.Logger
-	Pairing *pbc.Pairing
+	config    config.Config
+	logger    *logging.Logger
+	Pairing   group.Pairing
+	keyID     string
+	publicKey group.Element
+	generator group.Element
+
+	// keys caches the pairing and generator of every key this node has seen, the default key included
+	keysMutex sync.Mutex
+	keys      map[string]keyParams
+
+	// shares caches the dealt share of this node in every key version it has decrypted under, see share
+	sharesMutex sync.Mutex
+	shares      map[shareKey]nodeShare
+
+	// localShare is the share this node obtained from the distributed key generation, nil in dealer mode.
+	// It is replaced on every refresh, localEpoch is the epoch it belongs to.
+	mutex      sync.RWMutex
+	localShare group.Element
+	localEpoch int
 }
 
 // NewDecryptionService creates a new decryption service with the given configuration and logger.
 func NewDecryptionService(config config.Config, logger *logging.Logger) (Service, error) {
-	encodedParams, err := client.FetchPairingParams(config.KmsHttpAddress)
+	// The pairing, the public key and the node's own share belong to the default key of the KMS
+	params, err := loadPairingParams(config, logger)
 	if err != nil {
-		logger.Error("failed to fetch pairing parameters from KMS", "error", err)
 		return nil, err
 	}
 
-	params, err := DecodePairingParams(encodedParams)
+	pairing, err := group.NewPairing(params)
 	if err != nil {
-		logger.Error("failed to decode pairing parameters", "error", err)
+		logger.Error("failed to create pairing", "error", err)
+		return nil, errors.Wrap(err, "creating pairing")
+	}
+
+	// In DKG mode the public key only exists once the nodes have generated it together
+	var localShare group.Element
+	var localEpoch int
+	if config.DkgEnabled {
+		localShare, localEpoch, err = dkg.NewParticipant(config, pairing, logger).Join()
+		if err != nil {
+			logger.Error("failed to run distributed key generation", "error", err)
+			return nil, err
+		}
+	}
+
+	publicKeyResponse, err := client.FetchPublicKey(config.KmsHttpAddress, "")
+	if err != nil {
+		logger.Error("failed to fetch public key from KMS", "error", err)
+		return nil, err
+	}
+
+	publicKey, err := decodeG2(pairing, publicKeyResponse.Key)
+	if err != nil {
+		logger.Error("failed to decode public key", "error", err)
+		return nil, err
+	}
+
+	generator, err := decodeG2(pairing, publicKeyResponse.Generator)
+	if err != nil {
+		logger.Error("failed to decode generator", "error", err)
 		return nil, err
 	}
 
-	pairing := params.NewPairing()
-	if pairing == nil {
-		logger.Error("failed to create pairing")
-		return nil, errors.New("failed to create pairing")
+	service := &decryptionService{
+		config:     config,
+		logger:     logger,
+		Pairing:    pairing,
+		keyID:      publicKeyResponse.KeyID,
+		publicKey:  publicKey,
+		generator:  generator,
+		localShare: localShare,
+		localEpoch: localEpoch,
+		keys: map[string]keyParams{
+			publicKeyResponse.KeyID: {pairing: pairing, generator: generator},
+		},
+		shares: make(map[shareKey]nodeShare),
+	}
+
+	// Refuse to serve with a share that does not match the KMS commitments. A dealt share is received once, from the
+	// share file or else from the KMS, and kept by this node, the gateway never sees it.
+	if localShare != nil {
+		err = service.verifyLocalShare()
+	} else if !config.DkgEnabled {
+		if config.ShareFile != "" {
+			err = service.loadShareFile(config.ShareFile)
+		}
+		if err == nil {
+			_, _, err = service.share(service.keyID, 0)
+		}
+	}
+	if err != nil {
+		logger.Error("failed to load key share", "error", err)
+		return nil, err
+	}
+
+	// A node with its own share follows the refresh and reshare sessions opened by the KMS
+	if localShare != nil {
+		go service.watchSessions()
+	}
+
+	return service, nil
+}
+
+// Encrypt encrypts the plaintext under the latest version of the given key, or of the default key if the key id is empty,
+// and returns the base64-encoded ciphertext. The ciphertext carries the key id and version followed by U || W || V where
+// U = h^r for a random r, V is the plaintext masked with a keystream derived from e(U, pk) and W is the validity tag
+// binding U to V. Since e(U, pk) = e(U^s, g), the holders of the key shares of that version can jointly recompute the
+// mask from U alone without anyone learning the private key s, and they only do so for ciphertexts whose tag checks out.
+func (ds *decryptionService) Encrypt(keyID, plaintext string) (string, error) {
+	if len(plaintext) == 0 {
+		return "", errors.New("plaintext is empty")
+	}
+	if len(plaintext) > MaxPlaintextSize {
+		return "", fmt.Errorf("plaintext exceeds %d bytes", MaxPlaintextSize)
+	}
+
+	ciphertext, err := ds.encryptDirect(keyID, []byte(plaintext))
+	if err != nil {
+		return "", err
 	}
 
-	return &decryptionService{
-		config:  config,
-		logger:  logger,
-		Pairing: pairing,
-	}, nil
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// GetCiphertext generates a random ciphertext and returns it as a base64-encoded string.
-func (ds *decryptionService) GetCiphertext() string {
-	// Generate a random G1 element for the ciphertext
-	ciphertextElement := ds.Pairing.NewG1().Rand()
-	ciphertextBytes := ciphertextElement.Bytes()
-	ciphertext := base64.StdEncoding.EncodeToString(ciphertextBytes)
+// encryptDirect masks the plaintext with e(U, pk) for a random U under the latest version of the key and returns the
+// raw ciphertext laid out by sealEnvelope. It is the whole ciphertext in direct mode and the KEM header in hybrid mode.
+func (ds *decryptionService) encryptDirect(keyID string, plaintext []byte) ([]byte, error) {
+	// The key may have been rotated since it was last used, always encrypt under the latest version
+	publicKeyResponse, err := client.FetchPublicKey(ds.config.KmsHttpAddress, keyID)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching public key")
+	}
+	params, err := ds.keyParams(publicKeyResponse.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := decodeG2(params.pairing, publicKeyResponse.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding public key")
+	}
+
+	// The header is U = h^r for a random r, which also goes into the validity tag
+	r := params.pairing.NewZr().Rand()
+	header := params.pairing.NewG1().PowZn(ccaBase(params.pairing), r)
+
+	// Derive the shared secret by pairing the header with the public key
+	sharedKey := params.pairing.NewGT().Pair(header, publicKey)
+
+	payload := xorBytes(plaintext, deriveMask(sharedKey, len(plaintext)))
 
-	return ciphertext
+	// W = H(key id, version, U, V)^r proves that whoever built U also built V
+	point := validityPoint(params.pairing, publicKeyResponse.KeyID, publicKeyResponse.Version, header.Bytes(), payload)
+	tag := params.pairing.NewG2().PowZn(point, r)
+
+	return sealEnvelope(publicKeyResponse.KeyID, publicKeyResponse.Version, header.Bytes(), tag.Bytes(), payload)
 }
 
-// PartialDecryption performs a partial decryption of the given ciphertext using the given share.
-func (ds *decryptionService) PartialDecryption(ciphertext string, share string) (*pbc.Element, error) {
+// PartialDecryption performs a partial decryption of the given ciphertext with this node's share of the key version
+// the ciphertext was encrypted under.
+// Along with the partial it returns a proof that it was computed with the share behind the verification key g^{s_i}.
+func (ds *decryptionService) PartialDecryption(ciphertext string) (Partial, error) {
 	ds.logger.Debug("starting partial decryption")
 
-	// Decode a PBC element from the base64-encoded ciphertext
-	pbcElement, err := ds.decodeCipherText(ciphertext)
+	// Decode a PBC element from the base64-encoded ciphertext, in the pairing of the key it was encrypted under
+	keyID, version, pbcElement, err := ds.decodeCipherText(ciphertext)
 	if err != nil {
-		ds.logger.Error("generating ciphertext", "err", err)
-		return nil, err
+		if errors.Is(err, ErrInvalidCiphertext) {
+			ds.logger.Warn("refusing to decrypt invalid ciphertext", "err", err)
+		} else {
+			ds.logger.Error("generating ciphertext", "err", err)
+		}
+		return Partial{}, err
 	}
 
-	ds.logger.Debug("ciphertext element generated", "element", pbcElement.String())
+	ds.logger.Debug("ciphertext element generated", "key_id", keyID, "element", pbcElement.String())
 
-	// Decode a PBC element from the base64-encoded share
-	shareElement, err := ds.decodeShare(share)
+	params, err := ds.keyParams(keyID)
 	if err != nil {
-		ds.logger.Error("generating share", "err", err)
-		return nil, err
+		return Partial{}, err
 	}
 
-	ds.logger.Debug("share element generated", "element", shareElement.String())
+	shareElement, epoch, err := ds.share(keyID, version)
+	if err != nil {
+		ds.logger.Error("loading share", "err", err)
+		return Partial{}, err
+	}
 
 	// Perform the partial decryption
-	part := ds.Pairing.NewG1().PowZn(pbcElement, shareElement)
+	part := params.pairing.NewG1().PowZn(pbcElement, shareElement)
 	ds.logger.Debug("partial decryption result", "result", part.String())
 
-	return part, nil
+	// Prove that the partial and the verification key share the same exponent
+	verificationKey := params.pairing.NewG2().PowZn(params.generator, shareElement)
+	proof := proveEqualDiscreteLog(params.pairing, pbcElement, part, params.generator, verificationKey, shareElement)
+
+	return Partial{Element: part, Proof: proof, ShareID: ds.config.NodeID, Epoch: epoch}, nil
 }
 
 // PairingParams returns the pairing parameters used by the decryption service.
-func (ds *decryptionService) PairingParams() *pbc.Pairing {
+func (ds *decryptionService) PairingParams() group.Pairing {
 	return ds.Pairing
 }
 
-// decodeShare decodes a base64-encoded share and generates a PBC element.
-func (ds *decryptionService) decodeShare(share string) (*pbc.Element, error) {
+// keyParams returns the pairing and generator of a key, fetching them from the KMS the first time the key is used
+func (ds *decryptionService) keyParams(keyID string) (keyParams, error) {
+	ds.keysMutex.Lock()
+	defer ds.keysMutex.Unlock()
+
+	if params, ok := ds.keys[keyID]; ok {
+		return params, nil
+	}
+
+	encodedParams, err := client.FetchPairingParams(ds.config.KmsHttpAddress, keyID)
+	if err != nil {
+		return keyParams{}, errors.Wrapf(err, "fetching pairing parameters of key %s", keyID)
+	}
+	pairingParams, err := DecodePairingParams(encodedParams)
+	if err != nil {
+		return keyParams{}, errors.Wrapf(err, "decoding pairing parameters of key %s", keyID)
+	}
+	pairing, err := group.NewPairing(pairingParams)
+	if err != nil {
+		return keyParams{}, errors.Wrapf(err, "creating pairing of key %s", keyID)
+	}
+
+	publicKeyResponse, err := client.FetchPublicKey(ds.config.KmsHttpAddress, keyID)
+	if err != nil {
+		return keyParams{}, errors.Wrapf(err, "fetching public key of key %s", keyID)
+	}
+	generator, err := decodeG2(pairing, publicKeyResponse.Generator)
+	if err != nil {
+		return keyParams{}, errors.Wrapf(err, "decoding generator of key %s", keyID)
+	}
+
+	params := keyParams{pairing: pairing, generator: generator}
+	ds.keys[keyID] = params
+	return params, nil
+}
+
+// watchSessions polls the KMS for refresh and reshare sessions newer than the local share and takes part in them.
+// The new share replaces the old one only once it has been checked against the updated commitments.
+func (ds *decryptionService) watchSessions() {
+	participant := dkg.NewParticipant(ds.config, ds.Pairing, ds.logger)
+	for {
+		time.Sleep(ds.config.DkgPollInterval)
+
+		state, err := client.FetchDkgState(ds.config.KmsHttpAddress)
+		if err != nil {
+			ds.logger.Debug("failed to fetch dkg state", "err", err)
+			continue
+		}
+
+		ds.mutex.RLock()
+		share, epoch := ds.localShare, ds.localEpoch
+		ds.mutex.RUnlock()
+
+		if state.Epoch <= epoch || state.Phase != dkg.PhaseRegistering {
+			continue
+		}
+
+		var updated group.Element
+		switch {
+		case state.Kind == dkg.KindRefresh && share != nil:
+			updated, err = participant.Refresh(share, state.Epoch)
+		case state.Kind == dkg.KindReshare && (share != nil || ds.config.NodeID <= state.TotalShares):
+			updated, err = participant.Reshare(share, state.Epoch)
+		default:
+			continue
+		}
+		if err != nil {
+			ds.logger.Error("failed to take part in dkg session", "kind", state.Kind, "epoch", state.Epoch, "err", err)
+			continue
+		}
+
+		if updated != nil {
+			commitments, err := ds.fetchCommitments(ds.Pairing, ds.keyID, 0, ds.publicKey)
+			if err != nil {
+				ds.logger.Error("failed to fetch updated commitments", "epoch", state.Epoch, "err", err)
+				continue
+			}
+			if !verifyShare(ds.Pairing, ds.generator, commitments, ds.config.NodeID, updated) {
+				ds.logger.Error("updated share is not consistent with the commitments", "epoch", state.Epoch)
+				continue
+			}
+		}
+
+		ds.mutex.Lock()
+		ds.localShare, ds.localEpoch = updated, state.Epoch
+		ds.mutex.Unlock()
+		ds.logger.Info("key share updated", "kind", state.Kind, "share_id", ds.config.NodeID, "epoch", state.Epoch, "holds_share", updated != nil)
+	}
+}
+
+// decodeShare decodes a base64-encoded share and generates a PBC element of the given pairing.
+func (ds *decryptionService) decodeShare(pairing group.Pairing, share string) (group.Element, error) {
 	shareBytes, err := base64.StdEncoding.DecodeString(share)
 	if err != nil {
 		slog.Error("decoding share base64", "err", err)
 		return nil, err
 	}
 
-	// Log the decoded bytes
-	ds.logger.Debug("decoded share bytes", "bytes", shareBytes)
-
 	shareInt := new(big.Int).SetBytes(shareBytes)
-	shareElement := ds.Pairing.NewZr().SetBig(shareInt)
+	shareElement := pairing.NewZr().SetBig(shareInt)
 
 	if shareElement.Is0() {
 		ds.logger.Error("share element is zero after SetBig")
 		return nil, fmt.Errorf("share element is zero after SetBig")
 	}
 
-	ds.logger.Debug("share element generated", "element", shareElement.String())
-
 	return shareElement, nil
 }
 
-// decodeCipherText decodes a base64-encoded ciphertext and generates a PBC element and pairing.
-func (ds *decryptionService) decodeCipherText(ciphertext string) (*pbc.Element, error) {
+// decodeCipherText decodes a base64-encoded ciphertext and returns the key and version it was encrypted under and its
+// G1 header as a PBC element of that key's pairing. Only the header takes part in partial decryption, the masked payload
+// is left to the combiner, and the key version selects the share of this node to decrypt with.
+// The validity tag is checked here, before any share touches the header, and a ciphertext without a tag is only
+// accepted when legacy ciphertexts are enabled.
+func (ds *decryptionService) decodeCipherText(ciphertext string) (string, int, group.Element, error) {
 	ciphertextBytes, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
-		ds.logger.Error("Error decoding ciphertext base64:", "err", err)
-		return nil, err
+		// A malformed ciphertext is the client's error, the caller logs it as such
+		return "", 0, nil, errors.Wrapf(ErrInvalidCiphertext, "decoding ciphertext base64: %v", err)
 	}
 
 	// Log the decoded bytes
 	ds.logger.Debug("decoded ciphertext bytes", "bytes", ciphertextBytes)
 
-	// Create a new G1 element from the decoded ciphertext bytes
-	ciphertextElement := ds.Pairing.NewG1().SetBytes(ciphertextBytes)
+	sealed, err := openEnvelope(ciphertextBytes)
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	params, err := ds.keyParams(sealed.KeyID)
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	headerBytes, tagBytes, payload, err := splitCiphertext(params.pairing, sealed)
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	// Create a new G1 element from the ciphertext header bytes
+	ciphertextElement := params.pairing.NewG1().SetBytes(headerBytes)
 
 	if ciphertextElement.Is0() {
-		ds.logger.Error("ciphertext element is zero after SetBytes")
-		return nil, fmt.Errorf("ciphertext element is zero after SetBytes")
+		ds.logger.Debug("ciphertext element is zero after SetBytes")
+		return "", 0, nil, errors.Wrap(ErrInvalidCiphertext, "ciphertext header is the identity element")
+	}
+
+	if sealed.Format == legacyCiphertextFormat {
+		if !ds.config.LegacyCiphertexts {
+			return "", 0, nil, errors.Wrap(ErrInvalidCiphertext, "ciphertext has no validity tag")
+		}
+	} else if err := checkValidity(params.pairing, sealed, ciphertextElement, tagBytes, payload); err != nil {
+		return "", 0, nil, err
 	}
 
 	ds.logger.Debug("ciphertext element generated", "element", ciphertextElement.String())
 
-	return ciphertextElement, nil
+	return sealed.KeyID, sealed.Version, ciphertextElement, nil
 }
 
-// DecodePairingParams decodes the base64-encoded pairing parameters
-func DecodePairingParams(encodedParams string) (*pbc.Params, error) {
-	paramsBytes, err := base64.StdEncoding.DecodeString(encodedParams)
+// decodeG2 decodes a base64-encoded G2 element such as the public key or the generator.
+func decodeG2(pairing group.Pairing, encoded string) (group.Element, error) {
+	elementBytes, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return nil, err
 	}
 
-	params, err := pbc.NewParamsFromString(string(paramsBytes))
+	element := pairing.NewG2().SetBytes(elementBytes)
+	if element.Is0() {
+		return nil, errors.New("G2 element is zero after SetBytes")
+	}
+
+	return element, nil
+}
+
+// loadPairingParams loads the pairing parameters of the default key from the local file if one is configured,
+// and from the KMS otherwise
+func loadPairingParams(config config.Config, logger *logging.Logger) (string, error) {
+	if config.PairingParamsFile != "" {
+		params, err := LoadPairingParams(config.PairingParamsFile)
+		if err != nil {
+			logger.Error("failed to load pairing parameters from file", "path", config.PairingParamsFile, "error", err)
+			return "", err
+		}
+		logger.Info("pairing parameters loaded from file", "path", config.PairingParamsFile)
+		return params, nil
+	}
+
+	encodedParams, err := client.FetchPairingParams(config.KmsHttpAddress, "")
 	if err != nil {
-		return nil, err
+		logger.Error("failed to fetch pairing parameters from KMS", "error", err)
+		return "", err
+	}
+
+	params, err := DecodePairingParams(encodedParams)
+	if err != nil {
+		logger.Error("failed to decode pairing parameters", "error", err)
+		return "", err
+	}
+	return params, nil
+}
+
+// LoadPairingParams reads plain pairing parameters from a file
+func LoadPairingParams(path string) (string, error) {
+	paramsBytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	params := string(paramsBytes)
+	if _, err := group.ParamsType(params); err != nil {
+		return "", errors.Wrapf(err, "parsing pairing parameters in %s", path)
+	}
+
+	return params, nil
+}
+
+// DecodePairingParams decodes the base64-encoded pairing parameters
+func DecodePairingParams(encodedParams string) (string, error) {
+	paramsBytes, err := base64.StdEncoding.DecodeString(encodedParams)
+	if err != nil {
+		return "", err
+	}
+
+	params := string(paramsBytes)
+	if _, err := group.ParamsType(params); err != nil {
+		return "", err
 	}
 
 	return params, nil
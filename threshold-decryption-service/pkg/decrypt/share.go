@@ -0,0 +1,144 @@
+package decrypt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/client"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/group"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// shareKey identifies a version of a key of the KMS keyring
+type shareKey struct {
+	keyID   string
+	version int
+}
+
+// nodeShare is this node's share of one key version and the refresh epoch it belongs to
+type nodeShare struct {
+	element group.Element
+	epoch   int
+}
+
+// shareFile is the share of one decryption node as written by the KMS keygen command
+type shareFile struct {
+	KeyID   string `json:"key_id"`
+	ID      int    `json:"id"`
+	Share   string `json:"share"`
+	Version int    `json:"version"`
+	Epoch   int    `json:"epoch"`
+}
+
+// share returns this node's share of a key version, version 0 being the latest, with the epoch it belongs to.
+// A node taking part in the distributed key generation holds the share of the default key itself. Dealt shares are
+// fetched from the KMS the first time a key version is used, checked against its commitments and kept until the KMS
+// reports a new epoch for the version, i.e. until a refresh or reshare replaced them. Requests never carry a share.
+func (ds *decryptionService) share(keyID string, version int) (group.Element, int, error) {
+	if keyID == "" {
+		keyID = ds.keyID
+	}
+
+	if ds.config.DkgEnabled && keyID == ds.keyID {
+		ds.mutex.RLock()
+		defer ds.mutex.RUnlock()
+		if ds.localShare == nil {
+			return nil, 0, fmt.Errorf("node %d holds no share of key %q", ds.config.NodeID, keyID)
+		}
+		return ds.localShare, ds.localEpoch, nil
+	}
+
+	publicKeyResponse, err := client.FetchPublicKeyVersion(ds.config.KmsHttpAddress, keyID, version)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "fetching public key of %s version %d", keyID, version)
+	}
+
+	ds.sharesMutex.Lock()
+	defer ds.sharesMutex.Unlock()
+
+	cacheKey := shareKey{keyID: publicKeyResponse.KeyID, version: publicKeyResponse.Version}
+	if cached, ok := ds.shares[cacheKey]; ok && cached.epoch == publicKeyResponse.Epoch {
+		return cached.element, cached.epoch, nil
+	}
+
+	keyShare, err := client.FetchKeyShare(ds.config.KmsHttpAddress, publicKeyResponse.KeyID, publicKeyResponse.Version, ds.config.NodeID, ds.config.NodeToken)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "fetching share of %s version %d", publicKeyResponse.KeyID, publicKeyResponse.Version)
+	}
+	if keyShare.ID != ds.config.NodeID || keyShare.Version != publicKeyResponse.Version || keyShare.Epoch != publicKeyResponse.Epoch {
+		return nil, 0, fmt.Errorf("KMS returned share %d of version %d epoch %d, expected share %d of version %d epoch %d", keyShare.ID, keyShare.Version, keyShare.Epoch, ds.config.NodeID, publicKeyResponse.Version, publicKeyResponse.Epoch)
+	}
+
+	element, err := ds.verifiedShare(publicKeyResponse.KeyID, publicKeyResponse.Version, keyShare.Share)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ds.shares[cacheKey] = nodeShare{element: element, epoch: keyShare.Epoch}
+	ds.logger.Info("key share loaded from KMS", "key_id", publicKeyResponse.KeyID, "version", publicKeyResponse.Version, "share_id", ds.config.NodeID, "epoch", keyShare.Epoch)
+	return element, keyShare.Epoch, nil
+}
+
+// loadShareFile reads this node's share from a file written by the KMS keygen command, so the node needs no share
+// from the KMS for that key version. The file must hold the share of this node and match the KMS commitments.
+func (ds *decryptionService) loadShareFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file shareFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return errors.Wrapf(err, "parsing share file %s", path)
+	}
+	if file.ID != ds.config.NodeID {
+		return fmt.Errorf("share file %s holds share %d, this is node %d", path, file.ID, ds.config.NodeID)
+	}
+	if file.KeyID == "" || file.Version < 1 {
+		return fmt.Errorf("share file %s does not name its key and version", path)
+	}
+
+	element, err := ds.verifiedShare(file.KeyID, file.Version, file.Share)
+	if err != nil {
+		return errors.Wrapf(err, "share file %s", path)
+	}
+
+	ds.sharesMutex.Lock()
+	ds.shares[shareKey{keyID: file.KeyID, version: file.Version}] = nodeShare{element: element, epoch: file.Epoch}
+	ds.sharesMutex.Unlock()
+
+	ds.logger.Info("key share loaded from file", "path", path, "key_id", file.KeyID, "version", file.Version, "share_id", file.ID, "epoch", file.Epoch)
+	return nil
+}
+
+// verifiedShare decodes a share of this node in a key version and checks it against the commitments of that version
+func (ds *decryptionService) verifiedShare(keyID string, version int, share string) (group.Element, error) {
+	params, err := ds.keyParams(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	element, err := ds.decodeShare(params.pairing, share)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding share")
+	}
+
+	publicKeyResponse, err := client.FetchPublicKeyVersion(ds.config.KmsHttpAddress, keyID, version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching public key of %s version %d", keyID, version)
+	}
+	publicKey, err := decodeG2(params.pairing, publicKeyResponse.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding public key")
+	}
+
+	commitments, err := ds.fetchCommitments(params.pairing, keyID, version, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyShare(params.pairing, params.generator, commitments, ds.config.NodeID, element) {
+		return nil, fmt.Errorf("share %d of %s version %d is not consistent with the commitments", ds.config.NodeID, keyID, version)
+	}
+
+	return element, nil
+}
@@ -0,0 +1,48 @@
+package decrypt
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/group"
+)
+
+// MaxMessageSize is the largest message, in bytes, a partial signature is computed for. Large artifacts are signed by digest.
+const MaxMessageSize = 4096
+
+// signatureDomain separates the hash of signed messages from identities, so a signature is never an identity key
+const signatureDomain = "threshold-bls:"
+
+// hashMessage maps a message to H(m) in G1. It must match the hash the gateway uses to check partial signatures.
+func hashMessage(pairing group.Pairing, message string) group.Element {
+	return pairing.NewG1().SetFromStringHash(signatureDomain+message, sha256.New())
+}
+
+// PartialSign computes this node's BLS partial signature H(m)^{s_i} under the given key version, version 0 being the
+// latest, with the node's own share of it. Like a partial decryption it carries a Chaum-Pedersen proof against
+// the verification key g^{s_i}, so the gateway only combines partial signatures of honest shares.
+func (ds *decryptionService) PartialSign(keyID string, version int, message string) (Partial, error) {
+	if len(message) == 0 || len(message) > MaxMessageSize {
+		return Partial{}, fmt.Errorf("message must be between 1 and %d bytes", MaxMessageSize)
+	}
+	if keyID == "" {
+		keyID = ds.keyID
+	}
+
+	params, err := ds.keyParams(keyID)
+	if err != nil {
+		return Partial{}, err
+	}
+	shareElement, epoch, err := ds.share(keyID, version)
+	if err != nil {
+		return Partial{}, err
+	}
+
+	point := hashMessage(params.pairing, message)
+	part := params.pairing.NewG1().PowZn(point, shareElement)
+
+	verificationKey := params.pairing.NewG2().PowZn(params.generator, shareElement)
+	proof := proveEqualDiscreteLog(params.pairing, point, part, params.generator, verificationKey, shareElement)
+
+	ds.logger.Debug("partial signature computed", "key_id", keyID)
+	return Partial{Element: part, Proof: proof, ShareID: ds.config.NodeID, Epoch: epoch}, nil
+}
@@ -6,16 +6,18 @@ import (
 	"github.com/mdshahjahanmiah/explore-go/error"
 	"github.com/mdshahjahanmiah/explore-go/http"
 	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/config"
 )
 
-func MakeHandler(logger *logging.Logger, service Service) http.Endpoint {
+func MakeHandler(config config.Config, logger *logging.Logger, service Service) http.Endpoint {
 	opts := []kithttp.ServerOption{
+		kithttp.ServerBefore(kithttp.PopulateRequestContext),
 		kithttp.ServerErrorEncoder(error.EncodeError),
 	}
 
-	handleGetCiphertext := kithttp.NewServer(
-		getCiphertextEndpoint(logger, service),
-		kithttp.NopRequestDecoder,
+	handleEncrypt := kithttp.NewServer(
+		getEncryptEndpoint(logger, service),
+		decodeEncryptRequest,
 		kithttp.EncodeJSONResponse,
 		opts...,
 	)
@@ -27,9 +29,33 @@ func MakeHandler(logger *logging.Logger, service Service) http.Endpoint {
 		opts...,
 	)
 
+	handleIdentityEncrypt := kithttp.NewServer(
+		getIdentityEncryptEndpoint(logger, service),
+		decodeIdentityEncryptRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handlePartialIdentityKey := kithttp.NewServer(
+		getPartialIdentityKeyEndpoint(logger, service, config.GatewayToken),
+		decodePartialIdentityKeyRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
+	handlePartialSign := kithttp.NewServer(
+		getPartialSignEndpoint(logger, service, config.GatewayToken),
+		decodePartialSignRequest,
+		kithttp.EncodeJSONResponse,
+		opts...,
+	)
+
 	r := chi.NewRouter()
-	r.Method("GET", "/ciphertext", handleGetCiphertext)
+	r.Method("POST", "/encrypt", handleEncrypt)
 	r.Method("POST", "/partial-decrypt", handlePartialDecryption)
+	r.Method("POST", "/encrypt-identity", handleIdentityEncrypt)
+	r.Method("POST", "/partial-identity-key", handlePartialIdentityKey)
+	r.Method("POST", "/partial-sign", handlePartialSign)
 
 	return http.Endpoint{Pattern: "/*", Handler: r}
 }
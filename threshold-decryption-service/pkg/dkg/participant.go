@@ -0,0 +1,660 @@
+package dkg
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mdshahjahanmiah/explore-go/logging"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/client"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/config"
+	"github.com/mdshahjahanmiah/threshold-decryption-service/pkg/group"
+	"time"
+)
+
+// Phases of the distributed key generation session, as reported by the KMS
+const (
+	PhaseRegistering    = "registering"
+	PhaseDealing        = "dealing"
+	PhaseComplaining    = "complaining"
+	PhaseAnswering      = "answering"
+	PhaseRevealing      = "revealing"
+	PhaseVerifying      = "verifying"
+	PhaseReconstructing = "reconstructing"
+	PhaseCompleted      = "completed"
+	PhaseFailed         = "failed"
+)
+
+// Kinds of session, a keygen creates the key, a refresh re-randomizes the shares of the existing key
+// and a reshare hands the existing key to a new committee
+const (
+	KindKeygen  = "keygen"
+	KindRefresh = "refresh"
+	KindReshare = "reshare"
+)
+
+var phaseOrder = map[string]int{
+	PhaseRegistering:    0,
+	PhaseDealing:        1,
+	PhaseComplaining:    2,
+	PhaseAnswering:      3,
+	PhaseRevealing:      4,
+	PhaseVerifying:      5,
+	PhaseReconstructing: 6,
+	PhaseCompleted:      7,
+}
+
+// pedersenBaseDomain separates the hash used to derive the second Pedersen base from any other use of the generator
+const pedersenBaseDomain = "threshold-decryption/dkg/pedersen-base"
+
+// Participant runs one node's side of the GJKR distributed key generation.
+// Every node deals a random polynomial of its own, the node's final share is the sum of the
+// values it received from the qualified dealers and the private key is never assembled anywhere.
+type Participant struct {
+	config    config.Config
+	logger    *logging.Logger
+	pairing   group.Pairing
+	generator group.Element
+	base      group.Element
+}
+
+// NewParticipant creates the DKG participant for this node
+func NewParticipant(config config.Config, pairing group.Pairing, logger *logging.Logger) *Participant {
+	return &Participant{
+		config:  config,
+		logger:  logger,
+		pairing: pairing,
+	}
+}
+
+// Join waits for a session this node can take its first share from: the initial key generation,
+// or a reshare that adds the node to the committee. It returns the share and the epoch it belongs to.
+func (p *Participant) Join() (group.Element, int, error) {
+	for {
+		state, err := client.FetchDkgState(p.config.KmsHttpAddress)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if state.Kind == KindKeygen && state.Epoch == 0 {
+			share, err := p.Run()
+			return share, 0, err
+		}
+		if state.Kind == KindReshare && state.Phase == PhaseRegistering &&
+			p.config.NodeID > state.PreviousTotalShares && p.config.NodeID <= state.TotalShares {
+			share, err := p.Reshare(nil, state.Epoch)
+			return share, state.Epoch, err
+		}
+
+		p.logger.Debug("waiting for a dkg session to join", "kind", state.Kind, "epoch", state.Epoch, "phase", state.Phase)
+		time.Sleep(p.config.DkgPollInterval)
+	}
+}
+
+// Run takes part in every round of the key generation and returns this node's share of the joint private key
+func (p *Participant) Run() (group.Element, error) {
+	return p.run(KindKeygen, 0, nil)
+}
+
+// Refresh takes part in the refresh session of the given epoch and returns the refreshed share.
+// Every dealer shares zero, so adding what the node receives moves its share to a new polynomial
+// with the same constant term: the public key stays, and the old share no longer combines with the new ones.
+func (p *Participant) Refresh(share group.Element, epoch int) (group.Element, error) {
+	delta, err := p.run(KindRefresh, epoch, p.pairing.NewZr().Set0())
+	if err != nil {
+		return nil, err
+	}
+	return p.pairing.NewZr().Add(share, delta), nil
+}
+
+// Reshare takes part in the reshare session of the given epoch. A member of the old committee deals a sharing
+// of its share, a member of the new committee gets its new share back. A node joining the committee has no
+// share to deal, and a node leaving it gets nil back.
+func (p *Participant) Reshare(share group.Element, epoch int) (group.Element, error) {
+	return p.run(KindReshare, epoch, share)
+}
+
+// run takes part in every round of one session. Dealers share the given secret, or a random one in a keygen,
+// receivers get back the combination of the values received from the qualified dealers.
+func (p *Participant) run(kind string, epoch int, secret group.Element) (group.Element, error) {
+	nodeID := p.config.NodeID
+
+	state, err := p.waitForPhase(kind, epoch, PhaseRegistering)
+	if err != nil {
+		return nil, err
+	}
+	if nodeID < 1 || nodeID > participants(state) {
+		return nil, fmt.Errorf("node id %d is outside 1..%d", nodeID, participants(state))
+	}
+	if err := p.setGenerator(state.Generator); err != nil {
+		return nil, err
+	}
+
+	isDealer := nodeID <= dealers(state)
+	isReceiver := nodeID <= state.TotalShares
+	if isDealer && kind == KindReshare && secret == nil {
+		return nil, fmt.Errorf("node %d belongs to the old committee but holds no share to reshare", nodeID)
+	}
+
+	// Round 1: publish a transport key so dealers can encrypt our shares through the coordinator
+	transportSecret := p.pairing.NewZr().Rand()
+	transportKey := p.pairing.NewG2().PowZn(p.generator, transportSecret)
+	if err := client.RegisterDkgNode(p.config.KmsHttpAddress, nodeID, encode(transportKey), p.config.NodeToken); err != nil {
+		return nil, err
+	}
+	p.logger.Info("registered for distributed key generation", "node_id", nodeID, "kind", kind, "epoch", epoch)
+
+	// Round 2: deal a secret polynomial f and a blinding polynomial f' to every receiver.
+	// A refresh deals f(0) = f'(0) = 0, a reshare deals f(0) = the dealer's share.
+	state, err = p.waitForPhase(kind, epoch, PhaseDealing)
+	if err != nil {
+		return nil, err
+	}
+	secretPolynomial := randomPolynomial(p.pairing, state.Threshold)
+	blindingPolynomial := randomPolynomial(p.pairing, state.Threshold)
+	if secret != nil {
+		secretPolynomial[0].Set(secret)
+	}
+	if kind == KindRefresh {
+		blindingPolynomial[0].Set0()
+	}
+
+	if isDealer {
+		deal, err := p.deal(state, secretPolynomial, blindingPolynomial)
+		if err != nil {
+			return nil, err
+		}
+		if err := client.SubmitDkgDeal(p.config.KmsHttpAddress, nodeID, deal, p.config.NodeToken); err != nil {
+			return nil, err
+		}
+	}
+
+	// Round 3: check what every dealer sent us against its Pedersen commitments and complain about the rest
+	state, err = p.waitForPhase(kind, epoch, PhaseComplaining)
+	if err != nil {
+		return nil, err
+	}
+	received := make(map[int]sharePair, len(state.Deals))
+	if isReceiver {
+		accused := make([]int, 0)
+		for dealer := 1; dealer <= dealers(state); dealer++ {
+			pair, err := p.receiveShare(state, state.Deals[dealer], transportSecret)
+			if err != nil {
+				p.logger.Warn("rejecting dealer", "dealer", dealer, "err", err)
+				accused = append(accused, dealer)
+				continue
+			}
+			received[dealer] = pair
+		}
+		if err := client.SubmitDkgComplaints(p.config.KmsHttpAddress, nodeID, accused, p.config.NodeToken); err != nil {
+			return nil, err
+		}
+	}
+
+	// Round 4: an accused dealer answers every complaint by publishing the disputed share pair in the clear,
+	// a dealer that does not is disqualified. The round is skipped when nobody complains.
+	state, err = p.waitForPhase(kind, epoch, PhaseAnswering)
+	if err != nil {
+		return nil, err
+	}
+	if complainers := complainers(state, nodeID); state.Phase == PhaseAnswering && isDealer && len(complainers) > 0 && contains(state.Qualified, nodeID) {
+		answers := make(map[int]client.DkgSharePair, len(complainers))
+		for _, receiver := range complainers {
+			index := p.pairing.NewZr().SetInt32(int32(receiver))
+			answers[receiver] = sharePair{
+				share:    evaluatePolynomial(p.pairing, secretPolynomial, index),
+				blinding: evaluatePolynomial(p.pairing, blindingPolynomial, index),
+			}.encode()
+		}
+		if err := client.SubmitDkgAnswers(p.config.KmsHttpAddress, nodeID, answers, p.config.NodeToken); err != nil {
+			return nil, err
+		}
+	}
+
+	// Round 5: the qualified set is fixed, qualified dealers reveal the Feldman commitments g^{a_k} to their secret
+	// polynomial. A receiver takes the published answer of a dealer it complained about, once it checks out.
+	state, err = p.waitForPhase(kind, epoch, PhaseRevealing)
+	if err != nil {
+		return nil, err
+	}
+	if isReceiver {
+		for _, dealer := range state.Qualified {
+			if _, ok := received[dealer]; ok {
+				continue
+			}
+			answer, ok := state.Answers[dealer][nodeID]
+			if !ok {
+				return nil, fmt.Errorf("qualified dealer %d never answered the complaint of this node", dealer)
+			}
+			pair, err := p.checkAnswer(state, state.Deals[dealer].Commitments, answer)
+			if err != nil {
+				return nil, fmt.Errorf("answer of dealer %d: %w", dealer, err)
+			}
+			received[dealer] = pair
+		}
+	}
+	if isDealer && contains(state.Qualified, nodeID) {
+		reveal := make([]string, 0, len(secretPolynomial))
+		for k := firstCommitted(kind); k < len(secretPolynomial); k++ {
+			reveal = append(reveal, encode(p.pairing.NewG2().PowZn(p.generator, secretPolynomial[k])))
+		}
+		if err := client.SubmitDkgReveal(p.config.KmsHttpAddress, nodeID, reveal, p.config.NodeToken); err != nil {
+			return nil, err
+		}
+	}
+
+	// Round 6: every receiver checks its shares against the reveals and accuses the dealers whose reveal does not
+	// match, with the share pair as evidence. Nothing is published until every receiver has checked.
+	state, err = p.waitForPhase(kind, epoch, PhaseVerifying)
+	if err != nil {
+		return nil, err
+	}
+	if isReceiver && state.Phase == PhaseVerifying {
+		accusations := make(map[int]client.DkgSharePair)
+		for _, dealer := range state.Qualified {
+			if err := p.checkReveal(state, state.Reveals[dealer], received[dealer].share); err != nil {
+				p.logger.Warn("accusing dealer", "dealer", dealer, "err", err)
+				accusations[dealer] = received[dealer].encode()
+			}
+		}
+		if err := client.SubmitDkgVerification(p.config.KmsHttpAddress, nodeID, accusations, p.config.NodeToken); err != nil {
+			return nil, err
+		}
+	}
+
+	// Round 7: a qualified dealer caught cheating is not dropped, which would let it pick the key by quitting, but
+	// reconstructed: every receiver discloses its share of that dealer and the KMS rebuilds the dealer's reveal.
+	state, err = p.waitForPhase(kind, epoch, PhaseReconstructing)
+	if err != nil {
+		return nil, err
+	}
+	if isReceiver && state.Phase == PhaseReconstructing {
+		disclosures := make(map[int]client.DkgSharePair, len(state.Reconstructed))
+		for _, dealer := range state.Reconstructed {
+			disclosures[dealer] = received[dealer].encode()
+		}
+		if err := client.SubmitDkgDisclosures(p.config.KmsHttpAddress, nodeID, disclosures, p.config.NodeToken); err != nil {
+			return nil, err
+		}
+	}
+
+	// Round 8: our share combines the shares from the qualified dealers, each checked against its final reveal.
+	// It is their sum, or in a reshare their Lagrange combination so that it lies on sum_i l_i f_i.
+	state, err = p.waitForPhase(kind, epoch, PhaseCompleted)
+	if err != nil {
+		return nil, err
+	}
+	if !isReceiver {
+		p.logger.Info("node left the committee", "node_id", nodeID, "epoch", epoch)
+		return nil, nil
+	}
+
+	var weights map[int]group.Element
+	if kind == KindReshare {
+		weights = lagrangeAtZero(p.pairing, state.Qualified)
+	}
+
+	share := p.pairing.NewZr().Set0()
+	for _, dealer := range state.Qualified {
+		pair, ok := received[dealer]
+		if !ok {
+			return nil, fmt.Errorf("no valid share received from qualified dealer %d", dealer)
+		}
+		if err := p.checkReveal(state, state.Reveals[dealer], pair.share); err != nil {
+			return nil, fmt.Errorf("share from dealer %d: %w", dealer, err)
+		}
+
+		value := pair.share
+		if weights != nil {
+			value = p.pairing.NewZr().Mul(weights[dealer], value)
+		}
+		share.ThenAdd(value)
+	}
+
+	p.logger.Info("distributed key generation completed", "node_id", nodeID, "kind", kind, "epoch", epoch, "qualified", state.Qualified)
+	return share, nil
+}
+
+// deal commits to both polynomials with C_k = g^{a_k} h^{b_k} and encrypts (f(j), f'(j)) to every registered node j
+func (p *Participant) deal(state client.DkgState, secretPolynomial, blindingPolynomial []group.Element) (client.DkgDeal, error) {
+	commitments := make([]string, 0, len(secretPolynomial))
+	for k := firstCommitted(state.Kind); k < len(secretPolynomial); k++ {
+		commitment := p.pairing.NewG2().PowZn(p.generator, secretPolynomial[k])
+		commitment.ThenMul(p.pairing.NewG2().PowZn(p.base, blindingPolynomial[k]))
+		commitments = append(commitments, encode(commitment))
+	}
+
+	shares := make([]client.DkgEncryptedShare, 0, state.TotalShares)
+	for recipient := 1; recipient <= state.TotalShares; recipient++ {
+		transportKey, err := p.decodeG2(state.TransportKeys[recipient])
+		if err != nil {
+			return client.DkgDeal{}, fmt.Errorf("decoding transport key of node %d: %w", recipient, err)
+		}
+
+		index := p.pairing.NewZr().SetInt32(int32(recipient))
+		plaintext := append(evaluatePolynomial(p.pairing, secretPolynomial, index).Bytes(),
+			evaluatePolynomial(p.pairing, blindingPolynomial, index).Bytes()...)
+
+		// Hashed ElGamal: R = g^r, the keystream comes from E_j^r = R^{x_j}
+		ephemeralSecret := p.pairing.NewZr().Rand()
+		ephemeral := p.pairing.NewG2().PowZn(p.generator, ephemeralSecret)
+		sharedKey := p.pairing.NewG2().PowZn(transportKey, ephemeralSecret)
+
+		shares = append(shares, client.DkgEncryptedShare{
+			Recipient:  recipient,
+			Ephemeral:  encode(ephemeral),
+			Ciphertext: base64.StdEncoding.EncodeToString(xorBytes(plaintext, keystream(sharedKey, len(plaintext)))),
+		})
+	}
+
+	return client.DkgDeal{Commitments: commitments, Shares: shares}, nil
+}
+
+// sharePair is a dealer's share f(j) and blinding value f'(j) for this node
+type sharePair struct {
+	share    group.Element
+	blinding group.Element
+}
+
+func (pair sharePair) encode() client.DkgSharePair {
+	return client.DkgSharePair{
+		Share:    base64.StdEncoding.EncodeToString(pair.share.Bytes()),
+		Blinding: base64.StdEncoding.EncodeToString(pair.blinding.Bytes()),
+	}
+}
+
+// receiveShare decrypts the share pair a dealer sent to this node and checks it against the dealer's commitments
+func (p *Participant) receiveShare(state client.DkgState, deal client.DkgDeal, transportSecret group.Element) (sharePair, error) {
+	var encrypted *client.DkgEncryptedShare
+	for i := range deal.Shares {
+		if deal.Shares[i].Recipient == p.config.NodeID {
+			encrypted = &deal.Shares[i]
+			break
+		}
+	}
+	if encrypted == nil {
+		return sharePair{}, errors.New("no share addressed to this node")
+	}
+
+	ephemeral, err := p.decodeG2(encrypted.Ephemeral)
+	if err != nil {
+		return sharePair{}, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted.Ciphertext)
+	if err != nil {
+		return sharePair{}, err
+	}
+
+	scalarLength := int(p.pairing.ZrLength())
+	if len(ciphertext) != 2*scalarLength {
+		return sharePair{}, fmt.Errorf("expected %d bytes of encrypted share, got %d", 2*scalarLength, len(ciphertext))
+	}
+
+	sharedKey := p.pairing.NewG2().PowZn(ephemeral, transportSecret)
+	plaintext := xorBytes(ciphertext, keystream(sharedKey, len(ciphertext)))
+	pair := sharePair{
+		share:    p.pairing.NewZr().SetBytes(plaintext[:scalarLength]),
+		blinding: p.pairing.NewZr().SetBytes(plaintext[scalarLength:]),
+	}
+	if err := p.checkPair(state, deal.Commitments, pair); err != nil {
+		return sharePair{}, err
+	}
+	return pair, nil
+}
+
+// checkAnswer decodes the share pair a dealer published in answer to this node's complaint and checks it
+func (p *Participant) checkAnswer(state client.DkgState, commitments []string, answer client.DkgSharePair) (sharePair, error) {
+	share, err := p.decodeZr(answer.Share)
+	if err != nil {
+		return sharePair{}, err
+	}
+	blinding, err := p.decodeZr(answer.Blinding)
+	if err != nil {
+		return sharePair{}, err
+	}
+	pair := sharePair{share: share, blinding: blinding}
+	if err := p.checkPair(state, commitments, pair); err != nil {
+		return sharePair{}, err
+	}
+	return pair, nil
+}
+
+// checkPair checks g^{s} h^{s'} = prod_k C_k^{j^k} against the dealer's Pedersen commitments
+func (p *Participant) checkPair(state client.DkgState, encoded []string, pair sharePair) error {
+	commitments, err := p.decodeCommitments(state, encoded)
+	if err != nil {
+		return err
+	}
+
+	expected := evaluateCommitments(p.pairing, commitments, p.config.NodeID)
+	actual := p.pairing.NewG2().PowZn(p.generator, pair.share)
+	actual.ThenMul(p.pairing.NewG2().PowZn(p.base, pair.blinding))
+	if !actual.Equals(expected) {
+		return errors.New("share does not match the dealer's commitments")
+	}
+	return nil
+}
+
+// checkReveal checks g^{s} = prod_k A_k^{j^k} against the dealer's Feldman commitments
+func (p *Participant) checkReveal(state client.DkgState, encoded []string, share group.Element) error {
+	commitments, err := p.decodeCommitments(state, encoded)
+	if err != nil {
+		return fmt.Errorf("decoding reveal: %w", err)
+	}
+	if !p.pairing.NewG2().PowZn(p.generator, share).Equals(evaluateCommitments(p.pairing, commitments, p.config.NodeID)) {
+		return errors.New("share does not match the revealed commitments")
+	}
+	return nil
+}
+
+// waitForPhase polls the KMS until the session of the given kind and epoch reaches the given phase or fails
+func (p *Participant) waitForPhase(kind string, epoch int, phase string) (client.DkgState, error) {
+	for {
+		state, err := client.FetchDkgState(p.config.KmsHttpAddress)
+		if err != nil {
+			return client.DkgState{}, err
+		}
+		if state.Epoch > epoch {
+			return client.DkgState{}, fmt.Errorf("%s session of epoch %d was superseded by epoch %d", kind, epoch, state.Epoch)
+		}
+		if state.Kind == kind && state.Epoch == epoch {
+			if state.Phase == PhaseFailed {
+				return client.DkgState{}, fmt.Errorf("distributed %s failed: %s", kind, state.Reason)
+			}
+			if phaseOrder[state.Phase] >= phaseOrder[phase] {
+				return state, nil
+			}
+		}
+
+		p.logger.Debug("waiting for dkg phase", "kind", kind, "epoch", epoch, "phase", phase, "current", state.Phase)
+		time.Sleep(p.config.DkgPollInterval)
+	}
+}
+
+// setGenerator adopts the generator published by the KMS and derives the second Pedersen base h from it.
+// h is obtained by hashing, so nobody knows log_g(h) and the commitments stay binding.
+func (p *Participant) setGenerator(encoded string) error {
+	generator, err := p.decodeG2(encoded)
+	if err != nil {
+		return fmt.Errorf("decoding generator: %w", err)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(pedersenBaseDomain))
+	hash.Write(generator.Bytes())
+
+	p.generator = generator
+	p.base = p.pairing.NewG2().SetFromHash(hash.Sum(nil))
+	return nil
+}
+
+// decodeCommitments decodes one dealer's commitments for the session.
+// Refresh dealers leave out the constant term, it is the identity and is put back in front here.
+func (p *Participant) decodeCommitments(state client.DkgState, encoded []string) ([]group.Element, error) {
+	commitments := make([]group.Element, 0, state.Threshold)
+	if state.Kind == KindRefresh {
+		commitments = append(commitments, p.pairing.NewG2().Set1())
+	}
+
+	if len(commitments)+len(encoded) != state.Threshold {
+		return nil, fmt.Errorf("expected %d commitments, got %d", state.Threshold-len(commitments), len(encoded))
+	}
+	for k, value := range encoded {
+		commitment, err := p.decodeG2(value)
+		if err != nil {
+			return nil, fmt.Errorf("decoding commitment %d: %w", k, err)
+		}
+		commitments = append(commitments, commitment)
+	}
+	return commitments, nil
+}
+
+// firstCommitted is the index of the first coefficient a dealer commits to, refresh polynomials have no constant term
+func firstCommitted(kind string) int {
+	if kind == KindRefresh {
+		return 1
+	}
+	return 0
+}
+
+func (p *Participant) decodeZr(encoded string) (group.Element, error) {
+	scalarBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(scalarBytes) != int(p.pairing.ZrLength()) {
+		return nil, fmt.Errorf("expected %d bytes, got %d", p.pairing.ZrLength(), len(scalarBytes))
+	}
+	return p.pairing.NewZr().SetBytes(scalarBytes), nil
+}
+
+func (p *Participant) decodeG2(encoded string) (group.Element, error) {
+	elementBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(elementBytes) != int(p.pairing.G2Length()) {
+		return nil, fmt.Errorf("expected %d bytes, got %d", p.pairing.G2Length(), len(elementBytes))
+	}
+
+	element := p.pairing.NewG2().SetBytes(elementBytes)
+	if element.Is0() {
+		return nil, errors.New("G2 element is zero after SetBytes")
+	}
+	return element, nil
+}
+
+// dealers is the number of nodes dealing in the session, the old committee in a reshare
+func dealers(state client.DkgState) int {
+	if state.Kind == KindReshare {
+		return state.PreviousTotalShares
+	}
+	return state.TotalShares
+}
+
+// participants is the number of nodes taking part in the session as dealer, receiver or both
+func participants(state client.DkgState) int {
+	if dealers(state) > state.TotalShares {
+		return dealers(state)
+	}
+	return state.TotalShares
+}
+
+// complainers returns the receivers that complained about the dealer
+func complainers(state client.DkgState, dealer int) []int {
+	complainers := make([]int, 0)
+	for receiver, accused := range state.Complaints {
+		if contains(accused, dealer) {
+			complainers = append(complainers, receiver)
+		}
+	}
+	return complainers
+}
+
+// lagrangeAtZero returns the weights l_i = prod_{j != i} j / (j - i) that interpolate f(0) from the values f(i)
+func lagrangeAtZero(pairing group.Pairing, ids []int) map[int]group.Element {
+	weights := make(map[int]group.Element, len(ids))
+	for _, i := range ids {
+		numerator := pairing.NewZr().Set1()
+		denominator := pairing.NewZr().Set1()
+		for _, j := range ids {
+			if i == j {
+				continue
+			}
+			numerator.ThenMul(pairing.NewZr().SetInt32(int32(j)))
+			denominator.ThenMul(pairing.NewZr().SetInt32(int32(j - i)))
+		}
+		weights[i] = numerator.ThenDiv(denominator)
+	}
+	return weights
+}
+
+// randomPolynomial returns threshold random coefficients a_0..a_{t-1} over Zr
+func randomPolynomial(pairing group.Pairing, threshold int) []group.Element {
+	coefficients := make([]group.Element, threshold)
+	for k := range coefficients {
+		coefficients[k] = pairing.NewZr().Rand()
+	}
+	return coefficients
+}
+
+// evaluatePolynomial evaluates the polynomial at x with Horner's rule
+func evaluatePolynomial(pairing group.Pairing, coefficients []group.Element, x group.Element) group.Element {
+	result := pairing.NewZr().Set0()
+	for k := len(coefficients) - 1; k >= 0; k-- {
+		result.ThenMul(x)
+		result.ThenAdd(coefficients[k])
+	}
+	return result
+}
+
+// evaluateCommitments computes prod_k C_k^{x^k}
+func evaluateCommitments(pairing group.Pairing, commitments []group.Element, x int) group.Element {
+	result := pairing.NewG2().Set1()
+	index := pairing.NewZr().SetInt32(int32(x))
+	power := pairing.NewZr().Set1()
+	for _, commitment := range commitments {
+		result.ThenMul(pairing.NewG2().PowZn(commitment, power))
+		power.ThenMul(index)
+	}
+	return result
+}
+
+// keystream expands a G2 element into size bytes of SHA-256(counter || key) blocks
+func keystream(sharedKey group.Element, size int) []byte {
+	keyBytes := sharedKey.Bytes()
+	stream := make([]byte, 0, size+sha256.Size)
+
+	var counter [4]byte
+	for i := uint32(0); len(stream) < size; i++ {
+		binary.BigEndian.PutUint32(counter[:], i)
+		hash := sha256.New()
+		hash.Write(counter[:])
+		hash.Write(keyBytes)
+		stream = hash.Sum(stream)
+	}
+
+	return stream[:size]
+}
+
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+func contains(ids []int, id int) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func encode(element group.Element) string {
+	return base64.StdEncoding.EncodeToString(element.Bytes())
+}
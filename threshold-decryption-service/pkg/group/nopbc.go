@@ -0,0 +1,9 @@
+//go:build !cgo
+
+package group
+
+// Without cgo only the pure-Go backend is available, PBC pairings are refused
+
+func newPBCPairing(params string) (Pairing, error) {
+	return nil, ErrPBCUnavailable
+}
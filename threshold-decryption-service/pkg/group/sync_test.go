@@ -0,0 +1,50 @@
+package group
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// modules hold the copies of this package, the services build in separate contexts so each keeps its own
+var modules = []string{"key-management-service", "threshold-decryption-service", "gateway-service"}
+
+// sharedFiles must stay identical in every copy. The key management service adds the parameter generation on top.
+var sharedFiles = []string{
+	"bls12381.go",
+	"group.go",
+	"nopbc.go",
+	"pbc.go",
+	"group_test.go",
+	"nopbc_test.go",
+	"pbc_test.go",
+	"sync_test.go",
+}
+
+// TestCopiesIdentical compares this copy with the copies of the other modules checked out next to it
+func TestCopiesIdentical(t *testing.T) {
+	for _, module := range modules {
+		dir := filepath.Join("..", "..", "..", module, "pkg", "group")
+		if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+			t.Logf("%s is not checked out", module)
+			continue
+		}
+		for _, name := range sharedFiles {
+			ours, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatalf("read %s: %v", name, err)
+			}
+			theirs, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Errorf("%s: %v", module, err)
+				continue
+			}
+			if !bytes.Equal(ours, theirs) {
+				t.Errorf("%s differs from the copy of %s", name, module)
+			}
+		}
+	}
+}